@@ -0,0 +1,235 @@
+package audit
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	EventCodeIssued          = "code_issued"
+	EventTokenExchanged      = "token_exchanged"
+	EventTokenRefreshed      = "token_refreshed"
+	EventTokenRevoked        = "token_revoked"
+	EventClientCreated       = "client_created"
+	EventClientSuspended     = "client_suspended"
+	EventClientSecretRotated = "client_secret_rotated"
+	EventAdminKeyUsed        = "admin_key_used"
+
+	EventClientTokenPolicyUpdated  = "client_token_policy_updated"
+	EventClientRateLimitUpdated    = "client_rate_limit_updated"
+	EventClientRedirectURIsUpdated = "client_redirect_uris_updated"
+
+	// The prev_hash of the first event in the chain
+	GenesisHash = "0000000000000000000000000000000000000000000000000000000000000000"
+)
+
+type Event struct {
+	// Empty is store.DefaultTenantID
+	TenantID string
+	Type     string
+	// The admin key ID for admin actions, otherwise the user or client that caused the event
+	Actor     string
+	ClientID  *string
+	UserID    *string
+	IP        string
+	RequestID string
+	Details   map[string]string
+	// When it happened, default when it's appended
+	Time time.Time
+}
+
+// Record appends the event to the end of its tenant's chain, for callers that can wait on it like the CLI. The server
+// uses a Recorder. isPostgres is whether pool is Postgres rather than CRDB.
+func Record(ctx context.Context, pool *pgxpool.Pool, isPostgres bool, event Event) error {
+	return appendEvents(ctx, pool, isPostgres, utils.IfElse(event.TenantID == "", store.DefaultTenantID, event.TenantID), []Event{event})
+}
+
+// appendEvents appends the tenant's events in order in one transaction. The chain head is read and written in a
+// serializable transaction, so concurrent appends retry rather than fork.
+func appendEvents(ctx context.Context, pool *pgxpool.Pool, isPostgres bool, tenantID string, events []Event) error {
+	details := make([][]byte, len(events))
+	for i, event := range events {
+		details[i] = []byte("{}")
+		if event.Details != nil {
+			var err error
+			details[i], err = json.Marshal(event.Details)
+			if err != nil {
+				return fmt.Errorf("error in json.Marshal: %w", err)
+			}
+		}
+	}
+
+	return query.ReliableExecInTx(ctx, pool, time.Second*10, func(ctx context.Context, q *query.Queries) error {
+		if isPostgres {
+			err := q.SetIsolationLevel(ctx, query.Serializable)
+			if err != nil {
+				return fmt.Errorf("error in SetIsolationLevel: %w", err)
+			}
+		}
+
+		prevHash := GenesisHash
+		seq := int64(1)
+		latest, err := q.SelectLatestAuditEvent(ctx, tenantID)
+		if err != nil && !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("error in SelectLatestAuditEvent: %w", err)
+		}
+		if err == nil {
+			prevHash = latest.Hash
+			seq = latest.Seq + 1
+		}
+
+		for i, event := range events {
+			row := query.AuditEvent{
+				TenantID:  tenantID,
+				Seq:       seq,
+				EventType: event.Type,
+				Actor:     event.Actor,
+				ClientID:  event.ClientID,
+				UserID:    event.UserID,
+				Ip:        event.IP,
+				RequestID: event.RequestID,
+				Details:   details[i],
+				PrevHash:  prevHash,
+				// DB only keeps microseconds
+				Created: utils.IfElse(event.Time.IsZero(), time.Now(), event.Time).UTC().Truncate(time.Microsecond),
+			}
+			row.Hash, err = Hash(row)
+			if err != nil {
+				return fmt.Errorf("error in Hash: %w", err)
+			}
+
+			err = q.InsertAuditEvent(ctx, query.InsertAuditEventParams{
+				TenantID:  row.TenantID,
+				Seq:       row.Seq,
+				EventType: row.EventType,
+				Actor:     row.Actor,
+				ClientID:  row.ClientID,
+				UserID:    row.UserID,
+				Ip:        row.Ip,
+				RequestID: row.RequestID,
+				Details:   row.Details,
+				PrevHash:  row.PrevHash,
+				Hash:      row.Hash,
+				Created:   row.Created,
+			})
+			if err != nil {
+				return fmt.Errorf("error in InsertAuditEvent: %w", err)
+			}
+			prevHash = row.Hash
+			seq++
+		}
+		return nil
+	})
+}
+
+type hashInput struct {
+	// Left out for the default tenant, so events from before tenants existed still verify
+	TenantID  string `json:",omitempty"`
+	Seq       int64
+	EventType string
+	Actor     string
+	ClientID  *string
+	UserID    *string
+	IP        string
+	RequestID string
+	Details   map[string]string
+	PrevHash  string
+	Created   string
+}
+
+// Hash computes the hash of a row, covering the previous row's hash.
+// Details are decoded and re-encoded since jsonb does not preserve the original bytes.
+func Hash(row query.AuditEvent) (string, error) {
+	var details map[string]string
+	if err := json.Unmarshal(row.Details, &details); err != nil {
+		return "", fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	b, err := json.Marshal(hashInput{
+		TenantID:  utils.IfElse(row.TenantID == store.DefaultTenantID, "", row.TenantID),
+		Seq:       row.Seq,
+		EventType: row.EventType,
+		Actor:     row.Actor,
+		ClientID:  row.ClientID,
+		UserID:    row.UserID,
+		IP:        row.Ip,
+		RequestID: row.RequestID,
+		Details:   details,
+		PrevHash:  row.PrevHash,
+		Created:   row.Created.UTC().Format(time.RFC3339Nano),
+	})
+	if err != nil {
+		return "", fmt.Errorf("error in json.Marshal: %w", err)
+	}
+	h := sha256.Sum256(b)
+	return hex.EncodeToString(h[:]), nil
+}
+
+type VerifyResult struct {
+	Checked int64
+	Valid   bool
+	// The first seq that was modified, missing, or out of order
+	BrokenAtSeq *int64
+	Reason      string `json:",omitempty"`
+}
+
+// Verify walks the tenant's whole chain from the start
+func Verify(ctx context.Context, pool *pgxpool.Pool, tenantID string) (VerifyResult, error) {
+	res := VerifyResult{Valid: true}
+	prevHash := GenesisHash
+	prevSeq := int64(0)
+	for {
+		var events []query.AuditEvent
+		err := query.ReliableExec(ctx, pool, time.Second*30, func(ctx context.Context, q *query.Queries) (err error) {
+			events, err = q.ListAuditEventsAfterSeq(ctx, query.ListAuditEventsAfterSeqParams{
+				TenantID: tenantID,
+				Seq:      prevSeq,
+				RowLimit: 1000,
+			})
+			if err != nil {
+				return fmt.Errorf("error in ListAuditEventsAfterSeq: %w", err)
+			}
+			return nil
+		})
+		if err != nil {
+			return res, err
+		}
+		if len(events) == 0 {
+			return res, nil
+		}
+
+		for _, event := range events {
+			brokenReason := ""
+			hash, err := Hash(event)
+			switch {
+			case event.Seq != prevSeq+1:
+				brokenReason = fmt.Sprintf("expected seq %d", prevSeq+1)
+			case event.PrevHash != prevHash:
+				brokenReason = "prev_hash does not match previous event"
+			case err != nil:
+				brokenReason = err.Error()
+			case hash != event.Hash:
+				brokenReason = "hash does not match contents"
+			}
+			if brokenReason != "" {
+				res.Valid = false
+				res.BrokenAtSeq = utils.Ptr(event.Seq)
+				res.Reason = brokenReason
+				return res, nil
+			}
+			res.Checked++
+			prevHash = event.Hash
+			prevSeq = event.Seq
+		}
+	}
+}
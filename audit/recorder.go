@@ -0,0 +1,185 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// Events waiting to be appended. Once it's full Record waits for room, up to recordTimeout.
+	recorderBufferSize = 10000
+	recorderBatchSize  = 500
+	flushInterval      = time.Millisecond * 100
+	recordTimeout      = time.Second * 5
+	// Failed appends are retried with backoff up to this
+	maxRetryInterval = time.Second * 10
+
+	ErrRecorderFull = errors.New("audit buffer full")
+
+	logger = gologger.NewLogger()
+)
+
+// Recorder appends events in the background, a batch at a time, so requests don't wait on the chain head. Events are
+// appended after the action they record has committed. Failed appends are retried until they go through, and while
+// they fail the buffer fills up and Record starts failing, rather than dropping events. Events still buffered are
+// lost if the process dies.
+type Recorder struct {
+	append func(ctx context.Context, tenantID string, events []Event) error
+	events chan Event
+	stop   chan struct{}
+	done   chan struct{}
+	// Set by Shutdown before stop is closed
+	shutdownCtx context.Context
+}
+
+// StartRecorder appends recorded events until Shutdown is called. isPostgres is whether pool is Postgres rather than
+// CRDB.
+func StartRecorder(pool *pgxpool.Pool, isPostgres bool) *Recorder {
+	return startRecorder(func(ctx context.Context, tenantID string, events []Event) error {
+		return appendEvents(ctx, pool, isPostgres, tenantID, events)
+	})
+}
+
+func startRecorder(appendFn func(ctx context.Context, tenantID string, events []Event) error) *Recorder {
+	r := &Recorder{
+		append: appendFn,
+		events: make(chan Event, recorderBufferSize),
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go r.run()
+	return r
+}
+
+// Record queues the event without waiting for it to be appended. If the buffer is full it waits for room, and
+// returns ErrRecorderFull if there isn't any within recordTimeout, or ctx's error if it's done first.
+func (r *Recorder) Record(ctx context.Context, event Event) error {
+	if event.Time.IsZero() {
+		event.Time = time.Now()
+	}
+	select {
+	case r.events <- event:
+		return nil
+	default:
+	}
+
+	timer := time.NewTimer(recordTimeout)
+	defer timer.Stop()
+	select {
+	case r.events <- event:
+		return nil
+	case <-timer.C:
+		return ErrRecorderFull
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// Shutdown appends the events already recorded, retrying failed appends until ctx is done. Call it after the HTTP
+// server has shut down.
+func (r *Recorder) Shutdown(ctx context.Context) error {
+	r.shutdownCtx = ctx
+	close(r.stop)
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (r *Recorder) run() {
+	defer close(r.done)
+	ticker := time.NewTicker(flushInterval)
+	defer ticker.Stop()
+	var batch []Event
+	var failures int
+	var retryAt time.Time
+	for {
+		events := r.events
+		if len(batch) >= recorderBatchSize {
+			// Stop taking events until the batch is appended, so the buffer fills and Record waits
+			events = nil
+		}
+		select {
+		case event := <-events:
+			batch = append(batch, event)
+			if len(batch) < recorderBatchSize {
+				continue
+			}
+		case <-ticker.C:
+		case <-r.stop:
+			r.drain(batch)
+			return
+		}
+		if time.Now().Before(retryAt) {
+			continue
+		}
+		batch = r.flush(context.Background(), batch)
+		if len(batch) == 0 {
+			failures = 0
+			continue
+		}
+		failures++
+		retryAt = time.Now().Add(retryInterval(failures))
+	}
+}
+
+// drain appends the batch and everything buffered, retrying until the shutdown ctx is done
+func (r *Recorder) drain(batch []Event) {
+	for len(r.events) > 0 {
+		batch = append(batch, <-r.events)
+	}
+	for failures := 1; ; failures++ {
+		batch = r.flush(r.shutdownCtx, batch)
+		if len(batch) == 0 {
+			return
+		}
+		select {
+		case <-time.After(retryInterval(failures)):
+		case <-r.shutdownCtx.Done():
+			logger.Error().Int("events", len(batch)).Msg("shut down before the audit events could be appended, lost them")
+			return
+		}
+	}
+}
+
+func retryInterval(failures int) time.Duration {
+	if failures > 16 || flushInterval<<failures > maxRetryInterval {
+		return maxRetryInterval
+	}
+	return flushInterval << failures
+}
+
+// flush appends each tenant's events in one transaction, keeping their order. It returns the events of the tenants
+// that failed, in order, to retry.
+func (r *Recorder) flush(ctx context.Context, batch []Event) []Event {
+	if len(batch) == 0 {
+		return nil
+	}
+	var tenantIDs []string
+	byTenant := map[string][]Event{}
+	for _, event := range batch {
+		tenantID := utils.IfElse(event.TenantID == "", store.DefaultTenantID, event.TenantID)
+		if _, ok := byTenant[tenantID]; !ok {
+			tenantIDs = append(tenantIDs, tenantID)
+		}
+		byTenant[tenantID] = append(byTenant[tenantID], event)
+	}
+	var failed []Event
+	for _, tenantID := range tenantIDs {
+		ctx, cancel := context.WithTimeout(ctx, time.Second*30)
+		if err := r.append(ctx, tenantID, byTenant[tenantID]); err != nil {
+			logger.Error().Err(err).Str("tenantID", tenantID).Int("events", len(byTenant[tenantID])).Msg("error appending audit events, will retry")
+			failed = append(failed, byTenant[tenantID]...)
+		}
+		cancel()
+	}
+	return failed
+}
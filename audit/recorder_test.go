@@ -0,0 +1,129 @@
+package audit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeAppender fails while failing is set, and records what it appended otherwise
+type fakeAppender struct {
+	mu       sync.Mutex
+	failing  bool
+	attempts int
+	appended []string
+}
+
+func (f *fakeAppender) append(ctx context.Context, tenantID string, events []Event) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.attempts++
+	if f.failing {
+		return errors.New("database down")
+	}
+	for _, event := range events {
+		f.appended = append(f.appended, event.Type)
+	}
+	return nil
+}
+
+func (f *fakeAppender) set(failing bool) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.failing = failing
+}
+
+func (f *fakeAppender) state() (attempts int, appended []string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.attempts, append([]string(nil), f.appended...)
+}
+
+func setRecorderLimits(t *testing.T, bufferSize, batchSize int) {
+	oldBuffer, oldBatch, oldFlush, oldRecord, oldRetry := recorderBufferSize, recorderBatchSize, flushInterval, recordTimeout, maxRetryInterval
+	recorderBufferSize, recorderBatchSize = bufferSize, batchSize
+	flushInterval, recordTimeout, maxRetryInterval = time.Millisecond*5, time.Millisecond*50, time.Millisecond*20
+	t.Cleanup(func() {
+		recorderBufferSize, recorderBatchSize, flushInterval, recordTimeout, maxRetryInterval = oldBuffer, oldBatch, oldFlush, oldRecord, oldRetry
+	})
+}
+
+func TestRecorderRetriesFailedAppends(t *testing.T) {
+	setRecorderLimits(t, 100, 10)
+	appender := &fakeAppender{failing: true}
+	r := startRecorder(appender.append)
+	ctx := context.Background()
+
+	var want []string
+	for i := 0; i < 5; i++ {
+		want = append(want, fmt.Sprint("event", i))
+		require.NoError(t, r.Record(ctx, Event{Type: want[i]}))
+	}
+	require.Eventually(t, func() bool {
+		attempts, _ := appender.state()
+		return attempts >= 3
+	}, time.Second, time.Millisecond)
+	_, appended := appender.state()
+	require.Empty(t, appended)
+
+	appender.set(false)
+	require.Eventually(t, func() bool {
+		_, appended := appender.state()
+		return len(appended) == len(want)
+	}, time.Second, time.Millisecond)
+	_, appended = appender.state()
+	require.Equal(t, want, appended)
+
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, r.Shutdown(shutdownCtx))
+}
+
+func TestRecorderFullFailsInsteadOfDropping(t *testing.T) {
+	setRecorderLimits(t, 2, 2)
+	appender := &fakeAppender{failing: true}
+	r := startRecorder(appender.append)
+	ctx := context.Background()
+
+	// The batch holds 2 and the buffer 2, the 5th has nowhere to go while appends fail
+	var recorded []string
+	var err error
+	for i := 0; i < 5 && err == nil; i++ {
+		event := fmt.Sprint("event", i)
+		if err = r.Record(ctx, Event{Type: event}); err == nil {
+			recorded = append(recorded, event)
+		}
+	}
+	require.ErrorIs(t, err, ErrRecorderFull)
+
+	// Every event Record accepted is appended once the database is back
+	appender.set(false)
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, r.Shutdown(shutdownCtx))
+	_, appended := appender.state()
+	require.Equal(t, recorded, appended)
+}
+
+func TestRecorderShutdownRetries(t *testing.T) {
+	setRecorderLimits(t, 100, 10)
+	appender := &fakeAppender{failing: true}
+	r := startRecorder(appender.append)
+	ctx := context.Background()
+	require.NoError(t, r.Record(ctx, Event{Type: "event"}))
+
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		appender.set(false)
+	}()
+	shutdownCtx, cancel := context.WithTimeout(ctx, time.Second)
+	defer cancel()
+	require.NoError(t, r.Shutdown(shutdownCtx))
+	_, appended := appender.state()
+	require.Equal(t, []string{"event"}, appended)
+}
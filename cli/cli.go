@@ -0,0 +1,191 @@
+// Package cli has the operator subcommands of the continuewith binary, everything but serve.
+//
+// Commands that change clients and scopes talk to the database directly, since the admin API can't. Commands about
+// tokens and admin keys go through the admin API, so they're audited and work without database access.
+package cli
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"text/tabwriter"
+
+	"github.com/danthegoodman1/GoAPITemplate/audit"
+	"github.com/danthegoodman1/GoAPITemplate/client"
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/pg"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// Returned for unknown commands and bad arguments, the caller should print Usage
+	ErrUsage = errors.New("invalid usage")
+
+	// The audit log actor for changes made with the CLI
+	AuditActor = "_cli"
+
+	OutputTable = "table"
+	OutputJSON  = "json"
+
+	logger = gologger.NewLogger()
+)
+
+type command struct {
+	// Space separated words, e.g. "client create"
+	name  string
+	usage string
+	run   func(ctx context.Context, out io.Writer, args []string) error
+}
+
+// serve is run by main, it's only here for Usage
+var commands = []command{
+	{name: "serve", usage: "run the server, the default with no command"},
+	{name: "config print", usage: "[--redacted] [-o yaml|json], then any validation errors", run: configPrintCmd},
+	{name: "migrate up", usage: "[--limit N] [--dry-run]", run: migrateUpCmd},
+	{name: "migrate down", usage: "[--limit 1] [--dry-run]", run: migrateDownCmd},
+	{name: "migrate status", usage: "list migrations and when they were applied", run: migrateStatusCmd},
+	{name: "tenant create", usage: "TENANT_ID --name NAME [--host HOST] [--user-exchange-url URL] [--pre-issuance-hook-url URL] [--provider-secret SECRET] [--issuer ISSUER]", run: tenantCreateCmd},
+	{name: "tenant update", usage: "TENANT_ID [same flags as create, an empty value resets to the server's]", run: tenantUpdateCmd},
+	{name: "tenant list", usage: "list tenants", run: tenantListCmd},
+	{name: "client create", usage: "--name NAME [--id ID] [--tenant ID]", run: clientCreateCmd},
+	{name: "client rotate-secret", usage: "CLIENT_ID [--tenant ID]", run: clientRotateSecretCmd},
+	{name: "client set-policy", usage: "CLIENT_ID [--access-ttl 15m] [--refresh-ttl 720h] [--refresh-idle 24h] [--refresh-tokens always|offline_access|never] [--tenant ID]", run: clientSetPolicyCmd},
+	{name: "client set-redirect-uris", usage: "CLIENT_ID --uris \"https://app.example.com/callback ...\" [--tenant ID]", run: clientSetRedirectURIsCmd},
+	{name: "client set-rate-limit", usage: "CLIENT_ID [--per-minute 600] [--burst 100] [--tenant ID]", run: clientSetRateLimitCmd},
+	{name: "scope add", usage: "SCOPE [--description TEXT] [--tenant ID]", run: scopeAddCmd},
+	{name: "token inspect", usage: "ACCESS_TOKEN", run: tokenInspectCmd},
+	{name: "token revoke", usage: "--user USER_ID | --client CLIENT_ID | --user USER_ID --client CLIENT_ID | --before TIME [--async]", run: tokenRevokeCmd},
+	{name: "keys rotate", usage: "KEY_ID [--grace 24h]", run: keysRotateCmd},
+}
+
+func Usage() string {
+	var b strings.Builder
+	b.WriteString("usage: continuewith [command]\n\ncommands:\n")
+	tw := tabwriter.NewWriter(&b, 0, 4, 2, ' ', 0)
+	for _, cmd := range commands {
+		fmt.Fprintf(tw, "  %s\t%s\n", cmd.name, cmd.usage)
+	}
+	tw.Flush()
+	b.WriteString("\nevery command but serve takes -o table|json\n")
+	b.WriteString("database commands use the store config like the server, from CONFIG_FILE and STORE, PG_DSN, and SQLITE_PATH\n")
+	b.WriteString("--tenant defaults to the default tenant, API commands reach other tenants through their host or path in --url\n")
+	b.WriteString("API commands use --url (CW_URL) and --admin-key (CW_ADMIN_KEY, or ADMIN_KEY)\n")
+	return b.String()
+}
+
+// Run runs the command in args, e.g. client create --name app, writing its result to out
+func Run(ctx context.Context, out io.Writer, args []string) error {
+	for _, cmd := range commands {
+		words := strings.Fields(cmd.name)
+		if cmd.run == nil || len(args) < len(words) || strings.Join(args[:len(words)], " ") != cmd.name {
+			continue
+		}
+		return cmd.run(ctx, out, args[len(words):])
+	}
+	return fmt.Errorf("unknown command %q -- %w", strings.Join(args, " "), ErrUsage)
+}
+
+// newFlagSet has the -o flag every command takes
+func newFlagSet(name string) (*flag.FlagSet, *string) {
+	fs := flag.NewFlagSet(name, flag.ContinueOnError)
+	output := fs.String("o", OutputTable, "output format, table or json")
+	return fs, output
+}
+
+// parseArgs parses flags before and after positional args, returning the positional args
+func parseArgs(fs *flag.FlagSet, args []string, positional int) ([]string, error) {
+	var rest []string
+	for {
+		if err := fs.Parse(args); err != nil {
+			return nil, err
+		}
+		args = fs.Args()
+		if len(args) == 0 {
+			break
+		}
+		rest = append(rest, args[0])
+		args = args[1:]
+	}
+	if len(rest) != positional {
+		return nil, fmt.Errorf("%s takes %d argument(s), got %d -- %w", fs.Name(), positional, len(rest), ErrUsage)
+	}
+	return rest, nil
+}
+
+// write prints v as indented JSON, or rows as a table with the first row as the header
+func write(out io.Writer, format string, v any, rows [][]string) error {
+	switch format {
+	case OutputJSON:
+		enc := json.NewEncoder(out)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case OutputTable:
+		tw := tabwriter.NewWriter(out, 0, 4, 2, ' ', 0)
+		for _, row := range rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output %q, use table or json -- %w", format, ErrUsage)
+	}
+}
+
+// openStore opens the store the server is configured with. The pool is only set with the postgres store.
+func openStore() (store.Store, *pgxpool.Pool, func(), error) {
+	if err := utils.LoadStoreConfig(); err != nil {
+		return nil, nil, nil, err
+	}
+	switch utils.Store {
+	case store.KindPostgres:
+		pool, err := pg.ConnectToDB()
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error in pg.ConnectToDB: %w", err)
+		}
+		return store.NewPostgres(pool, utils.IsPostgres), pool, pool.Close, nil
+	case store.KindSQLite:
+		sqliteStore, err := store.OpenSQLite(utils.SQLitePath)
+		if err != nil {
+			return nil, nil, nil, fmt.Errorf("error in store.OpenSQLite: %w", err)
+		}
+		return sqliteStore, nil, func() { sqliteStore.Close() }, nil
+	default:
+		return nil, nil, nil, fmt.Errorf("STORE %q can't be changed from the cli, use postgres or sqlite", utils.Store)
+	}
+}
+
+// tenantFlag adds --tenant to database commands
+func tenantFlag(fs *flag.FlagSet) *string {
+	return fs.String("tenant", store.DefaultTenantID, "the tenant, for multi-tenant deployments")
+}
+
+// recordAudit records the event if the store is postgres, the only one with an audit log. pool is the one from
+// openStore.
+func recordAudit(ctx context.Context, pool *pgxpool.Pool, event audit.Event) {
+	if pool == nil {
+		return
+	}
+	event.Actor = AuditActor
+	if err := audit.Record(ctx, pool, utils.IsPostgres, event); err != nil {
+		logger.Error().Err(err).Str("eventType", event.Type).Msg("error recording audit event")
+	}
+}
+
+// apiFlags adds the flags for reaching the admin API
+func apiFlags(fs *flag.FlagSet) func() *client.Client {
+	url := fs.String("url", utils.GetEnvOrDefault("CW_URL", "http://localhost:8080"), "where the server is")
+	adminKey := fs.String("admin-key", utils.GetEnvOrDefault("CW_ADMIN_KEY", os.Getenv("ADMIN_KEY")), "an admin key with the command's permission")
+	return func() *client.Client {
+		return client.NewClient(client.Options{
+			URL:        *url,
+			AdminKey:   *adminKey,
+			MaxRetries: 2,
+		})
+	}
+}
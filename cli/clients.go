@@ -0,0 +1,411 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/audit"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/samber/lo"
+)
+
+type ClientSecretOutput struct {
+	ID     string
+	Name   string
+	Secret string
+}
+
+func genClientSecret() string {
+	return utils.GenRandomIDWithSize("cws_", 32)
+}
+
+func clientCreateCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("client create")
+	name := fs.String("name", "", "shown on the consent screen")
+	id := fs.String("id", "", "default is generated")
+	tenantID := tenantFlag(fs)
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if *name == "" {
+		return fmt.Errorf("--name is required -- %w", ErrUsage)
+	}
+	if *id == "" {
+		*id = utils.GenRandomID("c_")
+	}
+
+	st, pool, closeStore, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	var client query.Client
+	err = st.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.InsertClient(ctx, query.InsertClientParams{
+			TenantID: *tenantID,
+			ID:       *id,
+			Secret:   genClientSecret(),
+			Name:     *name,
+		})
+		if err != nil {
+			return fmt.Errorf("error in InsertClient: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	recordAudit(ctx, pool, audit.Event{
+		TenantID: *tenantID,
+		Type:     audit.EventClientCreated,
+		ClientID: utils.Ptr(client.ID),
+	})
+
+	return write(out, *output, ClientSecretOutput{ID: client.ID, Name: client.Name, Secret: client.Secret}, [][]string{
+		{"ID", "NAME", "SECRET"},
+		{client.ID, client.Name, client.Secret},
+	})
+}
+
+func clientRotateSecretCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("client rotate-secret")
+	tenantID := tenantFlag(fs)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	st, pool, closeStore, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	var client query.Client
+	err = st.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.UpdateClientSecret(ctx, query.UpdateClientSecretParams{
+			TenantID: *tenantID,
+			ID:       positional[0],
+			Secret:   genClientSecret(),
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpdateClientSecret: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("client %s not found", positional[0])
+	}
+	if err != nil {
+		return err
+	}
+	recordAudit(ctx, pool, audit.Event{
+		TenantID: *tenantID,
+		Type:     audit.EventClientSecretRotated,
+		ClientID: utils.Ptr(client.ID),
+	})
+
+	return write(out, *output, ClientSecretOutput{ID: client.ID, Name: client.Name, Secret: client.Secret}, [][]string{
+		{"ID", "NAME", "SECRET"},
+		{client.ID, client.Name, client.Secret},
+	})
+}
+
+type ClientTokenPolicyOutput struct {
+	ID                      string
+	AccessTokenTTLSeconds   *int64
+	RefreshTokenTTLSeconds  *int64
+	RefreshTokenIdleSeconds *int64
+	RefreshTokenPolicy      string
+}
+
+// clientSetPolicyCmd only changes the flags that are passed, 0 resets a lifetime to the server's default
+func clientSetPolicyCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("client set-policy")
+	accessTTL := fs.Duration("access-ttl", 0, "access token lifetime, 0 is the server's default")
+	refreshTTL := fs.Duration("refresh-ttl", 0, "refresh token lifetime, 0 is the server's default")
+	refreshIdle := fs.Duration("refresh-idle", 0, "refresh tokens unused for this long expire, 0 is no idle timeout")
+	refreshTokens := fs.String("refresh-tokens", "", "always, offline_access, or never")
+	tenantID := tenantFlag(fs)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if set["refresh-tokens"] && !lo.Contains([]string{store.RefreshTokenPolicyAlways, store.RefreshTokenPolicyOfflineAccess, store.RefreshTokenPolicyNever}, *refreshTokens) {
+		return fmt.Errorf("--refresh-tokens must be always, offline_access, or never -- %w", ErrUsage)
+	}
+
+	st, pool, closeStore, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	var client query.Client
+	err = st.ExecInTx(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: *tenantID,
+			ID:       positional[0],
+		})
+		if err != nil {
+			return fmt.Errorf("error in SelectClient: %w", err)
+		}
+		params := query.UpdateClientTokenPolicyParams{
+			TenantID:                client.TenantID,
+			AccessTokenTtlSeconds:   client.AccessTokenTtlSeconds,
+			RefreshTokenTtlSeconds:  client.RefreshTokenTtlSeconds,
+			RefreshTokenIdleSeconds: client.RefreshTokenIdleSeconds,
+			RefreshTokenPolicy:      client.RefreshTokenPolicy,
+			ID:                      client.ID,
+		}
+		if set["access-ttl"] {
+			params.AccessTokenTtlSeconds = durationSeconds(*accessTTL)
+		}
+		if set["refresh-ttl"] {
+			params.RefreshTokenTtlSeconds = durationSeconds(*refreshTTL)
+		}
+		if set["refresh-idle"] {
+			params.RefreshTokenIdleSeconds = durationSeconds(*refreshIdle)
+		}
+		if set["refresh-tokens"] {
+			params.RefreshTokenPolicy = *refreshTokens
+		}
+		client, err = tx.UpdateClientTokenPolicy(ctx, params)
+		if err != nil {
+			return fmt.Errorf("error in UpdateClientTokenPolicy: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("client %s not found", positional[0])
+	}
+	if err != nil {
+		return err
+	}
+	recordAudit(ctx, pool, audit.Event{
+		TenantID: *tenantID,
+		Type:     audit.EventClientTokenPolicyUpdated,
+		ClientID: utils.Ptr(client.ID),
+	})
+
+	showSeconds := func(seconds *int64, unset string) string {
+		if seconds == nil {
+			return unset
+		}
+		return (time.Second * time.Duration(*seconds)).String()
+	}
+	return write(out, *output, ClientTokenPolicyOutput{
+		ID:                      client.ID,
+		AccessTokenTTLSeconds:   client.AccessTokenTtlSeconds,
+		RefreshTokenTTLSeconds:  client.RefreshTokenTtlSeconds,
+		RefreshTokenIdleSeconds: client.RefreshTokenIdleSeconds,
+		RefreshTokenPolicy:      client.RefreshTokenPolicy,
+	}, [][]string{
+		{"ID", "ACCESS TTL", "REFRESH TTL", "REFRESH IDLE", "REFRESH TOKENS"},
+		{
+			client.ID,
+			showSeconds(client.AccessTokenTtlSeconds, "default"),
+			showSeconds(client.RefreshTokenTtlSeconds, "default"),
+			showSeconds(client.RefreshTokenIdleSeconds, "none"),
+			client.RefreshTokenPolicy,
+		},
+	})
+}
+
+type ClientRateLimitOutput struct {
+	ID                 string
+	RateLimitPerMinute *int64
+	RateLimitBurst     *int64
+}
+
+// clientSetRateLimitCmd only changes the flags that are passed, 0 resets to the server's default
+func clientSetRateLimitCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("client set-rate-limit")
+	perMinute := fs.Int64("per-minute", 0, "requests a minute to /oauth2/authorize and /oauth2/token, 0 is the server's default")
+	burst := fs.Int64("burst", 0, "requests allowed at once, 0 is the server's default")
+	tenantID := tenantFlag(fs)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+
+	st, pool, closeStore, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	var client query.Client
+	err = st.ExecInTx(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: *tenantID,
+			ID:       positional[0],
+		})
+		if err != nil {
+			return fmt.Errorf("error in SelectClient: %w", err)
+		}
+		params := query.UpdateClientRateLimitParams{
+			TenantID:           client.TenantID,
+			RateLimitPerMinute: client.RateLimitPerMinute,
+			RateLimitBurst:     client.RateLimitBurst,
+			ID:                 client.ID,
+		}
+		if set["per-minute"] {
+			params.RateLimitPerMinute = utils.IfElse(*perMinute <= 0, nil, perMinute)
+		}
+		if set["burst"] {
+			params.RateLimitBurst = utils.IfElse(*burst <= 0, nil, burst)
+		}
+		client, err = tx.UpdateClientRateLimit(ctx, params)
+		if err != nil {
+			return fmt.Errorf("error in UpdateClientRateLimit: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("client %s not found", positional[0])
+	}
+	if err != nil {
+		return err
+	}
+	recordAudit(ctx, pool, audit.Event{
+		TenantID: *tenantID,
+		Type:     audit.EventClientRateLimitUpdated,
+		ClientID: utils.Ptr(client.ID),
+	})
+
+	show := func(n *int64) string {
+		if n == nil {
+			return "default"
+		}
+		return fmt.Sprint(*n)
+	}
+	return write(out, *output, ClientRateLimitOutput{
+		ID:                 client.ID,
+		RateLimitPerMinute: client.RateLimitPerMinute,
+		RateLimitBurst:     client.RateLimitBurst,
+	}, [][]string{
+		{"ID", "PER MINUTE", "BURST"},
+		{client.ID, show(client.RateLimitPerMinute), show(client.RateLimitBurst)},
+	})
+}
+
+type ClientRedirectURIsOutput struct {
+	ID           string
+	RedirectURIs []string
+}
+
+func clientSetRedirectURIsCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("client set-redirect-uris")
+	uris := fs.String("uris", "", "space separated, replaces the client's redirect URIs, empty removes them all")
+	tenantID := tenantFlag(fs)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	redirectURIs := lo.Uniq(strings.Fields(*uris))
+	for _, redirectURI := range redirectURIs {
+		if err := utils.ValidateRedirectURI(redirectURI); err != nil {
+			return fmt.Errorf("%s: %w", redirectURI, err)
+		}
+	}
+
+	st, pool, closeStore, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	var client query.Client
+	err = st.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.UpdateClientRedirectURIs(ctx, query.UpdateClientRedirectURIsParams{
+			TenantID:     *tenantID,
+			ID:           positional[0],
+			RedirectUris: redirectURIs,
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpdateClientRedirectURIs: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return fmt.Errorf("client %s not found", positional[0])
+	}
+	if err != nil {
+		return err
+	}
+	recordAudit(ctx, pool, audit.Event{
+		TenantID: *tenantID,
+		Type:     audit.EventClientRedirectURIsUpdated,
+		ClientID: utils.Ptr(client.ID),
+		Details: map[string]string{
+			"redirect_uris": strings.Join(client.RedirectUris, " "),
+		},
+	})
+
+	return write(out, *output, ClientRedirectURIsOutput{ID: client.ID, RedirectURIs: client.RedirectUris}, [][]string{
+		{"ID", "REDIRECT URIS"},
+		{client.ID, strings.Join(client.RedirectUris, " ")},
+	})
+}
+
+// durationSeconds is nil for 0, which means unset
+func durationSeconds(d time.Duration) *int64 {
+	if d <= 0 {
+		return nil
+	}
+	return utils.Ptr(int64(d / time.Second))
+}
+
+func scopeAddCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("scope add")
+	description := fs.String("description", "", "shown on the consent screen")
+	tenantID := tenantFlag(fs)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	st, _, closeStore, err := openStore()
+	if err != nil {
+		return err
+	}
+	defer closeStore()
+
+	var scope query.Scope
+	err = st.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		scope, err = tx.UpsertScope(ctx, query.UpsertScopeParams{
+			TenantID:    *tenantID,
+			ID:          positional[0],
+			Description: utils.IfElse(*description == "", nil, description),
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpsertScope: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	return write(out, *output, scope, [][]string{
+		{"ID", "DESCRIPTION"},
+		{scope.ID, utils.Deref(scope.Description, "")},
+	})
+}
@@ -0,0 +1,53 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"gopkg.in/yaml.v3"
+)
+
+var OutputYAML = "yaml"
+
+// configPrintCmd prints the config the server would run with, then fails if it's invalid so it can gate deploys
+func configPrintCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("config print")
+	redacted := fs.Bool("redacted", false, "replace secrets with REDACTED")
+	// The config is naturally YAML, unlike the other commands' tables
+	*output = OutputYAML
+	fs.Lookup("o").DefValue = OutputYAML
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	cfg, invalid := utils.ReadAndValidateConfig(utils.Config.Validate)
+	var configErrs utils.ConfigErrors
+	if invalid != nil && !errors.As(invalid, &configErrs) {
+		return invalid
+	}
+	if *redacted {
+		cfg = cfg.Redacted()
+	}
+
+	switch *output {
+	case OutputYAML:
+		enc := yaml.NewEncoder(out)
+		enc.SetIndent(2)
+		if err := enc.Encode(cfg); err != nil {
+			return fmt.Errorf("error encoding yaml: %w", err)
+		}
+		if err := enc.Close(); err != nil {
+			return fmt.Errorf("error encoding yaml: %w", err)
+		}
+	case OutputJSON:
+		if err := write(out, *output, cfg, nil); err != nil {
+			return err
+		}
+	default:
+		return fmt.Errorf("unknown output %q, use yaml or json -- %w", *output, ErrUsage)
+	}
+	return invalid
+}
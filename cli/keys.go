@@ -0,0 +1,29 @@
+package cli
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+)
+
+func keysRotateCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("keys rotate")
+	apiClient := apiFlags(fs)
+	grace := fs.Duration("grace", time.Hour*24, "how long the old key keeps working")
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	res, err := apiClient().RotateAdminKey(ctx, positional[0], *grace)
+	if err != nil {
+		return err
+	}
+
+	return write(out, *output, res, [][]string{
+		{"ID", "NAME", "KEY", "OLD KEY EXPIRES", "WORKFLOW"},
+		{res.ID, res.Name, res.Key, res.OldKeyExpires.Format(time.RFC3339), utils.Deref(res.WorkflowID, "")},
+	})
+}
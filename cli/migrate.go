@@ -0,0 +1,102 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/migrations"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	migrate "github.com/rubenv/sql-migrate"
+)
+
+var errNoMigrations = errors.New("only the postgres store has migrations, the sqlite schema is created when it's opened")
+
+type MigrateOutput struct {
+	Applied int
+}
+
+func migrateUpCmd(ctx context.Context, out io.Writer, args []string) error {
+	return runMigrate(ctx, out, args, "migrate up", migrations.Up, 0)
+}
+
+func migrateDownCmd(ctx context.Context, out io.Writer, args []string) error {
+	return runMigrate(ctx, out, args, "migrate down", migrations.Down, 1)
+}
+
+func runMigrate(ctx context.Context, out io.Writer, args []string, name string, dir migrate.MigrationDirection, defaultLimit int) error {
+	fs, output := newFlagSet(name)
+	limit := fs.Int("limit", defaultLimit, "how many migrations to apply, 0 is all")
+	dryRun := fs.Bool("dry-run", false, "print the SQL that would run instead of running it")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := utils.LoadStoreConfig(); err != nil {
+		return err
+	}
+	if utils.Store != store.KindPostgres {
+		return errNoMigrations
+	}
+
+	if *dryRun {
+		planned, err := migrations.PlanMigrations(utils.PGDSN, dir, *limit)
+		if err != nil {
+			return fmt.Errorf("error in PlanMigrations: %w", err)
+		}
+		if *output == OutputJSON {
+			return write(out, *output, planned, nil)
+		}
+		if len(planned) == 0 {
+			_, err = fmt.Fprintln(out, "-- nothing to migrate")
+			return err
+		}
+		for _, mig := range planned {
+			fmt.Fprintf(out, "-- %s\n", mig.ID)
+			for _, stmt := range mig.SQL {
+				fmt.Fprintln(out, strings.TrimSpace(stmt))
+			}
+			fmt.Fprintln(out)
+		}
+		return nil
+	}
+
+	applied, err := migrations.RunMigrations(ctx, utils.PGDSN, dir, *limit)
+	if err != nil {
+		return fmt.Errorf("error in RunMigrations: %w", err)
+	}
+	return write(out, *output, MigrateOutput{Applied: applied}, [][]string{
+		{"APPLIED"},
+		{fmt.Sprint(applied)},
+	})
+}
+
+func migrateStatusCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("migrate status")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+	if err := utils.LoadStoreConfig(); err != nil {
+		return err
+	}
+	if utils.Store != store.KindPostgres {
+		return errNoMigrations
+	}
+
+	statuses, err := migrations.MigrationsStatus(utils.PGDSN)
+	if err != nil {
+		return fmt.Errorf("error in MigrationsStatus: %w", err)
+	}
+	rows := [][]string{{"MIGRATION", "APPLIED"}}
+	for _, status := range statuses {
+		applied := "pending"
+		if status.Applied != nil {
+			applied = status.Applied.Format(time.RFC3339)
+		}
+		rows = append(rows, []string{status.ID, applied})
+	}
+	return write(out, *output, statuses, rows)
+}
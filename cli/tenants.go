@@ -0,0 +1,232 @@
+package cli
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/pg"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/samber/lo"
+)
+
+// TenantOutput leaves out the provider secret, it only says whether the tenant has its own
+type TenantOutput struct {
+	ID                         string
+	Name                       string
+	Host                       *string
+	ProviderUserExchangeURL    *string
+	ProviderPreIssuanceHookURL *string
+	HasProviderSecret          bool
+	Issuer                     *string
+	Created                    time.Time
+	Updated                    time.Time
+}
+
+func tenantOutput(t query.Tenant) TenantOutput {
+	return TenantOutput{
+		ID:                         t.ID,
+		Name:                       t.Name,
+		Host:                       t.Host,
+		ProviderUserExchangeURL:    t.ProviderUserExchangeUrl,
+		ProviderPreIssuanceHookURL: t.ProviderPreIssuanceHookUrl,
+		HasProviderSecret:          t.ProviderSecret != nil,
+		Issuer:                     t.Issuer,
+		Created:                    t.Created,
+		Updated:                    t.Updated,
+	}
+}
+
+func tenantRows(tenants ...query.Tenant) [][]string {
+	rows := [][]string{{"ID", "NAME", "HOST", "USER EXCHANGE URL", "ISSUER"}}
+	for _, t := range tenants {
+		rows = append(rows, []string{
+			t.ID,
+			t.Name,
+			utils.Deref(t.Host, "-"),
+			utils.Deref(t.ProviderUserExchangeUrl, "default"),
+			utils.Deref(t.Issuer, "default"),
+		})
+	}
+	return rows
+}
+
+// tenantFlags are the settings of tenant create and update
+type tenantFlags struct {
+	name, host, userExchangeURL, preIssuanceHookURL, providerSecret, issuer *string
+}
+
+func addTenantFlags(fs *flag.FlagSet) tenantFlags {
+	return tenantFlags{
+		name:               fs.String("name", "", "for operators"),
+		host:               fs.String("host", "", "requests to this host are the tenant's in host mode"),
+		userExchangeURL:    fs.String("user-exchange-url", "", "the tenant's PROVIDER_USER_EXCHANGE_URL, default the server's"),
+		preIssuanceHookURL: fs.String("pre-issuance-hook-url", "", "the tenant's PROVIDER_PRE_ISSUANCE_HOOK_URL, default the server's"),
+		providerSecret:     fs.String("provider-secret", "", "the tenant's PROVIDER_SECRET, default the server's"),
+		issuer:             fs.String("issuer", "", "the tenant's ISSUER, default the server's"),
+	}
+}
+
+// openTenantsDB connects to postgres, the only store with tenants
+func openTenantsDB() (*pgxpool.Pool, error) {
+	if err := utils.LoadStoreConfig(); err != nil {
+		return nil, err
+	}
+	if utils.Store != store.KindPostgres {
+		return nil, fmt.Errorf("tenants need the postgres store, STORE is %q", utils.Store)
+	}
+	pool, err := pg.ConnectToDB()
+	if err != nil {
+		return nil, fmt.Errorf("error in pg.ConnectToDB: %w", err)
+	}
+	return pool, nil
+}
+
+// nilIfEmpty is for nullable settings, where empty means the server's default
+func nilIfEmpty(s string) *string {
+	return utils.IfElse(s == "", nil, &s)
+}
+
+func tenantCreateCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("tenant create")
+	flags := addTenantFlags(fs)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	if *flags.name == "" {
+		return fmt.Errorf("--name is required -- %w", ErrUsage)
+	}
+
+	pool, err := openTenantsDB()
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	var tenant query.Tenant
+	err = query.ReliableExec(ctx, pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		tenant, err = q.InsertTenant(ctx, query.InsertTenantParams{
+			ID:                         positional[0],
+			Name:                       *flags.name,
+			Host:                       nilIfEmpty(*flags.host),
+			ProviderUserExchangeUrl:    nilIfEmpty(*flags.userExchangeURL),
+			ProviderPreIssuanceHookUrl: nilIfEmpty(*flags.preIssuanceHookURL),
+			ProviderSecret:             nilIfEmpty(*flags.providerSecret),
+			Issuer:                     nilIfEmpty(*flags.issuer),
+		})
+		if err != nil {
+			return fmt.Errorf("error in InsertTenant: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return write(out, *output, tenantOutput(tenant), tenantRows(tenant))
+}
+
+// tenantUpdateCmd only changes the flags that are passed
+func tenantUpdateCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("tenant update")
+	flags := addTenantFlags(fs)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+	set := map[string]bool{}
+	fs.Visit(func(f *flag.Flag) {
+		set[f.Name] = true
+	})
+	if set["name"] && *flags.name == "" {
+		return fmt.Errorf("--name can't be empty -- %w", ErrUsage)
+	}
+
+	pool, err := openTenantsDB()
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	var tenant query.Tenant
+	err = query.ReliableExecInTx(ctx, pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		tenant, err = q.SelectTenant(ctx, positional[0])
+		if err != nil {
+			return fmt.Errorf("error in SelectTenant: %w", err)
+		}
+		params := query.UpdateTenantParams{
+			Name:                       tenant.Name,
+			Host:                       tenant.Host,
+			ProviderUserExchangeUrl:    tenant.ProviderUserExchangeUrl,
+			ProviderPreIssuanceHookUrl: tenant.ProviderPreIssuanceHookUrl,
+			ProviderSecret:             tenant.ProviderSecret,
+			Issuer:                     tenant.Issuer,
+			ID:                         tenant.ID,
+		}
+		if set["name"] {
+			params.Name = *flags.name
+		}
+		if set["host"] {
+			params.Host = nilIfEmpty(*flags.host)
+		}
+		if set["user-exchange-url"] {
+			params.ProviderUserExchangeUrl = nilIfEmpty(*flags.userExchangeURL)
+		}
+		if set["pre-issuance-hook-url"] {
+			params.ProviderPreIssuanceHookUrl = nilIfEmpty(*flags.preIssuanceHookURL)
+		}
+		if set["provider-secret"] {
+			params.ProviderSecret = nilIfEmpty(*flags.providerSecret)
+		}
+		if set["issuer"] {
+			params.Issuer = nilIfEmpty(*flags.issuer)
+		}
+		tenant, err = q.UpdateTenant(ctx, params)
+		if err != nil {
+			return fmt.Errorf("error in UpdateTenant: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return fmt.Errorf("tenant %s not found", positional[0])
+	}
+	if err != nil {
+		return err
+	}
+	return write(out, *output, tenantOutput(tenant), tenantRows(tenant))
+}
+
+func tenantListCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("tenant list")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	pool, err := openTenantsDB()
+	if err != nil {
+		return err
+	}
+	defer pool.Close()
+
+	var tenants []query.Tenant
+	err = query.ReliableExec(ctx, pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		tenants, err = q.ListTenants(ctx)
+		if err != nil {
+			return fmt.Errorf("error in ListTenants: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return write(out, *output, lo.Map(tenants, func(item query.Tenant, index int) TenantOutput {
+		return tenantOutput(item)
+	}), tenantRows(tenants...))
+}
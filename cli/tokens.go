@@ -0,0 +1,106 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/client"
+	"github.com/samber/lo"
+)
+
+func tokenInspectCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("token inspect")
+	apiClient := apiFlags(fs)
+	positional, err := parseArgs(fs, args, 1)
+	if err != nil {
+		return err
+	}
+
+	info, err := apiClient().Introspect(ctx, positional[0])
+	if err != nil {
+		return err
+	}
+
+	lastUsed := "never"
+	if info.LastUsedMS != 0 {
+		lastUsed = time.UnixMilli(info.LastUsedMS).Format(time.RFC3339)
+	}
+	return write(out, *output, info, [][]string{
+		{"USER", "SCOPES", "CREATED", "EXPIRES", "LAST USED"},
+		{
+			info.UserID,
+			strings.Join(info.Scopes, " "),
+			time.UnixMilli(info.CreatedMS).Format(time.RFC3339),
+			time.UnixMilli(info.ExpiresMS).Format(time.RFC3339),
+			lastUsed,
+		},
+	})
+}
+
+func tokenRevokeCmd(ctx context.Context, out io.Writer, args []string) error {
+	fs, output := newFlagSet("token revoke")
+	apiClient := apiFlags(fs)
+	userID := fs.String("user", "", "revoke the user's tokens")
+	clientID := fs.String("client", "", "revoke the client's tokens, with --user only the user's grant to the client")
+	before := fs.String("before", "", "revoke tokens created before this RFC 3339 time")
+	async := fs.Bool("async", false, "revoke in a workflow, needs temporal")
+	if _, err := parseArgs(fs, args, 0); err != nil {
+		return err
+	}
+
+	// The user's grant to a client is revoked with their consent
+	if *userID != "" && *clientID != "" {
+		if *before != "" || *async {
+			return fmt.Errorf("--before and --async can't be used with both --user and --client -- %w", ErrUsage)
+		}
+		res, err := apiClient().RevokeConsent(ctx, *userID, *clientID)
+		if err != nil {
+			return err
+		}
+		return writeRevoked(out, *output, res)
+	}
+
+	var filter client.RevokeFilter
+	if *userID != "" {
+		filter.UserID = userID
+	}
+	if *clientID != "" {
+		filter.ClientID = clientID
+	}
+	if *before != "" {
+		t, err := time.Parse(time.RFC3339, *before)
+		if err != nil {
+			return fmt.Errorf("--before must be an RFC 3339 time: %s -- %w", err, ErrUsage)
+		}
+		filter.Before = &t
+	}
+	if lo.Count([]bool{filter.UserID != nil, filter.ClientID != nil, filter.Before != nil}, true) != 1 {
+		return fmt.Errorf("exactly one of --user, --client, or --before is required -- %w", ErrUsage)
+	}
+
+	if *async {
+		res, err := apiClient().RevokeTokensAsync(ctx, filter)
+		if err != nil {
+			return err
+		}
+		return write(out, *output, res, [][]string{
+			{"WORKFLOW", "RUN"},
+			{res.WorkflowID, res.RunID},
+		})
+	}
+	res, err := apiClient().RevokeTokens(ctx, filter)
+	if err != nil {
+		return err
+	}
+	return writeRevoked(out, *output, res)
+}
+
+func writeRevoked(out io.Writer, format string, res *client.RevokeTokensResponse) error {
+	return write(out, format, res, [][]string{
+		{"ACCESS TOKENS", "REFRESH TOKENS"},
+		{fmt.Sprint(res.AccessTokens), fmt.Sprint(res.RefreshTokens)},
+	})
+}
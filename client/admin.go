@@ -0,0 +1,345 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var ErrInvalidFilter = errors.New("exactly one of UserID, ClientID, or Before must be set")
+
+type VerifyAccessTokenResponse struct {
+	UserID               string
+	CreatedMS, ExpiresMS int64
+	// The previous time the token was introspected or used for userinfo, to the minute. 0 if it never was.
+	LastUsedMS int64 `json:",omitempty"`
+	Scopes     []string
+	// Profile and custom claims from the provider exchange
+	Claims json.RawMessage `json:",omitempty"`
+	// The tenant's issuer, empty if there isn't one
+	Issuer string `json:",omitempty"`
+}
+
+// Introspect returns the access token's grant, or ErrInvalidToken. Needs tokens:introspect.
+func (c *Client) Introspect(ctx context.Context, accessToken string) (*VerifyAccessTokenResponse, error) {
+	var res VerifyAccessTokenResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodGet,
+		path:       "/admin/access_token/" + url.PathEscape(accessToken),
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, notFoundAs(err, ErrInvalidToken)
+	}
+	return &res, nil
+}
+
+// MaxIntrospectBatch is the most tokens IntrospectBatch takes at once
+var MaxIntrospectBatch = 100
+
+// IntrospectBatch introspects up to MaxIntrospectBatch access tokens in one request. Every token is in the result,
+// nil if it isn't valid. Needs tokens:introspect.
+func (c *Client) IntrospectBatch(ctx context.Context, accessTokens []string) (map[string]*VerifyAccessTokenResponse, error) {
+	var res struct {
+		AccessTokens map[string]*VerifyAccessTokenResponse
+	}
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/access_tokens/introspect",
+		body: map[string][]string{
+			"access_tokens": accessTokens,
+		},
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.AccessTokens, nil
+}
+
+type ClientResponse struct {
+	ID        string
+	Suspended bool
+	Name      string
+	Created   time.Time
+	Updated   time.Time
+
+	// Nil when the client uses the server's default
+	AccessTokenTTLSeconds  *int64
+	RefreshTokenTTLSeconds *int64
+	// Nil when refresh tokens have no idle timeout
+	RefreshTokenIdleSeconds *int64
+	// always, offline_access, or never
+	RefreshTokenPolicy string
+	// Nil when the client uses the server's default
+	RateLimitPerMinute *int64
+	RateLimitBurst     *int64
+	// Where /oauth2/authorize can redirect to
+	RedirectURIs []string
+}
+
+// GetClient needs clients:read
+func (c *Client) GetClient(ctx context.Context, clientID string) (*ClientResponse, error) {
+	var res ClientResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodGet,
+		path:       "/admin/client/" + url.PathEscape(clientID),
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+var (
+	RefreshTokenPolicyAlways = "always"
+	// Refresh tokens are only issued when the user grants the offline_access scope
+	RefreshTokenPolicyOfflineAccess = "offline_access"
+	RefreshTokenPolicyNever         = "never"
+)
+
+type SetClientTokenPolicyRequest struct {
+	// Nil uses the server's default
+	AccessTokenTTLSeconds  *int64 `json:"access_token_ttl_seconds"`
+	RefreshTokenTTLSeconds *int64 `json:"refresh_token_ttl_seconds"`
+	// Nil disables the idle timeout
+	RefreshTokenIdleSeconds *int64 `json:"refresh_token_idle_seconds"`
+	RefreshTokenPolicy      string `json:"refresh_token_policy"`
+}
+
+// SetClientTokenPolicy replaces the client's token lifetimes and refresh token policy. Needs clients:write.
+func (c *Client) SetClientTokenPolicy(ctx context.Context, clientID string, req SetClientTokenPolicyRequest) (*ClientResponse, error) {
+	var res ClientResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodPut,
+		path:       "/admin/client/" + url.PathEscape(clientID) + "/token_policy",
+		body:       req,
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type SetClientRateLimitRequest struct {
+	// Requests a minute to /oauth2/authorize and /oauth2/token, nil uses the server's default
+	PerMinute *int64 `json:"per_minute"`
+	// Nil uses the server's default
+	Burst *int64 `json:"burst"`
+}
+
+// SetClientRateLimit replaces the client's rate limit. Needs clients:write.
+func (c *Client) SetClientRateLimit(ctx context.Context, clientID string, req SetClientRateLimitRequest) (*ClientResponse, error) {
+	var res ClientResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodPut,
+		path:       "/admin/client/" + url.PathEscape(clientID) + "/rate_limit",
+		body:       req,
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type SetClientRedirectURIsRequest struct {
+	// Absolute URIs without fragments, at most 20. Clients with one can leave redirect_uri out of authorize requests.
+	RedirectURIs []string `json:"redirect_uris"`
+}
+
+// SetClientRedirectURIs replaces where /oauth2/authorize can send the client's users back to. Needs clients:write.
+func (c *Client) SetClientRedirectURIs(ctx context.Context, clientID string, req SetClientRedirectURIsRequest) (*ClientResponse, error) {
+	var res ClientResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodPut,
+		path:       "/admin/client/" + url.PathEscape(clientID) + "/redirect_uris",
+		body:       req,
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type (
+	PutScopeRequest struct {
+		// Shown on the consent screen
+		Description *string `json:"description"`
+	}
+
+	ScopeResponse struct {
+		ID          string
+		Description *string
+		Created     time.Time
+		Updated     time.Time
+	}
+)
+
+// PutScope creates the scope or updates its description. Needs scopes:write.
+func (c *Client) PutScope(ctx context.Context, scopeID string, req PutScopeRequest) (*ScopeResponse, error) {
+	var res ScopeResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodPut,
+		path:       "/admin/scopes/" + url.PathEscape(scopeID),
+		body:       req,
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type (
+	SuspendClientRequest struct {
+		Suspended bool `json:"suspended"`
+		// Also revoke all of the client's tokens, only used when suspending
+		RevokeTokens bool `json:"revoke_tokens"`
+	}
+
+	SuspendClientResponse struct {
+		ClientResponse
+		RevokedTokens *RevokeTokensResponse `json:",omitempty"`
+	}
+)
+
+// SuspendClient suspends or unsuspends a client. Needs clients:write.
+func (c *Client) SuspendClient(ctx context.Context, clientID string, req SuspendClientRequest) (*SuspendClientResponse, error) {
+	var res SuspendClientResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodPost,
+		path:       "/admin/client/" + url.PathEscape(clientID) + "/suspend",
+		body:       req,
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type (
+	// RevokeFilter selects the tokens to revoke, exactly one field must be set
+	RevokeFilter struct {
+		UserID   *string
+		ClientID *string
+		// Tokens created before this time
+		Before *time.Time
+	}
+
+	RevokeTokensResponse struct {
+		AccessTokens  int64
+		RefreshTokens int64
+	}
+
+	BulkRevokeWorkflowResponse struct {
+		WorkflowID string
+		RunID      string
+	}
+)
+
+func (f RevokeFilter) request() (request, error) {
+	set := 0
+	for _, isSet := range []bool{f.UserID != nil, f.ClientID != nil, f.Before != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return request{}, ErrInvalidFilter
+	}
+
+	req := request{
+		method:     http.MethodPost,
+		idempotent: true,
+	}
+	switch {
+	case f.UserID != nil:
+		req.path = "/admin/revoke/user/" + url.PathEscape(*f.UserID)
+	case f.ClientID != nil:
+		req.path = "/admin/revoke/client/" + url.PathEscape(*f.ClientID)
+	default:
+		req.path = "/admin/revoke/before"
+		req.body = map[string]time.Time{"before": *f.Before}
+	}
+	return req, nil
+}
+
+// RevokeTokens revokes all of the matching access and refresh tokens. Needs tokens:revoke.
+func (c *Client) RevokeTokens(ctx context.Context, filter RevokeFilter) (*RevokeTokensResponse, error) {
+	req, err := filter.request()
+	if err != nil {
+		return nil, err
+	}
+	var res RevokeTokensResponse
+	err = c.doJSON(ctx, req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RevokeTokensAsync starts a workflow that revokes the tokens, for when there are too many to revoke in a request.
+// Needs temporal on the server.
+func (c *Client) RevokeTokensAsync(ctx context.Context, filter RevokeFilter) (*BulkRevokeWorkflowResponse, error) {
+	req, err := filter.request()
+	if err != nil {
+		return nil, err
+	}
+	req.query = url.Values{"async": {"true"}}
+	// Starting the workflow twice would revoke twice, which is fine, but it would also be two workflows
+	req.idempotent = false
+	var res BulkRevokeWorkflowResponse
+	err = c.doJSON(ctx, req, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+type ConsentResponse struct {
+	UserID   string
+	ClientID string
+	Scopes   []string
+	Created  time.Time
+	Updated  time.Time
+	// The last time the grant was refreshed, or its access tokens were introspected
+	LastUsed *time.Time
+}
+
+// ListConsents lists the clients a user has consented to. Needs tokens:introspect.
+func (c *Client) ListConsents(ctx context.Context, userID string) ([]ConsentResponse, error) {
+	var res struct {
+		Consents []ConsentResponse
+	}
+	err := c.doJSON(ctx, request{
+		method:     http.MethodGet,
+		path:       "/admin/consents/" + url.PathEscape(userID),
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res.Consents, nil
+}
+
+// RevokeConsent deletes the user's consent for the client and revokes the grant's tokens. Needs tokens:revoke.
+func (c *Client) RevokeConsent(ctx context.Context, userID, clientID string) (*RevokeTokensResponse, error) {
+	var res RevokeTokensResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodDelete,
+		path:       "/admin/consents/" + url.PathEscape(userID) + "/" + url.PathEscape(clientID),
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
@@ -0,0 +1,94 @@
+package client
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type (
+	CreateAdminKeyRequest struct {
+		Name        string     `json:"name"`
+		Permissions []string   `json:"permissions"`
+		Expires     *time.Time `json:"expires,omitempty"`
+	}
+
+	AdminKeyResponse struct {
+		ID          string
+		Name        string
+		Permissions []string
+		Expires     *time.Time
+		LastUsed    *time.Time
+		Revoked     bool
+		Created     time.Time
+		Updated     time.Time
+	}
+
+	CreateAdminKeyResponse struct {
+		AdminKeyResponse
+		// Only returned on creation, the server only stores the hash
+		Key string
+	}
+
+	RotateAdminKeyResponse struct {
+		CreateAdminKeyResponse
+		OldKeyExpires time.Time
+		// Set when temporal is enabled, cancel the workflow to keep the old key
+		WorkflowID *string `json:",omitempty"`
+	}
+)
+
+// CreateAdminKey needs admin_keys:write and every permission being granted
+func (c *Client) CreateAdminKey(ctx context.Context, req CreateAdminKeyRequest) (*CreateAdminKeyResponse, error) {
+	var res CreateAdminKeyResponse
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/keys",
+		body:   req,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListAdminKeys needs admin_keys:read
+func (c *Client) ListAdminKeys(ctx context.Context) ([]AdminKeyResponse, error) {
+	var res []AdminKeyResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodGet,
+		path:       "/admin/keys",
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// RotateAdminKey creates a new key with the same name and permissions, the old one keeps working for the grace
+// period (0 is the server default of 24 hours). Needs admin_keys:write.
+func (c *Client) RotateAdminKey(ctx context.Context, keyID string, gracePeriod time.Duration) (*RotateAdminKeyResponse, error) {
+	var res RotateAdminKeyResponse
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/keys/" + url.PathEscape(keyID) + "/rotate",
+		body: map[string]int64{
+			"grace_period_seconds": int64(gracePeriod.Seconds()),
+		},
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// RevokeAdminKey needs admin_keys:write
+func (c *Client) RevokeAdminKey(ctx context.Context, keyID string) error {
+	return c.doJSON(ctx, request{
+		method:     http.MethodDelete,
+		path:       "/admin/keys/" + url.PathEscape(keyID),
+		idempotent: true,
+	}, nil)
+}
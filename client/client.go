@@ -0,0 +1,211 @@
+// Package client is a Go client for the ContinueWith OAuth2 and admin APIs.
+//
+//	cw := client.NewClient(client.Options{
+//		URL:      "https://auth.example.com",
+//		AdminKey: os.Getenv("CW_ADMIN_KEY"),
+//	})
+//	tokens, err := cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, code)
+//	if errors.Is(err, client.ErrInvalidGrant) {
+//		// the code was already used or expired
+//	}
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/UltimateTournament/backoff/v4"
+	"github.com/samber/lo"
+)
+
+var (
+	// Responses should be small, this stops a misbehaving server from eating memory
+	maxResponseBytes int64 = 1 << 20
+
+	DefaultTimeout = time.Second * 10
+)
+
+// Options for the client. The zero value of everything but URL is usable.
+type Options struct {
+	// Where ContinueWith is, e.g. https://auth.example.com, or https://auth.example.com/acme for a tenant in path mode
+	URL string
+	// Needed for the admin API, the key needs the permission of each endpoint called
+	AdminKey string
+
+	// Redirects are never followed, the OAuth2 endpoints answer with them
+	HTTPClient *http.Client
+	// Timeout for each attempt, default DefaultTimeout
+	Timeout time.Duration
+	// Retries after the first attempt, only for network errors and 5xx. Requests that would issue something twice,
+	// like exchanging a code or creating a key, are never retried.
+	MaxRetries uint64
+}
+
+type Client struct {
+	opts       Options
+	httpClient *http.Client
+}
+
+func NewClient(opts Options) *Client {
+	opts.URL = strings.TrimSuffix(opts.URL, "/")
+	if opts.Timeout == 0 {
+		opts.Timeout = DefaultTimeout
+	}
+	httpClient := &http.Client{}
+	if opts.HTTPClient != nil {
+		// Copied so we don't change the caller's client
+		clientCopy := *opts.HTTPClient
+		httpClient = &clientCopy
+	}
+	httpClient.CheckRedirect = func(req *http.Request, via []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+	return &Client{
+		opts:       opts,
+		httpClient: httpClient,
+	}
+}
+
+type (
+	request struct {
+		method string
+		path   string
+		query  url.Values
+		// JSON encoded if not nil
+		body any
+		// Defaults to the admin key
+		bearer *string
+		header http.Header
+		// Safe to send more than once
+		idempotent bool
+	}
+
+	response struct {
+		statusCode int
+		header     http.Header
+		body       []byte
+	}
+)
+
+// do sends the request with retries. Non 2xx or 3xx responses are returned as an *APIError or *OAuthError.
+func (c *Client) do(ctx context.Context, r request) (*response, error) {
+	var body []byte
+	if r.body != nil {
+		var err error
+		body, err = json.Marshal(r.body)
+		if err != nil {
+			return nil, fmt.Errorf("error in json.Marshal: %w", err)
+		}
+	}
+	targetURL := c.opts.URL + r.path
+	if len(r.query) > 0 {
+		targetURL += "?" + r.query.Encode()
+	}
+	bearer := lo.FromPtrOr(r.bearer, c.opts.AdminKey)
+
+	var res *response
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Millisecond * 100
+	b.MaxElapsedTime = 0
+	maxRetries := lo.Ternary(r.idempotent, c.opts.MaxRetries, 0)
+	err := backoff.Retry(func() error {
+		tryCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+		req, err := http.NewRequestWithContext(tryCtx, r.method, targetURL, bytes.NewReader(body))
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("error in http.NewRequestWithContext: %w", err))
+		}
+		for key, vals := range r.header {
+			req.Header[key] = vals
+		}
+		if body != nil {
+			req.Header.Set("content-type", "application/json")
+		}
+		if bearer != "" {
+			req.Header.Set("Authorization", "Bearer "+bearer)
+		}
+
+		httpRes, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return backoff.Permanent(err)
+			}
+			return fmt.Errorf("error in httpClient.Do: %w", err)
+		}
+		defer httpRes.Body.Close()
+
+		resBytes, err := io.ReadAll(io.LimitReader(httpRes.Body, maxResponseBytes))
+		if err != nil {
+			return fmt.Errorf("error in io.ReadAll: %w", err)
+		}
+
+		// OAuth2 errors are JSON from the token endpoint, and redirects to the redirect URI with the error in the
+		// query from the authorize endpoint
+		oauthErr := parseOAuthErrorBody(httpRes.StatusCode, resBytes)
+		if oauthErr == nil {
+			oauthErr = parseOAuthError(httpRes.Header.Get("Location"))
+		}
+		if oauthErr != nil {
+			if oauthErr.Code == "server_error" || oauthErr.Code == "temporarily_unavailable" {
+				return oauthErr
+			}
+			return backoff.Permanent(oauthErr)
+		}
+		apiErr := &APIError{
+			StatusCode: httpRes.StatusCode,
+			Message:    string(resBytes),
+		}
+		if seconds, err := strconv.Atoi(httpRes.Header.Get("Retry-After")); err == nil {
+			apiErr.RetryAfter = time.Second * time.Duration(seconds)
+		}
+		switch {
+		case httpRes.StatusCode == http.StatusNotImplemented:
+			return backoff.Permanent(apiErr)
+		case httpRes.StatusCode >= 500:
+			return apiErr
+		case httpRes.StatusCode >= 400:
+			return backoff.Permanent(apiErr)
+		}
+
+		res = &response{
+			statusCode: httpRes.StatusCode,
+			header:     httpRes.Header,
+			body:       resBytes,
+		}
+		return nil
+	}, backoff.WithContext(backoff.WithMaxRetries(b, maxRetries), ctx))
+	return res, err
+}
+
+// doJSON sends the request and decodes the response into out, if it isn't nil
+func (c *Client) doJSON(ctx context.Context, r request, out any) error {
+	res, err := c.do(ctx, r)
+	if err != nil {
+		return err
+	}
+	if out == nil {
+		return nil
+	}
+	err = json.Unmarshal(res.body, out)
+	if err != nil {
+		return fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	return nil
+}
+
+// notFoundAs swaps ErrNotFound for a more specific error
+func notFoundAs(err, notFoundErr error) error {
+	if errors.Is(err, ErrNotFound) {
+		return notFoundErr
+	}
+	return err
+}
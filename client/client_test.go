@@ -0,0 +1,342 @@
+package client_test
+
+import (
+	"context"
+	"errors"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/client"
+	"github.com/danthegoodman1/GoAPITemplate/http_server"
+	"github.com/danthegoodman1/GoAPITemplate/provider_api"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/ratelimit"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/rs/zerolog"
+	"github.com/stretchr/testify/require"
+)
+
+var (
+	clientID     = "c1"
+	clientSecret = "s"
+	redirectURI  = "https://app.example.com/callback"
+)
+
+// testStore is the memory store, failing the next fail calls and making every client look suspended if suspended
+type testStore struct {
+	store.Store
+	calls     int64
+	fail      int64
+	suspended int32
+}
+
+func (s *testStore) Exec(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx store.Tx) error) error {
+	return s.ExecInTx(ctx, tryTimeout, f)
+}
+
+func (s *testStore) ExecInTx(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx store.Tx) error) error {
+	atomic.AddInt64(&s.calls, 1)
+	if atomic.AddInt64(&s.fail, -1) >= 0 {
+		return errors.New("database unavailable")
+	}
+	return s.Store.ExecInTx(ctx, tryTimeout, func(ctx context.Context, tx store.Tx) error {
+		return f(ctx, &testTx{Tx: tx, suspended: atomic.LoadInt32(&s.suspended) == 1})
+	})
+}
+
+// failNext makes the next n calls fail, and resets the call count
+func (s *testStore) failNext(n int64) {
+	atomic.StoreInt64(&s.fail, n)
+	atomic.StoreInt64(&s.calls, 0)
+}
+
+type testTx struct {
+	store.Tx
+	suspended bool
+}
+
+func (tx *testTx) SelectClient(ctx context.Context, arg query.SelectClientParams) (query.Client, error) {
+	client, err := tx.Tx.SelectClient(ctx, arg)
+	client.Suspended = client.Suspended || tx.suspended
+	return client, err
+}
+
+// newServer serves the OAuth2 and admin APIs from a memory store with clientID registered with redirectURI, opts
+// change the server's config
+func newServer(t *testing.T, opts ...func(cfg *http_server.Config)) (*testStore, *client.Client) {
+	st := &testStore{Store: store.NewMemory()}
+	cfg := http_server.Config{
+		Store: st,
+		UserExchanger: provider_api.UserExchangerFunc(func(ctx context.Context, authHeaderVal string) (*provider_api.ExchangeAuthForUserResponse, error) {
+			return &provider_api.ExchangeAuthForUserResponse{UserID: authHeaderVal}, nil
+		}),
+		AccessTokenTTL:  time.Hour,
+		RefreshTokenTTL: time.Hour * 24,
+		CodeTTL:         time.Minute,
+		AdminKey:        "admin",
+		Logger:          zerolog.Nop(),
+	}
+	for _, opt := range opts {
+		opt(&cfg)
+	}
+	srv := httptest.NewServer(http_server.NewHTTPServer(cfg).Echo)
+	t.Cleanup(srv.Close)
+
+	ctx := context.Background()
+	require.NoError(t, st.Exec(ctx, time.Second, func(ctx context.Context, tx store.Tx) error {
+		if _, err := tx.InsertClient(ctx, query.InsertClientParams{TenantID: store.DefaultTenantID, ID: clientID, Secret: clientSecret, Name: "test"}); err != nil {
+			return err
+		}
+		_, err := tx.UpsertScope(ctx, query.UpsertScopeParams{TenantID: store.DefaultTenantID, ID: "read"})
+		return err
+	}))
+	cw := client.NewClient(client.Options{URL: srv.URL, AdminKey: "admin", MaxRetries: 3})
+	_, err := cw.SetClientRedirectURIs(ctx, clientID, client.SetClientRedirectURIsRequest{RedirectURIs: []string{redirectURI}})
+	require.NoError(t, err)
+	return st, cw
+}
+
+func authorize(t *testing.T, cw *client.Client) string {
+	code, err := cw.Authorize(context.Background(), "u1", client.AuthorizeRequest{ClientID: clientID, RedirectURI: redirectURI, Scope: "read"})
+	require.NoError(t, err)
+	return code
+}
+
+func TestCodeFlow(t *testing.T) {
+	_, cw := newServer(t)
+	ctx := context.Background()
+
+	tokens, err := cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, authorize(t, cw))
+	require.NoError(t, err)
+	require.NotEmpty(t, tokens.RefreshToken)
+
+	refreshed, err := cw.RefreshToken(ctx, clientID, clientSecret, redirectURI, tokens.RefreshToken)
+	require.NoError(t, err)
+	require.NotEqual(t, tokens.RefreshToken, refreshed.RefreshToken)
+
+	// The redirect URI can be left out when the client has one
+	_, err = cw.Authorize(ctx, "u1", client.AuthorizeRequest{ClientID: clientID, Scope: "read"})
+	require.NoError(t, err)
+}
+
+func TestInvalidGrant(t *testing.T) {
+	_, cw := newServer(t)
+	ctx := context.Background()
+
+	code := authorize(t, cw)
+	_, err := cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, code)
+	require.NoError(t, err)
+	_, err = cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, code)
+	require.ErrorIs(t, err, client.ErrInvalidGrant)
+	var oauthErr *client.OAuthError
+	require.ErrorAs(t, err, &oauthErr)
+	require.Equal(t, "code not found", oauthErr.Description)
+
+	_, err = cw.RefreshToken(ctx, clientID, clientSecret, redirectURI, "r_made_up")
+	require.ErrorIs(t, err, client.ErrInvalidGrant)
+}
+
+func TestClientSuspended(t *testing.T) {
+	st, cw := newServer(t)
+	atomic.StoreInt32(&st.suspended, 1)
+	ctx := context.Background()
+
+	// Redirected, since the client and redirect URI check out
+	_, err := cw.Authorize(ctx, "u1", client.AuthorizeRequest{ClientID: clientID, RedirectURI: redirectURI, Scope: "read"})
+	require.ErrorIs(t, err, client.ErrClientSuspended)
+	require.ErrorIs(t, err, client.ErrAccessDenied)
+
+	// JSON
+	_, err = cw.ClientCredentials(ctx, clientID)
+	require.ErrorIs(t, err, client.ErrClientSuspended)
+}
+
+func TestAuthorizeDoesNotRedirectUnvalidated(t *testing.T) {
+	_, cw := newServer(t)
+	ctx := context.Background()
+
+	_, err := cw.Authorize(ctx, "u1", client.AuthorizeRequest{ClientID: "made_up", RedirectURI: "https://evil.example.com", Scope: "read"})
+	require.ErrorIs(t, err, client.ErrUnauthorizedClient)
+
+	_, err = cw.Authorize(ctx, "u1", client.AuthorizeRequest{ClientID: clientID, RedirectURI: "https://evil.example.com", Scope: "read"})
+	require.ErrorIs(t, err, client.ErrInvalidRequest)
+
+	_, err = cw.SetClientRedirectURIs(ctx, clientID, client.SetClientRedirectURIsRequest{RedirectURIs: []string{"/relative"}})
+	require.ErrorIs(t, err, client.ErrBadRequest)
+}
+
+func TestServerErrorNotRetried(t *testing.T) {
+	st, cw := newServer(t)
+	code := authorize(t, cw)
+
+	// Exchanging a code isn't safe to repeat
+	st.failNext(1)
+	_, err := cw.ExchangeCode(context.Background(), clientID, clientSecret, redirectURI, code)
+	require.ErrorIs(t, err, client.ErrServerError)
+	var oauthErr *client.OAuthError
+	require.ErrorAs(t, err, &oauthErr)
+	require.EqualValues(t, 1, atomic.LoadInt64(&st.calls))
+}
+
+func TestServerErrorRetried(t *testing.T) {
+	st, cw := newServer(t)
+	ctx := context.Background()
+	tokens, err := cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, authorize(t, cw))
+	require.NoError(t, err)
+
+	st.failNext(2)
+	claims, err := cw.UserInfo(ctx, tokens.AccessToken)
+	require.NoError(t, err)
+	require.Equal(t, "u1", claims["sub"])
+	require.EqualValues(t, 3, atomic.LoadInt64(&st.calls))
+
+	// 4xx aren't retried
+	st.failNext(0)
+	_, err = cw.GetClient(ctx, "made_up")
+	require.ErrorIs(t, err, client.ErrNotFound)
+	require.EqualValues(t, 1, atomic.LoadInt64(&st.calls))
+}
+
+func TestRateLimitChecksIPFirst(t *testing.T) {
+	st, cw := newServer(t, func(cfg *http_server.Config) {
+		cfg.RateLimiter = &ratelimit.Limiter{
+			Counters: ratelimit.NewMemory(),
+			IP:       ratelimit.PerMinute(1, 1),
+			Client:   ratelimit.PerMinute(600, 100),
+		}
+	})
+	ctx := context.Background()
+
+	// The IP's one token
+	st.failNext(0)
+	_, err := cw.ClientCredentials(ctx, clientID)
+	require.NoError(t, err)
+
+	// Refused without looking the client up
+	st.failNext(0)
+	_, err = cw.ClientCredentials(ctx, clientID)
+	require.ErrorIs(t, err, client.ErrRateLimited)
+	var apiErr *client.APIError
+	require.ErrorAs(t, err, &apiErr)
+	require.Greater(t, apiErr.RetryAfter, time.Duration(0))
+	require.Zero(t, atomic.LoadInt64(&st.calls))
+}
+
+func TestSuspendedClientCantRefresh(t *testing.T) {
+	_, cw := newServer(t)
+	ctx := context.Background()
+	tokens, err := cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, authorize(t, cw))
+	require.NoError(t, err)
+	code := authorize(t, cw)
+
+	// Without revoking the tokens
+	res, err := cw.SuspendClient(ctx, clientID, client.SuspendClientRequest{Suspended: true})
+	require.NoError(t, err)
+	require.True(t, res.Suspended)
+	require.Nil(t, res.RevokedTokens)
+	_, err = cw.RefreshToken(ctx, clientID, clientSecret, redirectURI, tokens.RefreshToken)
+	require.ErrorIs(t, err, client.ErrClientSuspended)
+	require.ErrorIs(t, err, client.ErrUnauthorizedClient)
+	_, err = cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, code)
+	require.ErrorIs(t, err, client.ErrClientSuspended)
+
+	// Neither was used up
+	_, err = cw.SuspendClient(ctx, clientID, client.SuspendClientRequest{Suspended: false})
+	require.NoError(t, err)
+	_, err = cw.RefreshToken(ctx, clientID, clientSecret, redirectURI, tokens.RefreshToken)
+	require.NoError(t, err)
+	_, err = cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, code)
+	require.NoError(t, err)
+}
+
+func TestCodeBoundToClient(t *testing.T) {
+	st, cw := newServer(t, func(cfg *http_server.Config) {
+		cfg.RateLimiter = &ratelimit.Limiter{
+			Counters: ratelimit.NewMemory(),
+			IP:       ratelimit.PerMinute(600, 100),
+			Client:   ratelimit.PerMinute(600, 100),
+			Lockout:  ratelimit.Lockout{Window: time.Minute, Duration: time.Hour, IPClientMaxFailures: 1},
+		}
+	})
+	ctx := context.Background()
+	require.NoError(t, st.Exec(ctx, time.Second, func(ctx context.Context, tx store.Tx) error {
+		_, err := tx.InsertClient(ctx, query.InsertClientParams{TenantID: store.DefaultTenantID, ID: "c2", Secret: clientSecret, Name: "other"})
+		return err
+	}))
+	code := authorize(t, cw)
+
+	_, err := cw.ExchangeCode(ctx, clientID, clientSecret, "https://evil.example.com", code)
+	require.ErrorIs(t, err, client.ErrInvalidGrant)
+	_, err = cw.ExchangeCode(ctx, "c2", clientSecret, redirectURI, code)
+	require.ErrorIs(t, err, client.ErrInvalidGrant)
+	tokens, err := cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, code)
+	require.NoError(t, err)
+
+	_, err = cw.RefreshToken(ctx, "c2", clientSecret, redirectURI, tokens.RefreshToken)
+	require.ErrorIs(t, err, client.ErrInvalidGrant)
+	// The mismatches count towards c2's lockout
+	_, err = cw.RefreshToken(ctx, "c2", clientSecret, redirectURI, tokens.RefreshToken)
+	require.ErrorIs(t, err, client.ErrRateLimited)
+}
+
+func TestClientSecret(t *testing.T) {
+	_, cw := newServer(t, func(cfg *http_server.Config) {
+		cfg.RateLimiter = &ratelimit.Limiter{
+			Counters: ratelimit.NewMemory(),
+			IP:       ratelimit.PerMinute(600, 100),
+			Client:   ratelimit.PerMinute(600, 100),
+			Lockout:  ratelimit.Lockout{Window: time.Minute, Duration: time.Hour, IPClientMaxFailures: 1},
+		}
+	})
+	ctx := context.Background()
+	code := authorize(t, cw)
+
+	_, err := cw.ExchangeCode(ctx, "made_up", clientSecret, redirectURI, code)
+	require.ErrorIs(t, err, client.ErrInvalidClient)
+	_, err = cw.ExchangeCode(ctx, clientID, "wrong", redirectURI, code)
+	require.ErrorIs(t, err, client.ErrInvalidClient)
+	// Guessing the secret locks the IP out of the client
+	_, err = cw.ExchangeCode(ctx, clientID, "wrong", redirectURI, code)
+	require.ErrorIs(t, err, client.ErrInvalidClient)
+	_, err = cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, code)
+	require.ErrorIs(t, err, client.ErrRateLimited)
+}
+
+func TestBulkRevoke(t *testing.T) {
+	_, cw := newServer(t)
+	ctx := context.Background()
+	tokens, err := cw.ExchangeCode(ctx, clientID, clientSecret, redirectURI, authorize(t, cw))
+	require.NoError(t, err)
+
+	res, err := cw.SuspendClient(ctx, clientID, client.SuspendClientRequest{Suspended: true, RevokeTokens: true})
+	require.NoError(t, err)
+	require.EqualValues(t, 1, res.RevokedTokens.AccessTokens)
+	require.EqualValues(t, 1, res.RevokedTokens.RefreshTokens)
+	_, err = cw.UserInfo(ctx, tokens.AccessToken)
+	require.ErrorIs(t, err, client.ErrInvalidToken)
+
+	revoked, err := cw.RevokeTokens(ctx, client.RevokeFilter{UserID: utils.Ptr("u1")})
+	require.NoError(t, err)
+	require.Zero(t, revoked.AccessTokens)
+}
+
+func TestPutScope(t *testing.T) {
+	_, cw := newServer(t)
+	ctx := context.Background()
+
+	_, err := cw.Authorize(ctx, "u1", client.AuthorizeRequest{ClientID: clientID, RedirectURI: redirectURI, Scope: "write"})
+	require.ErrorIs(t, err, client.ErrInvalidScope)
+
+	scope, err := cw.PutScope(ctx, "write", client.PutScopeRequest{Description: utils.Ptr("Write your pages")})
+	require.NoError(t, err)
+	require.Equal(t, "write", scope.ID)
+	require.Equal(t, "Write your pages", *scope.Description)
+	_, err = cw.Authorize(ctx, "u1", client.AuthorizeRequest{ClientID: clientID, RedirectURI: redirectURI, Scope: "write"})
+	require.NoError(t, err)
+
+	_, err = cw.PutScope(ctx, "read write", client.PutScopeRequest{})
+	require.ErrorIs(t, err, client.ErrBadRequest)
+}
@@ -0,0 +1,150 @@
+package client
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+var (
+	// Admin API errors, the *APIError returned can be matched with errors.Is
+
+	ErrBadRequest = errors.New("bad request")
+	// The admin key is missing, wrong, expired, or revoked
+	ErrUnauthorized = errors.New("unauthorized")
+	// The admin key doesn't have the endpoint's permission
+	ErrForbidden = errors.New("forbidden")
+	ErrNotFound  = errors.New("not found")
+	// The endpoint needs the postgres store
+	ErrNotImplemented = errors.New("not implemented")
+	ErrServerError    = errors.New("server error")
+	// Too many requests to the OAuth2 endpoints from this IP or client, or it's locked out after too many failures.
+	// APIError.RetryAfter says when to try again.
+	ErrRateLimited = errors.New("rate limited")
+
+	// The access token doesn't exist, expired, or was revoked
+	ErrInvalidToken = errors.New("invalid token")
+
+	// OAuth2 errors, the *OAuthError returned can be matched with errors.Is
+
+	ErrInvalidRequest = errors.New("invalid_request")
+	// The code or refresh token doesn't exist, expired, was already used, or was revoked
+	ErrInvalidGrant       = errors.New("invalid_grant")
+	ErrUnauthorizedClient = errors.New("unauthorized_client")
+	// The client secret is wrong, or the client doesn't exist
+	ErrInvalidClient           = errors.New("invalid_client")
+	ErrAccessDenied            = errors.New("access_denied")
+	ErrUnsupportedResponseType = errors.New("unsupported_response_type")
+	ErrInvalidScope            = errors.New("invalid_scope")
+	ErrTemporarilyUnavailable  = errors.New("temporarily_unavailable")
+	// The client is suspended, also matches ErrAccessDenied when authorizing and ErrUnauthorizedClient when exchanging a
+	// code or refreshing
+	ErrClientSuspended = errors.New("client suspended")
+
+	oauthErrors = map[string]error{
+		ErrInvalidRequest.Error():          ErrInvalidRequest,
+		ErrInvalidGrant.Error():            ErrInvalidGrant,
+		ErrUnauthorizedClient.Error():      ErrUnauthorizedClient,
+		ErrInvalidClient.Error():           ErrInvalidClient,
+		ErrAccessDenied.Error():            ErrAccessDenied,
+		ErrUnsupportedResponseType.Error(): ErrUnsupportedResponseType,
+		ErrInvalidScope.Error():            ErrInvalidScope,
+		"server_error":                     ErrServerError,
+		ErrTemporarilyUnavailable.Error():  ErrTemporarilyUnavailable,
+	}
+)
+
+// APIError is a non 2xx response from the admin API
+type APIError struct {
+	StatusCode int
+	Message    string
+	// From the Retry-After header of a 429
+	RetryAfter time.Duration
+}
+
+func (e *APIError) Error() string {
+	return fmt.Sprintf("%d - %s", e.StatusCode, e.Message)
+}
+
+func (e *APIError) Unwrap() error {
+	switch {
+	case e.StatusCode == http.StatusBadRequest:
+		return ErrBadRequest
+	case e.StatusCode == http.StatusUnauthorized:
+		return ErrUnauthorized
+	case e.StatusCode == http.StatusForbidden:
+		return ErrForbidden
+	case e.StatusCode == http.StatusNotFound:
+		return ErrNotFound
+	case e.StatusCode == http.StatusNotImplemented:
+		return ErrNotImplemented
+	case e.StatusCode == http.StatusTooManyRequests:
+		return ErrRateLimited
+	case e.StatusCode >= 500:
+		return ErrServerError
+	default:
+		return nil
+	}
+}
+
+// OAuthError is an RFC 6749 error from the OAuth2 endpoints
+type OAuthError struct {
+	// e.g. invalid_grant
+	Code        string
+	Description string
+}
+
+func (e *OAuthError) Error() string {
+	if e.Description == "" {
+		return e.Code
+	}
+	return fmt.Sprintf("%s: %s", e.Code, e.Description)
+}
+
+func (e *OAuthError) Is(target error) bool {
+	if target == ErrClientSuspended {
+		// What http_server returns for a suspended client
+		return (e.Code == ErrAccessDenied.Error() || e.Code == ErrUnauthorizedClient.Error()) && e.Description == "client suspended"
+	}
+	return oauthErrors[e.Code] == target
+}
+
+// parseOAuthError returns the error in a redirect location, or nil if there isn't one
+func parseOAuthError(location string) *OAuthError {
+	if location == "" {
+		return nil
+	}
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil
+	}
+	q := u.Query()
+	if q.Get("error") == "" {
+		return nil
+	}
+	return &OAuthError{
+		Code:        q.Get("error"),
+		Description: q.Get("error_description"),
+	}
+}
+
+// parseOAuthErrorBody returns the error in a 4xx or 5xx JSON body (RFC 6749 5.2), or nil if there isn't one
+func parseOAuthErrorBody(statusCode int, body []byte) *OAuthError {
+	if statusCode < 400 {
+		return nil
+	}
+	var res struct {
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &res); err != nil || res.Error == "" {
+		return nil
+	}
+	return &OAuthError{
+		Code:        res.Error,
+		Description: res.ErrorDescription,
+	}
+}
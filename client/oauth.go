@@ -0,0 +1,147 @@
+package client
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+
+	"github.com/samber/lo"
+)
+
+type (
+	AuthorizeRequest struct {
+		ClientID string `json:"client_id"`
+		// One of the client's registered redirect URIs, can be empty if it only has one
+		RedirectURI string `json:"redirect_uri"`
+		// Space separated
+		Scope string  `json:"scope"`
+		State *string `json:"state,omitempty"`
+	}
+
+	AccessTokenResponse struct {
+		AccessToken string `json:"access_token"`
+		// "bearer" or "mac"
+		TokenType    string `json:"token_type"`
+		ExpiresIn    int    `json:"expires_in"`
+		RefreshToken string `json:"refresh_token,omitempty"`
+	}
+
+	// accessTokenRequest is http_server.AccessTokenRequest, which binds the JSON body by field name
+	accessTokenRequest struct {
+		ClientID     string
+		RedirectURI  string
+		GrantType    string
+		RefreshToken *string `json:",omitempty"`
+		Code         *string `json:",omitempty"`
+	}
+
+	authorizeRequest struct {
+		ResponseType string `json:"response_type"`
+		AuthorizeRequest
+	}
+)
+
+// Authorize is called by the consent screen once the user consents. userAuth is forwarded to the provider as the
+// x-continuewith-user header to look the user up. Returns the authorization code for the client.
+func (c *Client) Authorize(ctx context.Context, userAuth string, req AuthorizeRequest) (string, error) {
+	res, err := c.do(ctx, request{
+		method: http.MethodPost,
+		path:   "/oauth2/authorize",
+		body: authorizeRequest{
+			ResponseType:     "code",
+			AuthorizeRequest: req,
+		},
+		bearer: lo.ToPtr(""),
+		header: http.Header{"X-Continuewith-User": {userAuth}},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	location, err := url.Parse(res.header.Get("Location"))
+	if err != nil {
+		return "", fmt.Errorf("error in url.Parse: %w", err)
+	}
+	code := location.Query().Get("code")
+	if code == "" {
+		return "", fmt.Errorf("no code in the redirect: %d - %s", res.statusCode, res.header.Get("Location"))
+	}
+	return code, nil
+}
+
+// ClientCredentials gets an access token for the client itself, not a user
+func (c *Client) ClientCredentials(ctx context.Context, clientID string) (*AccessTokenResponse, error) {
+	var res AccessTokenResponse
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/oauth2/authorize",
+		body: authorizeRequest{
+			ResponseType:     "client_credentials",
+			AuthorizeRequest: AuthorizeRequest{ClientID: clientID},
+		},
+		bearer: lo.ToPtr(""),
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ExchangeCode exchanges an authorization code for a token pair
+func (c *Client) ExchangeCode(ctx context.Context, clientID, clientSecret, redirectURI, code string) (*AccessTokenResponse, error) {
+	return c.token(ctx, clientSecret, accessTokenRequest{
+		ClientID:    clientID,
+		RedirectURI: redirectURI,
+		GrantType:   "authorization_code",
+		Code:        &code,
+	})
+}
+
+// RefreshToken gets a new access token and refresh token. The old refresh token is revoked, using it again revokes
+// the whole grant.
+func (c *Client) RefreshToken(ctx context.Context, clientID, clientSecret, redirectURI, refreshToken string) (*AccessTokenResponse, error) {
+	return c.token(ctx, clientSecret, accessTokenRequest{
+		ClientID:     clientID,
+		RedirectURI:  redirectURI,
+		GrantType:    "refresh_token",
+		RefreshToken: &refreshToken,
+	})
+}
+
+// token authenticates as the client with HTTP basic auth, the ID and secret are form encoded first (RFC 6749 2.3.1)
+func (c *Client) token(ctx context.Context, clientSecret string, req accessTokenRequest) (*AccessTokenResponse, error) {
+	var res AccessTokenResponse
+	basic := base64.StdEncoding.EncodeToString([]byte(url.QueryEscape(req.ClientID) + ":" + url.QueryEscape(clientSecret)))
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/oauth2/token",
+		body:   req,
+		bearer: lo.ToPtr(""),
+		header: http.Header{"Authorization": {"Basic " + basic}},
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// UserInfo returns the claims of the access token's user, with their ID as sub
+func (c *Client) UserInfo(ctx context.Context, accessToken string) (map[string]any, error) {
+	claims := map[string]any{}
+	err := c.doJSON(ctx, request{
+		method:     http.MethodGet,
+		path:       "/oauth2/userinfo",
+		bearer:     &accessToken,
+		idempotent: true,
+	}, &claims)
+	if errors.Is(err, ErrUnauthorized) {
+		return nil, ErrInvalidToken
+	}
+	if err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
@@ -0,0 +1,135 @@
+package client
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+)
+
+type (
+	CreateWebhookSubscriptionRequest struct {
+		URL        string   `json:"url"`
+		EventTypes []string `json:"event_types"`
+	}
+
+	WebhookSubscriptionResponse struct {
+		ID         string
+		URL        string
+		EventTypes []string
+		Disabled   bool
+		Created    time.Time
+		Updated    time.Time
+	}
+
+	CreateWebhookSubscriptionResponse struct {
+		WebhookSubscriptionResponse
+		// Only returned on creation, used to verify the signature header
+		Secret string
+	}
+)
+
+// CreateWebhookSubscription needs webhooks:write and the postgres store
+func (c *Client) CreateWebhookSubscription(ctx context.Context, req CreateWebhookSubscriptionRequest) (*CreateWebhookSubscriptionResponse, error) {
+	var res CreateWebhookSubscriptionResponse
+	err := c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/webhooks",
+		body:   req,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ListWebhookSubscriptions needs webhooks:read and the postgres store
+func (c *Client) ListWebhookSubscriptions(ctx context.Context) ([]WebhookSubscriptionResponse, error) {
+	var res []WebhookSubscriptionResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodGet,
+		path:       "/admin/webhooks",
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// DeleteWebhookSubscription needs webhooks:write and the postgres store
+func (c *Client) DeleteWebhookSubscription(ctx context.Context, subscriptionID string) error {
+	return c.doJSON(ctx, request{
+		method:     http.MethodDelete,
+		path:       "/admin/webhooks/" + url.PathEscape(subscriptionID),
+		idempotent: true,
+	}, nil)
+}
+
+type (
+	// ListWebhookDeliveriesRequest filters are all optional
+	ListWebhookDeliveriesRequest struct {
+		// pending, delivered, or failed
+		Status         *string
+		SubscriptionID *string
+		// NextBeforeID of the previous page
+		BeforeID *string
+		// Default 100, max 1000
+		Limit int32
+	}
+
+	WebhookDeliveryResponse struct {
+		ID             string
+		SubscriptionID string
+		EventID        string
+		EventType      string
+		Payload        json.RawMessage
+		Status         string
+		Attempts       int64
+		NextAttempt    time.Time
+		LastStatusCode *int64
+		LastError      *string
+		Delivered      *time.Time
+		Created        time.Time
+		Updated        time.Time
+	}
+
+	ListWebhookDeliveriesResponse struct {
+		Deliveries []WebhookDeliveryResponse
+		// Pass as BeforeID to get the next page, nil on the last page
+		NextBeforeID *string `json:",omitempty"`
+	}
+)
+
+// ListWebhookDeliveries needs webhooks:read and the postgres store
+func (c *Client) ListWebhookDeliveries(ctx context.Context, req ListWebhookDeliveriesRequest) (*ListWebhookDeliveriesResponse, error) {
+	q := url.Values{}
+	setQuery(q, "status", req.Status)
+	setQuery(q, "subscription_id", req.SubscriptionID)
+	setQuery(q, "before_id", req.BeforeID)
+	if req.Limit != 0 {
+		q.Set("limit", fmt.Sprint(req.Limit))
+	}
+
+	var res ListWebhookDeliveriesResponse
+	err := c.doJSON(ctx, request{
+		method:     http.MethodGet,
+		path:       "/admin/webhooks/deliveries",
+		query:      q,
+		idempotent: true,
+	}, &res)
+	if err != nil {
+		return nil, err
+	}
+	return &res, nil
+}
+
+// ReplayWebhookDelivery sends a delivery again with a fresh set of attempts. Needs webhooks:write and the postgres store.
+func (c *Client) ReplayWebhookDelivery(ctx context.Context, deliveryID string) error {
+	return c.doJSON(ctx, request{
+		method: http.MethodPost,
+		path:   "/admin/webhooks/deliveries/" + url.PathEscape(deliveryID) + "/replay",
+	}, nil)
+}
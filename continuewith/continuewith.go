@@ -0,0 +1,114 @@
+// Package continuewith embeds the ContinueWith OAuth2 endpoints in another Go server.
+//
+//	handler, err := continuewith.New(continuewith.Options{
+//		Store:         store.NewMemory(),
+//		UserExchanger: provider_api.UserExchangerFunc(lookupUser),
+//	})
+//	mux.Handle("/oauth/", http.StripPrefix("/oauth", handler))
+//
+// Nothing is read from the environment, and there are no background jobs. The admin API is served too, but admin keys
+// (other than AdminKey), the audit log, and webhooks need a migrated Postgres or CRDB Pool and return 501 without
+// one. Webhooks are only delivered and the audit log only written by the full server.
+package continuewith
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/http_server"
+	"github.com/danthegoodman1/GoAPITemplate/provider_api"
+	"github.com/danthegoodman1/GoAPITemplate/ratelimit"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/rs/zerolog"
+)
+
+var (
+	ErrMissingStore         = errors.New("missing Store")
+	ErrMissingUserExchanger = errors.New("missing UserExchanger")
+
+	DefaultAccessTokenTTL  = time.Hour
+	DefaultRefreshTokenTTL = time.Hour * 12
+	DefaultCodeTTL         = time.Minute * 10
+)
+
+type Options struct {
+	// Where clients, scopes, codes, tokens, and consents are kept. Required.
+	Store store.Store
+	// Looks up the user from the x-continuewith-user header when they consent. Required.
+	// Use a provider_api.Client to call the provider over HTTP, or a provider_api.UserExchangerFunc to look the user up directly.
+	UserExchanger provider_api.UserExchanger
+	// Can deny or customize grants before they're issued. Optional.
+	PreIssuanceHook provider_api.PreIssuanceHook
+	// A database migrated with the migrations package, for the admin routes that need it. Optional, usually the same
+	// pool as a store.NewPostgres Store.
+	Pool *pgxpool.Pool
+
+	// Default DefaultAccessTokenTTL
+	AccessTokenTTL time.Duration
+	// Default DefaultRefreshTokenTTL
+	RefreshTokenTTL time.Duration
+	// Refresh tokens unused for this long expire, the default 0 disables it. Each refresh pushes the expiry back, up
+	// to RefreshTokenTTL after the grant.
+	RefreshTokenIdleTTL time.Duration
+	// How long an authorization code can be exchanged, default DefaultCodeTTL
+	CodeTTL time.Duration
+
+	// Bearer key for the admin API. Optional, the admin API rejects everything without it.
+	AdminKey string
+	// Returned as iss from introspection and userinfo. Optional.
+	Issuer string
+
+	// Throttles /oauth2/authorize and /oauth2/token, e.g. with ratelimit.NewMemory() counters. Optional.
+	RateLimiter *ratelimit.Limiter
+	// X-Forwarded-For is only believed from these proxies, and private and loopback addresses
+	TrustedProxies []*net.IPNet
+
+	// Default is the gologger logger
+	Logger *zerolog.Logger
+}
+
+// New returns the OAuth2 (/oauth2/...) and admin (/admin/...) endpoints as an http.Handler
+func New(opts Options) (http.Handler, error) {
+	if opts.Store == nil {
+		return nil, ErrMissingStore
+	}
+	if opts.UserExchanger == nil {
+		return nil, ErrMissingUserExchanger
+	}
+
+	cfg := http_server.Config{
+		Store:           opts.Store,
+		UserExchanger:   opts.UserExchanger,
+		PreIssuanceHook: opts.PreIssuanceHook,
+		Pool:            opts.Pool,
+		AccessTokenTTL:  opts.AccessTokenTTL,
+		RefreshTokenTTL: opts.RefreshTokenTTL,
+		CodeTTL:         opts.CodeTTL,
+
+		RefreshTokenIdleTTL: opts.RefreshTokenIdleTTL,
+		AdminKey:            opts.AdminKey,
+		Issuer:              opts.Issuer,
+		RateLimiter:         opts.RateLimiter,
+		TrustedProxies:      opts.TrustedProxies,
+	}
+	if cfg.AccessTokenTTL == 0 {
+		cfg.AccessTokenTTL = DefaultAccessTokenTTL
+	}
+	if cfg.RefreshTokenTTL == 0 {
+		cfg.RefreshTokenTTL = DefaultRefreshTokenTTL
+	}
+	if cfg.CodeTTL == 0 {
+		cfg.CodeTTL = DefaultCodeTTL
+	}
+	if opts.Logger != nil {
+		cfg.Logger = *opts.Logger
+	} else {
+		cfg.Logger = gologger.NewLogger()
+	}
+
+	return http_server.NewHTTPServer(cfg).Echo, nil
+}
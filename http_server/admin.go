@@ -2,46 +2,109 @@ package http_server
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/danthegoodman1/GoAPITemplate/pg"
+	"github.com/danthegoodman1/GoAPITemplate/audit"
+	"github.com/danthegoodman1/GoAPITemplate/observability"
 	"github.com/danthegoodman1/GoAPITemplate/query"
-	"github.com/jackc/pgx/v5"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/tenants"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/danthegoodman1/GoAPITemplate/workflows"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
 type VerifyAccessTokenResponse struct {
 	UserID               string
 	CreatedMS, ExpiresMS int64
-	Scopes               []string
+	// The previous time the token was introspected or used for userinfo, to the minute. 0 if it never was.
+	LastUsedMS int64 `json:",omitempty"`
+	Scopes     []string
+	// Profile and custom claims from the provider exchange
+	Claims json.RawMessage `json:",omitempty"`
+	// The tenant's issuer, omitted if there isn't one
+	Issuer string `json:",omitempty"`
 }
 
 func (s *HTTPServer) CheckAccessToken(c *CustomContext) error {
 	ctx := c.Request().Context()
 	accessTokenID := c.Param("accessToken")
 
-	var accessToken query.AccessToken
-	err := query.ReliableExec(ctx, pg.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
-		accessToken, err = q.SelectValidAccessToken(ctx, accessTokenID)
-		if err != nil {
-			return fmt.Errorf("error in SelectValidAccessToken: %w", err)
-		}
-		return nil
-	})
-	if errors.Is(err, pgx.ErrNoRows) {
+	accessToken, err := s.validAccessToken(ctx, c.Tenant.ID, accessTokenID)
+	if errors.Is(err, store.ErrNotFound) {
+		observability.RecordIntrospection(false)
 		return c.String(http.StatusNotFound, "no code found")
 	}
 	if err != nil {
-		c.InternalError(err, "error getting access token")
+		return c.InternalError(err, "error getting access token")
 	}
+	observability.RecordIntrospection(true)
+
+	return c.JSON(http.StatusOK, verifyAccessTokenResponse(c.Tenant, accessToken))
+}
 
-	return c.JSON(http.StatusOK, VerifyAccessTokenResponse{
+func verifyAccessTokenResponse(tenant *tenants.Tenant, accessToken query.AccessToken) VerifyAccessTokenResponse {
+	res := VerifyAccessTokenResponse{
+		Issuer:    tenant.Issuer,
 		UserID:    accessToken.UserID,
 		CreatedMS: accessToken.Created.UnixMilli(),
 		ExpiresMS: accessToken.Expires.UnixMilli(),
 		Scopes:    accessToken.Scopes,
-	})
+		Claims:    accessToken.Claims,
+	}
+	if accessToken.LastUsed != nil {
+		res.LastUsedMS = accessToken.LastUsed.UnixMilli()
+	}
+	return res
+}
+
+type (
+	BatchCheckAccessTokensRequest struct {
+		AccessTokens []string `json:"access_tokens" validate:"required,min=1,max=100,dive,required"`
+	}
+
+	BatchCheckAccessTokensResponse struct {
+		// Every requested token, null if it isn't valid
+		AccessTokens map[string]*VerifyAccessTokenResponse
+	}
+)
+
+// BatchCheckAccessTokens introspects up to 100 access tokens at once
+func (s *HTTPServer) BatchCheckAccessTokens(c *CustomContext) error {
+	ctx := c.Request().Context()
+	var reqBody BatchCheckAccessTokensRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	accessTokens, err := s.validAccessTokens(ctx, c.Tenant.ID, reqBody.AccessTokens)
+	if err != nil {
+		return c.InternalError(err, "error getting access tokens")
+	}
+
+	res := BatchCheckAccessTokensResponse{
+		AccessTokens: map[string]*VerifyAccessTokenResponse{},
+	}
+	for _, id := range reqBody.AccessTokens {
+		if _, ok := res.AccessTokens[id]; ok {
+			continue
+		}
+		var info *VerifyAccessTokenResponse
+		accessToken, ok := accessTokens[id]
+		if ok {
+			info = utils.Ptr(verifyAccessTokenResponse(c.Tenant, accessToken))
+		}
+		observability.RecordIntrospection(ok)
+		res.AccessTokens[id] = info
+	}
+	return c.JSON(http.StatusOK, res)
 }
 
 type ClientResponse struct {
@@ -50,6 +113,35 @@ type ClientResponse struct {
 	Name      string
 	Created   time.Time
 	Updated   time.Time
+
+	// Nil when the client uses the server's default
+	AccessTokenTTLSeconds  *int64
+	RefreshTokenTTLSeconds *int64
+	// Nil when refresh tokens have no idle timeout
+	RefreshTokenIdleSeconds *int64
+	RefreshTokenPolicy      string
+	// Nil when the client uses the server's default
+	RateLimitPerMinute *int64
+	RateLimitBurst     *int64
+	// Where /oauth2/authorize can redirect to
+	RedirectURIs []string
+}
+
+func clientResponse(client query.Client) ClientResponse {
+	return ClientResponse{
+		ID:                      client.ID,
+		Suspended:               client.Suspended,
+		Name:                    client.Name,
+		Created:                 client.Created,
+		Updated:                 client.Updated,
+		AccessTokenTTLSeconds:   client.AccessTokenTtlSeconds,
+		RefreshTokenTTLSeconds:  client.RefreshTokenTtlSeconds,
+		RefreshTokenIdleSeconds: client.RefreshTokenIdleSeconds,
+		RefreshTokenPolicy:      client.RefreshTokenPolicy,
+		RateLimitPerMinute:      client.RateLimitPerMinute,
+		RateLimitBurst:          client.RateLimitBurst,
+		RedirectURIs:            client.RedirectUris,
+	}
 }
 
 func (s *HTTPServer) GetClientFromID(c *CustomContext) error {
@@ -57,25 +149,396 @@ func (s *HTTPServer) GetClientFromID(c *CustomContext) error {
 	clientID := c.Param("clientID")
 
 	var client query.Client
-	err := query.ReliableExec(ctx, pg.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
-		client, err = q.SelectClient(ctx, clientID)
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: c.Tenant.ID,
+			ID:       clientID,
+		})
 		if err != nil {
 			return fmt.Errorf("error in SelectClient: %w", err)
 		}
 		return nil
 	})
-	if errors.Is(err, pgx.ErrNoRows) {
+	if errors.Is(err, store.ErrNotFound) {
+		return c.String(http.StatusNotFound, "client not found")
+	}
+	if err != nil {
+		return c.InternalError(err, "error getting client")
+	}
+
+	return c.JSON(http.StatusOK, clientResponse(client))
+}
+
+type SetClientTokenPolicyRequest struct {
+	// Null uses the server's default
+	AccessTokenTTLSeconds  *int64 `json:"access_token_ttl_seconds" validate:"omitempty,min=1"`
+	RefreshTokenTTLSeconds *int64 `json:"refresh_token_ttl_seconds" validate:"omitempty,min=1"`
+	// Null disables the idle timeout
+	RefreshTokenIdleSeconds *int64 `json:"refresh_token_idle_seconds" validate:"omitempty,min=1"`
+	// always, offline_access, or never
+	RefreshTokenPolicy string `json:"refresh_token_policy" validate:"required,oneof=always offline_access never"`
+}
+
+// SetClientTokenPolicy replaces the client's token lifetimes and refresh token policy. Existing tokens keep their
+// expiry, but refreshes follow the new policy.
+func (s *HTTPServer) SetClientTokenPolicy(c *CustomContext) error {
+	ctx := c.Request().Context()
+	clientID := c.Param("clientID")
+	var reqBody SetClientTokenPolicyRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	var client query.Client
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.UpdateClientTokenPolicy(ctx, query.UpdateClientTokenPolicyParams{
+			TenantID:                c.Tenant.ID,
+			AccessTokenTtlSeconds:   reqBody.AccessTokenTTLSeconds,
+			RefreshTokenTtlSeconds:  reqBody.RefreshTokenTTLSeconds,
+			RefreshTokenIdleSeconds: reqBody.RefreshTokenIdleSeconds,
+			RefreshTokenPolicy:      reqBody.RefreshTokenPolicy,
+			ID:                      clientID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpdateClientTokenPolicy: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
 		return c.String(http.StatusNotFound, "client not found")
 	}
 	if err != nil {
-		c.InternalError(err, "error getting client")
+		return c.InternalError(err, "error updating client")
+	}
+
+	event := c.auditEvent(audit.EventClientTokenPolicyUpdated)
+	event.ClientID = utils.Ptr(clientID)
+	event.Details = tokenPolicyDetails(client)
+	if err := c.recordAudit(event); err != nil {
+		return c.InternalError(err, "error recording audit event")
+	}
+
+	return c.JSON(http.StatusOK, clientResponse(client))
+}
+
+// tokenPolicyDetails is the client's token policy for the audit log, unset lifetimes are left out
+func tokenPolicyDetails(client query.Client) map[string]string {
+	details := map[string]string{
+		"refresh_token_policy": client.RefreshTokenPolicy,
+	}
+	if client.AccessTokenTtlSeconds != nil {
+		details["access_token_ttl_seconds"] = fmt.Sprint(*client.AccessTokenTtlSeconds)
+	}
+	if client.RefreshTokenTtlSeconds != nil {
+		details["refresh_token_ttl_seconds"] = fmt.Sprint(*client.RefreshTokenTtlSeconds)
+	}
+	if client.RefreshTokenIdleSeconds != nil {
+		details["refresh_token_idle_seconds"] = fmt.Sprint(*client.RefreshTokenIdleSeconds)
+	}
+	return details
+}
+
+type SetClientRateLimitRequest struct {
+	// Requests a minute to /oauth2/authorize and /oauth2/token, null uses the server's default
+	PerMinute *int64 `json:"per_minute" validate:"omitempty,min=1"`
+	// Null uses the server's default
+	Burst *int64 `json:"burst" validate:"omitempty,min=1"`
+}
+
+// SetClientRateLimit replaces the client's rate limit, it applies from the next request
+func (s *HTTPServer) SetClientRateLimit(c *CustomContext) error {
+	ctx := c.Request().Context()
+	clientID := c.Param("clientID")
+	var reqBody SetClientRateLimitRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	var client query.Client
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.UpdateClientRateLimit(ctx, query.UpdateClientRateLimitParams{
+			TenantID:           c.Tenant.ID,
+			RateLimitPerMinute: reqBody.PerMinute,
+			RateLimitBurst:     reqBody.Burst,
+			ID:                 clientID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpdateClientRateLimit: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return c.String(http.StatusNotFound, "client not found")
+	}
+	if err != nil {
+		return c.InternalError(err, "error updating client")
+	}
+
+	event := c.auditEvent(audit.EventClientRateLimitUpdated)
+	event.ClientID = utils.Ptr(clientID)
+	event.Details = map[string]string{}
+	if client.RateLimitPerMinute != nil {
+		event.Details["per_minute"] = fmt.Sprint(*client.RateLimitPerMinute)
+	}
+	if client.RateLimitBurst != nil {
+		event.Details["burst"] = fmt.Sprint(*client.RateLimitBurst)
+	}
+	if err := c.recordAudit(event); err != nil {
+		return c.InternalError(err, "error recording audit event")
+	}
+
+	return c.JSON(http.StatusOK, clientResponse(client))
+}
+
+type SetClientRedirectURIsRequest struct {
+	// Absolute URIs without a fragment, compared exactly. Empty stops the client from getting codes.
+	RedirectURIs []string `json:"redirect_uris" validate:"max=20"`
+}
+
+// SetClientRedirectURIs replaces where /oauth2/authorize can send the client's users back to
+func (s *HTTPServer) SetClientRedirectURIs(c *CustomContext) error {
+	ctx := c.Request().Context()
+	clientID := c.Param("clientID")
+	var reqBody SetClientRedirectURIsRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	for _, redirectURI := range reqBody.RedirectURIs {
+		if err := utils.ValidateRedirectURI(redirectURI); err != nil {
+			return c.String(http.StatusBadRequest, err.Error())
+		}
+	}
+
+	var client query.Client
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.UpdateClientRedirectURIs(ctx, query.UpdateClientRedirectURIsParams{
+			TenantID:     c.Tenant.ID,
+			RedirectUris: lo.Uniq(reqBody.RedirectURIs),
+			ID:           clientID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpdateClientRedirectURIs: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return c.String(http.StatusNotFound, "client not found")
+	}
+	if err != nil {
+		return c.InternalError(err, "error updating client")
+	}
+
+	event := c.auditEvent(audit.EventClientRedirectURIsUpdated)
+	event.ClientID = utils.Ptr(clientID)
+	event.Details = map[string]string{
+		"redirect_uris": strings.Join(client.RedirectUris, " "),
+	}
+	if err := c.recordAudit(event); err != nil {
+		return c.InternalError(err, "error recording audit event")
+	}
+
+	return c.JSON(http.StatusOK, clientResponse(client))
+}
+
+type (
+	PutScopeRequest struct {
+		// Shown on the consent screen
+		Description *string `json:"description"`
+	}
+
+	ScopeResponse struct {
+		ID          string
+		Description *string
+		Created     time.Time
+		Updated     time.Time
+	}
+)
+
+// PutScope creates the scope or updates its description
+func (s *HTTPServer) PutScope(c *CustomContext) error {
+	ctx := c.Request().Context()
+	scopeID := c.Param("scopeID")
+	var reqBody PutScopeRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	// Scopes are requested space separated
+	if strings.ContainsAny(scopeID, " \t\n") {
+		return c.String(http.StatusBadRequest, "scope IDs can't contain whitespace")
+	}
+
+	var scope query.Scope
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		scope, err = tx.UpsertScope(ctx, query.UpsertScopeParams{
+			TenantID:    c.Tenant.ID,
+			ID:          scopeID,
+			Description: reqBody.Description,
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpsertScope: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error upserting scope")
+	}
+
+	return c.JSON(http.StatusOK, ScopeResponse{
+		ID:          scope.ID,
+		Description: scope.Description,
+		Created:     scope.Created,
+		Updated:     scope.Updated,
+	})
+}
+
+type (
+	RevokeTokensResponse = revocation.Result
+
+	BulkRevokeWorkflowResponse struct {
+		WorkflowID string
+		RunID      string
+	}
+)
+
+// bulkRevoke revokes in the request, or with ?async=true starts a BulkRevokeWorkflow and returns its ID
+func (s *HTTPServer) bulkRevoke(c *CustomContext, filter revocation.Filter) error {
+	ctx := c.Request().Context()
+	filter.TenantID = c.Tenant.ID
+	event := c.auditEvent(audit.EventTokenRevoked)
+	event.UserID = filter.UserID
+	event.ClientID = filter.ClientID
+	event.Details = map[string]string{}
+	if filter.Before != nil {
+		event.Details["before"] = filter.Before.Format(time.RFC3339Nano)
+	}
+
+	if async, _ := strconv.ParseBool(c.QueryParam("async")); async {
+		if s.Temporal == nil {
+			return c.String(http.StatusBadRequest, "async revocation requires temporal, set TEMPORAL_HOST_PORT")
+		}
+		run, err := s.Temporal.StartWorkflow(ctx, utils.GenKSortedID("revoke_"), workflows.BulkRevokeWorkflow, filter)
+		if err != nil {
+			return c.InternalError(err, "error starting revocation workflow")
+		}
+		event.Details["workflow_id"] = run.GetID()
+		if err := c.recordAudit(event); err != nil {
+			return c.InternalError(err, "error recording audit event")
+		}
+		return c.JSON(http.StatusAccepted, BulkRevokeWorkflowResponse{
+			WorkflowID: run.GetID(),
+			RunID:      run.GetRunID(),
+		})
+	}
+
+	var res RevokeTokensResponse
+	err := s.Store.ExecInTx(ctx, time.Second*20, func(ctx context.Context, tx store.Tx) (err error) {
+		res, err = revocation.Revoke(ctx, tx, filter)
+		return
+	})
+	if err != nil {
+		return c.InternalError(err, "error revoking tokens")
+	}
+	s.revoked(ctx, filter.Notice())
+
+	zerolog.Ctx(ctx).Warn().Interface("filter", filter).Int64("accessTokens", res.AccessTokens).Int64("refreshTokens", res.RefreshTokens).Msg("revoked tokens")
+	for k, v := range revokeDetails(res) {
+		event.Details[k] = v
+	}
+	if err := c.recordAudit(event); err != nil {
+		return c.InternalError(err, "error recording audit event")
+	}
+	return c.JSON(http.StatusOK, res)
+}
+
+func (s *HTTPServer) RevokeUserTokens(c *CustomContext) error {
+	return s.bulkRevoke(c, revocation.Filter{UserID: utils.Ptr(c.Param("userID"))})
+}
+
+func (s *HTTPServer) RevokeClientTokens(c *CustomContext) error {
+	return s.bulkRevoke(c, revocation.Filter{ClientID: utils.Ptr(c.Param("clientID"))})
+}
+
+type RevokeTokensBeforeRequest struct {
+	// Tokens created before this time are revoked
+	Before time.Time `json:"before" validate:"required"`
+}
+
+func (s *HTTPServer) RevokeTokensBefore(c *CustomContext) error {
+	var reqBody RevokeTokensBeforeRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	return s.bulkRevoke(c, revocation.Filter{Before: utils.Ptr(reqBody.Before)})
+}
+
+type (
+	SuspendClientRequest struct {
+		Suspended bool `json:"suspended"`
+		// Also revoke all of the client's tokens, only used when suspending
+		RevokeTokens bool `json:"revoke_tokens"`
+	}
+
+	SuspendClientResponse struct {
+		ClientResponse
+		RevokedTokens *RevokeTokensResponse `json:",omitempty"`
+	}
+)
+
+func (s *HTTPServer) SuspendClient(c *CustomContext) error {
+	ctx := c.Request().Context()
+	clientID := c.Param("clientID")
+	var reqBody SuspendClientRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	var client query.Client
+	var revoked *RevokeTokensResponse
+	err := s.Store.ExecInTx(ctx, time.Second*20, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.UpdateClientSuspended(ctx, query.UpdateClientSuspendedParams{
+			TenantID:  c.Tenant.ID,
+			ID:        clientID,
+			Suspended: reqBody.Suspended,
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpdateClientSuspended: %w", err)
+		}
+
+		if reqBody.Suspended && reqBody.RevokeTokens {
+			res, err := revocation.Revoke(ctx, tx, revocation.Filter{TenantID: c.Tenant.ID, ClientID: utils.Ptr(clientID)})
+			if err != nil {
+				return err
+			}
+			revoked = &res
+		}
+		return nil
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return c.String(http.StatusNotFound, "client not found")
+	}
+	if err != nil {
+		return c.InternalError(err, "error updating client")
+	}
+	if revoked != nil {
+		s.revoked(ctx, revocation.Notice{TenantID: c.Tenant.ID, ClientID: utils.Ptr(clientID)})
+	}
+
+	event := c.auditEvent(audit.EventClientSuspended)
+	event.ClientID = utils.Ptr(clientID)
+	event.Details = map[string]string{
+		"suspended": fmt.Sprint(client.Suspended),
+	}
+	if revoked != nil {
+		for k, v := range revokeDetails(*revoked) {
+			event.Details[k] = v
+		}
+	}
+	if err := c.recordAudit(event); err != nil {
+		return c.InternalError(err, "error recording audit event")
 	}
 
-	return c.JSON(http.StatusOK, ClientResponse{
-		ID:        client.ID,
-		Suspended: client.Suspended,
-		Name:      client.Name,
-		Created:   client.Created,
-		Updated:   client.Updated,
+	return c.JSON(http.StatusOK, SuspendClientResponse{
+		ClientResponse: clientResponse(client),
+		RevokedTokens:  revoked,
 	})
 }
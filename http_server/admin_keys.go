@@ -0,0 +1,387 @@
+package http_server
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/audit"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/danthegoodman1/GoAPITemplate/workflows"
+	"github.com/jackc/pgx/v5"
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+var (
+	PermTokensIntrospect = "tokens:introspect"
+	PermTokensRevoke     = "tokens:revoke"
+	PermClientsRead      = "clients:read"
+	PermClientsWrite     = "clients:write"
+	PermScopesWrite      = "scopes:write"
+	PermAdminKeysRead    = "admin_keys:read"
+	PermAdminKeysWrite   = "admin_keys:write"
+	PermAuditRead        = "audit:read"
+	PermWebhooksRead     = "webhooks:read"
+	PermWebhooksWrite    = "webhooks:write"
+
+	AdminPermissions = []string{
+		PermTokensIntrospect,
+		PermTokensRevoke,
+		PermClientsRead,
+		PermClientsWrite,
+		PermScopesWrite,
+		PermAdminKeysRead,
+		PermAdminKeysWrite,
+		PermAuditRead,
+		PermWebhooksRead,
+		PermWebhooksWrite,
+	}
+
+	// The ADMIN_KEY env var, has every permission for every tenant and is used to bootstrap scoped keys
+	EnvAdminKeyID = "_env"
+)
+
+func parseBearerToken(header string) (string, bool) {
+	if len(header) <= len("bearer ") || !strings.EqualFold(header[:len("bearer ")], "bearer ") {
+		return "", false
+	}
+	return header[len("bearer "):], true
+}
+
+// AdminMiddleware authenticates the admin key, use RequirePermission on routes to authorize it. Stored keys only work
+// for their own tenant.
+func (s *HTTPServer) AdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		cc := c.(*CustomContext)
+		ctx := c.Request().Context()
+		key, ok := parseBearerToken(c.Request().Header.Get("Authorization"))
+		if !ok {
+			return c.String(http.StatusUnauthorized, "invalid auth header")
+		}
+
+		if s.AdminKey != "" && subtle.ConstantTimeCompare([]byte(key), []byte(s.AdminKey)) == 1 {
+			cc.AdminKeyID = EnvAdminKeyID
+			cc.AdminPermissions = AdminPermissions
+			if err := auditAdminKeyUsed(cc); err != nil {
+				return cc.InternalError(err, "error recording audit event")
+			}
+			return next(c)
+		}
+
+		// Without postgres there are no stored keys, only ADMIN_KEY
+		if s.Pool == nil {
+			return c.String(http.StatusUnauthorized, "invalid auth header")
+		}
+
+		var adminKey query.AdminKey
+		err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+			adminKey, err = q.SelectValidAdminKeyByHash(ctx, query.SelectValidAdminKeyByHashParams{
+				TenantID: cc.Tenant.ID,
+				KeyHash:  utils.SHA256Hex(key),
+			})
+			if err != nil {
+				return fmt.Errorf("error in SelectValidAdminKeyByHash: %w", err)
+			}
+			err = q.UpdateAdminKeyLastUsed(ctx, query.UpdateAdminKeyLastUsedParams{
+				TenantID: adminKey.TenantID,
+				ID:       adminKey.ID,
+			})
+			if err != nil {
+				return fmt.Errorf("error in UpdateAdminKeyLastUsed: %w", err)
+			}
+			return nil
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			return c.String(http.StatusUnauthorized, "invalid auth header")
+		}
+		if err != nil {
+			return cc.InternalError(err, "error getting admin key")
+		}
+
+		cc.AdminKeyID = adminKey.ID
+		cc.AdminPermissions = adminKey.Permissions
+		zerolog.Ctx(ctx).UpdateContext(func(c zerolog.Context) zerolog.Context {
+			return c.Str("adminKeyID", adminKey.ID)
+		})
+		if err := auditAdminKeyUsed(cc); err != nil {
+			return cc.InternalError(err, "error recording audit event")
+		}
+		return next(c)
+	}
+}
+
+// auditAdminKeyUsed records writes only, reads like introspection are far too hot and are covered by last_used
+func auditAdminKeyUsed(c *CustomContext) error {
+	if c.Request().Method == http.MethodGet {
+		return nil
+	}
+	event := c.auditEvent(audit.EventAdminKeyUsed)
+	event.Details = map[string]string{
+		"method": c.Request().Method,
+		"path":   c.Request().URL.Path,
+	}
+	return c.recordAudit(event)
+}
+
+// RequirePermission must be used after AdminMiddleware
+func RequirePermission(perm string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			cc := c.(*CustomContext)
+			if !lo.Contains(cc.AdminPermissions, perm) {
+				return c.String(http.StatusForbidden, fmt.Sprintf("admin key missing permission %s", perm))
+			}
+			return next(c)
+		}
+	}
+}
+
+type (
+	CreateAdminKeyRequest struct {
+		Name        string     `json:"name" validate:"required"`
+		Permissions []string   `json:"permissions" validate:"required,min=1"`
+		Expires     *time.Time `json:"expires"`
+	}
+
+	AdminKeyResponse struct {
+		ID          string
+		Name        string
+		Permissions []string
+		Expires     *time.Time
+		LastUsed    *time.Time
+		Revoked     bool
+		Created     time.Time
+		Updated     time.Time
+	}
+
+	CreateAdminKeyResponse struct {
+		AdminKeyResponse
+		// Only returned on creation, we only store the hash
+		Key string
+	}
+)
+
+func adminKeyToResponse(key query.AdminKey) AdminKeyResponse {
+	return AdminKeyResponse{
+		ID:          key.ID,
+		Name:        key.Name,
+		Permissions: key.Permissions,
+		Expires:     key.Expires,
+		LastUsed:    key.LastUsed,
+		Revoked:     key.Revoked,
+		Created:     key.Created,
+		Updated:     key.Updated,
+	}
+}
+
+func (s *HTTPServer) CreateAdminKey(c *CustomContext) error {
+	ctx := c.Request().Context()
+	var reqBody CreateAdminKeyRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	_, unknownPerms := lo.Difference(AdminPermissions, reqBody.Permissions)
+	if len(unknownPerms) > 0 {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("unknown permissions: %+v", unknownPerms))
+	}
+	// A key can't grant more than it has
+	_, missingPerms := lo.Difference(c.AdminPermissions, reqBody.Permissions)
+	if len(missingPerms) > 0 {
+		return c.String(http.StatusForbidden, fmt.Sprintf("admin key missing permissions: %+v", missingPerms))
+	}
+
+	key := utils.GenRandomIDWithSize("cwak_", 32)
+	var adminKey query.AdminKey
+	err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		adminKey, err = q.InsertAdminKey(ctx, query.InsertAdminKeyParams{
+			TenantID:    c.Tenant.ID,
+			ID:          utils.GenRandomID("ak_"),
+			Name:        reqBody.Name,
+			KeyHash:     utils.SHA256Hex(key),
+			Permissions: lo.Uniq(reqBody.Permissions),
+			Expires:     reqBody.Expires,
+		})
+		if err != nil {
+			return fmt.Errorf("error in InsertAdminKey: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error creating admin key")
+	}
+
+	return c.JSON(http.StatusOK, CreateAdminKeyResponse{
+		AdminKeyResponse: adminKeyToResponse(adminKey),
+		Key:              key,
+	})
+}
+
+func (s *HTTPServer) ListAdminKeys(c *CustomContext) error {
+	ctx := c.Request().Context()
+
+	var adminKeys []query.AdminKey
+	err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		adminKeys, err = q.ListAdminKeys(ctx, c.Tenant.ID)
+		if err != nil {
+			return fmt.Errorf("error in ListAdminKeys: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error listing admin keys")
+	}
+
+	return c.JSON(http.StatusOK, lo.Map(adminKeys, func(item query.AdminKey, index int) AdminKeyResponse {
+		return adminKeyToResponse(item)
+	}))
+}
+
+// RevokeAdminKey revokes a key, which can't have permissions the revoking key doesn't
+func (s *HTTPServer) RevokeAdminKey(c *CustomContext) error {
+	ctx := c.Request().Context()
+	keyID := c.Param("keyID")
+
+	var rows int64
+	err := query.ReliableExecInTx(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) error {
+		adminKey, err := q.SelectAdminKey(ctx, query.SelectAdminKeyParams{
+			TenantID: c.Tenant.ID,
+			ID:       keyID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in SelectAdminKey: %w", err)
+		}
+		_, missingPerms := lo.Difference(c.AdminPermissions, adminKey.Permissions)
+		if len(missingPerms) > 0 {
+			return utils.PermError(fmt.Sprintf("admin key missing permissions: %+v", missingPerms))
+		}
+
+		rows, err = q.RevokeAdminKey(ctx, query.RevokeAdminKeyParams{
+			TenantID: c.Tenant.ID,
+			ID:       keyID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in RevokeAdminKey: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.String(http.StatusNotFound, "admin key not found")
+	}
+	if utils.IsErr[utils.PermError](err) {
+		return c.String(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return c.InternalError(err, "error revoking admin key")
+	}
+	if rows == 0 {
+		return c.String(http.StatusNotFound, "admin key not found")
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+type (
+	RotateAdminKeyRequest struct {
+		// How long the old key keeps working, defaults to 24 hours
+		GracePeriodSeconds int64 `json:"grace_period_seconds" validate:"gte=0"`
+	}
+
+	RotateAdminKeyResponse struct {
+		CreateAdminKeyResponse
+		OldKeyExpires time.Time
+		// Set when temporal is enabled, cancel the workflow to keep the old key
+		WorkflowID *string `json:",omitempty"`
+	}
+)
+
+// RotateAdminKey creates a new key with the same name and permissions, and revokes the old one after a grace period
+func (s *HTTPServer) RotateAdminKey(c *CustomContext) error {
+	ctx := c.Request().Context()
+	keyID := c.Param("keyID")
+	var reqBody RotateAdminKeyRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	gracePeriod := lo.Ternary(reqBody.GracePeriodSeconds == 0, time.Hour*24, time.Second*time.Duration(reqBody.GracePeriodSeconds))
+	oldKeyExpires := time.Now().Add(gracePeriod)
+
+	key := utils.GenRandomIDWithSize("cwak_", 32)
+	var adminKey query.AdminKey
+	err := query.ReliableExecInTx(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) error {
+		oldKey, err := q.SelectAdminKey(ctx, query.SelectAdminKeyParams{
+			TenantID: c.Tenant.ID,
+			ID:       keyID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in SelectAdminKey: %w", err)
+		}
+		if oldKey.Revoked {
+			return pgx.ErrNoRows
+		}
+		_, missingPerms := lo.Difference(c.AdminPermissions, oldKey.Permissions)
+		if len(missingPerms) > 0 {
+			return utils.PermError(fmt.Sprintf("admin key missing permissions: %+v", missingPerms))
+		}
+		if oldKey.Expires != nil && oldKey.Expires.Before(oldKeyExpires) {
+			oldKeyExpires = *oldKey.Expires
+		}
+
+		adminKey, err = q.InsertAdminKey(ctx, query.InsertAdminKeyParams{
+			TenantID:    c.Tenant.ID,
+			ID:          utils.GenRandomID("ak_"),
+			Name:        oldKey.Name,
+			KeyHash:     utils.SHA256Hex(key),
+			Permissions: oldKey.Permissions,
+		})
+		if err != nil {
+			return fmt.Errorf("error in InsertAdminKey: %w", err)
+		}
+
+		// Without temporal the expiry does the revoking, with it this is a backstop in case the workflow is cancelled
+		_, err = q.UpdateAdminKeyExpires(ctx, query.UpdateAdminKeyExpiresParams{
+			TenantID: c.Tenant.ID,
+			ID:       keyID,
+			Expires:  utils.Ptr(oldKeyExpires),
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpdateAdminKeyExpires: %w", err)
+		}
+		return nil
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return c.String(http.StatusNotFound, "admin key not found")
+	}
+	if utils.IsErr[utils.PermError](err) {
+		return c.String(http.StatusForbidden, err.Error())
+	}
+	if err != nil {
+		return c.InternalError(err, "error rotating admin key")
+	}
+
+	res := RotateAdminKeyResponse{
+		CreateAdminKeyResponse: CreateAdminKeyResponse{
+			AdminKeyResponse: adminKeyToResponse(adminKey),
+			Key:              key,
+		},
+		OldKeyExpires: oldKeyExpires,
+	}
+	if s.Temporal != nil {
+		run, err := s.Temporal.StartWorkflow(ctx, fmt.Sprintf("rotate-admin-key-%s", keyID), workflows.RotateAdminKeyWorkflow, c.Tenant.ID, keyID, gracePeriod)
+		if err != nil {
+			// The expiry still revokes it
+			zerolog.Ctx(ctx).Error().Err(err).Str("keyID", keyID).Msg("error starting RotateAdminKeyWorkflow")
+		} else {
+			res.WorkflowID = utils.Ptr(run.GetID())
+		}
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
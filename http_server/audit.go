@@ -0,0 +1,141 @@
+package http_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/audit"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/samber/lo"
+)
+
+// auditEvent creates an event with the request info filled in. The actor defaults to the admin key if there is one.
+func (c *CustomContext) auditEvent(eventType string) audit.Event {
+	event := audit.Event{
+		Type:      eventType,
+		Actor:     c.AdminKeyID,
+		IP:        c.RealIP(),
+		RequestID: c.RequestID,
+	}
+	if c.Tenant != nil {
+		event.TenantID = c.Tenant.ID
+	}
+	return event
+}
+
+// recordAudit is called after the audited action has committed, the event is appended in the background. It only
+// fails when the recorder is backed up, the request should fail then rather than go unaudited.
+func (c *CustomContext) recordAudit(event audit.Event) error {
+	// The audit log needs postgres
+	if c.auditRecorder == nil {
+		return nil
+	}
+	return c.auditRecorder.Record(c.Request().Context(), event)
+}
+
+func revokeDetails(res RevokeTokensResponse) map[string]string {
+	return map[string]string{
+		"access_tokens":  fmt.Sprint(res.AccessTokens),
+		"refresh_tokens": fmt.Sprint(res.RefreshTokens),
+	}
+}
+
+type (
+	ListAuditEventsRequest struct {
+		EventType *string    `query:"event_type"`
+		Actor     *string    `query:"actor"`
+		ClientID  *string    `query:"client_id"`
+		UserID    *string    `query:"user_id"`
+		Since     *time.Time `query:"since"`
+		Until     *time.Time `query:"until"`
+		BeforeSeq *int64     `query:"before_seq"`
+		Limit     int32      `query:"limit" validate:"gte=0,lte=1000"`
+	}
+
+	AuditEventResponse struct {
+		Seq       int64
+		EventType string
+		Actor     string
+		ClientID  *string
+		UserID    *string
+		IP        string
+		RequestID string
+		Details   json.RawMessage
+		PrevHash  string
+		Hash      string
+		Created   time.Time
+	}
+
+	ListAuditEventsResponse struct {
+		Events []AuditEventResponse
+		// Pass as before_seq to get the next page, omitted on the last page
+		NextBeforeSeq *int64 `json:",omitempty"`
+	}
+)
+
+func (s *HTTPServer) ListAuditEvents(c *CustomContext) error {
+	ctx := c.Request().Context()
+	var reqBody ListAuditEventsRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	limit := lo.Ternary(reqBody.Limit == 0, 100, reqBody.Limit)
+
+	var events []query.AuditEvent
+	err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		events, err = q.ListAuditEvents(ctx, query.ListAuditEventsParams{
+			TenantID:  c.Tenant.ID,
+			EventType: reqBody.EventType,
+			Actor:     reqBody.Actor,
+			ClientID:  reqBody.ClientID,
+			UserID:    reqBody.UserID,
+			Since:     reqBody.Since,
+			Until:     reqBody.Until,
+			BeforeSeq: reqBody.BeforeSeq,
+			RowLimit:  limit,
+		})
+		if err != nil {
+			return fmt.Errorf("error in ListAuditEvents: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error listing audit events")
+	}
+
+	res := ListAuditEventsResponse{
+		Events: lo.Map(events, func(item query.AuditEvent, index int) AuditEventResponse {
+			return AuditEventResponse{
+				Seq:       item.Seq,
+				EventType: item.EventType,
+				Actor:     item.Actor,
+				ClientID:  item.ClientID,
+				UserID:    item.UserID,
+				IP:        item.Ip,
+				RequestID: item.RequestID,
+				Details:   item.Details,
+				PrevHash:  item.PrevHash,
+				Hash:      item.Hash,
+				Created:   item.Created,
+			}
+		}),
+	}
+	if len(events) == int(limit) {
+		res.NextBeforeSeq = utils.Ptr(events[len(events)-1].Seq)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// VerifyAuditLog checks the tenant's whole chain
+func (s *HTTPServer) VerifyAuditLog(c *CustomContext) error {
+	res, err := audit.Verify(c.Request().Context(), s.Pool, c.Tenant.ID)
+	if err != nil {
+		return c.InternalError(err, "error verifying audit log")
+	}
+	return c.JSON(http.StatusOK, res)
+}
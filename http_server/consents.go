@@ -0,0 +1,126 @@
+package http_server
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/audit"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/danthegoodman1/GoAPITemplate/webhooks"
+	"github.com/samber/lo"
+)
+
+type (
+	ConsentResponse struct {
+		UserID   string
+		ClientID string
+		Scopes   []string
+		Created  time.Time
+		Updated  time.Time
+		// The last time the grant was refreshed, or its access tokens were introspected
+		LastUsed *time.Time
+	}
+
+	ListConsentsResponse struct {
+		Consents []ConsentResponse
+	}
+)
+
+// ListConsents lists the clients a user has consented to, and the scopes they last granted each
+func (s *HTTPServer) ListConsents(c *CustomContext) error {
+	ctx := c.Request().Context()
+	userID := c.Param("userID")
+
+	var consents []query.Consent
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		consents, err = tx.ListConsentsByUserID(ctx, query.ListConsentsByUserIDParams{
+			TenantID: c.Tenant.ID,
+			UserID:   userID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in ListConsentsByUserID: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error listing consents")
+	}
+
+	return c.JSON(http.StatusOK, ListConsentsResponse{
+		Consents: lo.Map(consents, func(item query.Consent, index int) ConsentResponse {
+			return ConsentResponse{
+				UserID:   item.UserID,
+				ClientID: item.ClientID,
+				Scopes:   item.Scopes,
+				Created:  item.Created,
+				Updated:  item.Updated,
+				LastUsed: item.LastUsed,
+			}
+		}),
+	})
+}
+
+// RevokeConsent deletes the user's consent for a client and revokes the grant's tokens
+func (s *HTTPServer) RevokeConsent(c *CustomContext) error {
+	ctx := c.Request().Context()
+	userID := c.Param("userID")
+	clientID := c.Param("clientID")
+
+	var deleted int64
+	var res RevokeTokensResponse
+	err := s.Store.ExecInTx(ctx, time.Second*20, func(ctx context.Context, tx store.Tx) (err error) {
+		deleted, err = tx.DeleteConsent(ctx, query.DeleteConsentParams{
+			TenantID: c.Tenant.ID,
+			UserID:   userID,
+			ClientID: clientID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in DeleteConsent: %w", err)
+		}
+		res.AccessTokens, err = tx.RevokeAccessTokensByUserAndClient(ctx, query.RevokeAccessTokensByUserAndClientParams{
+			TenantID: c.Tenant.ID,
+			UserID:   userID,
+			ClientID: clientID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in RevokeAccessTokensByUserAndClient: %w", err)
+		}
+		res.RefreshTokens, err = tx.RevokeRefreshTokensByUserAndClient(ctx, query.RevokeRefreshTokensByUserAndClientParams{
+			TenantID: c.Tenant.ID,
+			UserID:   userID,
+			ClientID: clientID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in RevokeRefreshTokensByUserAndClient: %w", err)
+		}
+		return tx.EnqueueWebhook(ctx, c.Tenant.ID, webhooks.EventAuthorizationRevoked, webhooks.AuthorizationRevokedData{
+			UserID:        utils.Ptr(userID),
+			ClientID:      utils.Ptr(clientID),
+			AccessTokens:  res.AccessTokens,
+			RefreshTokens: res.RefreshTokens,
+		})
+	})
+	if err != nil {
+		return c.InternalError(err, "error revoking consent")
+	}
+	s.revoked(ctx, revocation.Notice{TenantID: c.Tenant.ID, UserID: utils.Ptr(userID), ClientID: utils.Ptr(clientID)})
+	if deleted == 0 && res.AccessTokens == 0 && res.RefreshTokens == 0 {
+		return c.String(http.StatusNotFound, "consent not found")
+	}
+
+	event := c.auditEvent(audit.EventTokenRevoked)
+	event.UserID = utils.Ptr(userID)
+	event.ClientID = utils.Ptr(clientID)
+	event.Details = revokeDetails(res)
+	event.Details["consent"] = "revoked"
+	if err := c.recordAudit(event); err != nil {
+		return c.InternalError(err, "error recording audit event")
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
@@ -6,31 +6,60 @@ import (
 	"net/http"
 	"net/url"
 
+	"github.com/danthegoodman1/GoAPITemplate/audit"
 	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/observability"
+	"github.com/danthegoodman1/GoAPITemplate/tenants"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
 	"github.com/google/uuid"
 	"github.com/labstack/echo/v4"
 	"github.com/rs/zerolog"
+	oteltrace "go.opentelemetry.io/otel/trace"
 )
 
 type CustomContext struct {
 	echo.Context
 	RequestID string
 	UserID    string
+	// Set by ResolveTenant, nil only for /hc in multi-tenant mode
+	Tenant *tenants.Tenant
+
+	// Set by ReturnErrorResponse, used for metrics
+	OAuthError string
+	// Set by rateLimit when the client exists, so failures count against it
+	rateLimitClientID string
+	// Nil without the audit log
+	auditRecorder *audit.Recorder
+
+	// Set by AdminMiddleware
+	AdminKeyID       string
+	AdminPermissions []string
 }
 
-func CreateReqContext(next echo.HandlerFunc) echo.HandlerFunc {
+func (s *HTTPServer) CreateReqContext(next echo.HandlerFunc) echo.HandlerFunc {
 	return func(c echo.Context) error {
 		reqID := uuid.NewString()
+		tenant, _ := c.Get(tenantKey).(*tenants.Tenant)
 		ctx := context.WithValue(c.Request().Context(), gologger.ReqIDKey, reqID)
-		ctx = logger.WithContext(ctx)
+		ctx = s.Logger.WithContext(ctx)
 		c.SetRequest(c.Request().WithContext(ctx))
 		logger := zerolog.Ctx(ctx)
 		logger.UpdateContext(func(c zerolog.Context) zerolog.Context {
-			return c.Str("reqID", reqID)
+			c = c.Str("reqID", reqID)
+			if tenant != nil {
+				c = c.Str("tenantID", tenant.ID)
+			}
+			if sc := oteltrace.SpanContextFromContext(ctx); sc.IsValid() {
+				c = c.Str("traceID", sc.TraceID().String())
+			}
+			return c
 		})
 		cc := &CustomContext{
 			Context:   c,
 			RequestID: reqID,
+			Tenant:    tenant,
+
+			auditRecorder: s.AuditRecorder,
 		}
 		return next(cc)
 	}
@@ -71,7 +100,10 @@ func (c *CustomContext) ReturnAuthorizeRedirectURI(baseURI, code string, state *
 	return c.Redirect(http.StatusFound, u.String())
 }
 
+// ReturnErrorResponse redirects an authorization error back to the client (RFC 6749 4.1.2.1). Only use it once the
+// client and baseURI have been validated, otherwise use ReturnJSONErrorResponse so we aren't an open redirect.
 func (c *CustomContext) ReturnErrorResponse(baseURI, errType string, errDescription, errURI, state *string) error {
+	c.OAuthError = errType
 	u, err := url.Parse(baseURI)
 	if err != nil {
 		return c.InternalError(err, "error in url.Parse")
@@ -82,12 +114,52 @@ func (c *CustomContext) ReturnErrorResponse(baseURI, errType string, errDescript
 		q.Set("error_description", *errDescription)
 	}
 	if errURI != nil {
-		q.Set("err_uri", *errURI)
+		q.Set("error_uri", *errURI)
 	}
 	if state != nil {
 		q.Set("state", *state)
 	}
 
 	u.RawQuery = q.Encode()
-	return c.Redirect(http.StatusNotFound, u.String())
+	return c.Redirect(http.StatusFound, u.String())
+}
+
+type OAuthErrorResponse struct {
+	Error            string `json:"error"`
+	ErrorDescription string `json:"error_description,omitempty"`
+}
+
+// ReturnJSONErrorResponse responds with the error as JSON, for the token endpoint (RFC 6749 5.2) and authorization
+// requests that can't be redirected. server_error is a 500 and temporarily_unavailable a 503, so clients retry them.
+// invalid_client is a 401 asking for HTTP basic auth.
+func (c *CustomContext) ReturnJSONErrorResponse(errType string, errDescription *string) error {
+	c.OAuthError = errType
+	status := http.StatusBadRequest
+	switch errType {
+	case AuthErrInvalidClient:
+		status = http.StatusUnauthorized
+		c.Response().Header().Set("WWW-Authenticate", `Basic realm="oauth2"`)
+	case AuthErrServerError:
+		status = http.StatusInternalServerError
+	case AuthErrTemporarilyUnavailable:
+		status = http.StatusServiceUnavailable
+	}
+	return c.JSON(status, OAuthErrorResponse{
+		Error:            errType,
+		ErrorDescription: utils.Deref(errDescription, ""),
+	})
+}
+
+// oauthOutcome is the OAuth error returned to the client, or success
+func (c *CustomContext) oauthOutcome() string {
+	switch {
+	case c.OAuthError != "":
+		return c.OAuthError
+	case c.Response().Status >= 500:
+		return AuthErrServerError
+	case c.Response().Status >= 400:
+		return AuthErrInvalidRequest
+	default:
+		return observability.OutcomeSuccess
+	}
 }
@@ -3,16 +3,23 @@ package http_server
 import (
 	"context"
 	"errors"
-	"fmt"
 	"net"
 	"net/http"
 	"os"
-	"strings"
 	"time"
 
+	"github.com/danthegoodman1/GoAPITemplate/audit"
 	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/provider_api"
+	"github.com/danthegoodman1/GoAPITemplate/ratelimit"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/tenants"
+	"github.com/danthegoodman1/GoAPITemplate/tokencache"
 	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/danthegoodman1/GoAPITemplate/workflows"
 	"github.com/go-playground/validator/v10"
+	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/labstack/echo/v4"
 	"github.com/labstack/echo/v4/middleware"
 	"github.com/rs/zerolog"
@@ -23,26 +30,108 @@ var logger = gologger.NewLogger()
 
 type HTTPServer struct {
 	Echo *echo.Echo
+	Config
+
+	// Every request's tenant when Tenants is nil
+	defaultTenant *tenants.Tenant
+}
+
+// Config is everything the handlers need, nothing in here is read from the environment
+type Config struct {
+	Store         store.Store
+	UserExchanger provider_api.UserExchanger
+	// The Postgres or CRDB database behind admin keys, bulk revocation, the audit log, and webhooks. Optional, those
+	// routes return 501 without it.
+	Pool *pgxpool.Pool
+	// Optional
+	PreIssuanceHook provider_api.PreIssuanceHook
+	// Returned from introspection and userinfo as the token's issuer. Optional.
+	Issuer string
+
+	// Resolves each request's tenant in multi-tenant mode, which then use the tenant's provider and issuer rather than
+	// the ones above. Optional, nil serves everything as store.DefaultTenantID.
+	Tenants *tenants.Registry
+
+	AccessTokenTTL  time.Duration
+	RefreshTokenTTL time.Duration
+	// Refresh tokens unused for this long expire, 0 disables
+	RefreshTokenIdleTTL time.Duration
+	CodeTTL             time.Duration
+
+	// Has every admin permission. Optional, stored admin keys work without it when there is a Pool.
+	AdminKey string
+
+	// Caches valid access tokens for introspection and userinfo. Optional, revocations made by this server evict from
+	// it and are sent to the other replicas with RevocationNotifier.
+	IntrospectionCache *tokencache.Cache
+	// Optional, nil doesn't tell the other replicas about revocations
+	RevocationNotifier *revocation.Notifier
+
+	// Runs async bulk revocations and admin key rotations. Optional, nil without Temporal.
+	Temporal *workflows.Worker
+
+	// Appends security events to the audit log. Optional, nil doesn't record them.
+	AuditRecorder *audit.Recorder
+
+	// Throttles /oauth2/authorize and /oauth2/token. Optional, nil doesn't limit.
+	RateLimiter *ratelimit.Limiter
+	// X-Forwarded-For is only believed from these proxies, and private and loopback addresses
+	TrustedProxies []*net.IPNet
+
+	Logger zerolog.Logger
 }
 
 type CustomValidator struct {
 	validator *validator.Validate
 }
 
-func StartHTTPServer() *HTTPServer {
-	listener, err := net.Listen("tcp", fmt.Sprintf(":%s", utils.GetEnvOrDefault("HTTP_PORT", "8080")))
+// StartHTTPServer serves the handlers from NewHTTPServer on addr, exiting if it can't
+func StartHTTPServer(cfg Config, addr string) *HTTPServer {
+	listener, err := net.Listen("tcp", addr)
 	if err != nil {
 		logger.Error().Err(err).Msg("error creating tcp listener, exiting")
 		os.Exit(1)
 	}
+	s := NewHTTPServer(cfg)
+	s.Echo.Listener = listener
+	go func() {
+		logger.Info().Msg("starting h2c server on " + listener.Addr().String())
+		err := s.Echo.StartH2CServer("", &http2.Server{})
+		// stop the broker
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("failed to start h2c server, exiting")
+			os.Exit(1)
+		}
+	}()
+
+	return s
+}
+
+// NewHTTPServer sets up the routes without listening, s.Echo is an http.Handler
+func NewHTTPServer(cfg Config) *HTTPServer {
 	s := &HTTPServer{
-		Echo: echo.New(),
+		Echo:   echo.New(),
+		Config: cfg,
+		defaultTenant: &tenants.Tenant{
+			ID:              store.DefaultTenantID,
+			Issuer:          cfg.Issuer,
+			UserExchanger:   cfg.UserExchanger,
+			PreIssuanceHook: cfg.PreIssuanceHook,
+		},
 	}
 	s.Echo.HideBanner = true
 	s.Echo.HidePort = true
 	s.Echo.JSONSerializer = &utils.NoEscapeJSONSerializer{}
+	// Otherwise anyone can set X-Forwarded-For to dodge the rate limits or fill the audit log with any IP
+	var trust []echo.TrustOption
+	for _, ipNet := range cfg.TrustedProxies {
+		trust = append(trust, echo.TrustIPRange(ipNet))
+	}
+	s.Echo.IPExtractor = echo.ExtractIPFromXFFHeader(trust...)
 
-	s.Echo.Use(CreateReqContext)
+	s.Echo.Pre(s.ResolveTenant)
+	s.Echo.Use(TracingMiddleware)
+	s.Echo.Use(s.CreateReqContext)
 	s.Echo.Use(LoggerMiddleware)
 	s.Echo.Use(middleware.CORS())
 	s.Echo.Validator = &CustomValidator{validator: validator.New()}
@@ -54,26 +143,51 @@ func StartHTTPServer() *HTTPServer {
 	oauthGroup := s.Echo.Group("/oauth2")
 	oauthGroup.POST("/authorize", ccHandler(s.PostAuthorize))
 	oauthGroup.POST("/token", ccHandler(s.PostAccessToken))
+	oauthGroup.GET("/userinfo", ccHandler(s.UserInfo))
 
 	// admin endpoints
-	adminGroup := s.Echo.Group("/admin", AdminMiddleware)
-	adminGroup.GET("/access_token/:accessToken", ccHandler(s.CheckAccessToken))
-	adminGroup.GET("/client/:clientID", ccHandler(s.GetClientFromID))
-
-	s.Echo.Listener = listener
-	go func() {
-		logger.Info().Msg("starting h2c server on " + listener.Addr().String())
-		err := s.Echo.StartH2CServer("", &http2.Server{})
-		// stop the broker
-		if err != nil && !errors.Is(err, http.ErrServerClosed) {
-			logger.Error().Err(err).Msg("failed to start h2c server, exiting")
-			os.Exit(1)
-		}
-	}()
+	adminGroup := s.Echo.Group("/admin", s.AdminMiddleware)
+	adminGroup.GET("/access_token/:accessToken", ccHandler(s.CheckAccessToken), RequirePermission(PermTokensIntrospect))
+	adminGroup.POST("/access_tokens/introspect", ccHandler(s.BatchCheckAccessTokens), RequirePermission(PermTokensIntrospect))
+	adminGroup.GET("/client/:clientID", ccHandler(s.GetClientFromID), RequirePermission(PermClientsRead))
+	adminGroup.PUT("/client/:clientID/token_policy", ccHandler(s.SetClientTokenPolicy), RequirePermission(PermClientsWrite))
+	adminGroup.PUT("/client/:clientID/rate_limit", ccHandler(s.SetClientRateLimit), RequirePermission(PermClientsWrite))
+	adminGroup.PUT("/client/:clientID/redirect_uris", ccHandler(s.SetClientRedirectURIs), RequirePermission(PermClientsWrite))
+	adminGroup.PUT("/scopes/:scopeID", ccHandler(s.PutScope), RequirePermission(PermScopesWrite))
+	adminGroup.GET("/consents/:userID", ccHandler(s.ListConsents), RequirePermission(PermTokensIntrospect))
+	adminGroup.DELETE("/consents/:userID/:clientID", ccHandler(s.RevokeConsent), RequirePermission(PermTokensRevoke))
+	adminGroup.POST("/client/:clientID/suspend", ccHandler(s.SuspendClient), RequirePermission(PermClientsWrite))
+	adminGroup.POST("/revoke/user/:userID", ccHandler(s.RevokeUserTokens), RequirePermission(PermTokensRevoke))
+	adminGroup.POST("/revoke/client/:clientID", ccHandler(s.RevokeClientTokens), RequirePermission(PermTokensRevoke))
+	adminGroup.POST("/revoke/before", ccHandler(s.RevokeTokensBefore), RequirePermission(PermTokensRevoke))
+
+	// only the postgres store has admin keys, the audit log, and webhooks
+	pgAdminGroup := adminGroup.Group("", s.RequirePostgres)
+	pgAdminGroup.POST("/keys", ccHandler(s.CreateAdminKey), RequirePermission(PermAdminKeysWrite))
+	pgAdminGroup.GET("/keys", ccHandler(s.ListAdminKeys), RequirePermission(PermAdminKeysRead))
+	pgAdminGroup.POST("/keys/:keyID/rotate", ccHandler(s.RotateAdminKey), RequirePermission(PermAdminKeysWrite))
+	pgAdminGroup.DELETE("/keys/:keyID", ccHandler(s.RevokeAdminKey), RequirePermission(PermAdminKeysWrite))
+	pgAdminGroup.GET("/audit", ccHandler(s.ListAuditEvents), RequirePermission(PermAuditRead))
+	pgAdminGroup.GET("/audit/verify", ccHandler(s.VerifyAuditLog), RequirePermission(PermAuditRead))
+	pgAdminGroup.POST("/webhooks", ccHandler(s.CreateWebhookSubscription), RequirePermission(PermWebhooksWrite))
+	pgAdminGroup.GET("/webhooks", ccHandler(s.ListWebhookSubscriptions), RequirePermission(PermWebhooksRead))
+	pgAdminGroup.DELETE("/webhooks/:subscriptionID", ccHandler(s.DeleteWebhookSubscription), RequirePermission(PermWebhooksWrite))
+	pgAdminGroup.GET("/webhooks/deliveries", ccHandler(s.ListWebhookDeliveries), RequirePermission(PermWebhooksRead))
+	pgAdminGroup.POST("/webhooks/deliveries/:deliveryID/replay", ccHandler(s.ReplayWebhookDelivery), RequirePermission(PermWebhooksWrite))
 
 	return s
 }
 
+// RequirePostgres is for routes that use the Pool directly rather than the store
+func (s *HTTPServer) RequirePostgres(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.Pool == nil {
+			return c.String(http.StatusNotImplemented, "only available with the postgres store")
+		}
+		return next(c)
+	}
+}
+
 func (cv *CustomValidator) Validate(i interface{}) error {
 	if err := cv.validator.Struct(i); err != nil {
 		return echo.NewHTTPError(http.StatusBadRequest, err.Error())
@@ -126,14 +240,3 @@ func LoggerMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
 		return nil
 	}
 }
-
-func AdminMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
-	return func(c echo.Context) error {
-		parts := strings.Split(c.Request().Header.Get("Authorization"), "earer ")
-		if len(parts) != 2 || parts[1] != utils.AdminKey {
-			return c.String(http.StatusBadRequest, "invalid auth header")
-		}
-
-		return next(c)
-	}
-}
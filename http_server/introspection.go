@@ -0,0 +1,113 @@
+package http_server
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/observability"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/samber/lo"
+)
+
+// Matches TouchAccessTokens
+var lastUsedResolution = time.Minute
+
+// validAccessToken returns the tenant's access token from the introspection cache or the store, and records its use.
+// LastUsed is the use before this one.
+func (s *HTTPServer) validAccessToken(ctx context.Context, tenantID, id string) (query.AccessToken, error) {
+	accessTokens, err := s.validAccessTokens(ctx, tenantID, []string{id})
+	if err != nil {
+		return query.AccessToken{}, err
+	}
+	accessToken, ok := accessTokens[id]
+	if !ok {
+		return query.AccessToken{}, fmt.Errorf("error in SelectValidAccessTokens: %w", store.ErrNotFound)
+	}
+	return accessToken, nil
+}
+
+// validAccessTokens is validAccessToken for many tokens, the ones that aren't cached are selected in one query. Tokens
+// that aren't valid, or are another tenant's, are left out.
+func (s *HTTPServer) validAccessTokens(ctx context.Context, tenantID string, ids []string) (map[string]query.AccessToken, error) {
+	found := map[string]query.AccessToken{}
+	ids = lo.Uniq(ids)
+	misses := ids
+	var generation uint64
+	if s.IntrospectionCache != nil {
+		generation = s.IntrospectionCache.Generation()
+		misses = nil
+		now := time.Now()
+		var due []query.AccessToken
+		for _, id := range ids {
+			accessToken, ok := s.IntrospectionCache.Get(id)
+			observability.RecordIntrospectionCache(ok, s.IntrospectionCache.Len())
+			if !ok {
+				misses = append(misses, id)
+				continue
+			}
+			// The cache is shared by every tenant, the store wouldn't find it either
+			if accessToken.TenantID != tenantID {
+				continue
+			}
+			found[id] = accessToken
+			if accessToken.LastUsed == nil || now.Sub(*accessToken.LastUsed) >= lastUsedResolution {
+				due = append(due, accessToken)
+			}
+		}
+		if len(due) > 0 {
+			_ = s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) error {
+				recordAccessTokensUse(ctx, tx, tenantID, due)
+				return nil
+			})
+			// Even if another replica recorded it first, or it failed, so the next hit doesn't try again
+			for _, accessToken := range due {
+				accessToken.LastUsed = utils.Ptr(now)
+				s.IntrospectionCache.Add(accessToken, generation)
+			}
+		}
+	}
+	if len(misses) == 0 {
+		return found, nil
+	}
+
+	var accessTokens []query.AccessToken
+	var touched map[string]bool
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		accessTokens, err = tx.SelectValidAccessTokens(ctx, query.SelectValidAccessTokensParams{
+			TenantID: tenantID,
+			Ids:      misses,
+		})
+		if err != nil {
+			return fmt.Errorf("error in SelectValidAccessTokens: %w", err)
+		}
+		touched = recordAccessTokensUse(ctx, tx, tenantID, accessTokens)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	for _, accessToken := range accessTokens {
+		found[accessToken.ID] = accessToken
+		if s.IntrospectionCache != nil {
+			if touched[accessToken.ID] {
+				accessToken.LastUsed = utils.Ptr(now)
+			}
+			s.IntrospectionCache.Add(accessToken, generation)
+		}
+	}
+	return found, nil
+}
+
+// revoked evicts the revoked access tokens from this replica's introspection cache, and notifies the others. Call it
+// after the revocation commits.
+func (s *HTTPServer) revoked(ctx context.Context, notice revocation.Notice) {
+	if s.IntrospectionCache != nil {
+		observability.RecordIntrospectionCacheEvictions(s.IntrospectionCache.Evict(notice))
+	}
+	s.RevocationNotifier.Notify(ctx, notice)
+}
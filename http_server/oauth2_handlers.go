@@ -2,16 +2,22 @@ package http_server
 
 import (
 	"context"
+	"crypto/subtle"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/danthegoodman1/GoAPITemplate/pg"
+	"github.com/danthegoodman1/GoAPITemplate/audit"
+	"github.com/danthegoodman1/GoAPITemplate/observability"
 	"github.com/danthegoodman1/GoAPITemplate/provider_api"
 	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/store"
 	"github.com/danthegoodman1/GoAPITemplate/utils"
-	"github.com/jackc/pgx/v5"
+	"github.com/danthegoodman1/GoAPITemplate/webhooks"
 	"github.com/rs/zerolog"
 	"github.com/samber/lo"
 	"net/http"
+	"net/url"
 	"strings"
 	"time"
 )
@@ -21,6 +27,8 @@ var (
 	ResponseTypeClientCredentials = "client_credentials"
 
 	AuthErrInvalidRequest          = "invalid_request"
+	AuthErrInvalidClient           = "invalid_client"
+	AuthErrInvalidGrant            = "invalid_grant"
 	AuthErrUnauthorizedClient      = "unauthorized_client"
 	AuthErrAccessDenied            = "access_denied"
 	AuthErrUnsupportedResponseType = "unsupported_response_type"
@@ -35,19 +43,25 @@ var (
 	MacTokenType    = "mac"
 
 	ClientUserID = "_client"
+
+	ErrClientSuspended = errors.New("client suspended")
+	// The token request's client_id or redirect_uri isn't the one the code was issued for
+	ErrCodeWrongClient         = errors.New("code was issued to another client")
+	ErrCodeWrongRedirectURI    = errors.New("redirect_uri doesn't match the authorization request")
+	ErrRefreshTokenWrongClient = errors.New("refresh token was issued to another client")
 )
 
 type (
 	AuthorizeRequest struct {
-		ResponseType string  `query:"response_type" validate:"require"`
-		ClientID     string  `query:"client_id" validate:"require"`
+		ResponseType string  `query:"response_type" validate:"required"`
+		ClientID     string  `query:"client_id" validate:"required"`
 		RedirectURI  string  `query:"redirect_uri"`
 		Scope        string  `query:"scope"`
 		State        *string `query:"state"`
 	}
 	PostAuthorizeRequest struct {
-		ResponseType string  `json:"response_type" validate:"require"`
-		ClientID     string  `json:"client_id" validate:"require"`
+		ResponseType string  `json:"response_type" validate:"required"`
+		ClientID     string  `json:"client_id" validate:"required"`
 		RedirectURI  string  `json:"redirect_uri"`
 		Scope        string  `json:"scope"`
 		State        *string `json:"state"`
@@ -59,7 +73,7 @@ func (s *HTTPServer) PostAuthorize(c *CustomContext) error {
 	logger := zerolog.Ctx(c.Request().Context())
 	var reqBody PostAuthorizeRequest
 	if err := ValidateRequest(c, &reqBody); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+		return c.ReturnJSONErrorResponse(AuthErrInvalidRequest, utils.Ptr(err.Error()))
 	}
 
 	// Update our logger to have the context
@@ -67,20 +81,28 @@ func (s *HTTPServer) PostAuthorize(c *CustomContext) error {
 		return c.Str("ClientID", reqBody.ClientID).Str("ResponseType", reqBody.ResponseType).Str("RedirectURI", reqBody.RedirectURI).Str("Scope", reqBody.Scope)
 	})
 
+	if limited, err := s.rateLimit(c, "authorize", reqBody.ClientID); limited {
+		return err
+	}
+	defer s.rateLimitFailure(c)
+
 	// Validate response type
 	if reqBody.ResponseType != ResponseTypeAuthorizationCode && reqBody.ResponseType != ResponseTypeClientCredentials {
-		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrUnsupportedResponseType, nil, nil, reqBody.State)
+		return c.ReturnJSONErrorResponse(AuthErrUnsupportedResponseType, nil)
 	}
 
 	// Handle flow for response type
+	var err error
 	switch reqBody.ResponseType {
 	case ResponseTypeAuthorizationCode:
-		return s.handleGetAuthorizationCode(c, reqBody)
+		err = s.handleGetAuthorizationCode(c, reqBody)
 	case ResponseTypeClientCredentials:
-		return s.handleGetClientCredentials(c, reqBody)
+		err = s.handleGetClientCredentials(c, reqBody)
 	default:
-		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrUnsupportedResponseType, nil, nil, reqBody.State)
+		return c.ReturnJSONErrorResponse(AuthErrUnsupportedResponseType, nil)
 	}
+	observability.RecordAuthorization(reqBody.ClientID, reqBody.ResponseType, c.oauthOutcome())
+	return err
 }
 
 func (s *HTTPServer) handleGetAuthorizationCode(c *CustomContext, reqBody PostAuthorizeRequest) error {
@@ -90,23 +112,33 @@ func (s *HTTPServer) handleGetAuthorizationCode(c *CustomContext, reqBody PostAu
 	// Lookup client and get scopes
 	var client query.Client
 	var scopes []query.Scope
-	err := query.ReliableExec(ctx, pg.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
-		client, err = q.SelectClient(ctx, reqBody.ClientID)
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: c.Tenant.ID,
+			ID:       reqBody.ClientID,
+		})
 		if err != nil {
 			return fmt.Errorf("error in SelectClient: %w", err)
 		}
-		scopes, err = q.ListScopes(ctx)
+		scopes, err = tx.ListScopes(ctx, c.Tenant.ID)
 		if err != nil {
 			return fmt.Errorf("error in ListScopes: %w", err)
 		}
 		return
 	})
-	if errors.Is(err, pgx.ErrNoRows) {
-		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrUnauthorizedClient, utils.Ptr("unknown client_id"), nil, reqBody.State)
+	// Nothing is validated until we have the client and its redirect URI, so these errors can't redirect
+	if errors.Is(err, store.ErrNotFound) {
+		return c.ReturnJSONErrorResponse(AuthErrUnauthorizedClient, utils.Ptr("unknown client_id"))
 	}
 	if err != nil {
-		return c.InternalError(err, "error getting client info")
+		logger.Error().Err(err).Msg("error getting client info")
+		return c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
+	}
+	redirectURI, ok := registeredRedirectURI(client, reqBody.RedirectURI)
+	if !ok {
+		return c.ReturnJSONErrorResponse(AuthErrInvalidRequest, utils.Ptr("redirect_uri isn't registered for the client"))
 	}
+	reqBody.RedirectURI = redirectURI
 
 	// Verify client not suspended
 	if client.Suspended {
@@ -114,10 +146,11 @@ func (s *HTTPServer) handleGetAuthorizationCode(c *CustomContext, reqBody PostAu
 	}
 
 	// Validate scopes
-	requestedScopes := strings.Split(reqBody.Scope, " ")
+	requestedScopes := strings.Fields(reqBody.Scope)
 	scopeIDs := lo.Map(scopes, func(item query.Scope, index int) string {
 		return item.ID
 	})
+	scopeIDs = append(scopeIDs, ScopeOfflineAccess)
 
 	_, unknownScopes := lo.Difference(scopeIDs, requestedScopes)
 	if len(unknownScopes) > 0 {
@@ -126,29 +159,92 @@ func (s *HTTPServer) handleGetAuthorizationCode(c *CustomContext, reqBody PostAu
 	}
 
 	// Forward auth header to provider API and get user info back
-	userInfo, err := provider_api.ExchangeAuthForUserInfo(ctx, utils.ProviderAPIUserExchange, c.Request().Header.Get("x-continuewith-user"))
+	userInfo, err := c.Tenant.UserExchanger.ExchangeAuthForUserInfo(ctx, c.Request().Header.Get("x-continuewith-user"))
 	if err != nil {
-		var errType, errDesc string
-		if isClientError := errors.Is(err, provider_api.ErrClientError); isClientError {
-			errType = AuthErrInvalidRequest
-			errDesc = err.Error()
-		} else {
-			errType = AuthErrServerError
-			errDesc = err.Error()
+		errType, errDesc := providerErrorResponse(err)
+		if errType == AuthErrServerError {
 			logger.Error().Err(err).Msg("server error exchanging auth for user info")
 		}
 		return c.ReturnErrorResponse(reqBody.RedirectURI, errType, utils.Ptr(errDesc), nil, reqBody.State)
 	}
 
+	// The provider can limit what this user is allowed to grant
+	grantedScopes := requestedScopes
+	if userInfo.Scopes != nil {
+		grantedScopes = lo.Intersect(requestedScopes, userInfo.Scopes)
+		if len(requestedScopes) > 0 && len(grantedScopes) == 0 {
+			return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrAccessDenied, utils.Ptr("user can't grant any of the requested scopes"), nil, reqBody.State)
+		}
+	}
+
+	claims, err := userInfo.ClaimsJSON()
+	if err != nil {
+		logger.Error().Err(err).Msg("error in ClaimsJSON")
+		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrServerError, utils.Ptr("internal server error"), nil, reqBody.State)
+	}
+
+	// Let the provider veto or customize the grant
+	hook, err := preIssuance(ctx, c.Tenant, provider_api.PreIssuanceRequest{
+		Event:    provider_api.PreIssuanceAuthorizationCode,
+		UserID:   userInfo.UserID,
+		ClientID: client.ID,
+		Scopes:   grantedScopes,
+		Claims:   claims,
+	})
+	if err != nil {
+		errType, errDesc := providerErrorResponse(err)
+		if errType == AuthErrServerError {
+			logger.Error().Err(err).Msg("server error calling pre-issuance hook")
+		}
+		return c.ReturnErrorResponse(reqBody.RedirectURI, errType, utils.Ptr(errDesc), nil, reqBody.State)
+	}
+	var accessTokenTTL, refreshTokenTTL *int64
+	if hook != nil {
+		if hook.Deny {
+			return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrAccessDenied, utils.Ptr(utils.Deref(hook.Reason, "denied by provider")), nil, reqBody.State)
+		}
+		grantedScopes = narrowScopes(grantedScopes, hook)
+		claims, err = hook.MergeClaims(claims)
+		if err != nil {
+			logger.Error().Err(err).Msg("error in MergeClaims")
+			return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrServerError, utils.Ptr("internal server error"), nil, reqBody.State)
+		}
+		accessTokenTTL = hook.AccessTokenTTLSeconds
+		refreshTokenTTL = hook.RefreshTokenTTLSeconds
+	}
+
 	// Insert the authorization code that can be exchanged for a token pair
 	authCode := utils.GenRandomIDWithSize("ac_", 10)
-	err = query.ReliableExec(ctx, pg.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) error {
-		return q.InsertAuthorizationCode(ctx, query.InsertAuthorizationCodeParams{
+	err = s.Store.ExecInTx(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) error {
+		err := tx.InsertAuthorizationCode(ctx, query.InsertAuthorizationCodeParams{
+			TenantID: c.Tenant.ID,
 			ID:       authCode,
 			UserID:   userInfo.UserID,
-			Scopes:   nil,
-			Expires:  time.Now().Add(time.Minute * 10),
+			Scopes:   grantedScopes,
+			Expires:  time.Now().Add(s.CodeTTL),
+			ClientID: client.ID,
+			Claims:   claims,
+
+			AccessTokenTtlSeconds:  accessTokenTTL,
+			RefreshTokenTtlSeconds: refreshTokenTTL,
+			RedirectUri:            &reqBody.RedirectURI,
+		})
+		if err != nil {
+			return fmt.Errorf("error in InsertAuthorizationCode: %w", err)
+		}
+		err = tx.UpsertConsent(ctx, query.UpsertConsentParams{
+			TenantID: c.Tenant.ID,
+			UserID:   userInfo.UserID,
 			ClientID: client.ID,
+			Scopes:   grantedScopes,
+		})
+		if err != nil {
+			return fmt.Errorf("error in UpsertConsent: %w", err)
+		}
+		return tx.EnqueueWebhook(ctx, c.Tenant.ID, webhooks.EventAuthorizationGranted, webhooks.AuthorizationGrantedData{
+			UserID:   userInfo.UserID,
+			ClientID: client.ID,
+			Scopes:   grantedScopes,
 		})
 	})
 	if err != nil {
@@ -156,7 +252,28 @@ func (s *HTTPServer) handleGetAuthorizationCode(c *CustomContext, reqBody PostAu
 		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrServerError, utils.Ptr("internal server error"), nil, reqBody.State)
 	}
 
-	return c.ReturnAuthorizeRedirectURI(reqBody.RedirectURI, authCode, nil)
+	event := c.auditEvent(audit.EventCodeIssued)
+	event.Actor = userInfo.UserID
+	event.ClientID = utils.Ptr(client.ID)
+	event.UserID = utils.Ptr(userInfo.UserID)
+	if err := c.recordAudit(event); err != nil {
+		logger.Error().Err(err).Msg("error recording audit event")
+		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrServerError, utils.Ptr("internal server error"), nil, reqBody.State)
+	}
+
+	return c.ReturnAuthorizeRedirectURI(reqBody.RedirectURI, authCode, reqBody.State)
+}
+
+// registeredRedirectURI returns the redirect URI to use for the client, false if the requested one isn't registered.
+// Clients with a single registered URI can omit it.
+func registeredRedirectURI(client query.Client, requested string) (string, bool) {
+	if requested == "" {
+		if len(client.RedirectUris) == 1 {
+			return client.RedirectUris[0], true
+		}
+		return "", false
+	}
+	return requested, lo.Contains(client.RedirectUris, requested)
 }
 
 func (s *HTTPServer) handleGetClientCredentials(c *CustomContext, reqBody PostAuthorizeRequest) error {
@@ -165,57 +282,76 @@ func (s *HTTPServer) handleGetClientCredentials(c *CustomContext, reqBody PostAu
 	// Lookup client
 	var client query.Client
 	clientAccessTokenID := utils.GenRandomIDWithSize("ca_", 16)
-	err := query.ReliableExec(ctx, pg.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
-		client, err = q.SelectClient(ctx, reqBody.ClientID)
+	err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: c.Tenant.ID,
+			ID:       reqBody.ClientID,
+		})
 		if err != nil {
 			return fmt.Errorf("error in SelectClient: %w", err)
 		}
+		if client.Suspended {
+			return ErrClientSuspended
+		}
 
 		// Insert a client credentials access token
-		err = q.InsertAccessToken(ctx, query.InsertAccessTokenParams{
+		err = tx.InsertAccessToken(ctx, query.InsertAccessTokenParams{
+			TenantID:     c.Tenant.ID,
 			ID:           clientAccessTokenID,
 			ClientID:     reqBody.ClientID,
 			RefreshToken: nil,
 			UserID:       ClientUserID,
 			Scopes:       nil,
-			Expires:      time.Now().Add(time.Second * time.Duration(utils.AccessTokenExpireSeconds)),
+			Expires:      time.Now().Add(time.Second * time.Duration(s.clientTokenPolicy(client).accessTTL)),
 		})
 		if err != nil {
 			return fmt.Errorf("error in InsertAccessToken: %w", err)
 		}
 		return
 	})
-	if errors.Is(err, pgx.ErrNoRows) {
-		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrUnauthorizedClient, utils.Ptr("unknown client_id"), nil, reqBody.State)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.ReturnJSONErrorResponse(AuthErrUnauthorizedClient, utils.Ptr("unknown client_id"))
+	}
+	if errors.Is(err, ErrClientSuspended) {
+		return c.ReturnJSONErrorResponse(AuthErrAccessDenied, utils.Ptr(err.Error()))
 	}
 	if err != nil {
-		return c.InternalError(err, "error getting client info")
+		zerolog.Ctx(ctx).Error().Err(err).Msg("error getting client info")
+		return c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
 	}
 
-	// Verify client not suspended
-	if client.Suspended {
-		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrAccessDenied, utils.Ptr("client suspended"), nil, reqBody.State)
+	event := c.auditEvent(audit.EventTokenExchanged)
+	event.Actor = client.ID
+	event.ClientID = utils.Ptr(client.ID)
+	event.UserID = utils.Ptr(ClientUserID)
+	event.Details = map[string]string{
+		"response_type": ResponseTypeClientCredentials,
+	}
+	if err := c.recordAudit(event); err != nil {
+		logger.Error().Err(err).Msg("error recording audit event")
+		return c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
 	}
 
 	return c.JSON(http.StatusOK, AccessTokenResponse{
 		AccessToken:  clientAccessTokenID,
 		TokenType:    BearerTokenType,
-		ExpiresIn:    int(utils.AccessTokenExpireSeconds),
+		ExpiresIn:    int(s.clientTokenPolicy(client).accessTTL),
 		RefreshToken: "", // will be omitted
 	})
 }
 
 type (
-	// ClientSecret is actually not required (which makes sense)
-	// according to the RFC: https://datatracker.ietf.org/doc/html/rfc6749#section-4.1.3
+	// The client authenticates with its secret, in HTTP basic auth or ClientSecret:
+	// https://datatracker.ietf.org/doc/html/rfc6749#section-2.3.1
 	AccessTokenRequest struct {
-		ClientID string `query:"client_id" validate:"require"`
+		ClientID     string `query:"client_id" validate:"required"`
+		ClientSecret string `query:"client_secret"`
 
-		RedirectURI string `query:"redirect_uri" validate:"require"`
-		GrantType   string `query:"grant_type" validate:"require"`
+		RedirectURI string `query:"redirect_uri" validate:"required"`
+		GrantType   string `query:"grant_type" validate:"required"`
 
 		RefreshToken *string `query:"refresh_token"`
-		Code         *string `query:"refresh_token"`
+		Code         *string `query:"code"`
 	}
 
 	AccessTokenResponse struct {
@@ -231,23 +367,70 @@ type (
 func (s *HTTPServer) PostAccessToken(c *CustomContext) error {
 	var reqBody AccessTokenRequest
 	if err := ValidateRequest(c, &reqBody); err != nil {
-		return c.String(http.StatusBadRequest, err.Error())
+		return c.ReturnJSONErrorResponse(AuthErrInvalidRequest, utils.Ptr(err.Error()))
+	}
+	if limited, err := s.rateLimit(c, "token", reqBody.ClientID); limited {
+		return err
+	}
+	defer s.rateLimitFailure(c)
+	if ok, err := s.authenticateClient(c, reqBody); !ok {
+		return err
 	}
 
 	switch reqBody.GrantType {
 	case GrantTypeAuthorizationCode:
 		if reqBody.Code == nil {
-			return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrInvalidRequest, utils.Ptr("missing code"), nil, nil)
+			return c.ReturnJSONErrorResponse(AuthErrInvalidRequest, utils.Ptr("missing code"))
 		}
-		return s.handleAuthorizationCodeRequest(c, reqBody)
+		err := s.handleAuthorizationCodeRequest(c, reqBody)
+		observability.RecordTokenExchange(reqBody.ClientID, c.oauthOutcome())
+		return err
 	case GrantTypeRefreshToken:
 		if reqBody.RefreshToken == nil {
-			return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrInvalidRequest, utils.Ptr("missing refresh token"), nil, nil)
+			return c.ReturnJSONErrorResponse(AuthErrInvalidRequest, utils.Ptr("missing refresh token"))
 		}
-		return s.handleRefreshTokenRequest(c, reqBody)
+		err := s.handleRefreshTokenRequest(c, reqBody)
+		observability.RecordRefresh(reqBody.ClientID, c.oauthOutcome())
+		return err
 	default:
-		return c.ReturnErrorResponse(reqBody.RedirectURI, AuthErrInvalidRequest, utils.Ptr("invalid grant_type"), nil, nil)
+		return c.ReturnJSONErrorResponse(AuthErrInvalidRequest, utils.Ptr("invalid grant_type"))
+	}
+}
+
+// authenticateClient checks the client's secret, from HTTP basic auth or the client_secret param, responding with
+// invalid_client and returning false if it's missing or wrong
+func (s *HTTPServer) authenticateClient(c *CustomContext, reqBody AccessTokenRequest) (bool, error) {
+	ctx := c.Request().Context()
+	clientID, secret := reqBody.ClientID, reqBody.ClientSecret
+	if basicID, basicSecret, ok := c.Request().BasicAuth(); ok {
+		// Both are form encoded before they're put in the header
+		var err error
+		clientID, err = url.QueryUnescape(basicID)
+		if err == nil {
+			secret, err = url.QueryUnescape(basicSecret)
+		}
+		if err != nil || clientID != reqBody.ClientID {
+			return false, c.ReturnJSONErrorResponse(AuthErrInvalidClient, utils.Ptr("bad client authentication"))
+		}
+	}
+
+	var client query.Client
+	err := s.Store.Exec(ctx, time.Second*5, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: c.Tenant.ID,
+			ID:       clientID,
+		})
+		return err
+	})
+	if err != nil && !errors.Is(err, store.ErrNotFound) {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("error getting client")
+		return false, c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
 	}
+	// Unknown clients get the same answer as a wrong secret
+	if err != nil || secret == "" || subtle.ConstantTimeCompare([]byte(client.Secret), []byte(secret)) != 1 {
+		return false, c.ReturnJSONErrorResponse(AuthErrInvalidClient, utils.Ptr("bad client authentication"))
+	}
+	return true, nil
 }
 
 func (s *HTTPServer) handleAuthorizationCodeRequest(c *CustomContext, request AccessTokenRequest) error {
@@ -255,38 +438,65 @@ func (s *HTTPServer) handleAuthorizationCodeRequest(c *CustomContext, request Ac
 	logger := zerolog.Ctx(ctx)
 
 	// Generate token pair
-	refreshTokenID := utils.GenRandomIDWithSize("r_", 16)
+	refreshTokenID := ""
 	accessTokenID := utils.GenRandomIDWithSize("a_", 16)
-	err := query.ReliableExecInTx(ctx, pg.Pool, time.Second*20, func(ctx context.Context, q *query.Queries) error {
-		if utils.IsPostgres {
-			err := q.SetIsolationLevel(ctx, query.Serializable)
-			if err != nil {
-				return fmt.Errorf("error in SetIsolationLevel: %w", err)
-			}
-		}
-		code, err := q.DeleteAuthorizationCode(ctx, *request.Code)
+	var code query.AuthorizationCode
+	var policy tokenPolicy
+	err := s.Store.ExecInTx(ctx, time.Second*20, func(ctx context.Context, tx store.Tx) (err error) {
+		code, err = tx.DeleteAuthorizationCode(ctx, query.DeleteAuthorizationCodeParams{
+			TenantID: c.Tenant.ID,
+			ID:       *request.Code,
+		})
 		if err != nil {
 			return fmt.Errorf("error in SelectAuthorizationCode: %w", err)
 		}
-
-		// Insert the tokens
-		err = q.InsertRefreshToken(ctx, query.InsertRefreshTokenParams{
-			ID:       refreshTokenID,
-			ClientID: code.ClientID,
-			UserID:   code.UserID,
-			Scopes:   code.Scopes,
-			Expires:  time.Now().Add(time.Second * time.Duration(utils.RefreshTokenExpireSeconds)),
+		// Otherwise one client could redeem another's code, or pick whose rate limits it's counted against
+		if code.ClientID != request.ClientID {
+			return ErrCodeWrongClient
+		}
+		if code.RedirectUri != nil && *code.RedirectUri != request.RedirectURI {
+			return ErrCodeWrongRedirectURI
+		}
+		client, err := tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: c.Tenant.ID,
+			ID:       code.ClientID,
 		})
 		if err != nil {
-			return fmt.Errorf("error in InsertRefreshToken: %w", err)
+			return fmt.Errorf("error in SelectClient: %w", err)
+		}
+		if client.Suspended {
+			return ErrClientSuspended
+		}
+		policy = s.clientTokenPolicy(client).shorten(code.AccessTokenTtlSeconds, code.RefreshTokenTtlSeconds)
+
+		// Insert the tokens
+		now := time.Now()
+		if policy.issuesRefreshToken(code.Scopes) {
+			refreshTokenID = utils.GenRandomIDWithSize("r_", 16)
+			err = tx.InsertRefreshToken(ctx, query.InsertRefreshTokenParams{
+				TenantID: c.Tenant.ID,
+				ID:       refreshTokenID,
+				ClientID: code.ClientID,
+				UserID:   code.UserID,
+				Scopes:   code.Scopes,
+				Expires:  policy.refreshExpires(now, now),
+				Claims:   code.Claims,
+
+				GrantCreated: &now,
+			})
+			if err != nil {
+				return fmt.Errorf("error in InsertRefreshToken: %w", err)
+			}
 		}
-		err = q.InsertAccessToken(ctx, query.InsertAccessTokenParams{
+		err = tx.InsertAccessToken(ctx, query.InsertAccessTokenParams{
+			TenantID:     c.Tenant.ID,
 			ID:           accessTokenID,
 			ClientID:     code.ClientID,
 			UserID:       code.UserID,
 			Scopes:       code.Scopes,
-			Expires:      time.Now().Add(time.Second * time.Duration(utils.AccessTokenExpireSeconds)),
-			RefreshToken: utils.Ptr(refreshTokenID),
+			Expires:      now.Add(time.Second * time.Duration(policy.accessTTL)),
+			RefreshToken: lo.Ternary(refreshTokenID == "", nil, utils.Ptr(refreshTokenID)),
+			Claims:       code.Claims,
 		})
 		if err != nil {
 			return fmt.Errorf("error in InsertAccessToken: %w", err)
@@ -294,19 +504,37 @@ func (s *HTTPServer) handleAuthorizationCodeRequest(c *CustomContext, request Ac
 
 		return nil
 	})
-	if errors.Is(err, pgx.ErrNoRows) {
-		return c.ReturnErrorResponse(request.RedirectURI, AuthErrInvalidRequest, utils.Ptr("code not found"), nil, nil)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.ReturnJSONErrorResponse(AuthErrInvalidGrant, utils.Ptr("code not found"))
+	}
+	if errors.Is(err, ErrCodeWrongClient) || errors.Is(err, ErrCodeWrongRedirectURI) {
+		return c.ReturnJSONErrorResponse(AuthErrInvalidGrant, utils.Ptr(err.Error()))
+	}
+	if errors.Is(err, ErrClientSuspended) {
+		return c.ReturnJSONErrorResponse(AuthErrUnauthorizedClient, utils.Ptr(err.Error()))
 	}
 	if err != nil {
 		logger.Error().Err(err).Msg("error exchanging auth code for tokens in DB")
-		return c.ReturnErrorResponse(request.RedirectURI, AuthErrInvalidRequest, utils.Ptr("internal server error"), nil, nil)
+		return c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
+	}
+
+	event := c.auditEvent(audit.EventTokenExchanged)
+	event.Actor = code.ClientID
+	event.ClientID = utils.Ptr(code.ClientID)
+	event.UserID = utils.Ptr(code.UserID)
+	event.Details = map[string]string{
+		"grant_type": GrantTypeAuthorizationCode,
+	}
+	if err := c.recordAudit(event); err != nil {
+		logger.Error().Err(err).Msg("error recording audit event")
+		return c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
 	}
 
 	return c.JSON(http.StatusOK, AccessTokenResponse{
 		AccessToken:  accessTokenID,
 		TokenType:    BearerTokenType,
-		ExpiresIn:    int(utils.AccessTokenExpireSeconds),
-		RefreshToken: refreshTokenID,
+		ExpiresIn:    int(policy.accessTTL),
+		RefreshToken: refreshTokenID, // omitempty, the client's policy might not issue one
 	})
 }
 
@@ -315,51 +543,159 @@ func (s *HTTPServer) handleRefreshTokenRequest(c *CustomContext, request AccessT
 	logger := zerolog.Ctx(ctx)
 	start := time.Now()
 
+	// The hook is called before the transaction so it isn't held open during an HTTP call
+	var hook *provider_api.PreIssuanceResponse
+	if c.Tenant.PreIssuanceHook != nil {
+		var current query.RefreshToken
+		err := s.Store.Exec(ctx, time.Second*10, func(ctx context.Context, tx store.Tx) (err error) {
+			current, err = tx.SelectValidRefreshToken(ctx, query.SelectValidRefreshTokenParams{
+				TenantID: c.Tenant.ID,
+				ID:       *request.RefreshToken,
+			})
+			if err != nil {
+				return fmt.Errorf("error in SelectValidRefreshToken: %w", err)
+			}
+			return nil
+		})
+		if err != nil && !errors.Is(err, store.ErrNotFound) {
+			logger.Error().Err(err).Msg("error getting refresh token")
+			return c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
+		}
+
+		// Missing and revoked tokens are handled in the transaction, the provider doesn't get a say in reuse
+		if err == nil {
+			hook, err = preIssuance(ctx, c.Tenant, provider_api.PreIssuanceRequest{
+				Event:    provider_api.PreIssuanceRefreshToken,
+				UserID:   current.UserID,
+				ClientID: current.ClientID,
+				Scopes:   current.Scopes,
+				Claims:   current.Claims,
+			})
+			if err != nil {
+				errType, errDesc := providerErrorResponse(err)
+				if errType == AuthErrServerError {
+					logger.Error().Err(err).Msg("server error calling pre-issuance hook")
+				}
+				return c.ReturnJSONErrorResponse(errType, utils.Ptr(errDesc))
+			}
+			if hook.Deny {
+				return c.ReturnJSONErrorResponse(AuthErrAccessDenied, utils.Ptr(utils.Deref(hook.Reason, "denied by provider")))
+			}
+		}
+	}
+
 	// Lookup token
 	newRefreshToken := ""
 	newAccessToken := utils.GenRandomIDWithSize("a_", 16)
-	err := query.ReliableExecInTx(ctx, pg.Pool, time.Second*20, func(ctx context.Context, q *query.Queries) error {
-		if utils.IsPostgres {
-			err := q.SetIsolationLevel(ctx, query.Serializable)
+	var refreshToken query.RefreshToken
+	var policy tokenPolicy
+	reuseDetected := false
+	err := s.Store.ExecInTx(ctx, time.Second*20, func(ctx context.Context, tx store.Tx) (err error) {
+
+		refreshToken, err = tx.SelectValidRefreshToken(ctx, query.SelectValidRefreshTokenParams{
+			TenantID: c.Tenant.ID,
+			ID:       *request.RefreshToken,
+		})
+		if errors.Is(err, store.ErrNotFound) {
+			refreshToken, err = tx.SelectRefreshToken(ctx, query.SelectRefreshTokenParams{
+				TenantID: c.Tenant.ID,
+				ID:       *request.RefreshToken,
+			})
 			if err != nil {
-				return fmt.Errorf("error in SetIsolationLevel: %w", err)
+				return fmt.Errorf("error in SelectRefreshToken: %w", err)
+			}
+			if !refreshToken.Revoked {
+				return fmt.Errorf("refresh token expired: %w", store.ErrNotFound)
 			}
+			if refreshToken.ReplacedBy == nil {
+				// Revoked by an admin, a consent revocation, or a suspension
+				return ErrRefreshTokenRevoked
+			}
+			// A rotated refresh token is being used again, it's probably been leaked so kill the whole grant
+			reuseDetected = true
+			return handleRefreshTokenReuse(ctx, tx, refreshToken)
 		}
-
-		refreshToken, err := q.SelectValidRefreshToken(ctx, *request.RefreshToken)
 		if err != nil {
 			return fmt.Errorf("error in SelectValidRefreshToken: %w", err)
 		}
+		if refreshToken.ClientID != request.ClientID {
+			return ErrRefreshTokenWrongClient
+		}
 
-		expired := start.After(refreshToken.Expires)
-		if expired {
-			// If expired, we need to make a new one
-			newRefreshToken = utils.GenRandomIDWithSize("r_", 16)
-			err = q.RevokeRefreshToken(ctx, refreshToken.ID)
-			if err != nil {
-				return fmt.Errorf("error in RevokeRefreshToken: %w", err)
-			}
+		client, err := tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: refreshToken.TenantID,
+			ID:       refreshToken.ClientID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in SelectClient: %w", err)
+		}
+		// Suspending doesn't have to revoke the tokens, so the client can't be allowed to keep refreshing them
+		if client.Suspended {
+			return ErrClientSuspended
+		}
+		policy = s.clientTokenPolicy(client).shortenByHook(hook)
+		// The policy can change after the refresh token was issued
+		if !policy.issuesRefreshToken(refreshToken.Scopes) {
+			return ErrRefreshTokensDisabled
+		}
 
-			err = q.InsertRefreshToken(ctx, query.InsertRefreshTokenParams{
-				ID:       newRefreshToken,
-				ClientID: refreshToken.ClientID,
-				UserID:   refreshToken.UserID,
-				Scopes:   refreshToken.Scopes,
-				Expires:  time.Now().Add(time.Second * time.Duration(utils.RefreshTokenExpireSeconds)),
-			})
+		// Every refresh rotates the refresh token, so a leaked one being used after the client has refreshed is noticed
+		newRefreshToken = utils.GenRandomIDWithSize("r_", 16)
+		rotated, err := tx.RotateRefreshToken(ctx, query.RotateRefreshTokenParams{
+			TenantID:   refreshToken.TenantID,
+			ID:         refreshToken.ID,
+			ReplacedBy: &newRefreshToken,
+		})
+		if err != nil {
+			return fmt.Errorf("error in RotateRefreshToken: %w", err)
+		}
+		if rotated == 0 {
+			return fmt.Errorf("refresh token already rotated: %w", store.ErrNotFound)
+		}
+		grantStart := grantCreated(refreshToken)
+		err = tx.InsertRefreshToken(ctx, query.InsertRefreshTokenParams{
+			TenantID: refreshToken.TenantID,
+			ID:       newRefreshToken,
+			ClientID: refreshToken.ClientID,
+			UserID:   refreshToken.UserID,
+			Scopes:   refreshToken.Scopes,
+			// Without an idle timeout the expiry was set when the grant was exchanged
+			Expires: lo.Ternary(policy.refreshIdle > 0, policy.refreshExpires(grantStart, start), refreshToken.Expires),
+			Claims:  refreshToken.Claims,
+
+			GrantCreated: &grantStart,
+		})
+		if err != nil {
+			return fmt.Errorf("error in InsertRefreshToken: %w", err)
+		}
+		err = tx.TouchConsent(ctx, query.TouchConsentParams{
+			TenantID: refreshToken.TenantID,
+			UserID:   refreshToken.UserID,
+			ClientID: refreshToken.ClientID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in TouchConsent: %w", err)
+		}
+
+		// The hook's scopes and claims only apply to this access token, the refresh token keeps the original grant
+		accessClaims := refreshToken.Claims
+		if hook != nil {
+			accessClaims, err = hook.MergeClaims(accessClaims)
 			if err != nil {
-				return fmt.Errorf("error in InsertRefreshToken: %w", err)
+				return fmt.Errorf("error in MergeClaims: %w", err)
 			}
 		}
 
 		// Insert the new access token
-		err = q.InsertAccessToken(ctx, query.InsertAccessTokenParams{
+		err = tx.InsertAccessToken(ctx, query.InsertAccessTokenParams{
+			TenantID:     refreshToken.TenantID,
 			ID:           newAccessToken,
 			ClientID:     refreshToken.ClientID,
 			UserID:       refreshToken.UserID,
-			Scopes:       refreshToken.Scopes,
-			Expires:      time.Now().Add(time.Second * time.Duration(utils.AccessTokenExpireSeconds)),
-			RefreshToken: utils.Ptr(lo.Ternary(expired, newRefreshToken, refreshToken.ID)),
+			Scopes:       narrowScopes(refreshToken.Scopes, hook),
+			Expires:      time.Now().Add(time.Second * time.Duration(policy.accessTTL)),
+			RefreshToken: &newRefreshToken,
+			Claims:       accessClaims,
 		})
 		if err != nil {
 			return fmt.Errorf("error in InsertAccessToken: %w", err)
@@ -367,18 +703,95 @@ func (s *HTTPServer) handleRefreshTokenRequest(c *CustomContext, request AccessT
 
 		return nil
 	})
-	if errors.Is(err, pgx.ErrNoRows) {
-		return c.ReturnErrorResponse(request.RedirectURI, AuthErrInvalidRequest, utils.Ptr("refresh token not found"), nil, nil)
+	if errors.Is(err, store.ErrNotFound) {
+		return c.ReturnJSONErrorResponse(AuthErrInvalidGrant, utils.Ptr("refresh token not found"))
+	}
+	if errors.Is(err, ErrRefreshTokensDisabled) || errors.Is(err, ErrRefreshTokenRevoked) || errors.Is(err, ErrRefreshTokenWrongClient) {
+		return c.ReturnJSONErrorResponse(AuthErrInvalidGrant, utils.Ptr(err.Error()))
+	}
+	if errors.Is(err, ErrClientSuspended) {
+		return c.ReturnJSONErrorResponse(AuthErrUnauthorizedClient, utils.Ptr(err.Error()))
 	}
 	if err != nil {
 		logger.Error().Err(err).Msg("error exchanging auth code for tokens in DB")
-		return c.ReturnErrorResponse(request.RedirectURI, AuthErrInvalidRequest, utils.Ptr("internal server error"), nil, nil)
+		return c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
+	}
+	if reuseDetected {
+		s.revoked(ctx, revocation.Notice{TenantID: refreshToken.TenantID, UserID: utils.Ptr(refreshToken.UserID), ClientID: utils.Ptr(refreshToken.ClientID)})
+		logger.Warn().Str("refreshTokenID", refreshToken.ID).Str("clientID", refreshToken.ClientID).Str("userID", refreshToken.UserID).Msg("refresh token reuse detected, revoked grant")
+		return c.ReturnJSONErrorResponse(AuthErrInvalidGrant, utils.Ptr("refresh token revoked"))
+	}
+
+	event := c.auditEvent(audit.EventTokenRefreshed)
+	event.Actor = refreshToken.ClientID
+	event.ClientID = utils.Ptr(refreshToken.ClientID)
+	event.UserID = utils.Ptr(refreshToken.UserID)
+	if err := c.recordAudit(event); err != nil {
+		logger.Error().Err(err).Msg("error recording audit event")
+		return c.ReturnJSONErrorResponse(AuthErrServerError, utils.Ptr("internal server error"))
 	}
 
 	return c.JSON(http.StatusOK, AccessTokenResponse{
 		AccessToken:  newAccessToken,
 		TokenType:    BearerTokenType,
-		ExpiresIn:    int(utils.AccessTokenExpireSeconds),
-		RefreshToken: newRefreshToken, // omitempty, will only be included if old expired
+		ExpiresIn:    int(policy.accessTTL),
+		RefreshToken: newRefreshToken,
+	})
+}
+
+// handleRefreshTokenReuse revokes all of the user's tokens for the client and notifies the provider
+func handleRefreshTokenReuse(ctx context.Context, tx store.Tx, refreshToken query.RefreshToken) error {
+	params := query.RevokeAccessTokensByUserAndClientParams{
+		TenantID: refreshToken.TenantID,
+		UserID:   refreshToken.UserID,
+		ClientID: refreshToken.ClientID,
+	}
+	accessTokens, err := tx.RevokeAccessTokensByUserAndClient(ctx, params)
+	if err != nil {
+		return fmt.Errorf("error in RevokeAccessTokensByUserAndClient: %w", err)
+	}
+	refreshTokens, err := tx.RevokeRefreshTokensByUserAndClient(ctx, query.RevokeRefreshTokensByUserAndClientParams(params))
+	if err != nil {
+		return fmt.Errorf("error in RevokeRefreshTokensByUserAndClient: %w", err)
+	}
+	return tx.EnqueueWebhook(ctx, refreshToken.TenantID, webhooks.EventRefreshTokenReuse, webhooks.RefreshTokenReuseData{
+		UserID:               refreshToken.UserID,
+		ClientID:             refreshToken.ClientID,
+		RefreshTokenID:       refreshToken.ID,
+		AccessTokensRevoked:  accessTokens,
+		RefreshTokensRevoked: refreshTokens,
 	})
 }
+
+// UserInfo is the OIDC style userinfo endpoint, it returns the claims for the user of the bearer access token
+func (s *HTTPServer) UserInfo(c *CustomContext) error {
+	ctx := c.Request().Context()
+	accessTokenID, ok := parseBearerToken(c.Request().Header.Get("Authorization"))
+	if !ok {
+		c.Response().Header().Set("WWW-Authenticate", `Bearer`)
+		return c.String(http.StatusUnauthorized, "missing access token")
+	}
+
+	accessToken, err := s.validAccessToken(ctx, c.Tenant.ID, accessTokenID)
+	if errors.Is(err, store.ErrNotFound) || (err == nil && accessToken.UserID == ClientUserID) {
+		c.Response().Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		return c.String(http.StatusUnauthorized, "invalid access token")
+	}
+	if err != nil {
+		return c.InternalError(err, "error getting access token")
+	}
+
+	claims := map[string]any{}
+	if accessToken.Claims != nil {
+		err = json.Unmarshal(accessToken.Claims, &claims)
+		if err != nil {
+			return c.InternalError(err, "error in json.Unmarshal")
+		}
+	}
+	claims["sub"] = accessToken.UserID
+	if c.Tenant.Issuer != "" {
+		claims["iss"] = c.Tenant.Issuer
+	}
+
+	return c.JSON(http.StatusOK, claims)
+}
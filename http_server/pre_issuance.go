@@ -0,0 +1,59 @@
+package http_server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/provider_api"
+	"github.com/danthegoodman1/GoAPITemplate/tenants"
+	"github.com/samber/lo"
+)
+
+// preIssuance calls the tenant's pre-issuance hook, returning nil if it doesn't have one
+func preIssuance(ctx context.Context, tenant *tenants.Tenant, req provider_api.PreIssuanceRequest) (*provider_api.PreIssuanceResponse, error) {
+	if tenant.PreIssuanceHook == nil {
+		return nil, nil
+	}
+	return tenant.PreIssuanceHook.PreIssuance(ctx, req)
+}
+
+func (s *HTTPServer) accessTokenTTLSeconds() int64 {
+	return int64(s.AccessTokenTTL / time.Second)
+}
+
+func (s *HTTPServer) refreshTokenTTLSeconds() int64 {
+	return int64(s.RefreshTokenTTL / time.Second)
+}
+
+func (s *HTTPServer) refreshTokenIdleSeconds() int64 {
+	return int64(s.RefreshTokenIdleTTL / time.Second)
+}
+
+// narrowScopes applies the hook's scopes, it can only remove scopes
+func narrowScopes(scopes []string, hook *provider_api.PreIssuanceResponse) []string {
+	if hook == nil || hook.Scopes == nil {
+		return scopes
+	}
+	return lo.Intersect(scopes, hook.Scopes)
+}
+
+// shortenTTL returns the hook's TTL if it's shorter than the default
+func shortenTTL(defaultSeconds int64, hookSeconds *int64) int64 {
+	if hookSeconds != nil && *hookSeconds > 0 && *hookSeconds < defaultSeconds {
+		return *hookSeconds
+	}
+	return defaultSeconds
+}
+
+// providerErrorResponse maps an error calling the provider to an OAuth error type and description
+func providerErrorResponse(err error) (errType, errDesc string) {
+	switch {
+	case errors.Is(err, provider_api.ErrClientError):
+		return AuthErrInvalidRequest, err.Error()
+	case errors.Is(err, provider_api.ErrCircuitOpen):
+		return AuthErrTemporarilyUnavailable, "provider unavailable, try again later"
+	default:
+		return AuthErrServerError, err.Error()
+	}
+}
@@ -0,0 +1,101 @@
+package http_server
+
+import (
+	"context"
+	"errors"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/observability"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/ratelimit"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+// The OAuth errors that count towards a lockout, what guessing codes, refresh tokens, client IDs, or client secrets
+// gets. Clients don't authenticate to /oauth2/authorize, so there's no lockout of a whole client, anyone could fail
+// on its behalf.
+var lockoutErrors = []string{AuthErrInvalidGrant, AuthErrUnauthorizedClient, AuthErrInvalidClient}
+
+// rateLimit takes a token for the request's IP and then its client, responding with a 429 and returning true if
+// either is out, or the IP is locked out. The IP goes first so a throttled IP can't make us look the client up. Made up
+// client IDs only count against the IP, so they can't fill the counters. If the counters fail the request is allowed,
+// sign in shouldn't go down with them.
+func (s *HTTPServer) rateLimit(c *CustomContext, endpoint, clientID string) (bool, error) {
+	if s.RateLimiter == nil {
+		return false, nil
+	}
+	ctx := c.Request().Context()
+	wait, err := s.RateLimiter.AllowIP(ctx, c.RealIP())
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("error rate limiting, allowing the request")
+		return false, nil
+	}
+	if wait > 0 {
+		return true, tooManyRequests(c, endpoint, ratelimit.KindIP, wait)
+	}
+
+	limit, known := s.clientRateLimit(ctx, c.Tenant.ID, clientID)
+	if !known {
+		return false, nil
+	}
+	c.rateLimitClientID = clientID
+	wait, kind, err := s.RateLimiter.AllowClient(ctx, c.RealIP(), clientID, limit)
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("error rate limiting, allowing the request")
+		return false, nil
+	}
+	if wait > 0 {
+		return true, tooManyRequests(c, endpoint, kind, wait)
+	}
+	return false, nil
+}
+
+func tooManyRequests(c *CustomContext, endpoint, kind string, wait time.Duration) error {
+	observability.RecordRateLimited(endpoint, kind)
+	c.Response().Header().Set("Retry-After", strconv.FormatInt(int64(math.Ceil(wait.Seconds())), 10))
+	return c.String(http.StatusTooManyRequests, "too many requests")
+}
+
+// clientRateLimit is the client's own limit, known is false if the client doesn't exist
+func (s *HTTPServer) clientRateLimit(ctx context.Context, tenantID, clientID string) (limit ratelimit.Limit, known bool) {
+	var client query.Client
+	err := s.Store.Exec(ctx, time.Second*5, func(ctx context.Context, tx store.Tx) (err error) {
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{
+			TenantID: tenantID,
+			ID:       clientID,
+		})
+		return err
+	})
+	if errors.Is(err, store.ErrNotFound) {
+		return ratelimit.Limit{}, false
+	}
+	if err != nil {
+		zerolog.Ctx(ctx).Error().Err(err).Msg("error getting client rate limit, only limiting the IP")
+		return ratelimit.Limit{}, false
+	}
+	return ratelimit.PerMinute(utils.Deref(client.RateLimitPerMinute, 0), utils.Deref(client.RateLimitBurst, 0)), true
+}
+
+// rateLimitFailure counts the request towards a lockout if it failed with one of lockoutErrors, defer it after
+// rateLimit
+func (s *HTTPServer) rateLimitFailure(c *CustomContext) {
+	if s.RateLimiter == nil || !lo.Contains(lockoutErrors, c.OAuthError) {
+		return
+	}
+	ctx := c.Request().Context()
+	logger := zerolog.Ctx(ctx)
+	locked, err := s.RateLimiter.Fail(ctx, c.RealIP(), c.rateLimitClientID)
+	if err != nil {
+		logger.Error().Err(err).Msg("error counting rate limit failure")
+	}
+	for _, kind := range locked {
+		observability.RecordRateLimitLockout(kind)
+		logger.Warn().Str("ip", c.RealIP()).Str("ClientID", c.rateLimitClientID).Str("limit", kind).Msg("locked out after too many failures")
+	}
+}
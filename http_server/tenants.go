@@ -0,0 +1,56 @@
+package http_server
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+
+	"github.com/danthegoodman1/GoAPITemplate/tenants"
+	"github.com/labstack/echo/v4"
+)
+
+// Where ResolveTenant leaves the tenant for CreateReqContext
+var tenantKey = "tenant"
+
+// ResolveTenant finds the request's tenant. It runs before routing so the tenant's path prefix can be stripped in
+// path mode. Unknown tenants are a 404, and /hc has no tenant.
+func (s *HTTPServer) ResolveTenant(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		if s.Tenants == nil {
+			c.Set(tenantKey, s.defaultTenant)
+			return next(c)
+		}
+		req := c.Request()
+		if req.URL.Path == "/hc" {
+			return next(c)
+		}
+
+		var tenant *tenants.Tenant
+		var err error
+		if s.Tenants.Mode() == tenants.ModePath {
+			id, rest := splitTenantPath(req.URL.Path)
+			tenant, err = s.Tenants.ByID(req.Context(), id)
+			if err == nil {
+				req.URL.Path = rest
+				req.URL.RawPath = ""
+			}
+		} else {
+			tenant, err = s.Tenants.ByHost(req.Context(), req.Host)
+		}
+		if errors.Is(err, tenants.ErrNotFound) {
+			return c.String(http.StatusNotFound, "unknown tenant")
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("error resolving tenant")
+			return c.String(http.StatusInternalServerError, "internal error")
+		}
+		c.Set(tenantKey, tenant)
+		return next(c)
+	}
+}
+
+// splitTenantPath splits /acme/oauth2/token into acme and /oauth2/token
+func splitTenantPath(p string) (string, string) {
+	id, rest, _ := strings.Cut(strings.TrimPrefix(p, "/"), "/")
+	return id, "/" + rest
+}
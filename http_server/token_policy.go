@@ -0,0 +1,130 @@
+package http_server
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/provider_api"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/samber/lo"
+)
+
+var (
+	// Always known, even if the provider hasn't defined it. Clients with the offline_access refresh token policy only
+	// get refresh tokens when it's granted.
+	ScopeOfflineAccess = "offline_access"
+
+	ErrRefreshTokensDisabled = errors.New("refresh tokens disabled for client")
+	// The refresh token was revoked other than by rotation, so it's not reuse
+	ErrRefreshTokenRevoked = errors.New("refresh token revoked")
+)
+
+// tokenPolicy is a client's token lifetimes in seconds, with the server's defaults filled in
+type tokenPolicy struct {
+	accessTTL int64
+	// From when the grant was first exchanged, it's the longest a session can last
+	refreshTTL int64
+	// 0 is no idle timeout
+	refreshIdle   int64
+	refreshTokens string
+}
+
+func (s *HTTPServer) clientTokenPolicy(client query.Client) tokenPolicy {
+	return tokenPolicy{
+		accessTTL:     utils.Deref(client.AccessTokenTtlSeconds, s.accessTokenTTLSeconds()),
+		refreshTTL:    utils.Deref(client.RefreshTokenTtlSeconds, s.refreshTokenTTLSeconds()),
+		refreshIdle:   utils.Deref(client.RefreshTokenIdleSeconds, s.refreshTokenIdleSeconds()),
+		refreshTokens: client.RefreshTokenPolicy,
+	}
+}
+
+// shorten applies the pre-issuance hook's TTLs, which can only make them shorter
+func (p tokenPolicy) shorten(accessTTL, refreshTTL *int64) tokenPolicy {
+	p.accessTTL = shortenTTL(p.accessTTL, accessTTL)
+	p.refreshTTL = shortenTTL(p.refreshTTL, refreshTTL)
+	return p
+}
+
+// shortenByHook is shorten for a hook response that may be nil
+func (p tokenPolicy) shortenByHook(hook *provider_api.PreIssuanceResponse) tokenPolicy {
+	if hook == nil {
+		return p
+	}
+	return p.shorten(hook.AccessTokenTTLSeconds, hook.RefreshTokenTTLSeconds)
+}
+
+// issuesRefreshToken is whether a grant of scopes gets a refresh token, and whether it can keep being refreshed
+func (p tokenPolicy) issuesRefreshToken(scopes []string) bool {
+	switch p.refreshTokens {
+	case store.RefreshTokenPolicyNever:
+		return false
+	case store.RefreshTokenPolicyOfflineAccess:
+		return lo.Contains(scopes, ScopeOfflineAccess)
+	default:
+		return true
+	}
+}
+
+// refreshExpires is when a refresh token for a grant exchanged at grantCreated expires if it's used at now. The idle
+// timeout slides forward with each use, but never past the refresh token lifetime after the grant.
+func (p tokenPolicy) refreshExpires(grantCreated, now time.Time) time.Time {
+	expires := grantCreated.Add(time.Second * time.Duration(p.refreshTTL))
+	if p.refreshIdle > 0 {
+		if idle := now.Add(time.Second * time.Duration(p.refreshIdle)); idle.Before(expires) {
+			return idle
+		}
+	}
+	return expires
+}
+
+// grantCreated is when the refresh token's grant was first exchanged
+func grantCreated(refreshToken query.RefreshToken) time.Time {
+	return utils.Deref(refreshToken.GrantCreated, refreshToken.Created)
+}
+
+// recordAccessTokensUse sets last_used on the tenant's access tokens and their consents, at most once a minute each,
+// in one update for each table. Returns the IDs of the tokens it touched. Introspection shouldn't fail because of it,
+// so errors are only logged.
+func recordAccessTokensUse(ctx context.Context, tx store.Tx, tenantID string, accessTokens []query.AccessToken) map[string]bool {
+	touched := map[string]bool{}
+	if len(accessTokens) == 0 {
+		return touched
+	}
+	ids, err := tx.TouchAccessTokens(ctx, query.TouchAccessTokensParams{
+		TenantID: tenantID,
+		Ids: lo.Map(accessTokens, func(item query.AccessToken, index int) string {
+			return item.ID
+		}),
+	})
+	if err != nil {
+		logger.Warn().Err(err).Int("accessTokens", len(accessTokens)).Msg("error in TouchAccessTokens")
+		return touched
+	}
+	for _, id := range ids {
+		touched[id] = true
+	}
+
+	type grant struct{ userID, clientID string }
+	grants := lo.Uniq(lo.FilterMap(accessTokens, func(item query.AccessToken, index int) (grant, bool) {
+		return grant{item.UserID, item.ClientID}, touched[item.ID] && item.UserID != ClientUserID
+	}))
+	if len(grants) == 0 {
+		return touched
+	}
+	err = tx.TouchConsents(ctx, query.TouchConsentsParams{
+		TenantID: tenantID,
+		UserIds: lo.Map(grants, func(item grant, index int) string {
+			return item.userID
+		}),
+		ClientIds: lo.Map(grants, func(item grant, index int) string {
+			return item.clientID
+		}),
+	})
+	if err != nil {
+		logger.Warn().Err(err).Int("consents", len(grants)).Msg("error in TouchConsents")
+	}
+	return touched
+}
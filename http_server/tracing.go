@@ -0,0 +1,35 @@
+package http_server
+
+import (
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/propagation"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+var tracer = otel.GetTracerProvider().Tracer("http")
+
+// TracingMiddleware starts a server span for every request, continuing the trace from an incoming traceparent header
+func TracingMiddleware(next echo.HandlerFunc) echo.HandlerFunc {
+	return func(c echo.Context) error {
+		req := c.Request()
+		ctx := otel.GetTextMapPropagator().Extract(req.Context(), propagation.HeaderCarrier(req.Header))
+		route := c.Path()
+		ctx, span := tracer.Start(ctx, req.Method+" "+route,
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(semconv.HTTPServerAttributesFromHTTPRequest("continuewith", route, req)...),
+		)
+		defer span.End()
+		c.SetRequest(req.WithContext(ctx))
+
+		err := next(c)
+		if err != nil {
+			span.RecordError(err)
+		}
+		status := c.Response().Status
+		span.SetAttributes(semconv.HTTPAttributesFromHTTPStatusCode(status)...)
+		span.SetStatus(semconv.SpanStatusFromHTTPStatusCode(status))
+		return err
+	}
+}
@@ -0,0 +1,238 @@
+package http_server
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/danthegoodman1/GoAPITemplate/webhooks"
+	"github.com/samber/lo"
+)
+
+type (
+	CreateWebhookSubscriptionRequest struct {
+		URL        string   `json:"url" validate:"required,url"`
+		EventTypes []string `json:"event_types" validate:"required,min=1"`
+	}
+
+	WebhookSubscriptionResponse struct {
+		ID         string
+		URL        string
+		EventTypes []string
+		Disabled   bool
+		Created    time.Time
+		Updated    time.Time
+	}
+
+	CreateWebhookSubscriptionResponse struct {
+		WebhookSubscriptionResponse
+		// Only returned on creation, used to verify the signature header
+		Secret string
+	}
+)
+
+func webhookSubscriptionToResponse(sub query.WebhookSubscription) WebhookSubscriptionResponse {
+	return WebhookSubscriptionResponse{
+		ID:         sub.ID,
+		URL:        sub.Url,
+		EventTypes: sub.EventTypes,
+		Disabled:   sub.Disabled,
+		Created:    sub.Created,
+		Updated:    sub.Updated,
+	}
+}
+
+func (s *HTTPServer) CreateWebhookSubscription(c *CustomContext) error {
+	ctx := c.Request().Context()
+	var reqBody CreateWebhookSubscriptionRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+
+	_, unknownEvents := lo.Difference(webhooks.EventTypes, reqBody.EventTypes)
+	if len(unknownEvents) > 0 {
+		return c.String(http.StatusBadRequest, fmt.Sprintf("unknown event types: %+v", unknownEvents))
+	}
+
+	var sub query.WebhookSubscription
+	err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		sub, err = q.InsertWebhookSubscription(ctx, query.InsertWebhookSubscriptionParams{
+			TenantID:   c.Tenant.ID,
+			ID:         utils.GenRandomID("wh_"),
+			Url:        reqBody.URL,
+			Secret:     utils.GenRandomIDWithSize("whsec_", 32),
+			EventTypes: lo.Uniq(reqBody.EventTypes),
+		})
+		if err != nil {
+			return fmt.Errorf("error in InsertWebhookSubscription: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error creating webhook subscription")
+	}
+
+	return c.JSON(http.StatusOK, CreateWebhookSubscriptionResponse{
+		WebhookSubscriptionResponse: webhookSubscriptionToResponse(sub),
+		Secret:                      sub.Secret,
+	})
+}
+
+func (s *HTTPServer) ListWebhookSubscriptions(c *CustomContext) error {
+	ctx := c.Request().Context()
+
+	var subs []query.WebhookSubscription
+	err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		subs, err = q.ListWebhookSubscriptions(ctx, c.Tenant.ID)
+		if err != nil {
+			return fmt.Errorf("error in ListWebhookSubscriptions: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error listing webhook subscriptions")
+	}
+
+	return c.JSON(http.StatusOK, lo.Map(subs, func(item query.WebhookSubscription, index int) WebhookSubscriptionResponse {
+		return webhookSubscriptionToResponse(item)
+	}))
+}
+
+func (s *HTTPServer) DeleteWebhookSubscription(c *CustomContext) error {
+	ctx := c.Request().Context()
+	subID := c.Param("subscriptionID")
+
+	var rows int64
+	err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		rows, err = q.DeleteWebhookSubscription(ctx, query.DeleteWebhookSubscriptionParams{
+			TenantID: c.Tenant.ID,
+			ID:       subID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in DeleteWebhookSubscription: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error deleting webhook subscription")
+	}
+	if rows == 0 {
+		return c.String(http.StatusNotFound, "webhook subscription not found")
+	}
+
+	return c.NoContent(http.StatusOK)
+}
+
+type (
+	ListWebhookDeliveriesRequest struct {
+		// pending, delivered, or failed
+		Status         *string `query:"status"`
+		SubscriptionID *string `query:"subscription_id"`
+		BeforeID       *string `query:"before_id"`
+		Limit          int32   `query:"limit" validate:"gte=0,lte=1000"`
+	}
+
+	WebhookDeliveryResponse struct {
+		ID             string
+		SubscriptionID string
+		EventID        string
+		EventType      string
+		Payload        json.RawMessage
+		Status         string
+		Attempts       int64
+		NextAttempt    time.Time
+		LastStatusCode *int64
+		LastError      *string
+		Delivered      *time.Time
+		Created        time.Time
+		Updated        time.Time
+	}
+
+	ListWebhookDeliveriesResponse struct {
+		Deliveries []WebhookDeliveryResponse
+		// Pass as before_id to get the next page, omitted on the last page
+		NextBeforeID *string `json:",omitempty"`
+	}
+)
+
+func (s *HTTPServer) ListWebhookDeliveries(c *CustomContext) error {
+	ctx := c.Request().Context()
+	var reqBody ListWebhookDeliveriesRequest
+	if err := ValidateRequest(c, &reqBody); err != nil {
+		return c.String(http.StatusBadRequest, err.Error())
+	}
+	limit := lo.Ternary(reqBody.Limit == 0, 100, reqBody.Limit)
+
+	var deliveries []query.WebhookDelivery
+	err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		deliveries, err = q.ListWebhookDeliveries(ctx, query.ListWebhookDeliveriesParams{
+			TenantID:       c.Tenant.ID,
+			Status:         reqBody.Status,
+			SubscriptionID: reqBody.SubscriptionID,
+			BeforeID:       reqBody.BeforeID,
+			RowLimit:       limit,
+		})
+		if err != nil {
+			return fmt.Errorf("error in ListWebhookDeliveries: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error listing webhook deliveries")
+	}
+
+	res := ListWebhookDeliveriesResponse{
+		Deliveries: lo.Map(deliveries, func(item query.WebhookDelivery, index int) WebhookDeliveryResponse {
+			return WebhookDeliveryResponse{
+				ID:             item.ID,
+				SubscriptionID: item.SubscriptionID,
+				EventID:        item.EventID,
+				EventType:      item.EventType,
+				Payload:        item.Payload,
+				Status:         item.Status,
+				Attempts:       item.Attempts,
+				NextAttempt:    item.NextAttempt,
+				LastStatusCode: item.LastStatusCode,
+				LastError:      item.LastError,
+				Delivered:      item.Delivered,
+				Created:        item.Created,
+				Updated:        item.Updated,
+			}
+		}),
+	}
+	if len(deliveries) == int(limit) {
+		res.NextBeforeID = utils.Ptr(deliveries[len(deliveries)-1].ID)
+	}
+
+	return c.JSON(http.StatusOK, res)
+}
+
+// ReplayWebhookDelivery puts a delivery back in the outbox with a fresh set of attempts
+func (s *HTTPServer) ReplayWebhookDelivery(c *CustomContext) error {
+	ctx := c.Request().Context()
+	deliveryID := c.Param("deliveryID")
+
+	var rows int64
+	err := query.ReliableExec(ctx, s.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		rows, err = q.ReplayWebhookDelivery(ctx, query.ReplayWebhookDeliveryParams{
+			TenantID: c.Tenant.ID,
+			ID:       deliveryID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in ReplayWebhookDelivery: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return c.InternalError(err, "error replaying webhook delivery")
+	}
+	if rows == 0 {
+		return c.String(http.StatusNotFound, "webhook delivery not found")
+	}
+
+	return c.NoContent(http.StatusOK)
+}
@@ -0,0 +1,158 @@
+package janitor
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/pg"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/uber-go/tally/v4"
+)
+
+var logger = gologger.NewLogger()
+
+// Janitor deletes expired and revoked codes and tokens. Every replica runs one, but a
+// Postgres advisory lock makes sure only one of them is cleaning at a time.
+type Janitor struct {
+	cfg   Config
+	scope tally.Scope
+	stop  chan struct{}
+	done  chan struct{}
+}
+
+type Config struct {
+	Pool     *pgxpool.Pool
+	Interval time.Duration
+	// How long expired and revoked rows are kept after they stop working, refresh token reuse detection needs them
+	Retention time.Duration
+	// Rows deleted per statement
+	BatchSize int64
+}
+
+type table struct {
+	name   string
+	delete func(ctx context.Context, q *query.Queries, before time.Time, limit int32) (int64, error)
+}
+
+var tables = []table{
+	{
+		name: "authorization_codes",
+		delete: func(ctx context.Context, q *query.Queries, before time.Time, limit int32) (int64, error) {
+			return q.DeleteExpiredAuthorizationCodes(ctx, query.DeleteExpiredAuthorizationCodesParams{Before: before, RowLimit: limit})
+		},
+	},
+	{
+		name: "access_tokens",
+		delete: func(ctx context.Context, q *query.Queries, before time.Time, limit int32) (int64, error) {
+			return q.DeleteExpiredAccessTokens(ctx, query.DeleteExpiredAccessTokensParams{Before: before, RowLimit: limit})
+		},
+	},
+	{
+		name: "refresh_tokens",
+		delete: func(ctx context.Context, q *query.Queries, before time.Time, limit int32) (int64, error) {
+			return q.DeleteExpiredRefreshTokens(ctx, query.DeleteExpiredRefreshTokensParams{Before: before, RowLimit: limit})
+		},
+	},
+	{
+		// Idle buckets don't need retention, they're only kept for the next request
+		name: "rate_limits",
+		delete: func(ctx context.Context, q *query.Queries, before time.Time, limit int32) (int64, error) {
+			return q.DeleteIdleRateLimits(ctx, limit)
+		},
+	},
+}
+
+func Start(cfg Config, scope tally.Scope) *Janitor {
+	j := &Janitor{
+		cfg:   cfg,
+		scope: scope.SubScope("janitor"),
+		stop:  make(chan struct{}),
+		done:  make(chan struct{}),
+	}
+	go j.run()
+	return j
+}
+
+func (j *Janitor) Shutdown(ctx context.Context) error {
+	close(j.stop)
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *Janitor) run() {
+	defer close(j.done)
+	ticker := time.NewTicker(j.cfg.Interval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithCancel(context.Background())
+			go func() {
+				// Stop mid-run on shutdown, batches are small so nothing is left half done
+				select {
+				case <-j.stop:
+					cancel()
+				case <-ctx.Done():
+				}
+			}()
+			ran, err := pg.WithAdvisoryLock(ctx, j.cfg.Pool, pg.AdvisoryLockJanitor, func(ctx context.Context) error {
+				return Clean(ctx, j.cfg, j.scope)
+			})
+			cancel()
+			if err != nil {
+				logger.Error().Err(err).Msg("error running janitor")
+				j.scope.Counter("errors").Inc(1)
+			} else if !ran {
+				logger.Debug().Msg("janitor lock held by another replica, skipping")
+				j.scope.Counter("skipped").Inc(1)
+			}
+		}
+	}
+}
+
+// Clean deletes expired rows from every table. It does not take the advisory lock, callers must make sure it only runs once at a time.
+func Clean(ctx context.Context, cfg Config, scope tally.Scope) error {
+	sw := scope.Timer("run_latency").Start()
+	defer sw.Stop()
+	before := time.Now().Add(-cfg.Retention)
+
+	for _, t := range tables {
+		deleted, err := cleanTable(ctx, cfg, t, before)
+		scope.Tagged(map[string]string{"table": t.name}).Counter("deleted_rows").Inc(deleted)
+		if err != nil {
+			return fmt.Errorf("error cleaning %s: %w", t.name, err)
+		}
+		if deleted > 0 {
+			logger.Info().Str("table", t.name).Int64("deleted", deleted).Msg("janitor deleted expired rows")
+		}
+	}
+	return nil
+}
+
+// cleanTable deletes in small batches so we never hold locks on a large number of rows
+func cleanTable(ctx context.Context, cfg Config, t table, before time.Time) (int64, error) {
+	var total int64
+	for {
+		var deleted int64
+		err := query.ReliableExec(ctx, cfg.Pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+			deleted, err = t.delete(ctx, q, before, int32(cfg.BatchSize))
+			return
+		})
+		if err != nil {
+			return total, err
+		}
+		total += deleted
+		if deleted < cfg.BatchSize {
+			return total, nil
+		}
+	}
+}
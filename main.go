@@ -3,6 +3,7 @@ package main
 import (
 	"context"
 	"errors"
+	"flag"
 	"fmt"
 	"github.com/danthegoodman1/GoAPITemplate/observability"
 	"github.com/joho/godotenv"
@@ -12,11 +13,23 @@ import (
 	"syscall"
 	"time"
 
+	"github.com/danthegoodman1/GoAPITemplate/audit"
+	"github.com/danthegoodman1/GoAPITemplate/cli"
 	"github.com/danthegoodman1/GoAPITemplate/gologger"
 	"github.com/danthegoodman1/GoAPITemplate/http_server"
+	"github.com/danthegoodman1/GoAPITemplate/janitor"
 	"github.com/danthegoodman1/GoAPITemplate/migrations"
 	"github.com/danthegoodman1/GoAPITemplate/pg"
+	"github.com/danthegoodman1/GoAPITemplate/provider_api"
+	"github.com/danthegoodman1/GoAPITemplate/ratelimit"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/tenants"
+	"github.com/danthegoodman1/GoAPITemplate/tokencache"
 	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/danthegoodman1/GoAPITemplate/webhooks"
+	"github.com/danthegoodman1/GoAPITemplate/workflows"
+	"github.com/jackc/pgx/v5/pgxpool"
 )
 
 var logger = gologger.NewLogger()
@@ -29,27 +42,201 @@ func main() {
 			os.Exit(1)
 		}
 	}
-	logger.Debug().Msg("starting Tangia mono api")
 
-	if err := pg.ConnectToDB(); err != nil {
-		logger.Error().Err(err).Msg("error connecting to CRDB")
+	args := os.Args[1:]
+	if len(args) == 0 || args[0] == "serve" {
+		serve()
+		return
+	}
+	if args[0] == "help" || args[0] == "-h" || args[0] == "--help" {
+		fmt.Print(cli.Usage())
+		return
+	}
+	err := cli.Run(context.Background(), os.Stdout, args)
+	switch {
+	case errors.Is(err, flag.ErrHelp):
+		return
+	case errors.Is(err, cli.ErrUsage):
+		fmt.Fprintf(os.Stderr, "%s\n\n%s", err, cli.Usage())
+		os.Exit(2)
+	case err != nil:
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func serve() {
+	if err := utils.LoadConfig(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
 		os.Exit(1)
 	}
+	logger.Debug().Msg("starting Tangia mono api")
 
-	err := migrations.CheckMigrations(utils.PGDSN)
+	shutdownTracing, err := observability.InitTracing(context.Background())
 	if err != nil {
-		logger.Error().Err(err).Msg("Error checking migrations")
+		logger.Error().Err(err).Msg("error initializing tracing")
 		os.Exit(1)
 	}
 
-	prometheusReporter := observability.NewPrometheusReporter()
-	err = observability.StartInternalHTTPServer(":8042", prometheusReporter)
-	if err != nil && !errors.Is(err, http.ErrServerClosed) {
-		logger.Error().Err(err).Msg("internal server couldn't start")
+	var st store.Store
+	// Only set with the postgres store
+	var pool *pgxpool.Pool
+	switch utils.Store {
+	case store.KindPostgres:
+		pool, err = pg.ConnectToDB()
+		if err != nil {
+			logger.Error().Err(err).Msg("error connecting to CRDB")
+			os.Exit(1)
+		}
+
+		if utils.AutoMigrate {
+			applied, err := migrations.RunMigrations(context.Background(), utils.PGDSN, migrations.Up, 0)
+			if err != nil {
+				logger.Error().Err(err).Msg("error running migrations")
+				os.Exit(1)
+			}
+			logger.Info().Int("applied", applied).Msg("ran migrations")
+		}
+		err = migrations.CheckMigrations(utils.PGDSN)
+		if err != nil {
+			logger.Error().Err(err).Msg("Error checking migrations")
+			os.Exit(1)
+		}
+		st = store.NewPostgres(pool, utils.IsPostgres)
+	case store.KindSQLite:
+		sqliteStore, err := store.OpenSQLite(utils.SQLitePath)
+		if err != nil {
+			logger.Error().Err(err).Msg("error opening sqlite store")
+			os.Exit(1)
+		}
+		defer sqliteStore.Close()
+		st = sqliteStore
+	case store.KindMemory:
+		logger.Warn().Msg("using the memory store, nothing will be persisted")
+		st = store.NewMemory()
+	default:
+		logger.Error().Str("store", utils.Store).Msg("unknown STORE, use postgres, sqlite, or memory")
 		os.Exit(1)
 	}
 
-	httpServer := http_server.StartHTTPServer()
+	prometheusReporter := observability.NewPrometheusReporter()
+	go func() {
+		err := observability.StartInternalHTTPServer(utils.InternalHTTPAddr, prometheusReporter)
+		if err != nil && !errors.Is(err, http.ErrServerClosed) {
+			logger.Error().Err(err).Msg("internal server couldn't start")
+			os.Exit(1)
+		}
+	}()
+	metricsScope, metricsCloser := observability.NewRootScope(prometheusReporter)
+	defer metricsCloser.Close()
+	observability.InitMetrics(metricsScope)
+
+	revocationNotifier := revocation.NewNotifier(pool, utils.IsPostgres)
+	var introspectionCache *tokencache.Cache
+	var revocationListener *revocation.Listener
+	if utils.IntrospectionCacheSize > 0 {
+		introspectionCache = tokencache.New(int(utils.IntrospectionCacheSize), time.Second*time.Duration(utils.IntrospectionCacheTTLSeconds))
+		if revocationNotifier != nil {
+			revocationListener = revocation.StartListener(pool, func(notice revocation.Notice) {
+				observability.RecordIntrospectionCacheEvictions(introspectionCache.Evict(notice))
+			})
+		} else if pool != nil {
+			logger.Warn().Int64("cacheTTLSeconds", utils.IntrospectionCacheTTLSeconds).Msg("CRDB doesn't have LISTEN/NOTIFY, tokens revoked by other replicas stay in the introspection cache until they expire from it")
+		}
+	}
+
+	var auditRecorder *audit.Recorder
+	if pool != nil {
+		auditRecorder = audit.StartRecorder(pool, utils.IsPostgres)
+	}
+
+	// With temporal, cleanup and webhook delivery run as workflows instead
+	var temporalWorker *workflows.Worker
+	var webhookWorker *webhooks.Worker
+	var janitorWorker *janitor.Janitor
+	janitorConfig := janitor.Config{
+		Pool:      pool,
+		Interval:  time.Second * time.Duration(utils.JanitorIntervalSeconds),
+		Retention: time.Hour * time.Duration(utils.JanitorRetentionHours),
+		BatchSize: utils.JanitorBatchSize,
+	}
+	if pool == nil {
+		// Jobs only work against postgres
+		if utils.TemporalHostPort != "" {
+			logger.Error().Msg("temporal requires the postgres store")
+			os.Exit(1)
+		}
+	} else if utils.TemporalHostPort != "" {
+		temporalWorker, err = workflows.Start(context.Background(), workflows.Config{
+			HostPort:           utils.TemporalHostPort,
+			Namespace:          utils.TemporalNamespace,
+			TaskQueue:          utils.TemporalTaskQueue,
+			Pool:               pool,
+			IsPostgres:         utils.IsPostgres,
+			Janitor:            janitorConfig,
+			WebhookMaxAttempts: utils.WebhookMaxAttempts,
+			Scope:              metricsScope,
+		})
+		if err != nil {
+			logger.Error().Err(err).Msg("error starting temporal worker")
+			os.Exit(1)
+		}
+	} else {
+		webhookWorker = webhooks.StartWorker(webhooks.NewDeliverer(pool, utils.WebhookMaxAttempts))
+		janitorWorker = janitor.Start(janitorConfig, metricsScope)
+	}
+
+	rateLimiter := &ratelimit.Limiter{
+		Counters: ratelimit.NewMemory(),
+		IP:       ratelimit.PerMinute(utils.RateLimitIPPerMinute, utils.RateLimitIPBurst),
+		Client:   ratelimit.PerMinute(utils.RateLimitClientPerMinute, utils.RateLimitClientBurst),
+		Lockout: ratelimit.Lockout{
+			IPMaxFailures:       utils.RateLimitIPMaxFailures,
+			IPClientMaxFailures: utils.RateLimitIPClientMaxFailures,
+			Window:              time.Second * time.Duration(utils.RateLimitFailureWindowSeconds),
+			Duration:            time.Second * time.Duration(utils.RateLimitLockoutSeconds),
+		},
+	}
+	if utils.RateLimitCounters == "postgres" {
+		rateLimiter.Counters = ratelimit.NewPostgres(pool)
+	}
+
+	providerOptions := provider_api.Options{
+		Secret:             utils.ProviderSecret,
+		UserExchangeURL:    utils.ProviderAPIUserExchange,
+		PreIssuanceHookURL: utils.PreIssuanceHookURL,
+		Timeout:            time.Millisecond * time.Duration(utils.ProviderTimeoutMS),
+		MaxRetries:         uint64(utils.ProviderMaxRetries),
+		BreakerFailures:    utils.ProviderBreakerFailures,
+		BreakerCooldown:    time.Second * time.Duration(utils.ProviderBreakerCooldownSeconds),
+	}
+	providerClient := provider_api.NewClient(providerOptions)
+	httpConfig := http_server.Config{
+		Store:           st,
+		UserExchanger:   providerClient,
+		Pool:            pool,
+		AccessTokenTTL:  time.Second * time.Duration(utils.AccessTokenExpireSeconds),
+		RefreshTokenTTL: time.Second * time.Duration(utils.RefreshTokenExpireSeconds),
+		CodeTTL:         time.Second * time.Duration(utils.AuthorizationCodeExpireSeconds),
+
+		RefreshTokenIdleTTL: time.Second * time.Duration(utils.RefreshTokenIdleSeconds),
+		AdminKey:            utils.AdminKey,
+		Issuer:              utils.Issuer,
+		IntrospectionCache:  introspectionCache,
+		RevocationNotifier:  revocationNotifier,
+		Temporal:            temporalWorker,
+		AuditRecorder:       auditRecorder,
+		RateLimiter:         rateLimiter,
+		TrustedProxies:      utils.TrustedProxies,
+		Logger:              gologger.NewLogger(),
+	}
+	if utils.PreIssuanceHookURL != "" {
+		httpConfig.PreIssuanceHook = providerClient
+	}
+	if utils.TenantMode != tenants.ModeSingle {
+		httpConfig.Tenants = tenants.NewRegistry(pool, utils.TenantMode, time.Second*time.Duration(utils.TenantCacheSeconds), providerOptions, utils.Issuer)
+	}
+	httpServer := http_server.StartHTTPServer(httpConfig, ":"+utils.HTTPPort)
 
 	c := make(chan os.Signal, 1)
 	signal.Notify(c, os.Interrupt, syscall.SIGTERM)
@@ -57,8 +244,7 @@ func main() {
 	logger.Warn().Msg("received shutdown signal!")
 
 	// For AWS ALB needing some time to de-register pod
-	// Convert the time to seconds
-	sleepTime := utils.GetEnvOrDefaultInt("SHUTDOWN_SLEEP_SEC", 0)
+	sleepTime := utils.ShutdownSleepSeconds
 	logger.Info().Msg(fmt.Sprintf("sleeping for %ds before exiting", sleepTime))
 
 	time.Sleep(time.Second * time.Duration(sleepTime))
@@ -71,4 +257,39 @@ func main() {
 	} else {
 		logger.Info().Msg("successfully shutdown HTTP server")
 	}
+	if auditRecorder != nil {
+		if err := auditRecorder.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("failed to flush audit events")
+		} else {
+			logger.Info().Msg("successfully flushed audit events")
+		}
+	}
+	if revocationListener != nil {
+		if err := revocationListener.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("failed to shutdown revocation listener")
+		} else {
+			logger.Info().Msg("successfully shutdown revocation listener")
+		}
+	}
+	if temporalWorker != nil {
+		if err := temporalWorker.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("failed to shutdown temporal worker")
+		} else {
+			logger.Info().Msg("successfully shutdown temporal worker")
+		}
+	} else if webhookWorker != nil {
+		if err := webhookWorker.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("failed to shutdown webhook worker")
+		} else {
+			logger.Info().Msg("successfully shutdown webhook worker")
+		}
+		if err := janitorWorker.Shutdown(ctx); err != nil {
+			logger.Error().Err(err).Msg("failed to shutdown janitor")
+		} else {
+			logger.Info().Msg("successfully shutdown janitor")
+		}
+	}
+	if err := shutdownTracing(ctx); err != nil {
+		logger.Error().Err(err).Msg("failed to flush traces")
+	}
 }
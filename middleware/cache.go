@@ -0,0 +1,79 @@
+package middleware
+
+import (
+	"crypto/sha256"
+	"sync"
+	"time"
+)
+
+// cache holds valid tokens until the TTL or the token's expiry, whichever is first.
+// Invalid tokens aren't cached, so a token can't be cached as invalid and then start working.
+type cache struct {
+	ttl        time.Duration
+	maxEntries int
+
+	mu      sync.Mutex
+	entries map[[sha256.Size]byte]cacheEntry
+}
+
+type cacheEntry struct {
+	info    *TokenInfo
+	expires time.Time
+}
+
+func newCache(ttl time.Duration, maxEntries int) *cache {
+	return &cache{
+		ttl:        ttl,
+		maxEntries: maxEntries,
+		entries:    map[[sha256.Size]byte]cacheEntry{},
+	}
+}
+
+// Keyed by hash so the tokens themselves aren't kept in memory
+func cacheKey(token string) [sha256.Size]byte {
+	return sha256.Sum256([]byte(token))
+}
+
+func (c *cache) get(token string) (*TokenInfo, bool) {
+	key := cacheKey(token)
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	entry, ok := c.entries[key]
+	if !ok {
+		return nil, false
+	}
+	if !time.Now().Before(entry.expires) {
+		delete(c.entries, key)
+		return nil, false
+	}
+	return entry.info, true
+}
+
+func (c *cache) set(token string, info *TokenInfo) {
+	now := time.Now()
+	expires := now.Add(c.ttl)
+	if !info.Expires.IsZero() && info.Expires.Before(expires) {
+		expires = info.Expires
+	}
+	if !now.Before(expires) {
+		return
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if len(c.entries) >= c.maxEntries {
+		for key, entry := range c.entries {
+			if !now.Before(entry.expires) {
+				delete(c.entries, key)
+			}
+		}
+		// Still full, drop whatever map iteration gives us first
+		for key := range c.entries {
+			if len(c.entries) < c.maxEntries {
+				break
+			}
+			delete(c.entries, key)
+		}
+	}
+	c.entries[cacheKey(token)] = cacheEntry{info: info, expires: expires}
+}
@@ -0,0 +1,119 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+)
+
+var (
+	DefaultCacheTTL        = time.Minute
+	DefaultCacheMaxEntries = 10_000
+)
+
+type IntrospectionOptions struct {
+	// Where ContinueWith is, e.g. https://auth.example.com
+	URL string
+	// Needs the tokens:introspect permission
+	AdminKey string
+
+	// Default has a 5 second timeout
+	HTTPClient *http.Client
+	// How long a valid token is cached, never past the token's expiry. A revoked token keeps working until it
+	// drops out of the cache. Default DefaultCacheTTL, negative disables caching.
+	CacheTTL time.Duration
+	// Default DefaultCacheMaxEntries
+	CacheMaxEntries int
+}
+
+// Introspector validates tokens with ContinueWith's GET /admin/access_token/:accessToken
+type Introspector struct {
+	opts  IntrospectionOptions
+	cache *cache
+}
+
+// introspectionResponse is http_server.VerifyAccessTokenResponse
+type introspectionResponse struct {
+	UserID               string
+	CreatedMS, ExpiresMS int64
+	Scopes               []string
+	Claims               json.RawMessage
+}
+
+func NewIntrospector(opts IntrospectionOptions) *Introspector {
+	opts.URL = strings.TrimSuffix(opts.URL, "/")
+	if opts.HTTPClient == nil {
+		opts.HTTPClient = &http.Client{Timeout: time.Second * 5}
+	}
+	if opts.CacheTTL == 0 {
+		opts.CacheTTL = DefaultCacheTTL
+	}
+	if opts.CacheMaxEntries <= 0 {
+		opts.CacheMaxEntries = DefaultCacheMaxEntries
+	}
+	i := &Introspector{opts: opts}
+	if opts.CacheTTL > 0 {
+		i.cache = newCache(opts.CacheTTL, opts.CacheMaxEntries)
+	}
+	return i
+}
+
+func (i *Introspector) Validate(ctx context.Context, token string) (*TokenInfo, error) {
+	if i.cache != nil {
+		if info, ok := i.cache.get(token); ok {
+			return info, nil
+		}
+	}
+
+	info, err := i.introspect(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	if i.cache != nil {
+		i.cache.set(token, info)
+	}
+	return info, nil
+}
+
+func (i *Introspector) introspect(ctx context.Context, token string) (*TokenInfo, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, i.opts.URL+"/admin/access_token/"+url.PathEscape(token), nil)
+	if err != nil {
+		return nil, fmt.Errorf("error in http.NewRequestWithContext: %w", err)
+	}
+	req.Header.Set("Authorization", "Bearer "+i.opts.AdminKey)
+
+	res, err := i.opts.HTTPClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error in httpClient.Do: %w", err)
+	}
+	defer res.Body.Close()
+
+	resBytes, err := io.ReadAll(io.LimitReader(res.Body, 1<<20))
+	if err != nil {
+		return nil, fmt.Errorf("error in io.ReadAll: %w", err)
+	}
+	switch {
+	case res.StatusCode == http.StatusNotFound:
+		return nil, ErrInvalidToken
+	case res.StatusCode > 299:
+		// A 401 or 403 here is our admin key, not the user's token
+		return nil, fmt.Errorf("introspection failed: %d - %s", res.StatusCode, resBytes)
+	}
+
+	var resBody introspectionResponse
+	err = json.Unmarshal(resBytes, &resBody)
+	if err != nil {
+		return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	return &TokenInfo{
+		UserID:  resBody.UserID,
+		Scopes:  resBody.Scopes,
+		Expires: time.UnixMilli(resBody.ExpiresMS),
+		Claims:  resBody.Claims,
+	}, nil
+}
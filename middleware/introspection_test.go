@@ -0,0 +1,191 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+// fakeContinueWith answers introspection for the tokens it has, a token of "broken" is a server error
+type fakeContinueWith struct {
+	mu     sync.Mutex
+	tokens map[string]introspectionResponse
+	calls  int
+}
+
+func (f *fakeContinueWith) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.calls++
+	if r.Header.Get("Authorization") != "Bearer adm" {
+		http.Error(w, "invalid auth header", http.StatusUnauthorized)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, "/admin/access_token/")
+	if token == "broken" {
+		http.Error(w, "internal error", http.StatusInternalServerError)
+		return
+	}
+	res, ok := f.tokens[token]
+	if !ok {
+		http.Error(w, "access token not found", http.StatusNotFound)
+		return
+	}
+	_ = json.NewEncoder(w).Encode(res)
+}
+
+func (f *fakeContinueWith) callCount() int {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.calls
+}
+
+func newIntrospector(t *testing.T, opts IntrospectionOptions) (*fakeContinueWith, *Introspector) {
+	fake := &fakeContinueWith{tokens: map[string]introspectionResponse{
+		"a_good": {
+			UserID:    "u1",
+			ExpiresMS: time.Now().Add(time.Hour).UnixMilli(),
+			Scopes:    []string{"pages:read"},
+			Claims:    json.RawMessage(`{"email":"ada@example.com"}`),
+		},
+	}}
+	srv := httptest.NewServer(fake)
+	t.Cleanup(srv.Close)
+	opts.URL = srv.URL + "/"
+	if opts.AdminKey == "" {
+		opts.AdminKey = "adm"
+	}
+	return fake, NewIntrospector(opts)
+}
+
+func TestIntrospection(t *testing.T) {
+	ctx := context.Background()
+	_, v := newIntrospector(t, IntrospectionOptions{})
+
+	info, err := v.Validate(ctx, "a_good")
+	require.NoError(t, err)
+	require.Equal(t, "u1", info.UserID)
+	require.Equal(t, []string{"pages:read"}, info.Scopes)
+	require.JSONEq(t, `{"email":"ada@example.com"}`, string(info.Claims))
+	require.WithinDuration(t, time.Now().Add(time.Hour), info.Expires, time.Second)
+
+	_, err = v.Validate(ctx, "a_made_up")
+	require.ErrorIs(t, err, ErrInvalidToken)
+
+	// Not the token's fault, so not ErrInvalidToken
+	_, err = v.Validate(ctx, "broken")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidToken)
+
+	_, badKey := newIntrospector(t, IntrospectionOptions{AdminKey: "wrong"})
+	_, err = badKey.Validate(ctx, "a_good")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrInvalidToken)
+}
+
+func TestIntrospectionCache(t *testing.T) {
+	ctx := context.Background()
+	fake, v := newIntrospector(t, IntrospectionOptions{CacheTTL: time.Millisecond * 50})
+
+	for i := 0; i < 3; i++ {
+		_, err := v.Validate(ctx, "a_good")
+		require.NoError(t, err)
+	}
+	require.Equal(t, 1, fake.callCount())
+
+	// Cached for the TTL at most
+	time.Sleep(time.Millisecond * 60)
+	_, err := v.Validate(ctx, "a_good")
+	require.NoError(t, err)
+	require.Equal(t, 2, fake.callCount())
+
+	// Invalid tokens aren't cached
+	_, err = v.Validate(ctx, "a_made_up")
+	require.ErrorIs(t, err, ErrInvalidToken)
+	_, err = v.Validate(ctx, "a_made_up")
+	require.ErrorIs(t, err, ErrInvalidToken)
+	require.Equal(t, 4, fake.callCount())
+}
+
+func TestIntrospectionCacheStopsAtExpiry(t *testing.T) {
+	ctx := context.Background()
+	fake, v := newIntrospector(t, IntrospectionOptions{CacheTTL: time.Hour})
+	fake.tokens["a_expiring"] = introspectionResponse{
+		UserID:    "u1",
+		ExpiresMS: time.Now().Add(time.Millisecond * 50).UnixMilli(),
+	}
+
+	_, err := v.Validate(ctx, "a_expiring")
+	require.NoError(t, err)
+	_, err = v.Validate(ctx, "a_expiring")
+	require.NoError(t, err)
+	require.Equal(t, 1, fake.callCount())
+
+	// Past its expiry it's introspected again, even though the TTL hasn't passed
+	time.Sleep(time.Millisecond * 60)
+	fake.mu.Lock()
+	delete(fake.tokens, "a_expiring")
+	fake.mu.Unlock()
+	_, err = v.Validate(ctx, "a_expiring")
+	require.ErrorIs(t, err, ErrInvalidToken)
+	require.Equal(t, 2, fake.callCount())
+}
+
+func TestCacheMaxEntries(t *testing.T) {
+	c := newCache(time.Hour, 2)
+	info := &TokenInfo{UserID: "u1", Expires: time.Now().Add(time.Hour)}
+	for _, token := range []string{"a", "b", "c"} {
+		c.set(token, info)
+	}
+	require.Len(t, c.entries, 2)
+	_, ok := c.get("c")
+	require.True(t, ok)
+}
+
+func TestRequire(t *testing.T) {
+	_, v := newIntrospector(t, IntrospectionOptions{})
+	handler := func(scopes ...string) http.Handler {
+		return Require(v, scopes...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info, ok := FromContext(r.Context())
+			require.True(t, ok)
+			_, _ = w.Write([]byte(info.UserID))
+		}))
+	}
+
+	for _, tc := range []struct {
+		name            string
+		auth            string
+		scopes          []string
+		status          int
+		wwwAuthenticate string
+	}{
+		{name: "no token", auth: "", status: http.StatusUnauthorized, wwwAuthenticate: `Bearer`},
+		{name: "not bearer", auth: "Basic a_good", status: http.StatusUnauthorized, wwwAuthenticate: `Bearer`},
+		{name: "invalid token", auth: "Bearer a_made_up", status: http.StatusUnauthorized, wwwAuthenticate: `Bearer error="invalid_token"`},
+		{name: "introspection down", auth: "Bearer broken", status: http.StatusServiceUnavailable},
+		{name: "missing scope", auth: "Bearer a_good", scopes: []string{"pages:read", "pages:write"}, status: http.StatusForbidden, wwwAuthenticate: `Bearer error="insufficient_scope", scope="pages:read pages:write"`},
+		{name: "has scopes", auth: "bearer a_good", scopes: []string{"pages:read"}, status: http.StatusOK},
+		{name: "no scopes needed", auth: "Bearer a_good", status: http.StatusOK},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/pages", nil)
+			if tc.auth != "" {
+				req.Header.Set("Authorization", tc.auth)
+			}
+			rec := httptest.NewRecorder()
+			handler(tc.scopes...).ServeHTTP(rec, req)
+			require.Equal(t, tc.status, rec.Code)
+			require.Equal(t, tc.wwwAuthenticate, rec.Header().Get("WWW-Authenticate"))
+			if tc.status == http.StatusOK {
+				require.Equal(t, "u1", rec.Body.String())
+			}
+		})
+	}
+}
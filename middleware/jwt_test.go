@@ -0,0 +1,89 @@
+package middleware
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/stretchr/testify/require"
+)
+
+var jwtTestKey = []byte("test key")
+
+func signJWT(t *testing.T, method jwt.SigningMethod, claims jwt.MapClaims) string {
+	key := any(jwtTestKey)
+	if method == jwt.SigningMethodNone {
+		key = jwt.UnsafeAllowNoneSignatureType
+	}
+	token, err := jwt.NewWithClaims(method, claims).SignedString(key)
+	require.NoError(t, err)
+	return token
+}
+
+func TestJWTValidator(t *testing.T) {
+	_, err := NewJWTValidator(JWTOptions{})
+	require.ErrorIs(t, err, ErrMissingAlgorithms)
+
+	v, err := NewJWTValidator(JWTOptions{
+		Keyfunc: func(token *jwt.Token) (any, error) {
+			return jwtTestKey, nil
+		},
+		Algorithms: []string{"HS256"},
+		Issuer:     "https://auth.example.com",
+		Audience:   "pages",
+	})
+	require.NoError(t, err)
+
+	exp := time.Now().Add(time.Hour).Truncate(time.Second)
+	validClaims := func() jwt.MapClaims {
+		return jwt.MapClaims{
+			"sub":   "u1",
+			"exp":   exp.Unix(),
+			"iss":   "https://auth.example.com",
+			"aud":   "pages",
+			"scope": "pages:read pages:write",
+		}
+	}
+	with := func(k string, val any) jwt.MapClaims {
+		claims := validClaims()
+		if val == nil {
+			delete(claims, k)
+		} else {
+			claims[k] = val
+		}
+		return claims
+	}
+	scp := with("scope", nil)
+	scp["scp"] = []string{"pages:read"}
+
+	for _, tc := range []struct {
+		name   string
+		token  string
+		valid  bool
+		scopes []string
+	}{
+		{name: "valid", token: signJWT(t, jwt.SigningMethodHS256, validClaims()), valid: true, scopes: []string{"pages:read", "pages:write"}},
+		{name: "scp array", token: signJWT(t, jwt.SigningMethodHS256, scp), valid: true, scopes: []string{"pages:read"}},
+		{name: "alg none", token: signJWT(t, jwt.SigningMethodNone, validClaims())},
+		{name: "unexpected alg", token: signJWT(t, jwt.SigningMethodHS384, validClaims())},
+		{name: "bad signature", token: signJWT(t, jwt.SigningMethodHS256, validClaims()) + "x"},
+		{name: "expired", token: signJWT(t, jwt.SigningMethodHS256, with("exp", time.Now().Add(-time.Minute).Unix()))},
+		{name: "no exp", token: signJWT(t, jwt.SigningMethodHS256, with("exp", nil))},
+		{name: "no sub", token: signJWT(t, jwt.SigningMethodHS256, with("sub", nil))},
+		{name: "wrong iss", token: signJWT(t, jwt.SigningMethodHS256, with("iss", "https://evil.example.com"))},
+		{name: "wrong aud", token: signJWT(t, jwt.SigningMethodHS256, with("aud", "billing"))},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			info, err := v.Validate(context.Background(), tc.token)
+			if !tc.valid {
+				require.ErrorIs(t, err, ErrInvalidToken)
+				return
+			}
+			require.NoError(t, err)
+			require.Equal(t, "u1", info.UserID)
+			require.Equal(t, tc.scopes, info.Scopes)
+			require.Equal(t, exp, info.Expires)
+		})
+	}
+}
@@ -0,0 +1,125 @@
+// Package middleware authenticates requests to your own services with ContinueWith access tokens.
+//
+//	v := middleware.NewIntrospector(middleware.IntrospectionOptions{
+//		URL:      "https://auth.example.com",
+//		AdminKey: os.Getenv("CW_ADMIN_KEY"), // needs tokens:introspect
+//	})
+//	mux.Handle("/pages", middleware.Require(v, "pages:read")(pagesHandler))
+//
+// Handlers get the token's user and scopes with FromContext.
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/labstack/echo/v4"
+	"github.com/rs/zerolog"
+	"github.com/samber/lo"
+)
+
+var (
+	// The token doesn't exist, expired, or was revoked
+	ErrInvalidToken = errors.New("invalid token")
+)
+
+type ctxKey string
+
+const tokenInfoKey ctxKey = "continuewith.tokenInfo"
+
+type TokenInfo struct {
+	// "_client" for client credentials tokens
+	UserID  string
+	Scopes  []string
+	Expires time.Time
+	// Profile and custom claims from the provider, if any
+	Claims json.RawMessage
+}
+
+// HasScopes is true if the token was granted every one of the scopes
+func (t TokenInfo) HasScopes(scopes ...string) bool {
+	return lo.Every(t.Scopes, scopes)
+}
+
+// Validator checks a bearer token, returning ErrInvalidToken if it isn't valid
+type Validator interface {
+	Validate(ctx context.Context, token string) (*TokenInfo, error)
+}
+
+func WithTokenInfo(ctx context.Context, info *TokenInfo) context.Context {
+	return context.WithValue(ctx, tokenInfoKey, info)
+}
+
+// FromContext returns the token info put in the context by Require or RequireEcho
+func FromContext(ctx context.Context) (*TokenInfo, bool) {
+	info, ok := ctx.Value(tokenInfoKey).(*TokenInfo)
+	return info, ok
+}
+
+// authenticate validates the request's bearer token and checks its scopes, writing the error response if it fails
+func authenticate(r *http.Request, w http.ResponseWriter, v Validator, scopes []string) (*TokenInfo, bool) {
+	token, ok := parseBearerToken(r.Header.Get("Authorization"))
+	if !ok {
+		w.Header().Set("WWW-Authenticate", `Bearer`)
+		http.Error(w, "missing access token", http.StatusUnauthorized)
+		return nil, false
+	}
+
+	info, err := v.Validate(r.Context(), token)
+	if errors.Is(err, ErrInvalidToken) {
+		w.Header().Set("WWW-Authenticate", `Bearer error="invalid_token"`)
+		http.Error(w, "invalid access token", http.StatusUnauthorized)
+		return nil, false
+	}
+	if err != nil {
+		zerolog.Ctx(r.Context()).Error().Err(err).Msg("error validating access token")
+		http.Error(w, "error validating access token", http.StatusServiceUnavailable)
+		return nil, false
+	}
+
+	if !info.HasScopes(scopes...) {
+		w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer error="insufficient_scope", scope="%s"`, strings.Join(scopes, " ")))
+		http.Error(w, "missing required scopes", http.StatusForbidden)
+		return nil, false
+	}
+	return info, true
+}
+
+// Require only lets requests through with a valid bearer token that has all of the scopes
+func Require(v Validator, scopes ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			info, ok := authenticate(r, w, v, scopes)
+			if !ok {
+				return
+			}
+			next.ServeHTTP(w, r.WithContext(WithTokenInfo(r.Context(), info)))
+		})
+	}
+}
+
+// RequireEcho is Require for echo, the token info is in c.Request().Context()
+func RequireEcho(v Validator, scopes ...string) echo.MiddlewareFunc {
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			info, ok := authenticate(c.Request(), c.Response(), v, scopes)
+			if !ok {
+				return nil
+			}
+			c.SetRequest(c.Request().WithContext(WithTokenInfo(c.Request().Context(), info)))
+			return next(c)
+		}
+	}
+}
+
+func parseBearerToken(header string) (string, bool) {
+	if len(header) <= len("bearer ") || !strings.EqualFold(header[:len("bearer ")], "bearer ") {
+		return "", false
+	}
+	return header[len("bearer "):], true
+}
@@ -0,0 +1,21 @@
+-- +migrate Up
+
+create table admin_keys (
+    id text not null,
+    name text not null,
+    key_hash text not null, -- hex sha256 of the key, the key itself is only shown on creation
+    permissions text[] not null default '{}',
+    expires timestamptz,
+    last_used timestamptz,
+    revoked bool not null default false,
+
+    created timestamptz not null default now(),
+    updated timestamptz not null default now(),
+    primary key (id)
+)
+;
+
+create unique index admin_keys_by_key_hash on admin_keys(key_hash);
+
+-- +migrate Down
+drop table admin_keys;
@@ -0,0 +1,25 @@
+-- +migrate Up
+
+-- append only, each row's hash covers the previous row's hash so edits and deletes can be detected
+create table audit_events (
+    seq int8 not null,
+    event_type text not null,
+    actor text not null, -- admin key ID for admin actions, otherwise the user or client that caused the event
+    client_id text,
+    user_id text,
+    ip text not null,
+    request_id text not null,
+    details jsonb not null default '{}',
+    prev_hash text not null,
+    hash text not null,
+
+    created timestamptz not null,
+    primary key (seq)
+)
+;
+
+create index audit_events_by_client_id on audit_events(client_id, seq);
+create index audit_events_by_user_id on audit_events(user_id, seq);
+
+-- +migrate Down
+drop table audit_events;
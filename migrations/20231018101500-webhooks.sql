@@ -0,0 +1,41 @@
+-- +migrate Up
+
+create table webhook_subscriptions (
+    id text not null,
+    url text not null,
+    secret text not null, -- used to HMAC sign payloads, so must be stored in the clear
+    event_types text[] not null default '{}',
+    disabled bool not null default false,
+
+    created timestamptz not null default now(),
+    updated timestamptz not null default now(),
+    primary key (id)
+)
+;
+
+-- outbox, rows are inserted in the same transaction as the event
+create table webhook_deliveries (
+    id text not null,
+    subscription_id text not null references webhook_subscriptions(id) on delete cascade,
+    event_id text not null,
+    event_type text not null,
+    payload jsonb not null,
+    status text not null default 'pending', -- pending, delivered, failed
+    attempts int8 not null default 0,
+    next_attempt timestamptz not null default now(),
+    last_status_code int8,
+    last_error text,
+    delivered timestamptz,
+
+    created timestamptz not null default now(),
+    updated timestamptz not null default now(),
+    primary key (id)
+)
+;
+
+create index webhook_deliveries_by_next_attempt on webhook_deliveries(status, next_attempt);
+create index webhook_deliveries_by_subscription_id on webhook_deliveries(subscription_id, id);
+
+-- +migrate Down
+drop table webhook_deliveries;
+drop table webhook_subscriptions;
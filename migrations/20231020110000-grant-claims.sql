@@ -0,0 +1,10 @@
+-- +migrate Up
+-- Profile and custom claims from the provider exchange, carried from the code to every token in the grant
+alter table authorization_codes add column claims jsonb;
+alter table refresh_tokens add column claims jsonb;
+alter table access_tokens add column claims jsonb;
+
+-- +migrate Down
+alter table authorization_codes drop column claims;
+alter table refresh_tokens drop column claims;
+alter table access_tokens drop column claims;
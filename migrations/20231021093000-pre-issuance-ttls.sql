@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Set by the pre-issuance hook to shorten the lifetimes of the tokens the code is exchanged for
+alter table authorization_codes add column access_token_ttl_seconds int8;
+alter table authorization_codes add column refresh_token_ttl_seconds int8;
+
+-- +migrate Down
+alter table authorization_codes drop column access_token_ttl_seconds;
+alter table authorization_codes drop column refresh_token_ttl_seconds;
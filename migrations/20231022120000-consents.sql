@@ -0,0 +1,15 @@
+-- +migrate Up
+-- The scopes a user has granted a client, updated every time they consent again
+create table consents (
+    user_id text not null,
+    client_id text not null references clients(id) on delete cascade,
+    scopes text[] not null,
+
+    created timestamptz not null default now(),
+    updated timestamptz not null default now(),
+    primary key (user_id, client_id)
+)
+;
+
+-- +migrate Down
+drop table consents;
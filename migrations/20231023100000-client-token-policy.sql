@@ -0,0 +1,14 @@
+-- +migrate Up
+-- Per client overrides of the server's token lifetimes, null uses the server's
+alter table clients add column access_token_ttl_seconds int8;
+alter table clients add column refresh_token_ttl_seconds int8;
+-- Refresh tokens unused for this long expire, each use pushes it back up to refresh_token_ttl_seconds after issuance
+alter table clients add column refresh_token_idle_seconds int8;
+-- always, offline_access (only when the offline_access scope is granted), or never
+alter table clients add column refresh_token_policy text not null default 'always';
+
+-- +migrate Down
+alter table clients drop column access_token_ttl_seconds;
+alter table clients drop column refresh_token_ttl_seconds;
+alter table clients drop column refresh_token_idle_seconds;
+alter table clients drop column refresh_token_policy;
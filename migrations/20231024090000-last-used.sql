@@ -0,0 +1,14 @@
+-- +migrate Up
+alter table access_tokens add column last_used timestamptz;
+alter table refresh_tokens add column last_used timestamptz;
+-- When the grant was first exchanged, carried over when refresh tokens are rotated. Null for refresh tokens from
+-- before this column, which use created instead.
+alter table refresh_tokens add column grant_created timestamptz;
+-- The last time any of the grant's tokens were used, for connected apps
+alter table consents add column last_used timestamptz;
+
+-- +migrate Down
+alter table access_tokens drop column last_used;
+alter table refresh_tokens drop column last_used;
+alter table refresh_tokens drop column grant_created;
+alter table consents drop column last_used;
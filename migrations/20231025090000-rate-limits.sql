@@ -0,0 +1,19 @@
+-- +migrate Up
+-- Token buckets for rate limiting, shared by every replica. A bucket is empty until full_at, and full once it's passed
+-- (GCRA's theoretical arrival time), so a missing row is a full bucket.
+create table rate_limits (
+    key text not null primary key,
+    full_at timestamptz not null,
+    -- Too many failures, requests are refused until then
+    locked_until timestamptz
+);
+create index rate_limits_full_at on rate_limits(full_at);
+
+-- Per client overrides of the server's client rate limit, null uses the server's
+alter table clients add column rate_limit_per_minute int8;
+alter table clients add column rate_limit_burst int8;
+
+-- +migrate Down
+alter table clients drop column rate_limit_per_minute;
+alter table clients drop column rate_limit_burst;
+drop table rate_limits;
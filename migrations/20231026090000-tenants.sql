@@ -0,0 +1,53 @@
+-- +migrate Up
+-- Each tenant is its own OAuth provider, with its own clients, scopes, tokens, consents, admin keys, and webhooks
+create table tenants (
+    id text not null,
+    name text not null,
+    -- Requests to this host are this tenant's, when tenants are resolved by host
+    host text,
+    -- Null uses the server's provider config
+    provider_user_exchange_url text,
+    provider_pre_issuance_hook_url text,
+    provider_secret text,
+    -- Returned as the Issuer of the tenant's introspected tokens
+    issuer text,
+
+    created timestamptz not null default now(),
+    updated timestamptz not null default now(),
+    primary key (id)
+)
+;
+
+create unique index tenants_by_host on tenants(host);
+
+-- Everything from before tenants belongs to the default tenant, the only one in single tenant mode
+insert into tenants (id, name) values ('default', 'Default');
+
+alter table clients add column tenant_id text not null default 'default';
+alter table scopes add column tenant_id text not null default 'default';
+alter table authorization_codes add column tenant_id text not null default 'default';
+alter table refresh_tokens add column tenant_id text not null default 'default';
+alter table access_tokens add column tenant_id text not null default 'default';
+alter table consents add column tenant_id text not null default 'default';
+alter table admin_keys add column tenant_id text not null default 'default';
+alter table audit_events add column tenant_id text not null default 'default';
+alter table webhook_subscriptions add column tenant_id text not null default 'default';
+alter table webhook_deliveries add column tenant_id text not null default 'default';
+
+create index audit_events_by_tenant_id on audit_events(tenant_id, seq);
+
+-- +migrate Down
+drop index audit_events_by_tenant_id;
+
+alter table clients drop column tenant_id;
+alter table scopes drop column tenant_id;
+alter table authorization_codes drop column tenant_id;
+alter table refresh_tokens drop column tenant_id;
+alter table access_tokens drop column tenant_id;
+alter table consents drop column tenant_id;
+alter table admin_keys drop column tenant_id;
+alter table audit_events drop column tenant_id;
+alter table webhook_subscriptions drop column tenant_id;
+alter table webhook_deliveries drop column tenant_id;
+
+drop table tenants;
@@ -0,0 +1,7 @@
+-- +migrate Up
+-- Scope names are only unique within a tenant. Its own migration because CRDB can't change a primary key in the same
+-- transaction as other schema changes to the table.
+alter table scopes drop constraint scopes_pkey, add primary key (tenant_id, id);
+
+-- +migrate Down
+alter table scopes drop constraint scopes_pkey, add primary key (id);
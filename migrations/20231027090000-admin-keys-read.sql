@@ -0,0 +1,10 @@
+-- +migrate Up
+-- Listing keys used to need admin_keys:write, keep it working for the keys that have it
+update admin_keys
+set permissions = array_append(permissions, 'admin_keys:read')
+where 'admin_keys:write' = any(permissions)
+and not 'admin_keys:read' = any(permissions);
+
+-- +migrate Down
+update admin_keys
+set permissions = array_remove(permissions, 'admin_keys:read');
@@ -0,0 +1,8 @@
+-- +migrate Up
+-- Each tenant has its own chain, so appends for one tenant don't wait on another's. Until now every event was in one
+-- chain, which is the default tenant's as long as no other tenant recorded events. Its own migration because CRDB
+-- can't change a primary key in the same transaction as other schema changes to the table.
+alter table audit_events drop constraint audit_events_pkey, add primary key (tenant_id, seq);
+
+-- +migrate Down
+alter table audit_events drop constraint audit_events_pkey, add primary key (seq);
@@ -0,0 +1,6 @@
+-- +migrate Up
+-- The primary key covers it now
+drop index audit_events_by_tenant_id;
+
+-- +migrate Down
+create index audit_events_by_tenant_id on audit_events(tenant_id, seq);
@@ -0,0 +1,7 @@
+-- +migrate Up
+-- The refresh token that replaced this one when it was used. Only rotated tokens being used again are treated as
+-- leaked, tokens revoked by an admin, a consent revocation, or a suspension are not.
+alter table refresh_tokens add column replaced_by text;
+
+-- +migrate Down
+alter table refresh_tokens drop column replaced_by;
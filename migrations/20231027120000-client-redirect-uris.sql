@@ -0,0 +1,7 @@
+-- +migrate Up
+-- Where /oauth2/authorize can send the user back to, authorization requests with any other redirect_uri are refused
+-- without redirecting
+alter table clients add column redirect_uris text[] not null default '{}';
+
+-- +migrate Down
+alter table clients drop column redirect_uris;
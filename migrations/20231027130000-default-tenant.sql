@@ -0,0 +1,10 @@
+-- +migrate Up
+-- Everything from before tenants belongs to the default tenant, the only one in single tenant mode.
+-- 20231026090000-tenants inserts it too, but that migration has already been applied, so any fix goes here, and this
+-- is a no-op where the row exists.
+insert into tenants (id, name) values ('default', 'Default')
+on conflict (id) do nothing
+;
+
+-- +migrate Down
+delete from tenants where id = 'default';
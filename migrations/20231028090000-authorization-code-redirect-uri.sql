@@ -0,0 +1,7 @@
+-- +migrate Up
+-- The redirect_uri the code was sent to, the token request has to send the same one. Null for codes issued before
+-- this, which expire within minutes anyway.
+alter table authorization_codes add column redirect_uri text;
+
+-- +migrate Down
+alter table authorization_codes drop column redirect_uri;
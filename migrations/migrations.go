@@ -1,12 +1,15 @@
 package migrations
 
 import (
+	"context"
 	"database/sql"
 	"embed"
 	"fmt"
+	"time"
 
 	// ensure "pgx" driver is loaded
 	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/pg"
 	_ "github.com/jackc/pgx/v5/stdlib"
 	migrate "github.com/rubenv/sql-migrate"
 )
@@ -17,39 +20,125 @@ var (
 
 	ErrMigrationsNotRun = fmt.Errorf("not all migrations applied")
 
+	Up   = migrate.Up
+	Down = migrate.Down
+
+	source = migrate.EmbedFileSystemMigrationSource{
+		FileSystem: migrations,
+		Root:       ".",
+	}
+	migrationSet = migrate.MigrationSet{
+		TableName: "migrations",
+	}
+
 	logger = gologger.NewLogger()
 )
 
-func RunMigrations(crdbDsn string) (int, error) {
+type (
+	PlannedMigration struct {
+		ID string
+		// The statements that would run, in order
+		SQL []string
+	}
+
+	MigrationStatus struct {
+		ID string
+		// Nil if pending
+		Applied *time.Time
+	}
+)
+
+// RunMigrations applies up to max migrations in dir, 0 is all of them. It holds an advisory lock while it runs, so
+// replicas migrating at startup and the migrate command wait for each other instead of racing. CockroachDB accepts
+// the lock but doesn't take it, so there nothing stops two runs racing.
+// Returns how many were applied.
+func RunMigrations(ctx context.Context, crdbDsn string, dir migrate.MigrationDirection, max int) (int, error) {
 	db, err := sql.Open("pgx", crdbDsn)
 	if err != nil {
 		return 0, err
 	}
 	defer db.Close()
-	src := migrate.EmbedFileSystemMigrationSource{
-		FileSystem: migrations,
-		Root:       ".",
+
+	// Advisory locks belong to the session, so the lock has its own connection and the migrations use others
+	conn, err := db.Conn(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("error in db.Conn: %w", err)
 	}
-	ms := migrate.MigrationSet{
-		TableName: "migrations",
+	defer conn.Close()
+	_, err = conn.ExecContext(ctx, "select pg_advisory_lock($1)", pg.AdvisoryLockMigrations)
+	if err != nil {
+		return 0, fmt.Errorf("error in pg_advisory_lock: %w", err)
 	}
-	return ms.Exec(db, "postgres", src, migrate.Up)
+	defer func() {
+		// Closing the db ends the session if this fails, which releases it anyway
+		if _, err := conn.ExecContext(context.Background(), "select pg_advisory_unlock($1)", pg.AdvisoryLockMigrations); err != nil {
+			logger.Error().Err(err).Msg("error releasing migration advisory lock")
+		}
+	}()
+
+	return migrationSet.ExecMax(db, "postgres", source, dir, max)
 }
 
-func CheckMigrations(crdbDsn string) error {
+// PlanMigrations returns what RunMigrations would run, without running it
+func PlanMigrations(crdbDsn string, dir migrate.MigrationDirection, max int) ([]PlannedMigration, error) {
 	db, err := sql.Open("pgx", crdbDsn)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	defer db.Close()
-	src := migrate.EmbedFileSystemMigrationSource{
-		FileSystem: migrations,
-		Root:       ".",
+	planned, _, err := migrationSet.PlanMigration(db, "postgres", source, dir, max)
+	if err != nil {
+		return nil, err
 	}
-	ms := migrate.MigrationSet{
-		TableName: "migrations",
+
+	res := []PlannedMigration{}
+	for _, mig := range planned {
+		res = append(res, PlannedMigration{
+			ID:  mig.Id,
+			SQL: mig.Queries,
+		})
+	}
+	return res, nil
+}
+
+// MigrationsStatus lists every migration, oldest first, and when it was applied
+func MigrationsStatus(crdbDsn string) ([]MigrationStatus, error) {
+	db, err := sql.Open("pgx", crdbDsn)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	records, err := migrationSet.GetMigrationRecords(db, "postgres")
+	if err != nil {
+		return nil, err
+	}
+	applied := map[string]time.Time{}
+	for _, record := range records {
+		applied[record.Id] = record.AppliedAt
+	}
+
+	found, err := source.FindMigrations()
+	if err != nil {
+		return nil, err
+	}
+	var res []MigrationStatus
+	for _, mig := range found {
+		status := MigrationStatus{ID: mig.Id}
+		if appliedAt, ok := applied[mig.Id]; ok {
+			status.Applied = &appliedAt
+		}
+		res = append(res, status)
+	}
+	return res, nil
+}
+
+func CheckMigrations(crdbDsn string) error {
+	db, err := sql.Open("pgx", crdbDsn)
+	if err != nil {
+		return err
 	}
-	migration, _, err := ms.PlanMigration(db, "postgres", src, migrate.Up, 0)
+	defer db.Close()
+	migration, _, err := migrationSet.PlanMigration(db, "postgres", source, migrate.Up, 0)
 	if err != nil {
 		return err
 	}
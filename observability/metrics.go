@@ -0,0 +1,19 @@
+package observability
+
+import (
+	"io"
+	"time"
+
+	"github.com/uber-go/tally/v4"
+	"github.com/uber-go/tally/v4/prometheus"
+)
+
+// NewRootScope creates the tally scope that reports to the prometheus reporter served on /metrics
+func NewRootScope(reporter prometheus.Reporter) (tally.Scope, io.Closer) {
+	return tally.NewRootScope(tally.ScopeOptions{
+		Prefix:          "continuewith",
+		CachedReporter:  reporter,
+		Separator:       prometheus.DefaultSeparator,
+		SanitizeOptions: &prometheus.DefaultSanitizerOpts,
+	}, time.Second)
+}
@@ -0,0 +1,131 @@
+package observability
+
+import (
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/uber-go/tally/v4"
+)
+
+var (
+	OutcomeSuccess = "success"
+
+	// Client IDs past the limit are all reported as this so a flood of clients can't blow up cardinality
+	OtherClientTag = "_other"
+	// Used for client IDs that have never succeeded, they come straight from the request
+	UnknownClientTag = "_unknown"
+
+	providerLatencyBuckets = tally.MustMakeExponentialDurationBuckets(time.Millisecond*5, 2, 12)
+
+	scope       = tally.NoopScope
+	clientTags  = map[string]struct{}{}
+	clientTagMu sync.Mutex
+)
+
+// InitMetrics sets the scope that the domain metrics report to, before this they go nowhere
+func InitMetrics(s tally.Scope) {
+	scope = s
+	utils.ReliableExecRetries = s.Counter("reliable_exec_retries")
+}
+
+// ClientTag returns the client ID to use as a label, only the first METRICS_MAX_CLIENT_TAGS clients get their own
+func ClientTag(clientID string) string {
+	clientTagMu.Lock()
+	defer clientTagMu.Unlock()
+	if _, ok := clientTags[clientID]; ok {
+		return clientID
+	}
+	if int64(len(clientTags)) >= utils.MetricsMaxClientTags {
+		return OtherClientTag
+	}
+	clientTags[clientID] = struct{}{}
+	return clientID
+}
+
+// clientTag only gives a client its own label once it has succeeded, otherwise anyone could fill the labels with made up IDs
+func clientTag(clientID, outcome string) string {
+	if outcome == OutcomeSuccess {
+		return ClientTag(clientID)
+	}
+	clientTagMu.Lock()
+	defer clientTagMu.Unlock()
+	if _, ok := clientTags[clientID]; ok {
+		return clientID
+	}
+	return UnknownClientTag
+}
+
+// RecordAuthorization counts a POST /authorize, outcome is the OAuth error or OutcomeSuccess
+func RecordAuthorization(clientID, responseType, outcome string) {
+	scope.Tagged(map[string]string{
+		"client_id":     clientTag(clientID, outcome),
+		"response_type": responseType,
+		"outcome":       outcome,
+	}).Counter("authorizations").Inc(1)
+}
+
+// RecordTokenExchange counts an authorization code being exchanged for tokens
+func RecordTokenExchange(clientID, outcome string) {
+	scope.Tagged(map[string]string{
+		"client_id": clientTag(clientID, outcome),
+		"outcome":   outcome,
+	}).Counter("token_exchanges").Inc(1)
+}
+
+// RecordRefresh counts a refresh token being used
+func RecordRefresh(clientID, outcome string) {
+	scope.Tagged(map[string]string{
+		"client_id": clientTag(clientID, outcome),
+		"outcome":   outcome,
+	}).Counter("token_refreshes").Inc(1)
+}
+
+// RecordIntrospection counts an access token lookup, hit is whether a valid token was found
+func RecordIntrospection(hit bool) {
+	scope.Tagged(map[string]string{
+		"result": utils.IfElse(hit, "hit", "miss"),
+	}).Counter("introspections").Inc(1)
+}
+
+// RecordIntrospectionCache counts an introspection cache lookup, and reports how many tokens are cached
+func RecordIntrospectionCache(hit bool, size int) {
+	scope.Tagged(map[string]string{
+		"result": utils.IfElse(hit, "hit", "miss"),
+	}).Counter("introspection_cache_lookups").Inc(1)
+	scope.Gauge("introspection_cache_size").Update(float64(size))
+}
+
+// RecordIntrospectionCacheEvictions counts cached tokens evicted because they were revoked
+func RecordIntrospectionCacheEvictions(evicted int) {
+	scope.Counter("introspection_cache_evictions").Inc(int64(evicted))
+}
+
+// RecordRateLimited counts a request refused with a 429, limit is ratelimit.KindIP, KindClient, or KindIPClient
+func RecordRateLimited(endpoint, limit string) {
+	scope.Tagged(map[string]string{
+		"endpoint": endpoint,
+		"limit":    limit,
+	}).Counter("rate_limited").Inc(1)
+}
+
+// RecordRateLimitLockout counts an IP, or an IP for one client, locked out after too many failures
+func RecordRateLimitLockout(limit string) {
+	scope.Tagged(map[string]string{
+		"limit": limit,
+	}).Counter("rate_limit_lockouts").Inc(1)
+}
+
+// RecordProviderAPICall records the latency of a provider_api call, errKind is empty on success
+func RecordProviderAPICall(endpoint string, d time.Duration, errKind string) {
+	s := scope.Tagged(map[string]string{
+		"endpoint": endpoint,
+	})
+	s.Histogram("provider_api_latency", providerLatencyBuckets).RecordDuration(d)
+	if errKind == "" {
+		return
+	}
+	s.Tagged(map[string]string{
+		"kind": errKind,
+	}).Counter("provider_api_errors").Inc(1)
+}
@@ -0,0 +1,49 @@
+package observability
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp"
+	"go.opentelemetry.io/otel/propagation"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// TracingEnabled is whether an OTLP endpoint is configured, the exporter reads the standard OTEL_EXPORTER_OTLP_* env vars itself
+func TracingEnabled() bool {
+	return os.Getenv("OTEL_EXPORTER_OTLP_ENDPOINT") != "" || os.Getenv("OTEL_EXPORTER_OTLP_TRACES_ENDPOINT") != ""
+}
+
+// InitTracing sets the global propagator, and when TracingEnabled the global tracer provider exporting over OTLP/HTTP.
+// Call the returned function on shutdown to flush spans.
+func InitTracing(ctx context.Context) (func(context.Context) error, error) {
+	// Always propagate so traceparent passes through to the provider even when we don't export
+	otel.SetTextMapPropagator(propagation.NewCompositeTextMapPropagator(propagation.TraceContext{}, propagation.Baggage{}))
+	if !TracingEnabled() {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter, err := otlptracehttp.New(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error in otlptracehttp.New: %w", err)
+	}
+
+	// OTEL_SERVICE_NAME and OTEL_RESOURCE_ATTRIBUTES override the defaults
+	res, err := resource.Merge(resource.NewWithAttributes(semconv.SchemaURL, semconv.ServiceNameKey.String("continuewith")), resource.Environment())
+	if err != nil {
+		return nil, fmt.Errorf("error in resource.Merge: %w", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(exporter),
+		sdktrace.WithResource(res),
+		sdktrace.WithSampler(sdktrace.ParentBased(sdktrace.AlwaysSample())),
+	)
+	otel.SetTracerProvider(tp)
+	logger.Info().Msg("exporting traces over OTLP")
+	return tp.Shutdown, nil
+}
@@ -0,0 +1,46 @@
+package pg
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Advisory lock keys, must be unique across everything that shares the database
+const (
+	AdvisoryLockJanitor    int64 = 7_100_001
+	AdvisoryLockMigrations int64 = 7_100_002
+)
+
+// WithAdvisoryLock runs f only if the session level advisory lock could be taken, so only one replica runs f at a time.
+// Returns false without running f if another session holds the lock.
+func WithAdvisoryLock(ctx context.Context, pool *pgxpool.Pool, key int64, f func(ctx context.Context) error) (bool, error) {
+	// Advisory locks belong to the session, so the same connection must be held until unlock
+	conn, err := pool.Acquire(ctx)
+	if err != nil {
+		return false, fmt.Errorf("error in Pool.Acquire: %w", err)
+	}
+	defer conn.Release()
+
+	var acquired bool
+	err = conn.QueryRow(ctx, "select pg_try_advisory_lock($1)", key).Scan(&acquired)
+	if err != nil {
+		return false, fmt.Errorf("error in pg_try_advisory_lock: %w", err)
+	}
+	if !acquired {
+		return false, nil
+	}
+	defer func() {
+		// Use a fresh context so the lock is released even if ctx was cancelled
+		unlockCtx, cancel := context.WithTimeout(context.Background(), StandardContextTimeout)
+		defer cancel()
+		if _, err := conn.Exec(unlockCtx, "select pg_advisory_unlock($1)", key); err != nil {
+			logger.Error().Err(err).Int64("key", key).Msg("error releasing advisory lock, closing connection")
+			// Closing the session is the only other way to release it
+			conn.Conn().Close(unlockCtx)
+		}
+	}()
+
+	return true, f(ctx)
+}
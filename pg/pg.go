@@ -10,30 +10,29 @@ import (
 )
 
 var (
-	Pool                   *pgxpool.Pool
 	StandardContextTimeout = 10 * time.Second
 
 	logger = gologger.NewLogger()
 )
 
-func ConnectToDB() error {
+// ConnectToDB connects to PG_DSN. Pass the pool to whatever needs it, nothing reads it from here.
+func ConnectToDB() (*pgxpool.Pool, error) {
 	logger.Debug().Msg("connecting to PG...")
-	var err error
 	config, err := pgxpool.ParseConfig(utils.PGDSN)
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	config.MaxConns = 10
-	config.MinConns = 1
+	config.MaxConns = int32(utils.PGMaxConns)
+	config.MinConns = int32(utils.PGMinConns)
 	config.HealthCheckPeriod = time.Second * 5
 	config.MaxConnLifetime = time.Minute * 30
 	config.MaxConnIdleTime = time.Minute * 30
 
-	Pool, err = pgxpool.NewWithConfig(context.Background(), config)
+	pool, err := pgxpool.NewWithConfig(context.Background(), config)
 	if err != nil {
-		return err
+		return nil, err
 	}
 	logger.Debug().Msg("connected to PG")
-	return nil
+	return pool, nil
 }
@@ -0,0 +1,50 @@
+// Package pgtest connects tests to the database at TEST_PG_DSN, migrated to the latest version. Tests that use it are
+// skipped when it isn't set. Set TEST_PG_IS_POSTGRES=1 for Postgres, like IS_POSTGRES.
+package pgtest
+
+import (
+	"context"
+	"os"
+	"sync"
+	"testing"
+
+	"github.com/danthegoodman1/GoAPITemplate/migrations"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	once    sync.Once
+	pool    *pgxpool.Pool
+	initErr error
+)
+
+// Pool returns the test database's pool
+func Pool(t testing.TB) *pgxpool.Pool {
+	t.Helper()
+	dsn := os.Getenv("TEST_PG_DSN")
+	if dsn == "" {
+		t.Skip("TEST_PG_DSN not set")
+	}
+	once.Do(func() {
+		ctx := context.Background()
+		if _, initErr = migrations.RunMigrations(ctx, dsn, migrations.Up, 0); initErr != nil {
+			return
+		}
+		pool, initErr = pgxpool.New(ctx, dsn)
+	})
+	if initErr != nil {
+		t.Fatalf("error setting up the test database: %s", initErr)
+	}
+	return pool
+}
+
+// IsPostgres is whether the test database is Postgres rather than CRDB, pass it where the code takes IS_POSTGRES
+func IsPostgres() bool {
+	return os.Getenv("TEST_PG_IS_POSTGRES") != ""
+}
+
+// TenantID is a new tenant for the test, so tests sharing the database don't see each other's rows
+func TenantID() string {
+	return utils.GenRandomIDWithSize("test_", 12)
+}
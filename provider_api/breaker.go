@@ -0,0 +1,74 @@
+package provider_api
+
+import (
+	"sync"
+	"time"
+)
+
+// breaker opens after a number of consecutive failed calls and fails fast until the cooldown is over,
+// then lets a single call through to check if the provider is back
+type breaker struct {
+	mu        sync.Mutex
+	threshold int64
+	cooldown  time.Duration
+
+	failures  int64
+	openUntil time.Time
+	probing   bool
+}
+
+func newBreaker(threshold int64, cooldown time.Duration) *breaker {
+	return &breaker{
+		threshold: threshold,
+		cooldown:  cooldown,
+	}
+}
+
+func (b *breaker) allow() bool {
+	if b.threshold <= 0 {
+		return true
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.failures < b.threshold {
+		return true
+	}
+	if b.probing || time.Now().Before(b.openUntil) {
+		return false
+	}
+	b.probing = true
+	return true
+}
+
+// release ends a call without recording it, so a canceled probe lets the next call check the provider instead
+func (b *breaker) release() {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+}
+
+func (b *breaker) record(ok bool) {
+	if b.threshold <= 0 {
+		return
+	}
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.probing = false
+	if ok {
+		if b.failures >= b.threshold {
+			logger.Info().Msg("provider api circuit breaker closed")
+		}
+		b.failures = 0
+		return
+	}
+	b.failures++
+	if b.failures >= b.threshold {
+		if b.failures == b.threshold {
+			logger.Warn().Int64("failures", b.failures).Dur("cooldown", b.cooldown).Msg("provider api circuit breaker opened")
+		}
+		b.openUntil = time.Now().Add(b.cooldown)
+	}
+}
@@ -0,0 +1,161 @@
+package provider_api
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"time"
+
+	"github.com/UltimateTournament/backoff/v4"
+	"github.com/danthegoodman1/GoAPITemplate/observability"
+	"github.com/danthegoodman1/GoAPITemplate/providersig"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/propagation"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+var (
+	// Responses from the provider should be tiny, this stops a misbehaving one from eating memory
+	maxResponseBytes int64 = 1 << 20
+)
+
+// Options for the HTTP provider client. The zero value of everything but Secret and UserExchangeURL is usable.
+type Options struct {
+	// Shared with the provider to sign requests
+	Secret string
+	// Called with the user's auth when they consent
+	UserExchangeURL string
+	// Optional, see PreIssuance
+	PreIssuanceHookURL string
+
+	// Timeout for each attempt
+	Timeout time.Duration
+	// Retries after the first attempt, only for network errors and 5xx
+	MaxRetries uint64
+	// Consecutive failed calls before the circuit breaker opens, 0 disables it
+	BreakerFailures int64
+	// How long the breaker stays open before letting a call through to check the provider
+	BreakerCooldown time.Duration
+}
+
+// Client calls the provider's API over HTTP, it's a UserExchanger and a PreIssuanceHook
+type Client struct {
+	opts       Options
+	httpClient *http.Client
+	breaker    *breaker
+}
+
+func NewClient(opts Options) *Client {
+	return &Client{
+		opts:       opts,
+		httpClient: &http.Client{},
+		breaker:    newBreaker(opts.BreakerFailures, opts.BreakerCooldown),
+	}
+}
+
+// instrument wraps a call to the provider in a span and records its metrics
+func (c *Client) instrument(ctx context.Context, endpoint string, f func(ctx context.Context) error) error {
+	ctx, span := tracer.Start(ctx, "provider_api."+endpoint, oteltrace.WithSpanKind(oteltrace.SpanKindClient))
+	defer span.End()
+	start := time.Now()
+	err := f(ctx)
+	observability.RecordProviderAPICall(endpoint, time.Since(start), errKind(err))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, errKind(err))
+	}
+	return err
+}
+
+func errKind(err error) string {
+	switch {
+	case err == nil:
+		return ""
+	case errors.Is(err, ErrNotFound):
+		return "not_found"
+	case errors.Is(err, ErrClientError):
+		return "client_error"
+	case errors.Is(err, ErrServerError):
+		return "server_error"
+	case errors.Is(err, ErrCircuitOpen):
+		return "circuit_open"
+	default:
+		return "request_error"
+	}
+}
+
+// newRequest creates a signed request with the headers, carrying the trace context. Call it for every attempt so retries
+// get a fresh signature timestamp.
+func (c *Client) newRequest(ctx context.Context, method, targetURL string, header http.Header, body []byte) (*http.Request, error) {
+	req, err := http.NewRequestWithContext(ctx, method, targetURL, bytes.NewReader(body))
+	if err != nil {
+		return nil, fmt.Errorf("error in http.NewRequestWithContext: %w", err)
+	}
+	for k, v := range header {
+		req.Header[http.CanonicalHeaderKey(k)] = v
+	}
+	if body != nil {
+		req.Header.Set("content-type", "application/json")
+	}
+	// So the provider can continue our trace
+	otel.GetTextMapPropagator().Inject(ctx, propagation.HeaderCarrier(req.Header))
+	providersig.SignRequest(c.opts.Secret, req, body)
+	return req, nil
+}
+
+// do sends the request built by newReq with retries, returning the response body on a 2xx
+func (c *Client) do(ctx context.Context, newReq func(ctx context.Context) (*http.Request, error)) ([]byte, error) {
+	if !c.breaker.allow() {
+		return nil, ErrCircuitOpen
+	}
+
+	var resBytes []byte
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Millisecond * 100
+	b.MaxElapsedTime = 0
+	err := backoff.Retry(func() error {
+		tryCtx, cancel := context.WithTimeout(ctx, c.opts.Timeout)
+		defer cancel()
+		req, err := newReq(tryCtx)
+		if err != nil {
+			return backoff.Permanent(fmt.Errorf("error creating request: %w", err))
+		}
+
+		res, err := c.httpClient.Do(req)
+		if err != nil {
+			if ctx.Err() != nil {
+				return backoff.Permanent(err)
+			}
+			return fmt.Errorf("error in httpClient.Do: %w", err)
+		}
+		defer res.Body.Close()
+
+		resBytes, err = io.ReadAll(io.LimitReader(res.Body, maxResponseBytes))
+		if err != nil {
+			return fmt.Errorf("error in io.ReadAll: %w", err)
+		}
+
+		switch {
+		case res.StatusCode == http.StatusNotFound:
+			return backoff.Permanent(ErrNotFound)
+		case res.StatusCode >= 500:
+			return fmt.Errorf("%d - %s -- %w", res.StatusCode, resBytes, ErrServerError)
+		case res.StatusCode > 299:
+			return backoff.Permanent(fmt.Errorf("%d - %s -- %w", res.StatusCode, resBytes, ErrClientError))
+		}
+		return nil
+	}, backoff.WithContext(backoff.WithMaxRetries(b, c.opts.MaxRetries), ctx))
+
+	// The caller giving up says nothing about the provider
+	if errors.Is(err, context.Canceled) {
+		c.breaker.release()
+		return resBytes, err
+	}
+	// The provider answering with a 4xx is still the provider working
+	c.breaker.record(err == nil || errors.Is(err, ErrNotFound) || errors.Is(err, ErrClientError))
+	return resBytes, err
+}
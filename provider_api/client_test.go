@@ -0,0 +1,192 @@
+package provider_api
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/providersig"
+	"github.com/stretchr/testify/require"
+)
+
+// provider answers user exchanges with the status from respond, 200s get a user
+type provider struct {
+	*httptest.Server
+	calls   int64
+	respond func(call int64) int
+}
+
+func newProvider(t *testing.T, respond func(call int64) int) *provider {
+	p := &provider{respond: respond}
+	p.Server = httptest.NewServer(providersig.Middleware("secret", providersig.DefaultTolerance)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		status := p.respond(atomic.AddInt64(&p.calls, 1))
+		if status == 0 {
+			// Hang until the client gives up
+			<-r.Context().Done()
+			return
+		}
+		w.WriteHeader(status)
+		if status == http.StatusOK {
+			_, _ = w.Write([]byte(`{"UserID":"u1"}`))
+		}
+	})))
+	t.Cleanup(p.Close)
+	return p
+}
+
+func (p *provider) client(opts Options) *Client {
+	opts.Secret = "secret"
+	opts.UserExchangeURL = p.URL
+	if opts.Timeout == 0 {
+		opts.Timeout = time.Second
+	}
+	return NewClient(opts)
+}
+
+func status(code int) func(int64) int {
+	return func(int64) int { return code }
+}
+
+func TestClientRetriesServerErrors(t *testing.T) {
+	p := newProvider(t, func(call int64) int {
+		if call < 3 {
+			return http.StatusBadGateway
+		}
+		return http.StatusOK
+	})
+	c := p.client(Options{MaxRetries: 2})
+
+	res, err := c.ExchangeAuthForUserInfo(context.Background(), "user")
+	require.NoError(t, err)
+	require.Equal(t, "u1", res.UserID)
+	require.EqualValues(t, 3, atomic.LoadInt64(&p.calls))
+}
+
+func TestClientGivesUpAfterMaxRetries(t *testing.T) {
+	p := newProvider(t, status(http.StatusInternalServerError))
+	c := p.client(Options{MaxRetries: 1})
+
+	_, err := c.ExchangeAuthForUserInfo(context.Background(), "user")
+	require.ErrorIs(t, err, ErrServerError)
+	require.EqualValues(t, 2, atomic.LoadInt64(&p.calls))
+}
+
+func TestClientDoesNotRetryClientErrors(t *testing.T) {
+	for _, tc := range []struct {
+		status int
+		err    error
+	}{
+		{http.StatusBadRequest, ErrClientError},
+		{http.StatusForbidden, ErrClientError},
+		{http.StatusNotFound, ErrNotFound},
+	} {
+		p := newProvider(t, status(tc.status))
+		c := p.client(Options{MaxRetries: 3})
+
+		_, err := c.ExchangeAuthForUserInfo(context.Background(), "user")
+		require.ErrorIs(t, err, tc.err, tc.status)
+		require.NotErrorIs(t, err, ErrServerError, tc.status)
+		require.EqualValues(t, 1, atomic.LoadInt64(&p.calls), tc.status)
+	}
+}
+
+func TestClientTimeout(t *testing.T) {
+	p := newProvider(t, func(call int64) int {
+		if call == 1 {
+			return 0
+		}
+		return http.StatusOK
+	})
+	c := p.client(Options{Timeout: time.Millisecond * 50})
+
+	_, err := c.ExchangeAuthForUserInfo(context.Background(), "user")
+	require.ErrorIs(t, err, context.DeadlineExceeded)
+
+	// A timed out attempt is retried like a 5xx
+	c = p.client(Options{Timeout: time.Millisecond * 50, MaxRetries: 1})
+	atomic.StoreInt64(&p.calls, 0)
+	res, err := c.ExchangeAuthForUserInfo(context.Background(), "user")
+	require.NoError(t, err)
+	require.Equal(t, "u1", res.UserID)
+}
+
+func TestClientBreaker(t *testing.T) {
+	failing := int32(1)
+	p := newProvider(t, func(int64) int {
+		if atomic.LoadInt32(&failing) == 1 {
+			return http.StatusServiceUnavailable
+		}
+		return http.StatusOK
+	})
+	cooldown := time.Millisecond * 100
+	c := p.client(Options{BreakerFailures: 2, BreakerCooldown: cooldown})
+	ctx := context.Background()
+
+	// Open after 2 failures, then fail fast without calling the provider
+	for i := 0; i < 2; i++ {
+		_, err := c.ExchangeAuthForUserInfo(ctx, "user")
+		require.ErrorIs(t, err, ErrServerError)
+	}
+	_, err := c.ExchangeAuthForUserInfo(ctx, "user")
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.EqualValues(t, 2, atomic.LoadInt64(&p.calls))
+
+	// Half-open: a failed probe opens it again for another cooldown
+	time.Sleep(cooldown)
+	_, err = c.ExchangeAuthForUserInfo(ctx, "user")
+	require.ErrorIs(t, err, ErrServerError)
+	_, err = c.ExchangeAuthForUserInfo(ctx, "user")
+	require.ErrorIs(t, err, ErrCircuitOpen)
+	require.EqualValues(t, 3, atomic.LoadInt64(&p.calls))
+
+	// Half-open: a successful probe closes it
+	atomic.StoreInt32(&failing, 0)
+	time.Sleep(cooldown)
+	_, err = c.ExchangeAuthForUserInfo(ctx, "user")
+	require.NoError(t, err)
+	_, err = c.ExchangeAuthForUserInfo(ctx, "user")
+	require.NoError(t, err)
+	require.EqualValues(t, 5, atomic.LoadInt64(&p.calls))
+}
+
+func TestClientBreakerOnlyOneProbe(t *testing.T) {
+	c := NewClient(Options{BreakerFailures: 1, BreakerCooldown: time.Millisecond})
+	c.breaker.record(false)
+	time.Sleep(time.Millisecond * 2)
+
+	require.True(t, c.breaker.allow())
+	require.False(t, c.breaker.allow())
+}
+
+func TestClientBreakerIgnoresCanceled(t *testing.T) {
+	p := newProvider(t, func(int64) int { return 0 })
+	c := p.client(Options{BreakerFailures: 1, BreakerCooldown: time.Hour})
+	c.breaker.record(true)
+
+	// Fail once so the breaker is open, then let a probe through
+	c.breaker.record(false)
+	c.breaker.openUntil = time.Now()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go func() {
+		time.Sleep(time.Millisecond * 50)
+		cancel()
+	}()
+	_, err := c.ExchangeAuthForUserInfo(ctx, "user")
+	require.ErrorIs(t, err, context.Canceled)
+
+	// The canceled probe neither closed the breaker nor reset its cooldown, the next call probes again
+	require.EqualValues(t, 1, c.breaker.failures)
+	require.True(t, c.breaker.allow())
+	require.False(t, c.breaker.allow())
+}
+
+func TestErrKind(t *testing.T) {
+	require.Equal(t, "client_error", errKind(ErrClientError))
+	require.Equal(t, "server_error", errKind(fmt.Errorf("502 -- %w", ErrServerError)))
+	require.Equal(t, "request_error", errKind(context.DeadlineExceeded))
+}
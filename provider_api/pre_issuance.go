@@ -0,0 +1,93 @@
+package provider_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+)
+
+var (
+	PreIssuanceAuthorizationCode = "authorization_code"
+	PreIssuanceRefreshToken      = "refresh_token"
+)
+
+type (
+	PreIssuanceRequest struct {
+		// authorization_code when a user consents, refresh_token when a client refreshes
+		Event    string
+		UserID   string
+		ClientID string
+		// What will be granted if the hook doesn't narrow it
+		Scopes []string
+		Claims json.RawMessage `json:",omitempty"`
+	}
+
+	PreIssuanceResponse struct {
+		Deny bool
+		// Returned to the client as the error_description when denying
+		Reason *string
+		// Narrows the scopes, anything not already being granted is ignored
+		Scopes []string
+		// Can only shorten the lifetimes, never extend them
+		AccessTokenTTLSeconds  *int64
+		RefreshTokenTTLSeconds *int64
+		// Merged into the grant's claims, replacing any with the same key
+		Claims map[string]any
+	}
+)
+
+// PreIssuanceHook can deny or customize a grant before anything is issued
+type PreIssuanceHook interface {
+	PreIssuance(ctx context.Context, req PreIssuanceRequest) (*PreIssuanceResponse, error)
+}
+
+type PreIssuanceHookFunc func(ctx context.Context, req PreIssuanceRequest) (*PreIssuanceResponse, error)
+
+func (f PreIssuanceHookFunc) PreIssuance(ctx context.Context, req PreIssuanceRequest) (*PreIssuanceResponse, error) {
+	return f(ctx, req)
+}
+
+// PreIssuance calls the hook at PreIssuanceHookURL, only use the client as a PreIssuanceHook if it's set
+func (c *Client) PreIssuance(ctx context.Context, reqBody PreIssuanceRequest) (*PreIssuanceResponse, error) {
+	body, err := json.Marshal(reqBody)
+	if err != nil {
+		return nil, fmt.Errorf("error in json.Marshal: %w", err)
+	}
+
+	var resBody PreIssuanceResponse
+	err = c.instrument(ctx, "pre_issuance", func(ctx context.Context) error {
+		resBytes, err := c.do(ctx, func(ctx context.Context) (*http.Request, error) {
+			return c.newRequest(ctx, http.MethodPost, c.opts.PreIssuanceHookURL, nil, body)
+		})
+		if err != nil {
+			return err
+		}
+		err = json.Unmarshal(resBytes, &resBody)
+		if err != nil {
+			return fmt.Errorf("error in json.Unmarshal: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &resBody, nil
+}
+
+// MergeClaims adds the hook's claims to the grant's claims JSON
+func (r PreIssuanceResponse) MergeClaims(claims json.RawMessage) (json.RawMessage, error) {
+	if len(r.Claims) == 0 {
+		return claims, nil
+	}
+	merged := map[string]any{}
+	if claims != nil {
+		if err := json.Unmarshal(claims, &merged); err != nil {
+			return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
+		}
+	}
+	for k, v := range r.Claims {
+		merged[k] = v
+	}
+	return json.Marshal(merged)
+}
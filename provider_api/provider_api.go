@@ -2,57 +2,103 @@ package provider_api
 
 import (
 	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/bytedance/sonic"
-	"github.com/danthegoodman1/GoAPITemplate/utils"
-	"github.com/samber/lo"
-	"io"
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/providersig"
+	"go.opentelemetry.io/otel"
 	"net/http"
 )
 
 var (
+	tracer = otel.GetTracerProvider().Tracer("provider_api")
+
 	ErrNotFound    = errors.New("not found")
 	ErrClientError = errors.New("client error (4xx)")
 	ErrServerError = errors.New("server error (5xx)")
+	// The provider has been failing, so we're not calling it for a bit
+	ErrCircuitOpen = errors.New("provider api circuit breaker open")
+
+	logger = gologger.NewLogger()
 )
 
 type ExchangeAuthForUserResponse struct {
 	UserID string
-}
 
-func ExchangeAuthForUserInfo(ctx context.Context, targetURL, authHeaderVal string) (*ExchangeAuthForUserResponse, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, targetURL, nil)
-	if err != nil {
-		return nil, fmt.Errorf("error in http.NewRequestWithContext: %w", err)
-	}
+	// Optional profile claims, stored with the grant and returned from introspection and userinfo
+	Name          *string
+	Email         *string
+	EmailVerified *bool
+	Picture       *string
+	Locale        *string
+	// Any other claims, the profile claims above win if a key collides
+	Claims map[string]any
 
-	req.Header.Set("x-continuewith-user", authHeaderVal)
-	req.Header.Set("x-continuewith-admin", utils.AdminKey)
+	// The scopes the user is allowed to grant, the requested scopes are narrowed to these. Nil allows any scope.
+	Scopes []string
+}
 
-	res, err := http.DefaultClient.Do(req)
-	if err != nil {
-		return nil, fmt.Errorf("error in http.DefaultClient.Do: %w", err)
+// ClaimsJSON returns the claims as an OIDC style JSON object (e.g. email_verified), or nil if there are none
+func (r ExchangeAuthForUserResponse) ClaimsJSON() ([]byte, error) {
+	claims := map[string]any{}
+	for k, v := range r.Claims {
+		claims[k] = v
 	}
-	defer res.Body.Close()
-
-	resBytes, err := io.ReadAll(req.Body)
-	if err != nil {
-		return nil, fmt.Errorf("error in io.ReadAll: %w", err)
+	if r.Name != nil {
+		claims["name"] = *r.Name
 	}
-
-	if res.StatusCode == 404 {
-		return nil, ErrNotFound
+	if r.Email != nil {
+		claims["email"] = *r.Email
+	}
+	if r.EmailVerified != nil {
+		claims["email_verified"] = *r.EmailVerified
 	}
-	if res.StatusCode > 299 {
-		return nil, fmt.Errorf("%d - %s -- %w", res.StatusCode, resBytes, lo.Ternary(res.StatusCode >= 500, ErrServerError, ErrClientError))
+	if r.Picture != nil {
+		claims["picture"] = *r.Picture
 	}
+	if r.Locale != nil {
+		claims["locale"] = *r.Locale
+	}
+	if len(claims) == 0 {
+		return nil, nil
+	}
+	return json.Marshal(claims)
+}
+
+// UserExchanger turns the user's auth from the consent screen (the x-continuewith-user header) into who they are.
+// Client does it over HTTP, embedders can look the user up directly with a UserExchangerFunc.
+type UserExchanger interface {
+	ExchangeAuthForUserInfo(ctx context.Context, authHeaderVal string) (*ExchangeAuthForUserResponse, error)
+}
 
+type UserExchangerFunc func(ctx context.Context, authHeaderVal string) (*ExchangeAuthForUserResponse, error)
+
+func (f UserExchangerFunc) ExchangeAuthForUserInfo(ctx context.Context, authHeaderVal string) (*ExchangeAuthForUserResponse, error) {
+	return f(ctx, authHeaderVal)
+}
+
+func (c *Client) ExchangeAuthForUserInfo(ctx context.Context, authHeaderVal string) (*ExchangeAuthForUserResponse, error) {
 	var resBody ExchangeAuthForUserResponse
-	err = sonic.Unmarshal(resBytes, &res)
+	err := c.instrument(ctx, "user_exchange", func(ctx context.Context) error {
+		resBytes, err := c.do(ctx, func(ctx context.Context) (*http.Request, error) {
+			return c.newRequest(ctx, http.MethodGet, c.opts.UserExchangeURL, http.Header{providersig.UserHeader: {authHeaderVal}}, nil)
+		})
+		if err != nil {
+			return err
+		}
+
+		err = json.Unmarshal(resBytes, &resBody)
+		if err != nil {
+			return fmt.Errorf("error in json.Unmarshal: %w", err)
+		}
+		if resBody.UserID == "" {
+			return fmt.Errorf("provider returned no UserID -- %w", ErrServerError)
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("error in sonic.Unmarshal: %w", err)
+		return nil, err
 	}
-
 	return &resBody, nil
 }
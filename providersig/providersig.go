@@ -0,0 +1,109 @@
+// Package providersig signs the requests ContinueWith makes to the provider API, and verifies them on the provider side.
+//
+// Provider backends written in Go can import it without pulling in the rest of ContinueWith:
+//
+//	http.Handle("/continuewith/exchange", providersig.Middleware(os.Getenv("PROVIDER_SECRET"), providersig.DefaultTolerance)(exchangeHandler))
+package providersig
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	Header = "x-continuewith-signature"
+	// The user's auth from the consent screen, signed along with the rest of the request
+	UserHeader = "x-continuewith-user"
+
+	// How far the signature timestamp can be from now, requests outside of this are treated as replays
+	DefaultTolerance = time.Minute * 5
+
+	ErrMissingSignature = errors.New("missing signature")
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature timestamp outside of tolerance")
+)
+
+// Sign returns the signature header value, in the format `t=<unix seconds>,v1=<hex hmac-sha256>`.
+// The HMAC is over the timestamp, method, request URI (path and query), the UserHeader value (empty if there isn't one),
+// and a SHA-256 of the body, separated by newlines. The host is left out since proxies in front of the provider often rewrite it.
+func Sign(secret string, timestamp time.Time, method, requestURI, user string, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", t, computeSignature(secret, t, method, requestURI, user, body))
+}
+
+// SignRequest sets the signature header on a request, body must be what the request will send. Set the UserHeader first.
+func SignRequest(secret string, req *http.Request, body []byte) {
+	req.Header.Set(Header, Sign(secret, time.Now(), req.Method, req.URL.RequestURI(), req.Header.Get(UserHeader), body))
+}
+
+func computeSignature(secret, t, method, requestURI, user string, body []byte) string {
+	bodyHash := sha256.Sum256(body)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strings.Join([]string{t, strings.ToUpper(method), requestURI, user, hex.EncodeToString(bodyHash[:])}, "\n")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify checks a signature header value
+func Verify(secret, header, method, requestURI, user string, body []byte, tolerance time.Duration) error {
+	if header == "" {
+		return ErrMissingSignature
+	}
+	var t, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			sig = v
+		}
+	}
+	ts, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(computeSignature(secret, t, method, requestURI, user, body))) {
+		return ErrInvalidSignature
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
+
+// VerifyRequest checks the signature of an incoming request. It reads the body and replaces it so handlers can still read it.
+func VerifyRequest(secret string, r *http.Request, tolerance time.Duration) error {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		body, err = io.ReadAll(r.Body)
+		if err != nil {
+			return fmt.Errorf("error reading body: %w", err)
+		}
+		r.Body.Close()
+		r.Body = io.NopCloser(bytes.NewReader(body))
+	}
+	return Verify(secret, r.Header.Get(Header), r.Method, r.URL.RequestURI(), r.Header.Get(UserHeader), body, tolerance)
+}
+
+// Middleware rejects requests without a valid signature with a 401
+func Middleware(secret string, tolerance time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if err := VerifyRequest(secret, r, tolerance); err != nil {
+				http.Error(w, err.Error(), http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,52 @@
+package providersig
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func signedRequest(user string) *http.Request {
+	req := httptest.NewRequest(http.MethodGet, "https://provider.example/exchange?x=1", nil)
+	if user != "" {
+		req.Header.Set(UserHeader, user)
+	}
+	SignRequest("secret", req, nil)
+	return req
+}
+
+func TestVerifyRequest(t *testing.T) {
+	require.NoError(t, VerifyRequest("secret", signedRequest("session_abc"), DefaultTolerance))
+	require.NoError(t, VerifyRequest("secret", signedRequest(""), DefaultTolerance))
+	require.ErrorIs(t, VerifyRequest("other", signedRequest("session_abc"), DefaultTolerance), ErrInvalidSignature)
+	require.ErrorIs(t, VerifyRequest("secret", httptest.NewRequest(http.MethodGet, "/", nil), DefaultTolerance), ErrMissingSignature)
+}
+
+func TestVerifyRequestUserHeaderIsSigned(t *testing.T) {
+	req := signedRequest("session_abc")
+	req.Header.Set(UserHeader, "session_victim")
+	require.ErrorIs(t, VerifyRequest("secret", req, DefaultTolerance), ErrInvalidSignature)
+
+	req = signedRequest("")
+	req.Header.Set(UserHeader, "session_victim")
+	require.ErrorIs(t, VerifyRequest("secret", req, DefaultTolerance), ErrInvalidSignature)
+}
+
+func TestVerifyRequestBodyIsSigned(t *testing.T) {
+	req := httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"a":1}`))
+	SignRequest("secret", req, []byte(`{"a":1}`))
+	require.NoError(t, VerifyRequest("secret", req, DefaultTolerance))
+
+	req = httptest.NewRequest(http.MethodPost, "/hook", strings.NewReader(`{"a":2}`))
+	SignRequest("secret", req, []byte(`{"a":1}`))
+	require.ErrorIs(t, VerifyRequest("secret", req, DefaultTolerance), ErrInvalidSignature)
+}
+
+func TestVerifyExpired(t *testing.T) {
+	header := Sign("secret", time.Now().Add(-time.Hour), http.MethodGet, "/", "", nil)
+	require.ErrorIs(t, Verify("secret", header, http.MethodGet, "/", "", nil, DefaultTolerance), ErrSignatureExpired)
+}
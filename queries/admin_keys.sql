@@ -0,0 +1,69 @@
+-- name: InsertAdminKey :one
+insert into admin_keys (
+    tenant_id
+    , id
+    , name
+    , key_hash
+    , permissions
+    , expires
+) values (
+    @tenant_id
+    , @id
+    , @name
+    , @key_hash
+    , @permissions
+    , @expires
+)
+returning *
+;
+
+-- name: SelectValidAdminKeyByHash :one
+select *
+from admin_keys
+where tenant_id = @tenant_id
+and key_hash = @key_hash
+and revoked = false
+and (expires is null or expires > now())
+;
+
+-- name: UpdateAdminKeyLastUsed :exec
+-- Only writes once a minute per key so hot keys don't hammer the row
+update admin_keys
+set last_used = now()
+where tenant_id = @tenant_id
+and id = @id
+and (last_used is null or last_used < now() - interval '1 minute')
+;
+
+-- name: ListAdminKeys :many
+select *
+from admin_keys
+where tenant_id = @tenant_id
+order by created
+;
+
+-- name: RevokeAdminKey :execrows
+update admin_keys
+set revoked = true
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+;
+
+-- name: SelectAdminKey :one
+select *
+from admin_keys
+where tenant_id = @tenant_id
+and id = @id
+;
+
+-- name: UpdateAdminKeyExpires :execrows
+-- Only shortens the expiry, used for the grace period when rotating a key
+update admin_keys
+set expires = @expires
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+and revoked = false
+and (expires is null or expires > @expires)
+;
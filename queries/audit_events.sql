@@ -0,0 +1,63 @@
+-- name: SelectLatestAuditEvent :one
+-- Each tenant has its own chain
+select *
+from audit_events
+where tenant_id = @tenant_id
+order by seq desc
+limit 1
+;
+
+-- name: InsertAuditEvent :exec
+insert into audit_events (
+    tenant_id
+    , seq
+    , event_type
+    , actor
+    , client_id
+    , user_id
+    , ip
+    , request_id
+    , details
+    , prev_hash
+    , hash
+    , created
+) values (
+    @tenant_id
+    , @seq
+    , @event_type
+    , @actor
+    , @client_id
+    , @user_id
+    , @ip
+    , @request_id
+    , @details
+    , @prev_hash
+    , @hash
+    , @created
+)
+;
+
+-- name: ListAuditEvents :many
+-- Newest first, paginate with before_seq
+select *
+from audit_events
+where tenant_id = @tenant_id
+and (sqlc.narg('event_type')::text is null or event_type = sqlc.narg('event_type'))
+and (sqlc.narg('actor')::text is null or actor = sqlc.narg('actor'))
+and (sqlc.narg('client_id')::text is null or client_id = sqlc.narg('client_id'))
+and (sqlc.narg('user_id')::text is null or user_id = sqlc.narg('user_id'))
+and (sqlc.narg('since')::timestamptz is null or created >= sqlc.narg('since'))
+and (sqlc.narg('until')::timestamptz is null or created < sqlc.narg('until'))
+and (sqlc.narg('before_seq')::int8 is null or seq < sqlc.narg('before_seq'))
+order by seq desc
+limit @row_limit
+;
+
+-- name: ListAuditEventsAfterSeq :many
+select *
+from audit_events
+where tenant_id = @tenant_id
+and seq > @seq
+order by seq
+limit @row_limit
+;
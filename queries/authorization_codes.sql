@@ -1,27 +1,49 @@
 -- name: InsertAuthorizationCode :exec
 insert into authorization_codes (
-    id
+    tenant_id
+    , id
     , user_id
     , client_id
     , scopes
     , expires
+    , claims
+    , access_token_ttl_seconds
+    , refresh_token_ttl_seconds
+    , redirect_uri
 ) values (
-     @id
+     @tenant_id
+     , @id
      , @user_id
      , @client_id
      , @scopes
      , @expires
+     , @claims
+     , @access_token_ttl_seconds
+     , @refresh_token_ttl_seconds
+     , @redirect_uri
  )
 ;
 
 -- name: SelectAuthorizationCode :one
 select *
 from authorization_codes
-where id = $1
+where tenant_id = @tenant_id
+and id = @id
 ;
 
 -- name: DeleteAuthorizationCode :one
 delete from authorization_codes
-where id = $1
+where tenant_id = @tenant_id
+and id = @id
 returning *
-;
\ No newline at end of file
+;
+
+-- name: DeleteExpiredAuthorizationCodes :execrows
+delete from authorization_codes
+where id in (
+    select id
+    from authorization_codes
+    where expires < @before
+    limit @row_limit
+)
+;
@@ -1,5 +1,70 @@
 -- name: SelectClient :one
 select *
 from clients
-where id = $1
-;
\ No newline at end of file
+where tenant_id = @tenant_id
+and id = @id
+;
+
+-- name: UpdateClientSuspended :one
+update clients
+set suspended = @suspended
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+returning *
+;
+
+-- name: InsertClient :one
+insert into clients (
+    tenant_id
+    , id
+    , secret
+    , name
+) values (
+    @tenant_id
+    , @id
+    , @secret
+    , @name
+)
+returning *
+;
+
+-- name: UpdateClientSecret :one
+update clients
+set secret = @secret
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+returning *
+;
+
+-- name: UpdateClientTokenPolicy :one
+update clients
+set access_token_ttl_seconds = @access_token_ttl_seconds
+    , refresh_token_ttl_seconds = @refresh_token_ttl_seconds
+    , refresh_token_idle_seconds = @refresh_token_idle_seconds
+    , refresh_token_policy = @refresh_token_policy
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+returning *
+;
+
+-- name: UpdateClientRateLimit :one
+update clients
+set rate_limit_per_minute = @rate_limit_per_minute
+    , rate_limit_burst = @rate_limit_burst
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+returning *
+;
+
+-- name: UpdateClientRedirectURIs :one
+update clients
+set redirect_uris = @redirect_uris
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+returning *
+;
@@ -0,0 +1,47 @@
+-- name: UpsertConsent :exec
+insert into consents (
+    tenant_id
+    , user_id
+    , client_id
+    , scopes
+) values (
+    @tenant_id
+    , @user_id
+    , @client_id
+    , @scopes
+)
+on conflict (user_id, client_id) do update
+set scopes = excluded.scopes
+    , updated = now()
+;
+
+-- name: ListConsentsByUserID :many
+select *
+from consents
+where tenant_id = @tenant_id
+and user_id = @user_id
+order by client_id
+;
+
+-- name: DeleteConsent :execrows
+delete from consents
+where tenant_id = @tenant_id
+and user_id = @user_id
+and client_id = @client_id
+;
+
+-- name: TouchConsent :exec
+update consents
+set last_used = now()
+where tenant_id = @tenant_id
+and user_id = @user_id
+and client_id = @client_id
+;
+
+-- name: TouchConsents :exec
+-- The consents of each user_ids[i] and client_ids[i]
+update consents
+set last_used = now()
+where tenant_id = @tenant_id
+and (user_id, client_id) in (select unnest(@user_ids::text[]), unnest(@client_ids::text[]))
+;
@@ -0,0 +1,50 @@
+-- name: TakeRateLimitToken :one
+-- Takes a token from the bucket, returning no rows if it's empty or the key is locked out
+insert into rate_limits (
+    key
+    , full_at
+) values (
+    @key
+    , now() + @interval_us::int8 * interval '1 microsecond'
+)
+on conflict (key) do update
+set full_at = greatest(rate_limits.full_at, now()) + @interval_us::int8 * interval '1 microsecond'
+where greatest(rate_limits.full_at, now()) + @interval_us::int8 * interval '1 microsecond' <= now() + @burst_us::int8 * interval '1 microsecond'
+and (rate_limits.locked_until is null or rate_limits.locked_until <= now())
+returning full_at
+;
+
+-- name: SelectRateLimit :one
+-- With the database's clock, so the wait doesn't depend on ours
+select full_at
+    , locked_until
+    , now()::timestamptz as now
+from rate_limits
+where key = $1
+;
+
+-- name: LockRateLimitKey :exec
+insert into rate_limits (
+    key
+    , full_at
+    , locked_until
+) values (
+    @key
+    , now()
+    , now() + @lockout_us::int8 * interval '1 microsecond'
+)
+on conflict (key) do update
+set locked_until = excluded.locked_until
+;
+
+-- name: DeleteIdleRateLimits :execrows
+-- A full, unlocked bucket is the same as no row
+delete from rate_limits
+where key in (
+    select key
+    from rate_limits
+    where full_at < now()
+    and (locked_until is null or locked_until < now())
+    limit @row_limit
+)
+;
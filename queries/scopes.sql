@@ -1,4 +1,20 @@
 -- name: ListScopes :many
 select *
 from scopes
-;
\ No newline at end of file
+where tenant_id = @tenant_id
+;
+-- name: UpsertScope :one
+insert into scopes (
+    tenant_id
+    , id
+    , description
+) values (
+    @tenant_id
+    , @id
+    , @description
+)
+on conflict (tenant_id, id) do update
+set description = excluded.description
+    , updated = now()
+returning *
+;
@@ -0,0 +1,45 @@
+-- name: ListTenants :many
+select *
+from tenants
+order by id
+;
+
+-- name: SelectTenant :one
+select *
+from tenants
+where id = @id
+;
+
+-- name: InsertTenant :one
+insert into tenants (
+    id
+    , name
+    , host
+    , provider_user_exchange_url
+    , provider_pre_issuance_hook_url
+    , provider_secret
+    , issuer
+) values (
+    @id
+    , @name
+    , @host
+    , @provider_user_exchange_url
+    , @provider_pre_issuance_hook_url
+    , @provider_secret
+    , @issuer
+)
+returning *
+;
+
+-- name: UpdateTenant :one
+update tenants
+set name = @name
+    , host = @host
+    , provider_user_exchange_url = @provider_user_exchange_url
+    , provider_pre_issuance_hook_url = @provider_pre_issuance_hook_url
+    , provider_secret = @provider_secret
+    , issuer = @issuer
+    , updated = now()
+where id = @id
+returning *
+;
@@ -1,73 +1,210 @@
 -- name: InsertRefreshToken :exec
 insert into refresh_tokens (
-    id
+    tenant_id
+    , id
     , client_id
     , user_id
     , scopes
     , expires
+    , claims
+    , grant_created
 ) values (
-    @id
+    @tenant_id
+    , @id
     , @client_id
     , @user_id
     , @scopes
     , @expires
+    , @claims
+    , @grant_created
 )
 ;
 
 -- name: InsertAccessToken :exec
 insert into access_tokens (
-    id
+    tenant_id
+    , id
     , client_id
     , refresh_token
     , user_id
     , scopes
     , expires
+    , claims
 ) values (
-    @id
+    @tenant_id
+    , @id
     , @client_id
     , @refresh_token
     , @user_id
     , @scopes
     , @expires
+    , @claims
 )
 ;
 
 -- name: SelectValidAccessToken :one
 select *
 from access_tokens
-where id = $1
+where tenant_id = @tenant_id
+and id = @id
+and expires > now()
+and revoked = false
+;
+
+-- name: SelectValidAccessTokens :many
+select *
+from access_tokens
+where tenant_id = @tenant_id
+and id = any(@ids::text[])
 and expires > now()
 and revoked = false
 ;
 
 -- name: SelectValidRefreshToken :one
--- Might be expired, if so need to regenerate and mark as revoked
 select *
 from refresh_tokens
-where id = $1
+where tenant_id = @tenant_id
+and id = @id
 and expires > now()
+and revoked = false
+;
+
+-- name: SelectRefreshToken :one
+-- Expired and revoked too, for reuse detection
+select *
+from refresh_tokens
+where tenant_id = @tenant_id
+and id = @id
 ;
 
--- name: RevokeRefreshToken :exec
+-- name: RotateRefreshToken :execrows
+-- Revokes a refresh token that was used, recording the one that replaced it for reuse detection
 update refresh_tokens
 set revoked = true
-where id = $1
+    , replaced_by = @replaced_by
+    , last_used = now()
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+and revoked = false
+;
+
+-- name: TouchAccessTokens :many
+-- At most once a minute per token, so introspecting on every request doesn't write on every request. Returns the IDs
+-- of the tokens it touched.
+update access_tokens
+set last_used = now()
+where tenant_id = @tenant_id
+and id = any(@ids::text[])
+and (last_used is null or last_used < now() - interval '1 minute')
+returning id
 ;
 
 -- name: RevokeAccessToken :exec
 update access_tokens
 set revoked = true
-where id = $1
+where tenant_id = @tenant_id
+and id = @id
 ;
 
 -- name: ListRefreshTokensByUserID :many
 select *
 from refresh_tokens
-where user_id = $1
+where tenant_id = @tenant_id
+and user_id = @user_id
 ;
 
 -- name: ListAccessTokensByUserID :many
 select *
 from access_tokens
-where user_id = $1
-;
\ No newline at end of file
+where tenant_id = @tenant_id
+and user_id = @user_id
+;
+
+-- name: RevokeAccessTokensByUserID :execrows
+update access_tokens
+set revoked = true
+where tenant_id = @tenant_id
+and user_id = @user_id
+and revoked = false
+;
+
+-- name: RevokeRefreshTokensByUserID :execrows
+update refresh_tokens
+set revoked = true
+where tenant_id = @tenant_id
+and user_id = @user_id
+and revoked = false
+;
+
+-- name: RevokeAccessTokensByClientID :execrows
+update access_tokens
+set revoked = true
+where tenant_id = @tenant_id
+and client_id = @client_id
+and revoked = false
+;
+
+-- name: RevokeRefreshTokensByClientID :execrows
+update refresh_tokens
+set revoked = true
+where tenant_id = @tenant_id
+and client_id = @client_id
+and revoked = false
+;
+
+-- name: RevokeAccessTokensCreatedBefore :execrows
+update access_tokens
+set revoked = true
+where tenant_id = @tenant_id
+and created < @before
+and revoked = false
+;
+
+-- name: RevokeRefreshTokensCreatedBefore :execrows
+update refresh_tokens
+set revoked = true
+where tenant_id = @tenant_id
+and created < @before
+and revoked = false
+;
+
+-- name: RevokeAccessTokensByUserAndClient :execrows
+update access_tokens
+set revoked = true
+where tenant_id = @tenant_id
+and user_id = @user_id
+and client_id = @client_id
+and revoked = false
+;
+
+-- name: RevokeRefreshTokensByUserAndClient :execrows
+update refresh_tokens
+set revoked = true
+where tenant_id = @tenant_id
+and user_id = @user_id
+and client_id = @client_id
+and revoked = false
+;
+
+-- name: DeleteExpiredAccessTokens :execrows
+delete from access_tokens
+where id in (
+    select id
+    from access_tokens
+    where expires < @before
+    or (revoked = true and created < @before)
+    limit @row_limit
+)
+;
+
+-- name: DeleteExpiredRefreshTokens :execrows
+delete from refresh_tokens
+where id in (
+    select id
+    from refresh_tokens
+    where expires < @before
+    or (revoked = true and created < @before)
+    limit @row_limit
+)
+;
@@ -0,0 +1,114 @@
+-- name: InsertWebhookSubscription :one
+insert into webhook_subscriptions (
+    tenant_id
+    , id
+    , url
+    , secret
+    , event_types
+) values (
+    @tenant_id
+    , @id
+    , @url
+    , @secret
+    , @event_types
+)
+returning *
+;
+
+-- name: SelectWebhookSubscription :one
+select *
+from webhook_subscriptions
+where tenant_id = @tenant_id
+and id = @id
+;
+
+-- name: ListWebhookSubscriptions :many
+select *
+from webhook_subscriptions
+where tenant_id = @tenant_id
+order by created
+;
+
+-- name: ListWebhookSubscriptionsForEvent :many
+select *
+from webhook_subscriptions
+where tenant_id = @tenant_id
+and disabled = false
+and @event_type::text = any(event_types)
+;
+
+-- name: DeleteWebhookSubscription :execrows
+delete from webhook_subscriptions
+where tenant_id = @tenant_id
+and id = @id
+;
+
+-- name: InsertWebhookDelivery :exec
+insert into webhook_deliveries (
+    tenant_id
+    , id
+    , subscription_id
+    , event_id
+    , event_type
+    , payload
+) values (
+    @tenant_id
+    , @id
+    , @subscription_id
+    , @event_id
+    , @event_type
+    , @payload
+)
+;
+
+-- name: ClaimWebhookDeliveries :many
+-- Every tenant's, the worker delivers for all of them
+-- Pushes next_attempt out to lease_until so other replicas skip these while they are in flight
+update webhook_deliveries
+set next_attempt = @lease_until
+    , updated = now()
+where id in (
+    select id
+    from webhook_deliveries
+    where status = 'pending'
+    and next_attempt <= now()
+    order by next_attempt
+    limit @row_limit
+    for update skip locked
+)
+returning *
+;
+
+-- name: UpdateWebhookDeliveryAttempt :exec
+update webhook_deliveries
+set attempts = attempts + 1
+    , status = @status
+    , last_status_code = @last_status_code
+    , last_error = @last_error
+    , next_attempt = @next_attempt
+    , delivered = @delivered
+    , updated = now()
+where id = @id
+;
+
+-- name: ListWebhookDeliveries :many
+-- Newest first, paginate with before_id
+select *
+from webhook_deliveries
+where tenant_id = @tenant_id
+and (sqlc.narg('status')::text is null or status = sqlc.narg('status'))
+and (sqlc.narg('subscription_id')::text is null or subscription_id = sqlc.narg('subscription_id'))
+and (sqlc.narg('before_id')::text is null or id < sqlc.narg('before_id'))
+order by id desc
+limit @row_limit
+;
+
+-- name: ReplayWebhookDelivery :execrows
+update webhook_deliveries
+set status = 'pending'
+    , attempts = 0
+    , next_attempt = now()
+    , updated = now()
+where tenant_id = @tenant_id
+and id = @id
+;
@@ -12,12 +12,18 @@ import (
 
 const deleteAuthorizationCode = `-- name: DeleteAuthorizationCode :one
 delete from authorization_codes
-where id = $1
-returning id, client_id, user_id, scopes, expires, created, updated
+where tenant_id = $1
+and id = $2
+returning id, client_id, user_id, scopes, expires, created, updated, claims, access_token_ttl_seconds, refresh_token_ttl_seconds, tenant_id, redirect_uri
 `
 
-func (q *Queries) DeleteAuthorizationCode(ctx context.Context, id string) (AuthorizationCode, error) {
-	row := q.db.QueryRow(ctx, deleteAuthorizationCode, id)
+type DeleteAuthorizationCodeParams struct {
+	TenantID string
+	ID       string
+}
+
+func (q *Queries) DeleteAuthorizationCode(ctx context.Context, arg DeleteAuthorizationCodeParams) (AuthorizationCode, error) {
+	row := q.db.QueryRow(ctx, deleteAuthorizationCode, arg.TenantID, arg.ID)
 	var i AuthorizationCode
 	err := row.Scan(
 		&i.ID,
@@ -27,53 +33,107 @@ func (q *Queries) DeleteAuthorizationCode(ctx context.Context, id string) (Autho
 		&i.Expires,
 		&i.Created,
 		&i.Updated,
+		&i.Claims,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.TenantID,
+		&i.RedirectUri,
 	)
 	return i, err
 }
 
+const deleteExpiredAuthorizationCodes = `-- name: DeleteExpiredAuthorizationCodes :execrows
+delete from authorization_codes
+where id in (
+    select id
+    from authorization_codes
+    where expires < $1
+    limit $2
+)
+`
+
+type DeleteExpiredAuthorizationCodesParams struct {
+	Before   time.Time
+	RowLimit int32
+}
+
+func (q *Queries) DeleteExpiredAuthorizationCodes(ctx context.Context, arg DeleteExpiredAuthorizationCodesParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredAuthorizationCodes, arg.Before, arg.RowLimit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const insertAuthorizationCode = `-- name: InsertAuthorizationCode :exec
 insert into authorization_codes (
-    id
+    tenant_id
+    , id
     , user_id
     , client_id
     , scopes
     , expires
+    , claims
+    , access_token_ttl_seconds
+    , refresh_token_ttl_seconds
+    , redirect_uri
 ) values (
      $1
      , $2
      , $3
      , $4
      , $5
+     , $6
+     , $7
+     , $8
+     , $9
+     , $10
  )
 `
 
 type InsertAuthorizationCodeParams struct {
-	ID       string
-	UserID   string
-	ClientID string
-	Scopes   []string
-	Expires  time.Time
+	TenantID               string
+	ID                     string
+	UserID                 string
+	ClientID               string
+	Scopes                 []string
+	Expires                time.Time
+	Claims                 []byte
+	AccessTokenTtlSeconds  *int64
+	RefreshTokenTtlSeconds *int64
+	RedirectUri            *string
 }
 
 func (q *Queries) InsertAuthorizationCode(ctx context.Context, arg InsertAuthorizationCodeParams) error {
 	_, err := q.db.Exec(ctx, insertAuthorizationCode,
+		arg.TenantID,
 		arg.ID,
 		arg.UserID,
 		arg.ClientID,
 		arg.Scopes,
 		arg.Expires,
+		arg.Claims,
+		arg.AccessTokenTtlSeconds,
+		arg.RefreshTokenTtlSeconds,
+		arg.RedirectUri,
 	)
 	return err
 }
 
 const selectAuthorizationCode = `-- name: SelectAuthorizationCode :one
-select id, client_id, user_id, scopes, expires, created, updated
+select id, client_id, user_id, scopes, expires, created, updated, claims, access_token_ttl_seconds, refresh_token_ttl_seconds, tenant_id, redirect_uri
 from authorization_codes
-where id = $1
+where tenant_id = $1
+and id = $2
 `
 
-func (q *Queries) SelectAuthorizationCode(ctx context.Context, id string) (AuthorizationCode, error) {
-	row := q.db.QueryRow(ctx, selectAuthorizationCode, id)
+type SelectAuthorizationCodeParams struct {
+	TenantID string
+	ID       string
+}
+
+func (q *Queries) SelectAuthorizationCode(ctx context.Context, arg SelectAuthorizationCodeParams) (AuthorizationCode, error) {
+	row := q.db.QueryRow(ctx, selectAuthorizationCode, arg.TenantID, arg.ID)
 	var i AuthorizationCode
 	err := row.Scan(
 		&i.ID,
@@ -83,6 +143,11 @@ func (q *Queries) SelectAuthorizationCode(ctx context.Context, id string) (Autho
 		&i.Expires,
 		&i.Created,
 		&i.Updated,
+		&i.Claims,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.TenantID,
+		&i.RedirectUri,
 	)
 	return i, err
 }
@@ -9,14 +9,274 @@ import (
 	"context"
 )
 
+const insertClient = `-- name: InsertClient :one
+insert into clients (
+    tenant_id
+    , id
+    , secret
+    , name
+) values (
+    $1
+    , $2
+    , $3
+    , $4
+)
+returning id, secret, suspended, name, created, updated, access_token_ttl_seconds, refresh_token_ttl_seconds, refresh_token_idle_seconds, refresh_token_policy, rate_limit_per_minute, rate_limit_burst, tenant_id, redirect_uris
+`
+
+type InsertClientParams struct {
+	TenantID string
+	ID       string
+	Secret   string
+	Name     string
+}
+
+func (q *Queries) InsertClient(ctx context.Context, arg InsertClientParams) (Client, error) {
+	row := q.db.QueryRow(ctx, insertClient,
+		arg.TenantID,
+		arg.ID,
+		arg.Secret,
+		arg.Name,
+	)
+	var i Client
+	err := row.Scan(
+		&i.ID,
+		&i.Secret,
+		&i.Suspended,
+		&i.Name,
+		&i.Created,
+		&i.Updated,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RefreshTokenIdleSeconds,
+		&i.RefreshTokenPolicy,
+		&i.RateLimitPerMinute,
+		&i.RateLimitBurst,
+		&i.TenantID,
+		&i.RedirectUris,
+	)
+	return i, err
+}
+
 const selectClient = `-- name: SelectClient :one
-select id, secret, suspended, name, created, updated
+select id, secret, suspended, name, created, updated, access_token_ttl_seconds, refresh_token_ttl_seconds, refresh_token_idle_seconds, refresh_token_policy, rate_limit_per_minute, rate_limit_burst, tenant_id, redirect_uris
 from clients
-where id = $1
+where tenant_id = $1
+and id = $2
+`
+
+type SelectClientParams struct {
+	TenantID string
+	ID       string
+}
+
+func (q *Queries) SelectClient(ctx context.Context, arg SelectClientParams) (Client, error) {
+	row := q.db.QueryRow(ctx, selectClient, arg.TenantID, arg.ID)
+	var i Client
+	err := row.Scan(
+		&i.ID,
+		&i.Secret,
+		&i.Suspended,
+		&i.Name,
+		&i.Created,
+		&i.Updated,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RefreshTokenIdleSeconds,
+		&i.RefreshTokenPolicy,
+		&i.RateLimitPerMinute,
+		&i.RateLimitBurst,
+		&i.TenantID,
+		&i.RedirectUris,
+	)
+	return i, err
+}
+
+const updateClientRateLimit = `-- name: UpdateClientRateLimit :one
+update clients
+set rate_limit_per_minute = $1
+    , rate_limit_burst = $2
+    , updated = now()
+where tenant_id = $3
+and id = $4
+returning id, secret, suspended, name, created, updated, access_token_ttl_seconds, refresh_token_ttl_seconds, refresh_token_idle_seconds, refresh_token_policy, rate_limit_per_minute, rate_limit_burst, tenant_id, redirect_uris
+`
+
+type UpdateClientRateLimitParams struct {
+	RateLimitPerMinute *int64
+	RateLimitBurst     *int64
+	TenantID           string
+	ID                 string
+}
+
+func (q *Queries) UpdateClientRateLimit(ctx context.Context, arg UpdateClientRateLimitParams) (Client, error) {
+	row := q.db.QueryRow(ctx, updateClientRateLimit,
+		arg.RateLimitPerMinute,
+		arg.RateLimitBurst,
+		arg.TenantID,
+		arg.ID,
+	)
+	var i Client
+	err := row.Scan(
+		&i.ID,
+		&i.Secret,
+		&i.Suspended,
+		&i.Name,
+		&i.Created,
+		&i.Updated,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RefreshTokenIdleSeconds,
+		&i.RefreshTokenPolicy,
+		&i.RateLimitPerMinute,
+		&i.RateLimitBurst,
+		&i.TenantID,
+		&i.RedirectUris,
+	)
+	return i, err
+}
+
+const updateClientRedirectURIs = `-- name: UpdateClientRedirectURIs :one
+update clients
+set redirect_uris = $1
+    , updated = now()
+where tenant_id = $2
+and id = $3
+returning id, secret, suspended, name, created, updated, access_token_ttl_seconds, refresh_token_ttl_seconds, refresh_token_idle_seconds, refresh_token_policy, rate_limit_per_minute, rate_limit_burst, tenant_id, redirect_uris
 `
 
-func (q *Queries) SelectClient(ctx context.Context, id string) (Client, error) {
-	row := q.db.QueryRow(ctx, selectClient, id)
+type UpdateClientRedirectURIsParams struct {
+	RedirectUris []string
+	TenantID     string
+	ID           string
+}
+
+func (q *Queries) UpdateClientRedirectURIs(ctx context.Context, arg UpdateClientRedirectURIsParams) (Client, error) {
+	row := q.db.QueryRow(ctx, updateClientRedirectURIs, arg.RedirectUris, arg.TenantID, arg.ID)
+	var i Client
+	err := row.Scan(
+		&i.ID,
+		&i.Secret,
+		&i.Suspended,
+		&i.Name,
+		&i.Created,
+		&i.Updated,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RefreshTokenIdleSeconds,
+		&i.RefreshTokenPolicy,
+		&i.RateLimitPerMinute,
+		&i.RateLimitBurst,
+		&i.TenantID,
+		&i.RedirectUris,
+	)
+	return i, err
+}
+
+const updateClientSecret = `-- name: UpdateClientSecret :one
+update clients
+set secret = $1
+    , updated = now()
+where tenant_id = $2
+and id = $3
+returning id, secret, suspended, name, created, updated, access_token_ttl_seconds, refresh_token_ttl_seconds, refresh_token_idle_seconds, refresh_token_policy, rate_limit_per_minute, rate_limit_burst, tenant_id, redirect_uris
+`
+
+type UpdateClientSecretParams struct {
+	Secret   string
+	TenantID string
+	ID       string
+}
+
+func (q *Queries) UpdateClientSecret(ctx context.Context, arg UpdateClientSecretParams) (Client, error) {
+	row := q.db.QueryRow(ctx, updateClientSecret, arg.Secret, arg.TenantID, arg.ID)
+	var i Client
+	err := row.Scan(
+		&i.ID,
+		&i.Secret,
+		&i.Suspended,
+		&i.Name,
+		&i.Created,
+		&i.Updated,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RefreshTokenIdleSeconds,
+		&i.RefreshTokenPolicy,
+		&i.RateLimitPerMinute,
+		&i.RateLimitBurst,
+		&i.TenantID,
+		&i.RedirectUris,
+	)
+	return i, err
+}
+
+const updateClientSuspended = `-- name: UpdateClientSuspended :one
+update clients
+set suspended = $1
+    , updated = now()
+where tenant_id = $2
+and id = $3
+returning id, secret, suspended, name, created, updated, access_token_ttl_seconds, refresh_token_ttl_seconds, refresh_token_idle_seconds, refresh_token_policy, rate_limit_per_minute, rate_limit_burst, tenant_id, redirect_uris
+`
+
+type UpdateClientSuspendedParams struct {
+	Suspended bool
+	TenantID  string
+	ID        string
+}
+
+func (q *Queries) UpdateClientSuspended(ctx context.Context, arg UpdateClientSuspendedParams) (Client, error) {
+	row := q.db.QueryRow(ctx, updateClientSuspended, arg.Suspended, arg.TenantID, arg.ID)
+	var i Client
+	err := row.Scan(
+		&i.ID,
+		&i.Secret,
+		&i.Suspended,
+		&i.Name,
+		&i.Created,
+		&i.Updated,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RefreshTokenIdleSeconds,
+		&i.RefreshTokenPolicy,
+		&i.RateLimitPerMinute,
+		&i.RateLimitBurst,
+		&i.TenantID,
+		&i.RedirectUris,
+	)
+	return i, err
+}
+
+const updateClientTokenPolicy = `-- name: UpdateClientTokenPolicy :one
+update clients
+set access_token_ttl_seconds = $1
+    , refresh_token_ttl_seconds = $2
+    , refresh_token_idle_seconds = $3
+    , refresh_token_policy = $4
+    , updated = now()
+where tenant_id = $5
+and id = $6
+returning id, secret, suspended, name, created, updated, access_token_ttl_seconds, refresh_token_ttl_seconds, refresh_token_idle_seconds, refresh_token_policy, rate_limit_per_minute, rate_limit_burst, tenant_id, redirect_uris
+`
+
+type UpdateClientTokenPolicyParams struct {
+	AccessTokenTtlSeconds   *int64
+	RefreshTokenTtlSeconds  *int64
+	RefreshTokenIdleSeconds *int64
+	RefreshTokenPolicy      string
+	TenantID                string
+	ID                      string
+}
+
+func (q *Queries) UpdateClientTokenPolicy(ctx context.Context, arg UpdateClientTokenPolicyParams) (Client, error) {
+	row := q.db.QueryRow(ctx, updateClientTokenPolicy,
+		arg.AccessTokenTtlSeconds,
+		arg.RefreshTokenTtlSeconds,
+		arg.RefreshTokenIdleSeconds,
+		arg.RefreshTokenPolicy,
+		arg.TenantID,
+		arg.ID,
+	)
 	var i Client
 	err := row.Scan(
 		&i.ID,
@@ -25,6 +285,14 @@ func (q *Queries) SelectClient(ctx context.Context, id string) (Client, error) {
 		&i.Name,
 		&i.Created,
 		&i.Updated,
+		&i.AccessTokenTtlSeconds,
+		&i.RefreshTokenTtlSeconds,
+		&i.RefreshTokenIdleSeconds,
+		&i.RefreshTokenPolicy,
+		&i.RateLimitPerMinute,
+		&i.RateLimitBurst,
+		&i.TenantID,
+		&i.RedirectUris,
 	)
 	return i, err
 }
@@ -18,36 +18,101 @@ type AccessToken struct {
 	Revoked      bool
 	Created      time.Time
 	Updated      time.Time
+	Claims       []byte
+	LastUsed     *time.Time
+	TenantID     string
+}
+
+type AdminKey struct {
+	ID          string
+	Name        string
+	KeyHash     string
+	Permissions []string
+	Expires     *time.Time
+	LastUsed    *time.Time
+	Revoked     bool
+	Created     time.Time
+	Updated     time.Time
+	TenantID    string
+}
+
+type AuditEvent struct {
+	Seq       int64
+	EventType string
+	Actor     string
+	ClientID  *string
+	UserID    *string
+	Ip        string
+	RequestID string
+	Details   []byte
+	PrevHash  string
+	Hash      string
+	Created   time.Time
+	TenantID  string
 }
 
 type AuthorizationCode struct {
-	ID       string
-	ClientID string
-	UserID   string
-	Scopes   []string
-	Expires  time.Time
-	Created  time.Time
-	Updated  time.Time
+	ID                     string
+	ClientID               string
+	UserID                 string
+	Scopes                 []string
+	Expires                time.Time
+	Created                time.Time
+	Updated                time.Time
+	Claims                 []byte
+	AccessTokenTtlSeconds  *int64
+	RefreshTokenTtlSeconds *int64
+	TenantID               string
+	RedirectUri            *string
 }
 
 type Client struct {
-	ID        string
-	Secret    string
-	Suspended bool
-	Name      string
-	Created   time.Time
-	Updated   time.Time
+	ID                      string
+	Secret                  string
+	Suspended               bool
+	Name                    string
+	Created                 time.Time
+	Updated                 time.Time
+	AccessTokenTtlSeconds   *int64
+	RefreshTokenTtlSeconds  *int64
+	RefreshTokenIdleSeconds *int64
+	RefreshTokenPolicy      string
+	RateLimitPerMinute      *int64
+	RateLimitBurst          *int64
+	TenantID                string
+	RedirectUris            []string
 }
 
-type RefreshToken struct {
-	ID       string
-	ClientID string
+type Consent struct {
 	UserID   string
+	ClientID string
 	Scopes   []string
-	Expires  time.Time
-	Revoked  bool
 	Created  time.Time
 	Updated  time.Time
+	LastUsed *time.Time
+	TenantID string
+}
+
+type RateLimit struct {
+	Key         string
+	FullAt      time.Time
+	LockedUntil *time.Time
+}
+
+type RefreshToken struct {
+	ID           string
+	ClientID     string
+	UserID       string
+	Scopes       []string
+	Expires      time.Time
+	Revoked      bool
+	Created      time.Time
+	Updated      time.Time
+	Claims       []byte
+	LastUsed     *time.Time
+	GrantCreated *time.Time
+	TenantID     string
+	ReplacedBy   *string
 }
 
 type Scope struct {
@@ -55,4 +120,45 @@ type Scope struct {
 	Description *string
 	Created     time.Time
 	Updated     time.Time
+	TenantID    string
+}
+
+type Tenant struct {
+	ID                         string
+	Name                       string
+	Host                       *string
+	ProviderUserExchangeUrl    *string
+	ProviderPreIssuanceHookUrl *string
+	ProviderSecret             *string
+	Issuer                     *string
+	Created                    time.Time
+	Updated                    time.Time
+}
+
+type WebhookDelivery struct {
+	ID             string
+	SubscriptionID string
+	EventID        string
+	EventType      string
+	Payload        []byte
+	Status         string
+	Attempts       int64
+	NextAttempt    time.Time
+	LastStatusCode *int64
+	LastError      *string
+	Delivered      *time.Time
+	Created        time.Time
+	Updated        time.Time
+	TenantID       string
+}
+
+type WebhookSubscription struct {
+	ID         string
+	Url        string
+	Secret     string
+	EventTypes []string
+	Disabled   bool
+	Created    time.Time
+	Updated    time.Time
+	TenantID   string
 }
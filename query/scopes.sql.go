@@ -10,12 +10,13 @@ import (
 )
 
 const listScopes = `-- name: ListScopes :many
-select id, description, created, updated
+select id, description, created, updated, tenant_id
 from scopes
+where tenant_id = $1
 `
 
-func (q *Queries) ListScopes(ctx context.Context) ([]Scope, error) {
-	rows, err := q.db.Query(ctx, listScopes)
+func (q *Queries) ListScopes(ctx context.Context, tenantID string) ([]Scope, error) {
+	rows, err := q.db.Query(ctx, listScopes, tenantID)
 	if err != nil {
 		return nil, err
 	}
@@ -28,6 +29,7 @@ func (q *Queries) ListScopes(ctx context.Context) ([]Scope, error) {
 			&i.Description,
 			&i.Created,
 			&i.Updated,
+			&i.TenantID,
 		); err != nil {
 			return nil, err
 		}
@@ -38,3 +40,38 @@ func (q *Queries) ListScopes(ctx context.Context) ([]Scope, error) {
 	}
 	return items, nil
 }
+
+const upsertScope = `-- name: UpsertScope :one
+insert into scopes (
+    tenant_id
+    , id
+    , description
+) values (
+    $1
+    , $2
+    , $3
+)
+on conflict (tenant_id, id) do update
+set description = excluded.description
+    , updated = now()
+returning id, description, created, updated, tenant_id
+`
+
+type UpsertScopeParams struct {
+	TenantID    string
+	ID          string
+	Description *string
+}
+
+func (q *Queries) UpsertScope(ctx context.Context, arg UpsertScopeParams) (Scope, error) {
+	row := q.db.QueryRow(ctx, upsertScope, arg.TenantID, arg.ID, arg.Description)
+	var i Scope
+	err := row.Scan(
+		&i.ID,
+		&i.Description,
+		&i.Created,
+		&i.Updated,
+		&i.TenantID,
+	)
+	return i, err
+}
@@ -10,14 +10,64 @@ import (
 	"time"
 )
 
+const deleteExpiredAccessTokens = `-- name: DeleteExpiredAccessTokens :execrows
+delete from access_tokens
+where id in (
+    select id
+    from access_tokens
+    where expires < $1
+    or (revoked = true and created < $1)
+    limit $2
+)
+`
+
+type DeleteExpiredAccessTokensParams struct {
+	Before   time.Time
+	RowLimit int32
+}
+
+func (q *Queries) DeleteExpiredAccessTokens(ctx context.Context, arg DeleteExpiredAccessTokensParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredAccessTokens, arg.Before, arg.RowLimit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const deleteExpiredRefreshTokens = `-- name: DeleteExpiredRefreshTokens :execrows
+delete from refresh_tokens
+where id in (
+    select id
+    from refresh_tokens
+    where expires < $1
+    or (revoked = true and created < $1)
+    limit $2
+)
+`
+
+type DeleteExpiredRefreshTokensParams struct {
+	Before   time.Time
+	RowLimit int32
+}
+
+func (q *Queries) DeleteExpiredRefreshTokens(ctx context.Context, arg DeleteExpiredRefreshTokensParams) (int64, error) {
+	result, err := q.db.Exec(ctx, deleteExpiredRefreshTokens, arg.Before, arg.RowLimit)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
 const insertAccessToken = `-- name: InsertAccessToken :exec
 insert into access_tokens (
-    id
+    tenant_id
+    , id
     , client_id
     , refresh_token
     , user_id
     , scopes
     , expires
+    , claims
 ) values (
     $1
     , $2
@@ -25,73 +75,97 @@ insert into access_tokens (
     , $4
     , $5
     , $6
+    , $7
+    , $8
 )
 `
 
 type InsertAccessTokenParams struct {
+	TenantID     string
 	ID           string
 	ClientID     string
 	RefreshToken *string
 	UserID       string
 	Scopes       []string
 	Expires      time.Time
+	Claims       []byte
 }
 
 func (q *Queries) InsertAccessToken(ctx context.Context, arg InsertAccessTokenParams) error {
 	_, err := q.db.Exec(ctx, insertAccessToken,
+		arg.TenantID,
 		arg.ID,
 		arg.ClientID,
 		arg.RefreshToken,
 		arg.UserID,
 		arg.Scopes,
 		arg.Expires,
+		arg.Claims,
 	)
 	return err
 }
 
 const insertRefreshToken = `-- name: InsertRefreshToken :exec
 insert into refresh_tokens (
-    id
+    tenant_id
+    , id
     , client_id
     , user_id
     , scopes
     , expires
+    , claims
+    , grant_created
 ) values (
     $1
     , $2
     , $3
     , $4
     , $5
+    , $6
+    , $7
+    , $8
 )
 `
 
 type InsertRefreshTokenParams struct {
-	ID       string
-	ClientID string
-	UserID   string
-	Scopes   []string
-	Expires  time.Time
+	TenantID     string
+	ID           string
+	ClientID     string
+	UserID       string
+	Scopes       []string
+	Expires      time.Time
+	Claims       []byte
+	GrantCreated *time.Time
 }
 
 func (q *Queries) InsertRefreshToken(ctx context.Context, arg InsertRefreshTokenParams) error {
 	_, err := q.db.Exec(ctx, insertRefreshToken,
+		arg.TenantID,
 		arg.ID,
 		arg.ClientID,
 		arg.UserID,
 		arg.Scopes,
 		arg.Expires,
+		arg.Claims,
+		arg.GrantCreated,
 	)
 	return err
 }
 
 const listAccessTokensByUserID = `-- name: ListAccessTokensByUserID :many
-select id, client_id, refresh_token, user_id, scopes, expires, revoked, created, updated
+select id, client_id, refresh_token, user_id, scopes, expires, revoked, created, updated, claims, last_used, tenant_id
 from access_tokens
-where user_id = $1
+where tenant_id = $1
+and user_id = $2
 `
 
-func (q *Queries) ListAccessTokensByUserID(ctx context.Context, userID string) ([]AccessToken, error) {
-	rows, err := q.db.Query(ctx, listAccessTokensByUserID, userID)
+type ListAccessTokensByUserIDParams struct {
+	TenantID string
+	UserID   string
+}
+
+func (q *Queries) ListAccessTokensByUserID(ctx context.Context, arg ListAccessTokensByUserIDParams) ([]AccessToken, error) {
+	rows, err := q.db.Query(ctx, listAccessTokensByUserID, arg.TenantID, arg.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -109,6 +183,9 @@ func (q *Queries) ListAccessTokensByUserID(ctx context.Context, userID string) (
 			&i.Revoked,
 			&i.Created,
 			&i.Updated,
+			&i.Claims,
+			&i.LastUsed,
+			&i.TenantID,
 		); err != nil {
 			return nil, err
 		}
@@ -121,13 +198,19 @@ func (q *Queries) ListAccessTokensByUserID(ctx context.Context, userID string) (
 }
 
 const listRefreshTokensByUserID = `-- name: ListRefreshTokensByUserID :many
-select id, client_id, user_id, scopes, expires, revoked, created, updated
+select id, client_id, user_id, scopes, expires, revoked, created, updated, claims, last_used, grant_created, tenant_id, replaced_by
 from refresh_tokens
-where user_id = $1
+where tenant_id = $1
+and user_id = $2
 `
 
-func (q *Queries) ListRefreshTokensByUserID(ctx context.Context, userID string) ([]RefreshToken, error) {
-	rows, err := q.db.Query(ctx, listRefreshTokensByUserID, userID)
+type ListRefreshTokensByUserIDParams struct {
+	TenantID string
+	UserID   string
+}
+
+func (q *Queries) ListRefreshTokensByUserID(ctx context.Context, arg ListRefreshTokensByUserIDParams) ([]RefreshToken, error) {
+	rows, err := q.db.Query(ctx, listRefreshTokensByUserID, arg.TenantID, arg.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -144,6 +227,11 @@ func (q *Queries) ListRefreshTokensByUserID(ctx context.Context, userID string)
 			&i.Revoked,
 			&i.Created,
 			&i.Updated,
+			&i.Claims,
+			&i.LastUsed,
+			&i.GrantCreated,
+			&i.TenantID,
+			&i.ReplacedBy,
 		); err != nil {
 			return nil, err
 		}
@@ -158,35 +246,268 @@ func (q *Queries) ListRefreshTokensByUserID(ctx context.Context, userID string)
 const revokeAccessToken = `-- name: RevokeAccessToken :exec
 update access_tokens
 set revoked = true
-where id = $1
+where tenant_id = $1
+and id = $2
 `
 
-func (q *Queries) RevokeAccessToken(ctx context.Context, id string) error {
-	_, err := q.db.Exec(ctx, revokeAccessToken, id)
+type RevokeAccessTokenParams struct {
+	TenantID string
+	ID       string
+}
+
+func (q *Queries) RevokeAccessToken(ctx context.Context, arg RevokeAccessTokenParams) error {
+	_, err := q.db.Exec(ctx, revokeAccessToken, arg.TenantID, arg.ID)
 	return err
 }
 
-const revokeRefreshToken = `-- name: RevokeRefreshToken :exec
+const revokeAccessTokensByClientID = `-- name: RevokeAccessTokensByClientID :execrows
+update access_tokens
+set revoked = true
+where tenant_id = $1
+and client_id = $2
+and revoked = false
+`
+
+type RevokeAccessTokensByClientIDParams struct {
+	TenantID string
+	ClientID string
+}
+
+func (q *Queries) RevokeAccessTokensByClientID(ctx context.Context, arg RevokeAccessTokensByClientIDParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAccessTokensByClientID, arg.TenantID, arg.ClientID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeAccessTokensByUserAndClient = `-- name: RevokeAccessTokensByUserAndClient :execrows
+update access_tokens
+set revoked = true
+where tenant_id = $1
+and user_id = $2
+and client_id = $3
+and revoked = false
+`
+
+type RevokeAccessTokensByUserAndClientParams struct {
+	TenantID string
+	UserID   string
+	ClientID string
+}
+
+func (q *Queries) RevokeAccessTokensByUserAndClient(ctx context.Context, arg RevokeAccessTokensByUserAndClientParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAccessTokensByUserAndClient, arg.TenantID, arg.UserID, arg.ClientID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeAccessTokensByUserID = `-- name: RevokeAccessTokensByUserID :execrows
+update access_tokens
+set revoked = true
+where tenant_id = $1
+and user_id = $2
+and revoked = false
+`
+
+type RevokeAccessTokensByUserIDParams struct {
+	TenantID string
+	UserID   string
+}
+
+func (q *Queries) RevokeAccessTokensByUserID(ctx context.Context, arg RevokeAccessTokensByUserIDParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAccessTokensByUserID, arg.TenantID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeAccessTokensCreatedBefore = `-- name: RevokeAccessTokensCreatedBefore :execrows
+update access_tokens
+set revoked = true
+where tenant_id = $1
+and created < $2
+and revoked = false
+`
+
+type RevokeAccessTokensCreatedBeforeParams struct {
+	TenantID string
+	Before   time.Time
+}
+
+func (q *Queries) RevokeAccessTokensCreatedBefore(ctx context.Context, arg RevokeAccessTokensCreatedBeforeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeAccessTokensCreatedBefore, arg.TenantID, arg.Before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeRefreshTokensByClientID = `-- name: RevokeRefreshTokensByClientID :execrows
 update refresh_tokens
 set revoked = true
-where id = $1
+where tenant_id = $1
+and client_id = $2
+and revoked = false
 `
 
-func (q *Queries) RevokeRefreshToken(ctx context.Context, id string) error {
-	_, err := q.db.Exec(ctx, revokeRefreshToken, id)
-	return err
+type RevokeRefreshTokensByClientIDParams struct {
+	TenantID string
+	ClientID string
+}
+
+func (q *Queries) RevokeRefreshTokensByClientID(ctx context.Context, arg RevokeRefreshTokensByClientIDParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeRefreshTokensByClientID, arg.TenantID, arg.ClientID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeRefreshTokensByUserAndClient = `-- name: RevokeRefreshTokensByUserAndClient :execrows
+update refresh_tokens
+set revoked = true
+where tenant_id = $1
+and user_id = $2
+and client_id = $3
+and revoked = false
+`
+
+type RevokeRefreshTokensByUserAndClientParams struct {
+	TenantID string
+	UserID   string
+	ClientID string
+}
+
+func (q *Queries) RevokeRefreshTokensByUserAndClient(ctx context.Context, arg RevokeRefreshTokensByUserAndClientParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeRefreshTokensByUserAndClient, arg.TenantID, arg.UserID, arg.ClientID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeRefreshTokensByUserID = `-- name: RevokeRefreshTokensByUserID :execrows
+update refresh_tokens
+set revoked = true
+where tenant_id = $1
+and user_id = $2
+and revoked = false
+`
+
+type RevokeRefreshTokensByUserIDParams struct {
+	TenantID string
+	UserID   string
+}
+
+func (q *Queries) RevokeRefreshTokensByUserID(ctx context.Context, arg RevokeRefreshTokensByUserIDParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeRefreshTokensByUserID, arg.TenantID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const revokeRefreshTokensCreatedBefore = `-- name: RevokeRefreshTokensCreatedBefore :execrows
+update refresh_tokens
+set revoked = true
+where tenant_id = $1
+and created < $2
+and revoked = false
+`
+
+type RevokeRefreshTokensCreatedBeforeParams struct {
+	TenantID string
+	Before   time.Time
+}
+
+func (q *Queries) RevokeRefreshTokensCreatedBefore(ctx context.Context, arg RevokeRefreshTokensCreatedBeforeParams) (int64, error) {
+	result, err := q.db.Exec(ctx, revokeRefreshTokensCreatedBefore, arg.TenantID, arg.Before)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const rotateRefreshToken = `-- name: RotateRefreshToken :execrows
+update refresh_tokens
+set revoked = true
+    , replaced_by = $1
+    , last_used = now()
+    , updated = now()
+where tenant_id = $2
+and id = $3
+and revoked = false
+`
+
+type RotateRefreshTokenParams struct {
+	ReplacedBy *string
+	TenantID   string
+	ID         string
+}
+
+// Revokes a refresh token that was used, recording the one that replaced it for reuse detection
+func (q *Queries) RotateRefreshToken(ctx context.Context, arg RotateRefreshTokenParams) (int64, error) {
+	result, err := q.db.Exec(ctx, rotateRefreshToken, arg.ReplacedBy, arg.TenantID, arg.ID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected(), nil
+}
+
+const selectRefreshToken = `-- name: SelectRefreshToken :one
+select id, client_id, user_id, scopes, expires, revoked, created, updated, claims, last_used, grant_created, tenant_id, replaced_by
+from refresh_tokens
+where tenant_id = $1
+and id = $2
+`
+
+type SelectRefreshTokenParams struct {
+	TenantID string
+	ID       string
+}
+
+// Expired and revoked too, for reuse detection
+func (q *Queries) SelectRefreshToken(ctx context.Context, arg SelectRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, selectRefreshToken, arg.TenantID, arg.ID)
+	var i RefreshToken
+	err := row.Scan(
+		&i.ID,
+		&i.ClientID,
+		&i.UserID,
+		&i.Scopes,
+		&i.Expires,
+		&i.Revoked,
+		&i.Created,
+		&i.Updated,
+		&i.Claims,
+		&i.LastUsed,
+		&i.GrantCreated,
+		&i.TenantID,
+		&i.ReplacedBy,
+	)
+	return i, err
 }
 
 const selectValidAccessToken = `-- name: SelectValidAccessToken :one
-select id, client_id, refresh_token, user_id, scopes, expires, revoked, created, updated
+select id, client_id, refresh_token, user_id, scopes, expires, revoked, created, updated, claims, last_used, tenant_id
 from access_tokens
-where id = $1
+where tenant_id = $1
+and id = $2
 and expires > now()
 and revoked = false
 `
 
-func (q *Queries) SelectValidAccessToken(ctx context.Context, id string) (AccessToken, error) {
-	row := q.db.QueryRow(ctx, selectValidAccessToken, id)
+type SelectValidAccessTokenParams struct {
+	TenantID string
+	ID       string
+}
+
+func (q *Queries) SelectValidAccessToken(ctx context.Context, arg SelectValidAccessTokenParams) (AccessToken, error) {
+	row := q.db.QueryRow(ctx, selectValidAccessToken, arg.TenantID, arg.ID)
 	var i AccessToken
 	err := row.Scan(
 		&i.ID,
@@ -198,20 +519,76 @@ func (q *Queries) SelectValidAccessToken(ctx context.Context, id string) (Access
 		&i.Revoked,
 		&i.Created,
 		&i.Updated,
+		&i.Claims,
+		&i.LastUsed,
+		&i.TenantID,
 	)
 	return i, err
 }
 
+const selectValidAccessTokens = `-- name: SelectValidAccessTokens :many
+select id, client_id, refresh_token, user_id, scopes, expires, revoked, created, updated, claims, last_used, tenant_id
+from access_tokens
+where tenant_id = $1
+and id = any($2::text[])
+and expires > now()
+and revoked = false
+`
+
+type SelectValidAccessTokensParams struct {
+	TenantID string
+	Ids      []string
+}
+
+func (q *Queries) SelectValidAccessTokens(ctx context.Context, arg SelectValidAccessTokensParams) ([]AccessToken, error) {
+	rows, err := q.db.Query(ctx, selectValidAccessTokens, arg.TenantID, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []AccessToken
+	for rows.Next() {
+		var i AccessToken
+		if err := rows.Scan(
+			&i.ID,
+			&i.ClientID,
+			&i.RefreshToken,
+			&i.UserID,
+			&i.Scopes,
+			&i.Expires,
+			&i.Revoked,
+			&i.Created,
+			&i.Updated,
+			&i.Claims,
+			&i.LastUsed,
+			&i.TenantID,
+		); err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
 const selectValidRefreshToken = `-- name: SelectValidRefreshToken :one
-select id, client_id, user_id, scopes, expires, revoked, created, updated
+select id, client_id, user_id, scopes, expires, revoked, created, updated, claims, last_used, grant_created, tenant_id, replaced_by
 from refresh_tokens
-where id = $1
+where tenant_id = $1
+and id = $2
 and expires > now()
+and revoked = false
 `
 
-// Might be expired, if so need to regenerate and mark as revoked
-func (q *Queries) SelectValidRefreshToken(ctx context.Context, id string) (RefreshToken, error) {
-	row := q.db.QueryRow(ctx, selectValidRefreshToken, id)
+type SelectValidRefreshTokenParams struct {
+	TenantID string
+	ID       string
+}
+
+func (q *Queries) SelectValidRefreshToken(ctx context.Context, arg SelectValidRefreshTokenParams) (RefreshToken, error) {
+	row := q.db.QueryRow(ctx, selectValidRefreshToken, arg.TenantID, arg.ID)
 	var i RefreshToken
 	err := row.Scan(
 		&i.ID,
@@ -222,6 +599,47 @@ func (q *Queries) SelectValidRefreshToken(ctx context.Context, id string) (Refre
 		&i.Revoked,
 		&i.Created,
 		&i.Updated,
+		&i.Claims,
+		&i.LastUsed,
+		&i.GrantCreated,
+		&i.TenantID,
+		&i.ReplacedBy,
 	)
 	return i, err
 }
+
+const touchAccessTokens = `-- name: TouchAccessTokens :many
+update access_tokens
+set last_used = now()
+where tenant_id = $1
+and id = any($2::text[])
+and (last_used is null or last_used < now() - interval '1 minute')
+returning id
+`
+
+type TouchAccessTokensParams struct {
+	TenantID string
+	Ids      []string
+}
+
+// At most once a minute per token, so introspecting on every request doesn't write on every request. Returns the IDs
+// of the tokens it touched.
+func (q *Queries) TouchAccessTokens(ctx context.Context, arg TouchAccessTokensParams) ([]string, error) {
+	rows, err := q.db.Query(ctx, touchAccessTokens, arg.TenantID, arg.Ids)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
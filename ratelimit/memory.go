@@ -0,0 +1,86 @@
+package ratelimit
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// Memory keeps the buckets in this process, so each replica limits on its own
+type Memory struct {
+	mu        sync.Mutex
+	buckets   map[string]*memoryBucket
+	lastSweep time.Time
+}
+
+type memoryBucket struct {
+	fullAt      time.Time
+	lockedUntil *time.Time
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		buckets:   map[string]*memoryBucket{},
+		lastSweep: time.Now(),
+	}
+}
+
+func (m *Memory) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	m.sweep(now)
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{fullAt: now}
+		m.buckets[key] = b
+	}
+	if d := wait(now, b.fullAt, b.lockedUntil, limit); d > 0 {
+		return d, nil
+	}
+	if b.fullAt.Before(now) {
+		b.fullAt = now
+	}
+	b.fullAt = b.fullAt.Add(limit.Interval)
+	return 0, nil
+}
+
+func (m *Memory) Lock(ctx context.Context, key string, d time.Duration) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	b, ok := m.buckets[key]
+	if !ok {
+		b = &memoryBucket{fullAt: now}
+		m.buckets[key] = b
+	}
+	lockedUntil := now.Add(d)
+	b.lockedUntil = &lockedUntil
+	return nil
+}
+
+func (m *Memory) Locked(ctx context.Context, key string) (time.Duration, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	b, ok := m.buckets[key]
+	if !ok || b.lockedUntil == nil {
+		return 0, nil
+	}
+	if d := time.Until(*b.lockedUntil); d > 0 {
+		return d, nil
+	}
+	return 0, nil
+}
+
+// sweep drops full, unlocked buckets once a minute, they're the same as no bucket
+func (m *Memory) sweep(now time.Time) {
+	if now.Sub(m.lastSweep) < time.Minute {
+		return
+	}
+	m.lastSweep = now
+	for key, b := range m.buckets {
+		if b.fullAt.Before(now) && (b.lockedUntil == nil || b.lockedUntil.Before(now)) {
+			delete(m.buckets, key)
+		}
+	}
+}
@@ -0,0 +1,87 @@
+package ratelimit
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres keeps the buckets in the rate_limits table so every replica shares them. Taking a token is one upsert,
+// the janitor deletes idle buckets.
+type Postgres struct {
+	pool *pgxpool.Pool
+}
+
+func NewPostgres(pool *pgxpool.Pool) *Postgres {
+	return &Postgres{pool: pool}
+}
+
+func (p *Postgres) Take(ctx context.Context, key string, limit Limit) (time.Duration, error) {
+	var d time.Duration
+	err := query.ReliableExec(ctx, p.pool, time.Second*2, func(ctx context.Context, q *query.Queries) (err error) {
+		d = 0
+		_, err = q.TakeRateLimitToken(ctx, query.TakeRateLimitTokenParams{
+			Key:        key,
+			IntervalUs: limit.Interval.Microseconds(),
+			BurstUs:    (time.Duration(limit.Burst) * limit.Interval).Microseconds(),
+		})
+		if err == nil {
+			return nil
+		}
+		if !errors.Is(err, pgx.ErrNoRows) {
+			return fmt.Errorf("error in TakeRateLimitToken: %w", err)
+		}
+		row, err := q.SelectRateLimit(ctx, key)
+		if errors.Is(err, pgx.ErrNoRows) {
+			// The janitor deleted it in between, so it's full
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error in SelectRateLimit: %w", err)
+		}
+		d = wait(row.Now, row.FullAt, row.LockedUntil, limit)
+		if d == 0 {
+			// Refilled in between, but we didn't get the token, so try again soon
+			d = time.Millisecond
+		}
+		return nil
+	})
+	return d, err
+}
+
+func (p *Postgres) Lock(ctx context.Context, key string, d time.Duration) error {
+	return query.ReliableExec(ctx, p.pool, time.Second*2, func(ctx context.Context, q *query.Queries) error {
+		err := q.LockRateLimitKey(ctx, query.LockRateLimitKeyParams{
+			Key:       key,
+			LockoutUs: d.Microseconds(),
+		})
+		if err != nil {
+			return fmt.Errorf("error in LockRateLimitKey: %w", err)
+		}
+		return nil
+	})
+}
+
+func (p *Postgres) Locked(ctx context.Context, key string) (time.Duration, error) {
+	var d time.Duration
+	err := query.ReliableExec(ctx, p.pool, time.Second*2, func(ctx context.Context, q *query.Queries) error {
+		d = 0
+		row, err := q.SelectRateLimit(ctx, key)
+		if errors.Is(err, pgx.ErrNoRows) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("error in SelectRateLimit: %w", err)
+		}
+		if row.LockedUntil != nil && row.LockedUntil.After(row.Now) {
+			d = row.LockedUntil.Sub(row.Now)
+		}
+		return nil
+	})
+	return d, err
+}
@@ -0,0 +1,188 @@
+// Package ratelimit throttles requests with token buckets per IP and per client, and locks IPs out after repeated
+// failures. The buckets live in Counters, Memory for a single replica or Postgres to share them between replicas.
+package ratelimit
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/samber/lo"
+)
+
+var (
+	// What AllowIP, AllowClient, and Fail say was limited
+	KindIP     = "ip"
+	KindClient = "client"
+	// An IP locked out of one client
+	KindIPClient = "ip_client"
+)
+
+// Limit is a token bucket holding Burst tokens, one token comes back every Interval
+type Limit struct {
+	Interval time.Duration
+	Burst    int64
+}
+
+// PerMinute is a bucket refilled at perMinute tokens a minute, it's disabled if either is zero
+func PerMinute(perMinute, burst int64) Limit {
+	var l Limit
+	if perMinute > 0 {
+		l.Interval = time.Minute / time.Duration(perMinute)
+	}
+	if burst > 0 {
+		l.Burst = burst
+	}
+	return l
+}
+
+func (l Limit) Enabled() bool {
+	return l.Interval > 0 && l.Burst > 0
+}
+
+// Counters hold the buckets, shared by everything using the same key
+type Counters interface {
+	// Take takes a token from the key's bucket. If it's empty or the key is locked out nothing is taken, and it
+	// returns how long until a token can be taken.
+	Take(ctx context.Context, key string, limit Limit) (time.Duration, error)
+	// Lock refuses every Take for the key for d
+	Lock(ctx context.Context, key string, d time.Duration) error
+	// Locked returns how long the key is locked out for, 0 if it isn't
+	Locked(ctx context.Context, key string) (time.Duration, error)
+}
+
+// Lockout locks an IP out, or an IP out of one client, once it fails more than its max within Window. Clients don't
+// authenticate to /oauth2/authorize, so a whole client is never locked out, anyone could lock out all its users.
+type Lockout struct {
+	// Zero disables
+	IPMaxFailures       int64
+	IPClientMaxFailures int64
+	Window              time.Duration
+	Duration            time.Duration
+}
+
+type Limiter struct {
+	Counters Counters
+	// Requests per IP, a zero Limit disables it
+	IP Limit
+	// Requests per client, unless the client has its own
+	Client  Limit
+	Lockout Lockout
+}
+
+// AllowIP takes a token for the IP. If it's empty or the IP is locked out it returns how long until the request
+// would be allowed.
+func (l *Limiter) AllowIP(ctx context.Context, ip string) (time.Duration, error) {
+	if !l.IP.Enabled() {
+		return 0, nil
+	}
+	wait, err := l.Counters.Take(ctx, ipKey(ip), l.IP)
+	if err != nil {
+		return 0, fmt.Errorf("error taking ip token: %w", err)
+	}
+	return wait, nil
+}
+
+// AllowClient is for after AllowIP, once the client is known to exist. It checks the IP isn't locked out of the
+// client, then takes a token for the client. client is the client's own limit, its zero fields are taken from
+// l.Client. If either refuses it returns how long until the request would be allowed, and which it was.
+func (l *Limiter) AllowClient(ctx context.Context, ip, clientID string, client Limit) (time.Duration, string, error) {
+	if l.ipClientLockout() {
+		wait, err := l.Counters.Locked(ctx, ipClientKey(ip, clientID))
+		if err != nil {
+			return 0, "", fmt.Errorf("error checking ip_client lockout: %w", err)
+		}
+		if wait > 0 {
+			return wait, KindIPClient, nil
+		}
+	}
+
+	if client.Interval == 0 {
+		client.Interval = l.Client.Interval
+	}
+	if client.Burst == 0 {
+		client.Burst = l.Client.Burst
+	}
+	if !client.Enabled() {
+		return 0, "", nil
+	}
+	wait, err := l.Counters.Take(ctx, KindClient+":"+clientID, client)
+	if err != nil {
+		return 0, "", fmt.Errorf("error taking client token: %w", err)
+	}
+	return wait, lo.Ternary(wait > 0, KindClient, ""), nil
+}
+
+// Fail records a failed request for the IP, and for the IP and client if clientID isn't empty, locking out the ones
+// that have failed too often. Only pass a clientID that exists, so made up ones can't fill the counters. It returns
+// the kinds it locked out.
+func (l *Limiter) Fail(ctx context.Context, ip, clientID string) ([]string, error) {
+	var locked []string
+	if l.Lockout.IPMaxFailures > 0 {
+		ok, err := l.fail(ctx, ipKey(ip), l.Lockout.IPMaxFailures)
+		if err != nil {
+			return locked, fmt.Errorf("error counting ip failure: %w", err)
+		}
+		if ok {
+			locked = append(locked, KindIP)
+		}
+	}
+	if clientID != "" && l.ipClientLockout() {
+		ok, err := l.fail(ctx, ipClientKey(ip, clientID), l.Lockout.IPClientMaxFailures)
+		if err != nil {
+			return locked, fmt.Errorf("error counting ip_client failure: %w", err)
+		}
+		if ok {
+			locked = append(locked, KindIPClient)
+		}
+	}
+	return locked, nil
+}
+
+// fail takes a failure token for key, locking it out if there are none left. Returns whether it locked it.
+func (l *Limiter) fail(ctx context.Context, key string, maxFailures int64) (bool, error) {
+	if l.Lockout.Window <= 0 || l.Lockout.Duration <= 0 {
+		return false, nil
+	}
+	failures := Limit{Interval: l.Lockout.Window / time.Duration(maxFailures), Burst: maxFailures}
+	wait, err := l.Counters.Take(ctx, "failures:"+key, failures)
+	if err != nil {
+		return false, err
+	}
+	if wait == 0 {
+		return false, nil
+	}
+	err = l.Counters.Lock(ctx, key, l.Lockout.Duration)
+	if err != nil {
+		return false, fmt.Errorf("error locking: %w", err)
+	}
+	return true, nil
+}
+
+func (l *Limiter) ipClientLockout() bool {
+	return l.Lockout.IPClientMaxFailures > 0 && l.Lockout.Window > 0 && l.Lockout.Duration > 0
+}
+
+func ipKey(ip string) string {
+	return KindIP + ":" + ip
+}
+
+// IPs don't have slashes, so this can't collide
+func ipClientKey(ip, clientID string) string {
+	return KindIPClient + ":" + ip + "/" + clientID
+}
+
+// wait is how long until a token can be taken from a bucket that's full at fullAt, 0 if one can be taken now
+func wait(now, fullAt time.Time, lockedUntil *time.Time, limit Limit) time.Duration {
+	if fullAt.Before(now) {
+		fullAt = now
+	}
+	d := fullAt.Add(limit.Interval).Sub(now) - time.Duration(limit.Burst)*limit.Interval
+	if lockedUntil != nil && lockedUntil.Sub(now) > d {
+		d = lockedUntil.Sub(now)
+	}
+	if d < 0 {
+		return 0
+	}
+	return d
+}
@@ -0,0 +1,97 @@
+package ratelimit
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+)
+
+func newLimiter(lockout Lockout) *Limiter {
+	lockout.Window = time.Minute
+	lockout.Duration = time.Hour
+	return &Limiter{
+		Counters: NewMemory(),
+		IP:       PerMinute(60, 100),
+		Client:   PerMinute(60, 100),
+		Lockout:  lockout,
+	}
+}
+
+func TestIPLockout(t *testing.T) {
+	l := newLimiter(Lockout{IPMaxFailures: 2})
+	ctx := context.Background()
+
+	for i := 0; i < 2; i++ {
+		locked, err := l.Fail(ctx, "1.1.1.1", "c1")
+		require.NoError(t, err)
+		require.Empty(t, locked)
+	}
+	locked, err := l.Fail(ctx, "1.1.1.1", "c1")
+	require.NoError(t, err)
+	require.Equal(t, []string{KindIP}, locked)
+
+	wait, err := l.AllowIP(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	require.Greater(t, wait, time.Minute)
+	wait, err = l.AllowIP(ctx, "2.2.2.2")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	// The client isn't locked out for other IPs
+	wait, kind, err := l.AllowClient(ctx, "2.2.2.2", "c1", Limit{})
+	require.NoError(t, err)
+	require.Zero(t, wait, kind)
+}
+
+func TestIPClientLockout(t *testing.T) {
+	l := newLimiter(Lockout{IPClientMaxFailures: 1})
+	ctx := context.Background()
+
+	_, err := l.Fail(ctx, "1.1.1.1", "c1")
+	require.NoError(t, err)
+	locked, err := l.Fail(ctx, "1.1.1.1", "c1")
+	require.NoError(t, err)
+	require.Equal(t, []string{KindIPClient}, locked)
+
+	wait, kind, err := l.AllowClient(ctx, "1.1.1.1", "c1", Limit{})
+	require.NoError(t, err)
+	require.Greater(t, wait, time.Minute)
+	require.Equal(t, KindIPClient, kind)
+
+	// Only that IP for that client
+	wait, err = l.AllowIP(ctx, "1.1.1.1")
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	wait, _, err = l.AllowClient(ctx, "1.1.1.1", "c2", Limit{})
+	require.NoError(t, err)
+	require.Zero(t, wait)
+	wait, _, err = l.AllowClient(ctx, "2.2.2.2", "c1", Limit{})
+	require.NoError(t, err)
+	require.Zero(t, wait)
+
+	// Made up clients aren't passed, so only the IP counts
+	l = newLimiter(Lockout{IPClientMaxFailures: 1})
+	for i := 0; i < 3; i++ {
+		locked, err = l.Fail(ctx, "1.1.1.1", "")
+		require.NoError(t, err)
+		require.Empty(t, locked)
+	}
+}
+
+func TestClientLimit(t *testing.T) {
+	l := newLimiter(Lockout{})
+	ctx := context.Background()
+
+	// The client's own burst, with the default interval
+	for i := 0; i < 2; i++ {
+		wait, _, err := l.AllowClient(ctx, "1.1.1.1", "c1", Limit{Burst: 2})
+		require.NoError(t, err)
+		require.Zero(t, wait)
+	}
+	wait, kind, err := l.AllowClient(ctx, "2.2.2.2", "c1", Limit{Burst: 2})
+	require.NoError(t, err)
+	require.Greater(t, wait, time.Duration(0))
+	require.Equal(t, KindClient, kind)
+}
@@ -0,0 +1,170 @@
+package revocation
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/UltimateTournament/backoff/v4"
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// The Postgres channel notices are sent on
+	NotifyChannel = "continuewith_revocations"
+
+	logger = gologger.NewLogger()
+)
+
+// Notice says which access tokens were revoked, the ones matching every field that's set. It's sent to every replica
+// so they can evict them from their introspection caches. An empty Notice matches every token, it's sent when
+// notices may have been missed. An empty TenantID matches every tenant.
+type Notice struct {
+	TenantID string     `json:",omitempty"`
+	UserID   *string    `json:",omitempty"`
+	ClientID *string    `json:",omitempty"`
+	Before   *time.Time `json:",omitempty"`
+}
+
+func (f Filter) Notice() Notice {
+	return Notice(f)
+}
+
+// Matches is whether the token was revoked by the notice
+func (n Notice) Matches(accessToken query.AccessToken) bool {
+	if n.TenantID != "" && n.TenantID != accessToken.TenantID {
+		return false
+	}
+	if n.UserID != nil && *n.UserID != accessToken.UserID {
+		return false
+	}
+	if n.ClientID != nil && *n.ClientID != accessToken.ClientID {
+		return false
+	}
+	if n.Before != nil && !accessToken.Created.Before(*n.Before) {
+		return false
+	}
+	return true
+}
+
+// Notifier sends notices with Postgres NOTIFY. A nil Notifier does nothing.
+type Notifier struct {
+	pool *pgxpool.Pool
+}
+
+// NewNotifier returns nil unless notices can reach the other replicas, which needs a Postgres pool. CRDB doesn't have
+// LISTEN/NOTIFY, and the other stores don't have a pool.
+func NewNotifier(pool *pgxpool.Pool, isPostgres bool) *Notifier {
+	if pool == nil || !isPostgres {
+		return nil
+	}
+	return &Notifier{pool: pool}
+}
+
+// Notify sends the notice to every replica listening with a Listener, including this one. Call it after the revocation
+// commits. The tokens are already revoked, so errors are only logged.
+func (n *Notifier) Notify(ctx context.Context, notice Notice) {
+	if n == nil {
+		return
+	}
+	payload, err := json.Marshal(notice)
+	if err != nil {
+		logger.Error().Err(err).Msg("error marshalling revocation notice")
+		return
+	}
+	_, err = n.pool.Exec(ctx, "select pg_notify($1, $2)", NotifyChannel, string(payload))
+	if err != nil {
+		logger.Error().Err(err).Interface("notice", notice).Msg("error sending revocation notice")
+	}
+}
+
+type Listener struct {
+	pool     *pgxpool.Pool
+	onNotice func(Notice)
+	cancel   context.CancelFunc
+	done     chan struct{}
+}
+
+// StartListener calls onNotice with every notice sent by Notify until Shutdown is called. It holds a connection from
+// the pool for LISTEN, reconnecting if it's lost, and sends onNotice an empty Notice each time it starts listening
+// because notices could have been missed while it wasn't. Only start it where NewNotifier isn't nil.
+func StartListener(pool *pgxpool.Pool, onNotice func(Notice)) *Listener {
+	ctx, cancel := context.WithCancel(context.Background())
+	l := &Listener{
+		pool:     pool,
+		onNotice: onNotice,
+		cancel:   cancel,
+		done:     make(chan struct{}),
+	}
+	go l.run(ctx)
+	return l
+}
+
+func (l *Listener) Shutdown(ctx context.Context) error {
+	l.cancel()
+	select {
+	case <-l.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (l *Listener) run(ctx context.Context) {
+	defer close(l.done)
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second
+	b.MaxInterval = time.Second * 30
+	b.MaxElapsedTime = 0
+	for {
+		started := time.Now()
+		err := l.listen(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if time.Since(started) > b.MaxInterval {
+			b.Reset()
+		}
+		wait := b.NextBackOff()
+		logger.Error().Err(err).Dur("retryIn", wait).Msg("lost revocation listener connection")
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(wait):
+		}
+	}
+}
+
+// listen blocks until the connection fails or ctx is cancelled
+func (l *Listener) listen(ctx context.Context) error {
+	pooled, err := l.pool.Acquire(ctx)
+	if err != nil {
+		return fmt.Errorf("error in Pool.Acquire: %w", err)
+	}
+	// It would still be listening, so it never goes back to the pool
+	conn := pooled.Hijack()
+	defer conn.Close(context.Background())
+
+	_, err = conn.Exec(ctx, "listen "+NotifyChannel)
+	if err != nil {
+		return fmt.Errorf("error in listen: %w", err)
+	}
+	l.onNotice(Notice{})
+
+	for {
+		notification, err := conn.WaitForNotification(ctx)
+		if err != nil {
+			return fmt.Errorf("error in WaitForNotification: %w", err)
+		}
+		var notice Notice
+		if err := json.Unmarshal([]byte(notification.Payload), &notice); err != nil {
+			// Evicting everything is always safe
+			logger.Error().Err(err).Str("payload", notification.Payload).Msg("error parsing revocation notice")
+			notice = Notice{}
+		}
+		l.onNotice(notice)
+	}
+}
@@ -0,0 +1,93 @@
+package revocation
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/danthegoodman1/GoAPITemplate/webhooks"
+)
+
+var ErrInvalidFilter = utils.PermError("exactly one of UserID, ClientID, or Before must be set")
+
+// Filter selects the tenant's tokens to revoke, exactly one of the other fields must be set
+type Filter struct {
+	TenantID string
+	UserID   *string `json:",omitempty"`
+	ClientID *string `json:",omitempty"`
+	// Tokens created before this time
+	Before *time.Time `json:",omitempty"`
+}
+
+type Result struct {
+	AccessTokens  int64
+	RefreshTokens int64
+}
+
+type revokeFunc func(ctx context.Context, tx store.Tx) (int64, error)
+
+func (f Filter) revokeFuncs() (revokeAccess, revokeRefresh revokeFunc, err error) {
+	set := 0
+	for _, isSet := range []bool{f.UserID != nil, f.ClientID != nil, f.Before != nil} {
+		if isSet {
+			set++
+		}
+	}
+	if set != 1 {
+		return nil, nil, ErrInvalidFilter
+	}
+
+	switch {
+	case f.UserID != nil:
+		return func(ctx context.Context, tx store.Tx) (int64, error) {
+				return tx.RevokeAccessTokensByUserID(ctx, query.RevokeAccessTokensByUserIDParams{TenantID: f.TenantID, UserID: *f.UserID})
+			}, func(ctx context.Context, tx store.Tx) (int64, error) {
+				return tx.RevokeRefreshTokensByUserID(ctx, query.RevokeRefreshTokensByUserIDParams{TenantID: f.TenantID, UserID: *f.UserID})
+			}, nil
+	case f.ClientID != nil:
+		return func(ctx context.Context, tx store.Tx) (int64, error) {
+				return tx.RevokeAccessTokensByClientID(ctx, query.RevokeAccessTokensByClientIDParams{TenantID: f.TenantID, ClientID: *f.ClientID})
+			}, func(ctx context.Context, tx store.Tx) (int64, error) {
+				return tx.RevokeRefreshTokensByClientID(ctx, query.RevokeRefreshTokensByClientIDParams{TenantID: f.TenantID, ClientID: *f.ClientID})
+			}, nil
+	default:
+		return func(ctx context.Context, tx store.Tx) (int64, error) {
+				return tx.RevokeAccessTokensCreatedBefore(ctx, query.RevokeAccessTokensCreatedBeforeParams{TenantID: f.TenantID, Before: *f.Before})
+			}, func(ctx context.Context, tx store.Tx) (int64, error) {
+				return tx.RevokeRefreshTokensCreatedBefore(ctx, query.RevokeRefreshTokensCreatedBeforeParams{TenantID: f.TenantID, Before: *f.Before})
+			}, nil
+	}
+}
+
+// Revoke revokes every token matching the filter and enqueues the authorization.revoked webhook.
+// Run it in a transaction so a partial revoke is never visible.
+func Revoke(ctx context.Context, tx store.Tx, filter Filter) (res Result, err error) {
+	revokeAccess, revokeRefresh, err := filter.revokeFuncs()
+	if err != nil {
+		return res, err
+	}
+
+	res.AccessTokens, err = revokeAccess(ctx, tx)
+	if err != nil {
+		return res, fmt.Errorf("error revoking access tokens: %w", err)
+	}
+	res.RefreshTokens, err = revokeRefresh(ctx, tx)
+	if err != nil {
+		return res, fmt.Errorf("error revoking refresh tokens: %w", err)
+	}
+
+	err = tx.EnqueueWebhook(ctx, filter.TenantID, webhooks.EventAuthorizationRevoked, webhooks.AuthorizationRevokedData{
+		UserID:        filter.UserID,
+		ClientID:      filter.ClientID,
+		Before:        filter.Before,
+		AccessTokens:  res.AccessTokens,
+		RefreshTokens: res.RefreshTokens,
+	})
+	if err != nil {
+		return res, fmt.Errorf("error in EnqueueWebhook: %w", err)
+	}
+	return res, nil
+}
@@ -0,0 +1,529 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/query"
+)
+
+// Memory keeps everything in maps, for tests and trying things out. Nothing survives a restart,
+// and the janitor doesn't run against it, so expired rows are only dropped when they're revoked or deleted.
+// It only holds DefaultTenantID, so tenant params are ignored.
+type Memory struct {
+	mu   sync.Mutex
+	data memoryData
+}
+
+type consentKey struct {
+	UserID   string
+	ClientID string
+}
+
+type memoryData struct {
+	clients            map[string]query.Client
+	scopes             map[string]query.Scope
+	authorizationCodes map[string]query.AuthorizationCode
+	accessTokens       map[string]query.AccessToken
+	refreshTokens      map[string]query.RefreshToken
+	consents           map[consentKey]query.Consent
+}
+
+// memoryTx is only used while Memory.mu is held
+type memoryTx struct {
+	data *memoryData
+	// Undoes each write in reverse to roll back
+	undo []func()
+}
+
+func NewMemory() *Memory {
+	return &Memory{
+		data: memoryData{
+			clients:            map[string]query.Client{},
+			scopes:             map[string]query.Scope{},
+			authorizationCodes: map[string]query.AuthorizationCode{},
+			accessTokens:       map[string]query.AccessToken{},
+			refreshTokens:      map[string]query.RefreshToken{},
+			consents:           map[consentKey]query.Consent{},
+		},
+	}
+}
+
+// Exec is the same as ExecInTx, there's no cost to a transaction here
+func (m *Memory) Exec(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx Tx) error) error {
+	return m.ExecInTx(ctx, tryTimeout, f)
+}
+
+// ExecInTx holds a lock for the whole of f so it's serializable, and rolls back if f errors
+func (m *Memory) ExecInTx(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, tryTimeout)
+	defer cancel()
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	tx := &memoryTx{data: &m.data}
+	err := f(ctx, tx)
+	if err != nil {
+		for i := len(tx.undo) - 1; i >= 0; i-- {
+			tx.undo[i]()
+		}
+	}
+	return err
+}
+
+// setRow writes a row, keeping what was there for a rollback. Rows are replaced rather than modified in place,
+// so the previous value is all the undo needs.
+func setRow[K comparable, V any](t *memoryTx, m map[K]V, k K, v V) {
+	t.undo = append(t.undo, undoRow(m, k))
+	m[k] = v
+}
+
+func deleteRow[K comparable, V any](t *memoryTx, m map[K]V, k K) {
+	t.undo = append(t.undo, undoRow(m, k))
+	delete(m, k)
+}
+
+func undoRow[K comparable, V any](m map[K]V, k K) func() {
+	prev, ok := m[k]
+	return func() {
+		if ok {
+			m[k] = prev
+		} else {
+			delete(m, k)
+		}
+	}
+}
+
+// cloneSlice keeps callers from modifying stored rows through a shared backing array
+func cloneSlice[T any](s []T) []T {
+	if s == nil {
+		return nil
+	}
+	return append([]T{}, s...)
+}
+
+func (t *memoryTx) checkClient(id string) error {
+	if _, ok := t.data.clients[id]; !ok {
+		return fmt.Errorf("client %s does not exist", id)
+	}
+	return nil
+}
+
+func (t *memoryTx) SelectClient(ctx context.Context, arg query.SelectClientParams) (query.Client, error) {
+	client, ok := t.data.clients[arg.ID]
+	if !ok {
+		return query.Client{}, ErrNotFound
+	}
+	client.RedirectUris = cloneSlice(client.RedirectUris)
+	return client, nil
+}
+
+func (t *memoryTx) InsertClient(ctx context.Context, arg query.InsertClientParams) (query.Client, error) {
+	if _, ok := t.data.clients[arg.ID]; ok {
+		return query.Client{}, fmt.Errorf("client %s already exists", arg.ID)
+	}
+	now := time.Now()
+	client := query.Client{
+		TenantID:           arg.TenantID,
+		ID:                 arg.ID,
+		Secret:             arg.Secret,
+		Name:               arg.Name,
+		Created:            now,
+		Updated:            now,
+		RefreshTokenPolicy: RefreshTokenPolicyAlways,
+		RedirectUris:       []string{},
+	}
+	setRow(t, t.data.clients, arg.ID, client)
+	return client, nil
+}
+
+func (t *memoryTx) UpdateClientSecret(ctx context.Context, arg query.UpdateClientSecretParams) (query.Client, error) {
+	client, ok := t.data.clients[arg.ID]
+	if !ok {
+		return query.Client{}, ErrNotFound
+	}
+	client.Secret = arg.Secret
+	client.Updated = time.Now()
+	setRow(t, t.data.clients, arg.ID, client)
+	return client, nil
+}
+
+func (t *memoryTx) UpdateClientRateLimit(ctx context.Context, arg query.UpdateClientRateLimitParams) (query.Client, error) {
+	client, ok := t.data.clients[arg.ID]
+	if !ok {
+		return query.Client{}, ErrNotFound
+	}
+	client.RateLimitPerMinute = arg.RateLimitPerMinute
+	client.RateLimitBurst = arg.RateLimitBurst
+	client.Updated = time.Now()
+	setRow(t, t.data.clients, arg.ID, client)
+	return client, nil
+}
+
+func (t *memoryTx) UpdateClientSuspended(ctx context.Context, arg query.UpdateClientSuspendedParams) (query.Client, error) {
+	client, ok := t.data.clients[arg.ID]
+	if !ok {
+		return query.Client{}, ErrNotFound
+	}
+	client.Suspended = arg.Suspended
+	client.Updated = time.Now()
+	setRow(t, t.data.clients, arg.ID, client)
+	return client, nil
+}
+
+func (t *memoryTx) UpdateClientTokenPolicy(ctx context.Context, arg query.UpdateClientTokenPolicyParams) (query.Client, error) {
+	client, ok := t.data.clients[arg.ID]
+	if !ok {
+		return query.Client{}, ErrNotFound
+	}
+	client.AccessTokenTtlSeconds = arg.AccessTokenTtlSeconds
+	client.RefreshTokenTtlSeconds = arg.RefreshTokenTtlSeconds
+	client.RefreshTokenIdleSeconds = arg.RefreshTokenIdleSeconds
+	client.RefreshTokenPolicy = arg.RefreshTokenPolicy
+	client.Updated = time.Now()
+	setRow(t, t.data.clients, arg.ID, client)
+	return client, nil
+}
+
+func (t *memoryTx) UpdateClientRedirectURIs(ctx context.Context, arg query.UpdateClientRedirectURIsParams) (query.Client, error) {
+	client, ok := t.data.clients[arg.ID]
+	if !ok {
+		return query.Client{}, ErrNotFound
+	}
+	client.RedirectUris = cloneSlice(arg.RedirectUris)
+	client.Updated = time.Now()
+	setRow(t, t.data.clients, arg.ID, client)
+	return client, nil
+}
+
+func (t *memoryTx) ListScopes(ctx context.Context, tenantID string) ([]query.Scope, error) {
+	var scopes []query.Scope
+	for _, scope := range t.data.scopes {
+		scopes = append(scopes, scope)
+	}
+	return scopes, nil
+}
+
+func (t *memoryTx) UpsertScope(ctx context.Context, arg query.UpsertScopeParams) (query.Scope, error) {
+	now := time.Now()
+	scope, ok := t.data.scopes[arg.ID]
+	if !ok {
+		scope = query.Scope{
+			TenantID: arg.TenantID,
+			ID:       arg.ID,
+			Created:  now,
+		}
+	}
+	scope.Description = arg.Description
+	scope.Updated = now
+	setRow(t, t.data.scopes, arg.ID, scope)
+	return scope, nil
+}
+
+func (t *memoryTx) InsertAuthorizationCode(ctx context.Context, arg query.InsertAuthorizationCodeParams) error {
+	if _, ok := t.data.authorizationCodes[arg.ID]; ok {
+		return fmt.Errorf("authorization code %s already exists", arg.ID)
+	}
+	if err := t.checkClient(arg.ClientID); err != nil {
+		return err
+	}
+	now := time.Now()
+	setRow(t, t.data.authorizationCodes, arg.ID, query.AuthorizationCode{
+		TenantID:               arg.TenantID,
+		ID:                     arg.ID,
+		ClientID:               arg.ClientID,
+		UserID:                 arg.UserID,
+		Scopes:                 cloneSlice(arg.Scopes),
+		Expires:                arg.Expires,
+		Created:                now,
+		Updated:                now,
+		Claims:                 cloneSlice(arg.Claims),
+		AccessTokenTtlSeconds:  arg.AccessTokenTtlSeconds,
+		RefreshTokenTtlSeconds: arg.RefreshTokenTtlSeconds,
+		RedirectUri:            arg.RedirectUri,
+	})
+	return nil
+}
+
+func (t *memoryTx) DeleteAuthorizationCode(ctx context.Context, arg query.DeleteAuthorizationCodeParams) (query.AuthorizationCode, error) {
+	code, ok := t.data.authorizationCodes[arg.ID]
+	if !ok {
+		return query.AuthorizationCode{}, ErrNotFound
+	}
+	deleteRow(t, t.data.authorizationCodes, arg.ID)
+	return code, nil
+}
+
+func (t *memoryTx) InsertAccessToken(ctx context.Context, arg query.InsertAccessTokenParams) error {
+	if _, ok := t.data.accessTokens[arg.ID]; ok {
+		return fmt.Errorf("access token %s already exists", arg.ID)
+	}
+	if err := t.checkClient(arg.ClientID); err != nil {
+		return err
+	}
+	now := time.Now()
+	setRow(t, t.data.accessTokens, arg.ID, query.AccessToken{
+		TenantID:     arg.TenantID,
+		ID:           arg.ID,
+		ClientID:     arg.ClientID,
+		RefreshToken: arg.RefreshToken,
+		UserID:       arg.UserID,
+		Scopes:       cloneSlice(arg.Scopes),
+		Expires:      arg.Expires,
+		Created:      now,
+		Updated:      now,
+		Claims:       cloneSlice(arg.Claims),
+	})
+	return nil
+}
+
+func (t *memoryTx) SelectValidAccessToken(ctx context.Context, arg query.SelectValidAccessTokenParams) (query.AccessToken, error) {
+	token, ok := t.data.accessTokens[arg.ID]
+	if !ok || token.Revoked || !token.Expires.After(time.Now()) {
+		return query.AccessToken{}, ErrNotFound
+	}
+	token.Scopes = cloneSlice(token.Scopes)
+	token.Claims = cloneSlice(token.Claims)
+	return token, nil
+}
+
+func (t *memoryTx) SelectValidAccessTokens(ctx context.Context, arg query.SelectValidAccessTokensParams) ([]query.AccessToken, error) {
+	var items []query.AccessToken
+	seen := map[string]bool{}
+	for _, id := range arg.Ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if token, err := t.SelectValidAccessToken(ctx, query.SelectValidAccessTokenParams{TenantID: arg.TenantID, ID: id}); err == nil {
+			items = append(items, token)
+		}
+	}
+	return items, nil
+}
+
+func (t *memoryTx) InsertRefreshToken(ctx context.Context, arg query.InsertRefreshTokenParams) error {
+	if _, ok := t.data.refreshTokens[arg.ID]; ok {
+		return fmt.Errorf("refresh token %s already exists", arg.ID)
+	}
+	if err := t.checkClient(arg.ClientID); err != nil {
+		return err
+	}
+	now := time.Now()
+	setRow(t, t.data.refreshTokens, arg.ID, query.RefreshToken{
+		TenantID: arg.TenantID,
+		ID:       arg.ID,
+		ClientID: arg.ClientID,
+		UserID:   arg.UserID,
+		Scopes:   cloneSlice(arg.Scopes),
+		Expires:  arg.Expires,
+		Created:  now,
+		Updated:  now,
+		Claims:   cloneSlice(arg.Claims),
+
+		GrantCreated: arg.GrantCreated,
+	})
+	return nil
+}
+
+func (t *memoryTx) SelectValidRefreshToken(ctx context.Context, arg query.SelectValidRefreshTokenParams) (query.RefreshToken, error) {
+	token, err := t.SelectRefreshToken(ctx, query.SelectRefreshTokenParams(arg))
+	if err != nil || token.Revoked || !token.Expires.After(time.Now()) {
+		return query.RefreshToken{}, ErrNotFound
+	}
+	return token, nil
+}
+
+func (t *memoryTx) SelectRefreshToken(ctx context.Context, arg query.SelectRefreshTokenParams) (query.RefreshToken, error) {
+	token, ok := t.data.refreshTokens[arg.ID]
+	if !ok {
+		return query.RefreshToken{}, ErrNotFound
+	}
+	token.Scopes = cloneSlice(token.Scopes)
+	token.Claims = cloneSlice(token.Claims)
+	return token, nil
+}
+
+func (t *memoryTx) RotateRefreshToken(ctx context.Context, arg query.RotateRefreshTokenParams) (int64, error) {
+	token, ok := t.data.refreshTokens[arg.ID]
+	if !ok || token.Revoked {
+		return 0, nil
+	}
+	now := time.Now()
+	token.Revoked = true
+	if arg.ReplacedBy != nil {
+		replacedBy := *arg.ReplacedBy
+		token.ReplacedBy = &replacedBy
+	}
+	token.LastUsed = &now
+	token.Updated = now
+	setRow(t, t.data.refreshTokens, arg.ID, token)
+	return 1, nil
+}
+
+func (t *memoryTx) TouchAccessTokens(ctx context.Context, arg query.TouchAccessTokensParams) ([]string, error) {
+	now := time.Now()
+	var touched []string
+	for _, id := range arg.Ids {
+		token, ok := t.data.accessTokens[id]
+		if !ok || (token.LastUsed != nil && token.LastUsed.After(now.Add(-time.Minute))) {
+			continue
+		}
+		token.LastUsed = &now
+		setRow(t, t.data.accessTokens, id, token)
+		touched = append(touched, id)
+	}
+	return touched, nil
+}
+
+// revokeAccessTokens revokes the unrevoked access tokens that match, returning how many
+func (t *memoryTx) revokeAccessTokens(match func(token query.AccessToken) bool) int64 {
+	var revoked int64
+	for id, token := range t.data.accessTokens {
+		if !token.Revoked && match(token) {
+			token.Revoked = true
+			setRow(t, t.data.accessTokens, id, token)
+			revoked++
+		}
+	}
+	return revoked
+}
+
+// revokeRefreshTokens revokes the unrevoked refresh tokens that match, returning how many
+func (t *memoryTx) revokeRefreshTokens(match func(token query.RefreshToken) bool) int64 {
+	var revoked int64
+	for id, token := range t.data.refreshTokens {
+		if !token.Revoked && match(token) {
+			token.Revoked = true
+			setRow(t, t.data.refreshTokens, id, token)
+			revoked++
+		}
+	}
+	return revoked
+}
+
+func (t *memoryTx) RevokeAccessTokensByUserAndClient(ctx context.Context, arg query.RevokeAccessTokensByUserAndClientParams) (int64, error) {
+	return t.revokeAccessTokens(func(token query.AccessToken) bool {
+		return token.UserID == arg.UserID && token.ClientID == arg.ClientID
+	}), nil
+}
+
+func (t *memoryTx) RevokeRefreshTokensByUserAndClient(ctx context.Context, arg query.RevokeRefreshTokensByUserAndClientParams) (int64, error) {
+	return t.revokeRefreshTokens(func(token query.RefreshToken) bool {
+		return token.UserID == arg.UserID && token.ClientID == arg.ClientID
+	}), nil
+}
+
+func (t *memoryTx) RevokeAccessTokensByUserID(ctx context.Context, arg query.RevokeAccessTokensByUserIDParams) (int64, error) {
+	return t.revokeAccessTokens(func(token query.AccessToken) bool {
+		return token.UserID == arg.UserID
+	}), nil
+}
+
+func (t *memoryTx) RevokeRefreshTokensByUserID(ctx context.Context, arg query.RevokeRefreshTokensByUserIDParams) (int64, error) {
+	return t.revokeRefreshTokens(func(token query.RefreshToken) bool {
+		return token.UserID == arg.UserID
+	}), nil
+}
+
+func (t *memoryTx) RevokeAccessTokensByClientID(ctx context.Context, arg query.RevokeAccessTokensByClientIDParams) (int64, error) {
+	return t.revokeAccessTokens(func(token query.AccessToken) bool {
+		return token.ClientID == arg.ClientID
+	}), nil
+}
+
+func (t *memoryTx) RevokeRefreshTokensByClientID(ctx context.Context, arg query.RevokeRefreshTokensByClientIDParams) (int64, error) {
+	return t.revokeRefreshTokens(func(token query.RefreshToken) bool {
+		return token.ClientID == arg.ClientID
+	}), nil
+}
+
+func (t *memoryTx) RevokeAccessTokensCreatedBefore(ctx context.Context, arg query.RevokeAccessTokensCreatedBeforeParams) (int64, error) {
+	return t.revokeAccessTokens(func(token query.AccessToken) bool {
+		return token.Created.Before(arg.Before)
+	}), nil
+}
+
+func (t *memoryTx) RevokeRefreshTokensCreatedBefore(ctx context.Context, arg query.RevokeRefreshTokensCreatedBeforeParams) (int64, error) {
+	return t.revokeRefreshTokens(func(token query.RefreshToken) bool {
+		return token.Created.Before(arg.Before)
+	}), nil
+}
+
+func (t *memoryTx) UpsertConsent(ctx context.Context, arg query.UpsertConsentParams) error {
+	if err := t.checkClient(arg.ClientID); err != nil {
+		return err
+	}
+	now := time.Now()
+	key := consentKey{UserID: arg.UserID, ClientID: arg.ClientID}
+	consent, ok := t.data.consents[key]
+	if !ok {
+		consent = query.Consent{
+			TenantID: arg.TenantID,
+			UserID:   arg.UserID,
+			ClientID: arg.ClientID,
+			Created:  now,
+		}
+	}
+	consent.Scopes = cloneSlice(arg.Scopes)
+	consent.Updated = now
+	setRow(t, t.data.consents, key, consent)
+	return nil
+}
+
+func (t *memoryTx) ListConsentsByUserID(ctx context.Context, arg query.ListConsentsByUserIDParams) ([]query.Consent, error) {
+	var consents []query.Consent
+	for key, consent := range t.data.consents {
+		if key.UserID == arg.UserID {
+			consent.Scopes = cloneSlice(consent.Scopes)
+			consents = append(consents, consent)
+		}
+	}
+	sort.Slice(consents, func(i, j int) bool {
+		return consents[i].ClientID < consents[j].ClientID
+	})
+	return consents, nil
+}
+
+func (t *memoryTx) DeleteConsent(ctx context.Context, arg query.DeleteConsentParams) (int64, error) {
+	key := consentKey{UserID: arg.UserID, ClientID: arg.ClientID}
+	if _, ok := t.data.consents[key]; !ok {
+		return 0, nil
+	}
+	deleteRow(t, t.data.consents, key)
+	return 1, nil
+}
+
+func (t *memoryTx) TouchConsent(ctx context.Context, arg query.TouchConsentParams) error {
+	key := consentKey{UserID: arg.UserID, ClientID: arg.ClientID}
+	consent, ok := t.data.consents[key]
+	if !ok {
+		return nil
+	}
+	now := time.Now()
+	consent.LastUsed = &now
+	setRow(t, t.data.consents, key, consent)
+	return nil
+}
+
+func (t *memoryTx) TouchConsents(ctx context.Context, arg query.TouchConsentsParams) error {
+	for i := range arg.UserIds {
+		err := t.TouchConsent(ctx, query.TouchConsentParams{
+			TenantID: arg.TenantID,
+			UserID:   arg.UserIds[i],
+			ClientID: arg.ClientIds[i],
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *memoryTx) EnqueueWebhook(ctx context.Context, tenantID, eventType string, data any) error {
+	return nil
+}
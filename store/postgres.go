@@ -0,0 +1,48 @@
+package store
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/webhooks"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+// Postgres is the sqlc backend, for Postgres and CRDB
+type Postgres struct {
+	pool         *pgxpool.Pool
+	serializable bool
+}
+
+type postgresTx struct {
+	*query.Queries
+}
+
+// NewPostgres uses pool for everything. Set serializable for Postgres, CRDB is always serializable.
+func NewPostgres(pool *pgxpool.Pool, serializable bool) *Postgres {
+	return &Postgres{pool: pool, serializable: serializable}
+}
+
+func (p *Postgres) Exec(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx Tx) error) error {
+	return query.ReliableExec(ctx, p.pool, tryTimeout, func(ctx context.Context, q *query.Queries) error {
+		return f(ctx, postgresTx{q})
+	})
+}
+
+func (p *Postgres) ExecInTx(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx Tx) error) error {
+	return query.ReliableExecInTx(ctx, p.pool, tryTimeout, func(ctx context.Context, q *query.Queries) error {
+		if p.serializable {
+			err := q.SetIsolationLevel(ctx, query.Serializable)
+			if err != nil {
+				return fmt.Errorf("error in SetIsolationLevel: %w", err)
+			}
+		}
+		return f(ctx, postgresTx{q})
+	})
+}
+
+func (t postgresTx) EnqueueWebhook(ctx context.Context, tenantID, eventType string, data any) error {
+	return webhooks.Enqueue(ctx, t.Queries, tenantID, eventType, data)
+}
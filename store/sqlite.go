@@ -0,0 +1,561 @@
+package store
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	_ "modernc.org/sqlite"
+)
+
+var (
+	//go:embed sqlite_schema.sql
+	sqliteSchema string
+
+	// Columns added to sqlite_schema.sql since it was first released, added to existing databases on open
+	sqliteAddedColumns = []sqliteColumn{
+		{"clients", "access_token_ttl_seconds", "integer"},
+		{"clients", "refresh_token_ttl_seconds", "integer"},
+		{"clients", "refresh_token_idle_seconds", "integer"},
+		{"clients", "refresh_token_policy", "text not null default 'always'"},
+		{"access_tokens", "last_used", "integer"},
+		{"refresh_tokens", "last_used", "integer"},
+		{"refresh_tokens", "grant_created", "integer"},
+		{"consents", "last_used", "integer"},
+		{"clients", "rate_limit_per_minute", "integer"},
+		{"clients", "rate_limit_burst", "integer"},
+		{"refresh_tokens", "replaced_by", "text"},
+		{"clients", "redirect_uris", "text not null default '[]'"},
+		{"authorization_codes", "redirect_uri", "text"},
+	}
+
+	clientColumns = "id, secret, suspended, name, created, updated, access_token_ttl_seconds, refresh_token_ttl_seconds, refresh_token_idle_seconds, refresh_token_policy, rate_limit_per_minute, rate_limit_burst, redirect_uris"
+)
+
+// SQLite is an embedded backend for small single replica deployments, no external database needed.
+// The schema is created on open, there are no migrations, new columns are added on open instead.
+// It only holds DefaultTenantID, so there are no tenant_id columns and tenant params are ignored.
+type SQLite struct {
+	db *sql.DB
+}
+
+type sqliteDB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+}
+
+type sqliteTx struct {
+	db sqliteDB
+}
+
+type sqliteColumn struct {
+	table, name, definition string
+}
+
+type scanner interface {
+	Scan(dest ...any) error
+}
+
+// OpenSQLite opens or creates the database file at path, use ":memory:" for a throwaway database
+func OpenSQLite(path string) (*SQLite, error) {
+	db, err := sql.Open("sqlite", fmt.Sprintf("file:%s?_pragma=foreign_keys(1)&_pragma=busy_timeout(5000)&_pragma=journal_mode(WAL)", path))
+	if err != nil {
+		return nil, fmt.Errorf("error in sql.Open: %w", err)
+	}
+	// SQLite has a single writer anyway, and a :memory: database only exists on its connection
+	db.SetMaxOpenConns(1)
+	db.SetConnMaxIdleTime(0)
+	db.SetConnMaxLifetime(0)
+
+	_, err = db.Exec(sqliteSchema)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error creating schema: %w", err)
+	}
+	err = addSQLiteColumns(db)
+	if err != nil {
+		db.Close()
+		return nil, fmt.Errorf("error in addSQLiteColumns: %w", err)
+	}
+	logger.Debug().Str("path", path).Msg("opened sqlite store")
+	return &SQLite{db: db}, nil
+}
+
+// addSQLiteColumns adds any of sqliteAddedColumns that a database created by an older version is missing
+func addSQLiteColumns(db *sql.DB) error {
+	for _, col := range sqliteAddedColumns {
+		var exists bool
+		err := db.QueryRow(`select count(*) > 0 from pragma_table_info(?) where name = ?`, col.table, col.name).Scan(&exists)
+		if err != nil {
+			return fmt.Errorf("error checking for %s.%s: %w", col.table, col.name, err)
+		}
+		if exists {
+			continue
+		}
+		_, err = db.Exec(fmt.Sprintf("alter table %s add column %s %s", col.table, col.name, col.definition))
+		if err != nil {
+			return fmt.Errorf("error adding %s.%s: %w", col.table, col.name, err)
+		}
+		logger.Info().Str("table", col.table).Str("column", col.name).Msg("added sqlite column")
+	}
+	return nil
+}
+
+func (s *SQLite) Close() error {
+	return s.db.Close()
+}
+
+func (s *SQLite) Exec(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, tryTimeout)
+	defer cancel()
+	return f(ctx, &sqliteTx{db: s.db})
+}
+
+// ExecInTx is serializable, SQLite transactions always are
+func (s *SQLite) ExecInTx(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx Tx) error) error {
+	ctx, cancel := context.WithTimeout(ctx, tryTimeout)
+	defer cancel()
+	tx, err := s.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("error in BeginTx: %w", err)
+	}
+	err = f(ctx, &sqliteTx{db: tx})
+	if err != nil {
+		if rbErr := tx.Rollback(); rbErr != nil {
+			logger.Error().Err(rbErr).Msg("error rolling back sqlite transaction")
+		}
+		return err
+	}
+	err = tx.Commit()
+	if err != nil {
+		return fmt.Errorf("error in Commit: %w", err)
+	}
+	return nil
+}
+
+func notFound(err error) error {
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNotFound
+	}
+	return err
+}
+
+func encodeScopes(scopes []string) (string, error) {
+	if scopes == nil {
+		scopes = []string{}
+	}
+	b, err := json.Marshal(scopes)
+	if err != nil {
+		return "", fmt.Errorf("error in json.Marshal: %w", err)
+	}
+	return string(b), nil
+}
+
+func decodeScopes(s string) ([]string, error) {
+	var scopes []string
+	err := json.Unmarshal([]byte(s), &scopes)
+	if err != nil {
+		return nil, fmt.Errorf("error in json.Unmarshal: %w", err)
+	}
+	return scopes, nil
+}
+
+// nullBytes makes sure nil is stored as NULL rather than an empty blob
+func nullBytes(b []byte) any {
+	if b == nil {
+		return nil
+	}
+	return b
+}
+
+func micros(t time.Time) int64 {
+	return t.UnixMicro()
+}
+
+// nullMicros is micros for nullable columns
+func nullMicros(t *time.Time) any {
+	if t == nil {
+		return nil
+	}
+	return t.UnixMicro()
+}
+
+func fromNullMicros(m *int64) *time.Time {
+	if m == nil {
+		return nil
+	}
+	t := time.UnixMicro(*m)
+	return &t
+}
+
+func scanClient(row scanner) (query.Client, error) {
+	var i query.Client
+	i.TenantID = DefaultTenantID
+	var created, updated int64
+	var redirectURIs string
+	err := row.Scan(&i.ID, &i.Secret, &i.Suspended, &i.Name, &created, &updated, &i.AccessTokenTtlSeconds, &i.RefreshTokenTtlSeconds, &i.RefreshTokenIdleSeconds, &i.RefreshTokenPolicy, &i.RateLimitPerMinute, &i.RateLimitBurst, &redirectURIs)
+	if err != nil {
+		return i, notFound(err)
+	}
+	i.Created, i.Updated = time.UnixMicro(created), time.UnixMicro(updated)
+	i.RedirectUris, err = decodeScopes(redirectURIs)
+	if err != nil {
+		return i, err
+	}
+	return i, nil
+}
+
+func scanScope(row scanner) (query.Scope, error) {
+	var i query.Scope
+	i.TenantID = DefaultTenantID
+	var created, updated int64
+	err := row.Scan(&i.ID, &i.Description, &created, &updated)
+	if err != nil {
+		return i, notFound(err)
+	}
+	i.Created, i.Updated = time.UnixMicro(created), time.UnixMicro(updated)
+	return i, nil
+}
+
+func scanAuthorizationCode(row scanner) (query.AuthorizationCode, error) {
+	var i query.AuthorizationCode
+	i.TenantID = DefaultTenantID
+	var scopes string
+	var expires, created, updated int64
+	err := row.Scan(&i.ID, &i.ClientID, &i.UserID, &scopes, &expires, &created, &updated, &i.Claims, &i.AccessTokenTtlSeconds, &i.RefreshTokenTtlSeconds, &i.RedirectUri)
+	if err != nil {
+		return i, notFound(err)
+	}
+	i.Expires, i.Created, i.Updated = time.UnixMicro(expires), time.UnixMicro(created), time.UnixMicro(updated)
+	i.Scopes, err = decodeScopes(scopes)
+	return i, err
+}
+
+func scanAccessToken(row scanner) (query.AccessToken, error) {
+	var i query.AccessToken
+	i.TenantID = DefaultTenantID
+	var scopes string
+	var expires, created, updated int64
+	var lastUsed *int64
+	err := row.Scan(&i.ID, &i.ClientID, &i.RefreshToken, &i.UserID, &scopes, &expires, &i.Revoked, &created, &updated, &i.Claims, &lastUsed)
+	if err != nil {
+		return i, notFound(err)
+	}
+	i.Expires, i.Created, i.Updated = time.UnixMicro(expires), time.UnixMicro(created), time.UnixMicro(updated)
+	i.LastUsed = fromNullMicros(lastUsed)
+	i.Scopes, err = decodeScopes(scopes)
+	return i, err
+}
+
+func scanRefreshToken(row scanner) (query.RefreshToken, error) {
+	var i query.RefreshToken
+	i.TenantID = DefaultTenantID
+	var scopes string
+	var expires, created, updated int64
+	var lastUsed, grantCreated *int64
+	err := row.Scan(&i.ID, &i.ClientID, &i.UserID, &scopes, &expires, &i.Revoked, &created, &updated, &i.Claims, &lastUsed, &grantCreated, &i.ReplacedBy)
+	if err != nil {
+		return i, notFound(err)
+	}
+	i.Expires, i.Created, i.Updated = time.UnixMicro(expires), time.UnixMicro(created), time.UnixMicro(updated)
+	i.LastUsed, i.GrantCreated = fromNullMicros(lastUsed), fromNullMicros(grantCreated)
+	i.Scopes, err = decodeScopes(scopes)
+	return i, err
+}
+
+func scanConsent(row scanner) (query.Consent, error) {
+	var i query.Consent
+	i.TenantID = DefaultTenantID
+	var scopes string
+	var created, updated int64
+	var lastUsed *int64
+	err := row.Scan(&i.UserID, &i.ClientID, &scopes, &created, &updated, &lastUsed)
+	if err != nil {
+		return i, notFound(err)
+	}
+	i.Created, i.Updated = time.UnixMicro(created), time.UnixMicro(updated)
+	i.LastUsed = fromNullMicros(lastUsed)
+	i.Scopes, err = decodeScopes(scopes)
+	return i, err
+}
+
+func (t *sqliteTx) execRows(ctx context.Context, q string, args ...any) (int64, error) {
+	res, err := t.db.ExecContext(ctx, q, args...)
+	if err != nil {
+		return 0, err
+	}
+	return res.RowsAffected()
+}
+
+func (t *sqliteTx) SelectClient(ctx context.Context, arg query.SelectClientParams) (query.Client, error) {
+	return scanClient(t.db.QueryRowContext(ctx, `select `+clientColumns+` from clients where id = ?`, arg.ID))
+}
+
+func (t *sqliteTx) InsertClient(ctx context.Context, arg query.InsertClientParams) (query.Client, error) {
+	now := micros(time.Now())
+	return scanClient(t.db.QueryRowContext(ctx, `insert into clients (id, secret, name, created, updated) values (?, ?, ?, ?, ?)
+returning `+clientColumns, arg.ID, arg.Secret, arg.Name, now, now))
+}
+
+func (t *sqliteTx) UpdateClientSecret(ctx context.Context, arg query.UpdateClientSecretParams) (query.Client, error) {
+	return scanClient(t.db.QueryRowContext(ctx, `update clients set secret = ?, updated = ? where id = ?
+returning `+clientColumns, arg.Secret, micros(time.Now()), arg.ID))
+}
+
+func (t *sqliteTx) UpdateClientTokenPolicy(ctx context.Context, arg query.UpdateClientTokenPolicyParams) (query.Client, error) {
+	return scanClient(t.db.QueryRowContext(ctx, `update clients
+set access_token_ttl_seconds = ?, refresh_token_ttl_seconds = ?, refresh_token_idle_seconds = ?, refresh_token_policy = ?, updated = ?
+where id = ?
+returning `+clientColumns, arg.AccessTokenTtlSeconds, arg.RefreshTokenTtlSeconds, arg.RefreshTokenIdleSeconds, arg.RefreshTokenPolicy, micros(time.Now()), arg.ID))
+}
+
+func (t *sqliteTx) UpdateClientRateLimit(ctx context.Context, arg query.UpdateClientRateLimitParams) (query.Client, error) {
+	return scanClient(t.db.QueryRowContext(ctx, `update clients
+set rate_limit_per_minute = ?, rate_limit_burst = ?, updated = ?
+where id = ?
+returning `+clientColumns, arg.RateLimitPerMinute, arg.RateLimitBurst, micros(time.Now()), arg.ID))
+}
+
+func (t *sqliteTx) UpdateClientRedirectURIs(ctx context.Context, arg query.UpdateClientRedirectURIsParams) (query.Client, error) {
+	redirectURIs, err := encodeScopes(arg.RedirectUris)
+	if err != nil {
+		return query.Client{}, err
+	}
+	return scanClient(t.db.QueryRowContext(ctx, `update clients
+set redirect_uris = ?, updated = ?
+where id = ?
+returning `+clientColumns, redirectURIs, micros(time.Now()), arg.ID))
+}
+
+func (t *sqliteTx) UpdateClientSuspended(ctx context.Context, arg query.UpdateClientSuspendedParams) (query.Client, error) {
+	return scanClient(t.db.QueryRowContext(ctx, `update clients
+set suspended = ?, updated = ?
+where id = ?
+returning `+clientColumns, arg.Suspended, micros(time.Now()), arg.ID))
+}
+
+func (t *sqliteTx) ListScopes(ctx context.Context, tenantID string) ([]query.Scope, error) {
+	rows, err := t.db.QueryContext(ctx, `select id, description, created, updated from scopes`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []query.Scope
+	for rows.Next() {
+		i, err := scanScope(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+func (t *sqliteTx) UpsertScope(ctx context.Context, arg query.UpsertScopeParams) (query.Scope, error) {
+	now := micros(time.Now())
+	return scanScope(t.db.QueryRowContext(ctx, `insert into scopes (id, description, created, updated) values (?, ?, ?, ?)
+on conflict (id) do update set description = excluded.description, updated = excluded.updated
+returning id, description, created, updated`, arg.ID, arg.Description, now, now))
+}
+
+func (t *sqliteTx) InsertAuthorizationCode(ctx context.Context, arg query.InsertAuthorizationCodeParams) error {
+	scopes, err := encodeScopes(arg.Scopes)
+	if err != nil {
+		return err
+	}
+	now := micros(time.Now())
+	_, err = t.db.ExecContext(ctx, `insert into authorization_codes (id, user_id, client_id, scopes, expires, created, updated, claims, access_token_ttl_seconds, refresh_token_ttl_seconds, redirect_uri)
+values (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`, arg.ID, arg.UserID, arg.ClientID, scopes, micros(arg.Expires), now, now, nullBytes(arg.Claims), arg.AccessTokenTtlSeconds, arg.RefreshTokenTtlSeconds, arg.RedirectUri)
+	return err
+}
+
+func (t *sqliteTx) DeleteAuthorizationCode(ctx context.Context, arg query.DeleteAuthorizationCodeParams) (query.AuthorizationCode, error) {
+	return scanAuthorizationCode(t.db.QueryRowContext(ctx, `delete from authorization_codes where id = ?
+returning id, client_id, user_id, scopes, expires, created, updated, claims, access_token_ttl_seconds, refresh_token_ttl_seconds, redirect_uri`, arg.ID))
+}
+
+func (t *sqliteTx) InsertAccessToken(ctx context.Context, arg query.InsertAccessTokenParams) error {
+	scopes, err := encodeScopes(arg.Scopes)
+	if err != nil {
+		return err
+	}
+	now := micros(time.Now())
+	_, err = t.db.ExecContext(ctx, `insert into access_tokens (id, client_id, refresh_token, user_id, scopes, expires, created, updated, claims)
+values (?, ?, ?, ?, ?, ?, ?, ?, ?)`, arg.ID, arg.ClientID, arg.RefreshToken, arg.UserID, scopes, micros(arg.Expires), now, now, nullBytes(arg.Claims))
+	return err
+}
+
+func (t *sqliteTx) SelectValidAccessToken(ctx context.Context, arg query.SelectValidAccessTokenParams) (query.AccessToken, error) {
+	return scanAccessToken(t.db.QueryRowContext(ctx, `select id, client_id, refresh_token, user_id, scopes, expires, revoked, created, updated, claims, last_used
+from access_tokens where id = ? and expires > ? and revoked = 0`, arg.ID, micros(time.Now())))
+}
+
+func (t *sqliteTx) SelectValidAccessTokens(ctx context.Context, arg query.SelectValidAccessTokensParams) ([]query.AccessToken, error) {
+	if len(arg.Ids) == 0 {
+		return nil, nil
+	}
+	args := []any{micros(time.Now())}
+	for _, id := range arg.Ids {
+		args = append(args, id)
+	}
+	rows, err := t.db.QueryContext(ctx, `select id, client_id, refresh_token, user_id, scopes, expires, revoked, created, updated, claims, last_used
+from access_tokens where expires > ? and revoked = 0 and id in (?`+strings.Repeat(", ?", len(arg.Ids)-1)+`)`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []query.AccessToken
+	for rows.Next() {
+		i, err := scanAccessToken(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+func (t *sqliteTx) InsertRefreshToken(ctx context.Context, arg query.InsertRefreshTokenParams) error {
+	scopes, err := encodeScopes(arg.Scopes)
+	if err != nil {
+		return err
+	}
+	now := micros(time.Now())
+	_, err = t.db.ExecContext(ctx, `insert into refresh_tokens (id, client_id, user_id, scopes, expires, created, updated, claims, grant_created)
+values (?, ?, ?, ?, ?, ?, ?, ?, ?)`, arg.ID, arg.ClientID, arg.UserID, scopes, micros(arg.Expires), now, now, nullBytes(arg.Claims), nullMicros(arg.GrantCreated))
+	return err
+}
+
+func (t *sqliteTx) SelectValidRefreshToken(ctx context.Context, arg query.SelectValidRefreshTokenParams) (query.RefreshToken, error) {
+	return scanRefreshToken(t.db.QueryRowContext(ctx, `select id, client_id, user_id, scopes, expires, revoked, created, updated, claims, last_used, grant_created, replaced_by
+from refresh_tokens where id = ? and expires > ? and revoked = 0`, arg.ID, micros(time.Now())))
+}
+
+func (t *sqliteTx) SelectRefreshToken(ctx context.Context, arg query.SelectRefreshTokenParams) (query.RefreshToken, error) {
+	return scanRefreshToken(t.db.QueryRowContext(ctx, `select id, client_id, user_id, scopes, expires, revoked, created, updated, claims, last_used, grant_created, replaced_by
+from refresh_tokens where id = ?`, arg.ID))
+}
+
+func (t *sqliteTx) RotateRefreshToken(ctx context.Context, arg query.RotateRefreshTokenParams) (int64, error) {
+	now := micros(time.Now())
+	return t.execRows(ctx, `update refresh_tokens set revoked = 1, replaced_by = ?, last_used = ?, updated = ? where id = ? and revoked = 0`, arg.ReplacedBy, now, now, arg.ID)
+}
+
+func (t *sqliteTx) TouchAccessTokens(ctx context.Context, arg query.TouchAccessTokensParams) ([]string, error) {
+	if len(arg.Ids) == 0 {
+		return nil, nil
+	}
+	now := time.Now()
+	args := []any{micros(now), micros(now.Add(-time.Minute))}
+	for _, id := range arg.Ids {
+		args = append(args, id)
+	}
+	rows, err := t.db.QueryContext(ctx, `update access_tokens set last_used = ?
+where (last_used is null or last_used < ?) and id in (?`+strings.Repeat(", ?", len(arg.Ids)-1)+`) returning id`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			return nil, err
+		}
+		items = append(items, id)
+	}
+	return items, rows.Err()
+}
+
+func (t *sqliteTx) RevokeAccessTokensByUserAndClient(ctx context.Context, arg query.RevokeAccessTokensByUserAndClientParams) (int64, error) {
+	return t.execRows(ctx, `update access_tokens set revoked = 1, updated = ? where user_id = ? and client_id = ? and revoked = 0`, micros(time.Now()), arg.UserID, arg.ClientID)
+}
+
+func (t *sqliteTx) RevokeRefreshTokensByUserAndClient(ctx context.Context, arg query.RevokeRefreshTokensByUserAndClientParams) (int64, error) {
+	return t.execRows(ctx, `update refresh_tokens set revoked = 1, updated = ? where user_id = ? and client_id = ? and revoked = 0`, micros(time.Now()), arg.UserID, arg.ClientID)
+}
+
+func (t *sqliteTx) RevokeAccessTokensByUserID(ctx context.Context, arg query.RevokeAccessTokensByUserIDParams) (int64, error) {
+	return t.execRows(ctx, `update access_tokens set revoked = 1, updated = ? where user_id = ? and revoked = 0`, micros(time.Now()), arg.UserID)
+}
+
+func (t *sqliteTx) RevokeRefreshTokensByUserID(ctx context.Context, arg query.RevokeRefreshTokensByUserIDParams) (int64, error) {
+	return t.execRows(ctx, `update refresh_tokens set revoked = 1, updated = ? where user_id = ? and revoked = 0`, micros(time.Now()), arg.UserID)
+}
+
+func (t *sqliteTx) RevokeAccessTokensByClientID(ctx context.Context, arg query.RevokeAccessTokensByClientIDParams) (int64, error) {
+	return t.execRows(ctx, `update access_tokens set revoked = 1, updated = ? where client_id = ? and revoked = 0`, micros(time.Now()), arg.ClientID)
+}
+
+func (t *sqliteTx) RevokeRefreshTokensByClientID(ctx context.Context, arg query.RevokeRefreshTokensByClientIDParams) (int64, error) {
+	return t.execRows(ctx, `update refresh_tokens set revoked = 1, updated = ? where client_id = ? and revoked = 0`, micros(time.Now()), arg.ClientID)
+}
+
+func (t *sqliteTx) RevokeAccessTokensCreatedBefore(ctx context.Context, arg query.RevokeAccessTokensCreatedBeforeParams) (int64, error) {
+	return t.execRows(ctx, `update access_tokens set revoked = 1, updated = ? where created < ? and revoked = 0`, micros(time.Now()), micros(arg.Before))
+}
+
+func (t *sqliteTx) RevokeRefreshTokensCreatedBefore(ctx context.Context, arg query.RevokeRefreshTokensCreatedBeforeParams) (int64, error) {
+	return t.execRows(ctx, `update refresh_tokens set revoked = 1, updated = ? where created < ? and revoked = 0`, micros(time.Now()), micros(arg.Before))
+}
+
+func (t *sqliteTx) UpsertConsent(ctx context.Context, arg query.UpsertConsentParams) error {
+	scopes, err := encodeScopes(arg.Scopes)
+	if err != nil {
+		return err
+	}
+	now := micros(time.Now())
+	_, err = t.db.ExecContext(ctx, `insert into consents (user_id, client_id, scopes, created, updated) values (?, ?, ?, ?, ?)
+on conflict (user_id, client_id) do update set scopes = excluded.scopes, updated = excluded.updated`, arg.UserID, arg.ClientID, scopes, now, now)
+	return err
+}
+
+func (t *sqliteTx) ListConsentsByUserID(ctx context.Context, arg query.ListConsentsByUserIDParams) ([]query.Consent, error) {
+	rows, err := t.db.QueryContext(ctx, `select user_id, client_id, scopes, created, updated, last_used from consents where user_id = ? order by client_id`, arg.UserID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []query.Consent
+	for rows.Next() {
+		i, err := scanConsent(rows)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, i)
+	}
+	return items, rows.Err()
+}
+
+func (t *sqliteTx) DeleteConsent(ctx context.Context, arg query.DeleteConsentParams) (int64, error) {
+	return t.execRows(ctx, `delete from consents where user_id = ? and client_id = ?`, arg.UserID, arg.ClientID)
+}
+
+func (t *sqliteTx) TouchConsent(ctx context.Context, arg query.TouchConsentParams) error {
+	_, err := t.db.ExecContext(ctx, `update consents set last_used = ? where user_id = ? and client_id = ?`, micros(time.Now()), arg.UserID, arg.ClientID)
+	return err
+}
+
+func (t *sqliteTx) TouchConsents(ctx context.Context, arg query.TouchConsentsParams) error {
+	if len(arg.UserIds) == 0 {
+		return nil
+	}
+	args := []any{micros(time.Now())}
+	for i := range arg.UserIds {
+		args = append(args, arg.UserIds[i], arg.ClientIds[i])
+	}
+	_, err := t.db.ExecContext(ctx, `update consents set last_used = ?
+where (user_id, client_id) in (values (?, ?)`+strings.Repeat(", (?, ?)", len(arg.UserIds)-1)+`)`, args...)
+	return err
+}
+
+func (t *sqliteTx) EnqueueWebhook(ctx context.Context, tenantID, eventType string, data any) error {
+	return nil
+}
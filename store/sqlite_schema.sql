@@ -0,0 +1,79 @@
+-- Mirrors the Postgres migrations. Times are unix microseconds, and scopes are JSON arrays.
+create table if not exists clients (
+    id text not null primary key,
+    secret text not null,
+    suspended integer not null default 0,
+    name text not null,
+    created integer not null,
+    updated integer not null,
+    access_token_ttl_seconds integer,
+    refresh_token_ttl_seconds integer,
+    refresh_token_idle_seconds integer,
+    refresh_token_policy text not null default 'always',
+    rate_limit_per_minute integer,
+    rate_limit_burst integer,
+    -- JSON array
+    redirect_uris text not null default '[]'
+);
+
+create table if not exists scopes (
+    id text not null primary key,
+    description text,
+    created integer not null,
+    updated integer not null
+);
+
+create table if not exists authorization_codes (
+    id text not null primary key,
+    client_id text not null references clients(id) on delete cascade,
+    user_id text not null,
+    scopes text not null,
+    expires integer not null,
+    created integer not null,
+    updated integer not null,
+    claims blob,
+    access_token_ttl_seconds integer,
+    refresh_token_ttl_seconds integer,
+    redirect_uri text
+);
+
+create table if not exists refresh_tokens (
+    id text not null primary key,
+    client_id text not null references clients(id) on delete cascade,
+    user_id text not null,
+    scopes text not null,
+    expires integer not null,
+    revoked integer not null default 0,
+    created integer not null,
+    updated integer not null,
+    claims blob,
+    last_used integer,
+    grant_created integer,
+    replaced_by text
+);
+create index if not exists refresh_tokens_user_client on refresh_tokens(user_id, client_id);
+
+create table if not exists access_tokens (
+    id text not null primary key,
+    client_id text not null references clients(id) on delete cascade,
+    refresh_token text,
+    user_id text not null,
+    scopes text not null,
+    expires integer not null,
+    revoked integer not null default 0,
+    created integer not null,
+    updated integer not null,
+    claims blob,
+    last_used integer
+);
+create index if not exists access_tokens_user_client on access_tokens(user_id, client_id);
+
+create table if not exists consents (
+    user_id text not null,
+    client_id text not null references clients(id) on delete cascade,
+    scopes text not null,
+    created integer not null,
+    updated integer not null,
+    last_used integer,
+    primary key (user_id, client_id)
+);
@@ -0,0 +1,87 @@
+package store
+
+import (
+	"context"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	KindPostgres = "postgres"
+	KindSQLite   = "sqlite"
+	KindMemory   = "memory"
+
+	// The tenant of single-tenant deployments, and of everything created before tenants existed
+	DefaultTenantID = "default"
+
+	// Values of clients.refresh_token_policy
+	RefreshTokenPolicyAlways = "always"
+	// Only issue refresh tokens when the user granted the offline_access scope
+	RefreshTokenPolicyOfflineAccess = "offline_access"
+	RefreshTokenPolicyNever         = "never"
+
+	// Returned by every backend when a row isn't found. It's pgx.ErrNoRows so the sqlc backend can return errors as is.
+	ErrNotFound = pgx.ErrNoRows
+
+	logger = gologger.NewLogger()
+)
+
+// Tx is what the OAuth flow needs from the database: clients, scopes, codes, tokens, and consents.
+// The method names and params match the sqlc queries, so the Postgres backend is just *query.Queries.
+// Everything is scoped to a tenant, SQLite and memory only have DefaultTenantID and ignore it.
+type Tx interface {
+	SelectClient(ctx context.Context, arg query.SelectClientParams) (query.Client, error)
+	InsertClient(ctx context.Context, arg query.InsertClientParams) (query.Client, error)
+	UpdateClientSecret(ctx context.Context, arg query.UpdateClientSecretParams) (query.Client, error)
+	UpdateClientTokenPolicy(ctx context.Context, arg query.UpdateClientTokenPolicyParams) (query.Client, error)
+	UpdateClientRateLimit(ctx context.Context, arg query.UpdateClientRateLimitParams) (query.Client, error)
+	UpdateClientRedirectURIs(ctx context.Context, arg query.UpdateClientRedirectURIsParams) (query.Client, error)
+	UpdateClientSuspended(ctx context.Context, arg query.UpdateClientSuspendedParams) (query.Client, error)
+
+	ListScopes(ctx context.Context, tenantID string) ([]query.Scope, error)
+	UpsertScope(ctx context.Context, arg query.UpsertScopeParams) (query.Scope, error)
+
+	InsertAuthorizationCode(ctx context.Context, arg query.InsertAuthorizationCodeParams) error
+	DeleteAuthorizationCode(ctx context.Context, arg query.DeleteAuthorizationCodeParams) (query.AuthorizationCode, error)
+
+	InsertAccessToken(ctx context.Context, arg query.InsertAccessTokenParams) error
+	SelectValidAccessToken(ctx context.Context, arg query.SelectValidAccessTokenParams) (query.AccessToken, error)
+	// The valid tokens out of ids, in no particular order
+	SelectValidAccessTokens(ctx context.Context, arg query.SelectValidAccessTokensParams) ([]query.AccessToken, error)
+	InsertRefreshToken(ctx context.Context, arg query.InsertRefreshTokenParams) error
+	SelectValidRefreshToken(ctx context.Context, arg query.SelectValidRefreshTokenParams) (query.RefreshToken, error)
+	// Might be expired or revoked, reuse detection relies on that
+	SelectRefreshToken(ctx context.Context, arg query.SelectRefreshTokenParams) (query.RefreshToken, error)
+	// Revokes the used refresh token and records its replacement, returns 0 if it was already revoked
+	RotateRefreshToken(ctx context.Context, arg query.RotateRefreshTokenParams) (int64, error)
+	// Records the access tokens' use at most once a minute each, returns the IDs of the ones it did
+	TouchAccessTokens(ctx context.Context, arg query.TouchAccessTokensParams) ([]string, error)
+	RevokeAccessTokensByUserAndClient(ctx context.Context, arg query.RevokeAccessTokensByUserAndClientParams) (int64, error)
+	RevokeRefreshTokensByUserAndClient(ctx context.Context, arg query.RevokeRefreshTokensByUserAndClientParams) (int64, error)
+	// Bulk revocation, each returns how many tokens it revoked
+	RevokeAccessTokensByUserID(ctx context.Context, arg query.RevokeAccessTokensByUserIDParams) (int64, error)
+	RevokeRefreshTokensByUserID(ctx context.Context, arg query.RevokeRefreshTokensByUserIDParams) (int64, error)
+	RevokeAccessTokensByClientID(ctx context.Context, arg query.RevokeAccessTokensByClientIDParams) (int64, error)
+	RevokeRefreshTokensByClientID(ctx context.Context, arg query.RevokeRefreshTokensByClientIDParams) (int64, error)
+	RevokeAccessTokensCreatedBefore(ctx context.Context, arg query.RevokeAccessTokensCreatedBeforeParams) (int64, error)
+	RevokeRefreshTokensCreatedBefore(ctx context.Context, arg query.RevokeRefreshTokensCreatedBeforeParams) (int64, error)
+
+	UpsertConsent(ctx context.Context, arg query.UpsertConsentParams) error
+	ListConsentsByUserID(ctx context.Context, arg query.ListConsentsByUserIDParams) ([]query.Consent, error)
+	DeleteConsent(ctx context.Context, arg query.DeleteConsentParams) (int64, error)
+	TouchConsent(ctx context.Context, arg query.TouchConsentParams) error
+	TouchConsents(ctx context.Context, arg query.TouchConsentsParams) error
+
+	// EnqueueWebhook writes to the webhook outbox in this transaction. Only Postgres has an outbox, it's a no-op elsewhere.
+	EnqueueWebhook(ctx context.Context, tenantID, eventType string, data any) error
+}
+
+type Store interface {
+	// Exec runs f, retrying transient errors where the backend has them
+	Exec(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx Tx) error) error
+	// ExecInTx runs f in a serializable transaction
+	ExecInTx(ctx context.Context, tryTimeout time.Duration, f func(ctx context.Context, tx Tx) error) error
+}
@@ -0,0 +1,452 @@
+package store_test
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/pg/pgtest"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/samber/lo"
+	"github.com/stretchr/testify/require"
+)
+
+// Every backend has to pass the same tests, Postgres runs when TEST_PG_DSN is set
+var backends = []struct {
+	name string
+	open func(t *testing.T) (st store.Store, tenantID string)
+}{
+	{store.KindMemory, func(t *testing.T) (store.Store, string) {
+		return store.NewMemory(), store.DefaultTenantID
+	}},
+	{store.KindSQLite, func(t *testing.T) (store.Store, string) {
+		st, err := store.OpenSQLite(":memory:")
+		require.NoError(t, err)
+		t.Cleanup(func() { st.Close() })
+		return st, store.DefaultTenantID
+	}},
+	{store.KindPostgres, func(t *testing.T) (store.Store, string) {
+		return store.NewPostgres(pgtest.Pool(t), pgtest.IsPostgres()), pgtest.TenantID()
+	}},
+}
+
+type conformance struct {
+	t        *testing.T
+	st       store.Store
+	tenantID string
+}
+
+func TestConformance(t *testing.T) {
+	tests := map[string]func(c conformance){
+		"Clients":            testClients,
+		"AuthorizationCodes": testAuthorizationCodes,
+		"AccessTokens":       testAccessTokens,
+		"RefreshTokens":      testRefreshTokens,
+		"RevokeByUser":       testRevokeByUser,
+		"BulkRevoke":         testBulkRevoke,
+		"Consents":           testConsents,
+		"Rollback":           testRollback,
+	}
+	for _, backend := range backends {
+		backend := backend
+		t.Run(backend.name, func(t *testing.T) {
+			for name, test := range tests {
+				test := test
+				t.Run(name, func(t *testing.T) {
+					st, tenantID := backend.open(t)
+					test(conformance{t: t, st: st, tenantID: tenantID})
+				})
+			}
+		})
+	}
+}
+
+// exec runs f in a transaction and fails the test on an error
+func (c conformance) exec(f func(ctx context.Context, tx store.Tx) error) {
+	c.t.Helper()
+	require.NoError(c.t, c.st.ExecInTx(context.Background(), time.Second*10, f))
+}
+
+func (c conformance) client() string {
+	c.t.Helper()
+	id := utils.GenRandomIDWithSize("c_", 12)
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		_, err := tx.InsertClient(ctx, query.InsertClientParams{TenantID: c.tenantID, ID: id, Secret: "secret", Name: "test"})
+		return err
+	})
+	return id
+}
+
+func (c conformance) accessToken(clientID, userID string, expires time.Time) string {
+	c.t.Helper()
+	id := utils.GenRandomIDWithSize("a_", 16)
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		return tx.InsertAccessToken(ctx, query.InsertAccessTokenParams{
+			TenantID: c.tenantID,
+			ID:       id,
+			ClientID: clientID,
+			UserID:   userID,
+			Scopes:   []string{"read"},
+			Expires:  expires,
+		})
+	})
+	return id
+}
+
+func (c conformance) refreshToken(clientID, userID string) string {
+	c.t.Helper()
+	id := utils.GenRandomIDWithSize("r_", 16)
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		return tx.InsertRefreshToken(ctx, query.InsertRefreshTokenParams{
+			TenantID: c.tenantID,
+			ID:       id,
+			ClientID: clientID,
+			UserID:   userID,
+			Scopes:   []string{"read", "write"},
+			Expires:  time.Now().Add(time.Hour),
+			Claims:   []byte(`{"email":"ada@example.com"}`),
+		})
+	})
+	return id
+}
+
+func testClients(c conformance) {
+	t := c.t
+	id := c.client()
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		client, err := tx.SelectClient(ctx, query.SelectClientParams{TenantID: c.tenantID, ID: id})
+		require.NoError(t, err)
+		require.Equal(t, "secret", client.Secret)
+		require.Equal(t, store.RefreshTokenPolicyAlways, client.RefreshTokenPolicy)
+		require.False(t, client.Suspended)
+		require.Empty(t, client.RedirectUris)
+
+		_, err = tx.InsertClient(ctx, query.InsertClientParams{TenantID: c.tenantID, ID: id, Secret: "other", Name: "dup"})
+		require.Error(t, err)
+		return nil
+	})
+
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		client, err := tx.UpdateClientSecret(ctx, query.UpdateClientSecretParams{TenantID: c.tenantID, ID: id, Secret: "rotated"})
+		require.NoError(t, err)
+		require.Equal(t, "rotated", client.Secret)
+
+		client, err = tx.UpdateClientTokenPolicy(ctx, query.UpdateClientTokenPolicyParams{
+			TenantID:              c.tenantID,
+			ID:                    id,
+			AccessTokenTtlSeconds: utils.Ptr(int64(60)),
+			RefreshTokenPolicy:    store.RefreshTokenPolicyNever,
+		})
+		require.NoError(t, err)
+		require.Equal(t, int64(60), *client.AccessTokenTtlSeconds)
+		require.Nil(t, client.RefreshTokenTtlSeconds)
+		require.Equal(t, store.RefreshTokenPolicyNever, client.RefreshTokenPolicy)
+
+		client, err = tx.UpdateClientRedirectURIs(ctx, query.UpdateClientRedirectURIsParams{
+			TenantID:     c.tenantID,
+			ID:           id,
+			RedirectUris: []string{"https://a.example.com/cb", "myapp://cb"},
+		})
+		require.NoError(t, err)
+		require.Equal(t, []string{"https://a.example.com/cb", "myapp://cb"}, client.RedirectUris)
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{TenantID: c.tenantID, ID: id})
+		require.NoError(t, err)
+		require.Equal(t, []string{"https://a.example.com/cb", "myapp://cb"}, client.RedirectUris)
+
+		client, err = tx.UpdateClientSuspended(ctx, query.UpdateClientSuspendedParams{TenantID: c.tenantID, ID: id, Suspended: true})
+		require.NoError(t, err)
+		require.True(t, client.Suspended)
+		client, err = tx.SelectClient(ctx, query.SelectClientParams{TenantID: c.tenantID, ID: id})
+		require.NoError(t, err)
+		require.True(t, client.Suspended)
+
+		_, err = tx.SelectClient(ctx, query.SelectClientParams{TenantID: c.tenantID, ID: "missing"})
+		require.ErrorIs(t, err, store.ErrNotFound)
+		_, err = tx.UpdateClientSecret(ctx, query.UpdateClientSecretParams{TenantID: c.tenantID, ID: "missing", Secret: "s"})
+		require.ErrorIs(t, err, store.ErrNotFound)
+		return nil
+	})
+}
+
+func testAuthorizationCodes(c conformance) {
+	t := c.t
+	clientID := c.client()
+	id := utils.GenRandomIDWithSize("ac_", 16)
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		return tx.InsertAuthorizationCode(ctx, query.InsertAuthorizationCodeParams{
+			TenantID:              c.tenantID,
+			ID:                    id,
+			UserID:                "u1",
+			ClientID:              clientID,
+			Scopes:                []string{"read"},
+			Expires:               time.Now().Add(time.Minute),
+			AccessTokenTtlSeconds: utils.Ptr(int64(30)),
+			RedirectUri:           utils.Ptr("https://app.example.com/callback"),
+		})
+	})
+
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		code, err := tx.DeleteAuthorizationCode(ctx, query.DeleteAuthorizationCodeParams{TenantID: c.tenantID, ID: id})
+		require.NoError(t, err)
+		require.Equal(t, "u1", code.UserID)
+		require.Equal(t, []string{"read"}, code.Scopes)
+		require.Equal(t, int64(30), *code.AccessTokenTtlSeconds)
+		require.Equal(t, "https://app.example.com/callback", *code.RedirectUri)
+
+		// Codes are single use
+		_, err = tx.DeleteAuthorizationCode(ctx, query.DeleteAuthorizationCodeParams{TenantID: c.tenantID, ID: id})
+		require.ErrorIs(t, err, store.ErrNotFound)
+
+		err = tx.InsertAuthorizationCode(ctx, query.InsertAuthorizationCodeParams{
+			TenantID: c.tenantID,
+			ID:       utils.GenRandomIDWithSize("ac_", 16),
+			ClientID: "missing",
+			Expires:  time.Now().Add(time.Minute),
+		})
+		require.Error(t, err)
+		return nil
+	})
+}
+
+func testAccessTokens(c conformance) {
+	t := c.t
+	clientID := c.client()
+	valid := c.accessToken(clientID, "u1", time.Now().Add(time.Hour))
+	other := c.accessToken(clientID, "u2", time.Now().Add(time.Hour))
+	expired := c.accessToken(clientID, "u1", time.Now().Add(-time.Second))
+
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		token, err := tx.SelectValidAccessToken(ctx, query.SelectValidAccessTokenParams{TenantID: c.tenantID, ID: valid})
+		require.NoError(t, err)
+		require.Equal(t, clientID, token.ClientID)
+		require.Equal(t, []string{"read"}, token.Scopes)
+		require.Nil(t, token.LastUsed)
+
+		_, err = tx.SelectValidAccessToken(ctx, query.SelectValidAccessTokenParams{TenantID: c.tenantID, ID: expired})
+		require.ErrorIs(t, err, store.ErrNotFound)
+
+		tokens, err := tx.SelectValidAccessTokens(ctx, query.SelectValidAccessTokensParams{TenantID: c.tenantID, Ids: []string{valid, expired, valid, "missing"}})
+		require.NoError(t, err)
+		require.Len(t, tokens, 1)
+		require.Equal(t, valid, tokens[0].ID)
+
+		// At most once a minute
+		touched, err := tx.TouchAccessTokens(ctx, query.TouchAccessTokensParams{TenantID: c.tenantID, Ids: []string{valid}})
+		require.NoError(t, err)
+		require.Equal(t, []string{valid}, touched)
+		touched, err = tx.TouchAccessTokens(ctx, query.TouchAccessTokensParams{TenantID: c.tenantID, Ids: []string{valid, other, "missing"}})
+		require.NoError(t, err)
+		require.Equal(t, []string{other}, touched)
+		touched, err = tx.TouchAccessTokens(ctx, query.TouchAccessTokensParams{TenantID: c.tenantID, Ids: []string{valid, other}})
+		require.NoError(t, err)
+		require.Empty(t, touched)
+
+		token, err = tx.SelectValidAccessToken(ctx, query.SelectValidAccessTokenParams{TenantID: c.tenantID, ID: valid})
+		require.NoError(t, err)
+		require.NotNil(t, token.LastUsed)
+		return nil
+	})
+}
+
+func testRefreshTokens(c conformance) {
+	t := c.t
+	clientID := c.client()
+	id := c.refreshToken(clientID, "u1")
+	next := c.refreshToken(clientID, "u1")
+
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		token, err := tx.SelectValidRefreshToken(ctx, query.SelectValidRefreshTokenParams{TenantID: c.tenantID, ID: id})
+		require.NoError(t, err)
+		require.Equal(t, []string{"read", "write"}, token.Scopes)
+		require.JSONEq(t, `{"email":"ada@example.com"}`, string(token.Claims))
+
+		rotated, err := tx.RotateRefreshToken(ctx, query.RotateRefreshTokenParams{TenantID: c.tenantID, ID: id, ReplacedBy: &next})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, rotated)
+
+		// Only the first rotation wins
+		rotated, err = tx.RotateRefreshToken(ctx, query.RotateRefreshTokenParams{TenantID: c.tenantID, ID: id, ReplacedBy: &next})
+		require.NoError(t, err)
+		require.EqualValues(t, 0, rotated)
+
+		_, err = tx.SelectValidRefreshToken(ctx, query.SelectValidRefreshTokenParams{TenantID: c.tenantID, ID: id})
+		require.ErrorIs(t, err, store.ErrNotFound)
+
+		token, err = tx.SelectRefreshToken(ctx, query.SelectRefreshTokenParams{TenantID: c.tenantID, ID: id})
+		require.NoError(t, err)
+		require.True(t, token.Revoked)
+		require.Equal(t, next, *token.ReplacedBy)
+		require.NotNil(t, token.LastUsed)
+
+		_, err = tx.SelectRefreshToken(ctx, query.SelectRefreshTokenParams{TenantID: c.tenantID, ID: "missing"})
+		require.ErrorIs(t, err, store.ErrNotFound)
+		return nil
+	})
+}
+
+func testRevokeByUser(c conformance) {
+	t := c.t
+	clientID := c.client()
+	otherClientID := c.client()
+	c.accessToken(clientID, "u1", time.Now().Add(time.Hour))
+	c.accessToken(clientID, "u1", time.Now().Add(time.Hour))
+	other := c.accessToken(otherClientID, "u1", time.Now().Add(time.Hour))
+	refreshToken := c.refreshToken(clientID, "u1")
+
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		revoked, err := tx.RevokeAccessTokensByUserAndClient(ctx, query.RevokeAccessTokensByUserAndClientParams{TenantID: c.tenantID, UserID: "u1", ClientID: clientID})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, revoked)
+		revoked, err = tx.RevokeRefreshTokensByUserAndClient(ctx, query.RevokeRefreshTokensByUserAndClientParams{TenantID: c.tenantID, UserID: "u1", ClientID: clientID})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, revoked)
+
+		_, err = tx.SelectValidAccessToken(ctx, query.SelectValidAccessTokenParams{TenantID: c.tenantID, ID: other})
+		require.NoError(t, err)
+
+		// Revoked without a replacement, so it isn't treated as reuse
+		token, err := tx.SelectRefreshToken(ctx, query.SelectRefreshTokenParams{TenantID: c.tenantID, ID: refreshToken})
+		require.NoError(t, err)
+		require.True(t, token.Revoked)
+		require.Nil(t, token.ReplacedBy)
+		return nil
+	})
+}
+
+func testBulkRevoke(c conformance) {
+	t := c.t
+	clientID := c.client()
+	otherClientID := c.client()
+	userID := utils.GenRandomIDWithSize("u_", 12)
+	old := c.accessToken(otherClientID, "u2", time.Now().Add(time.Hour))
+	oldRefreshToken := c.refreshToken(otherClientID, "u2")
+	time.Sleep(time.Millisecond * 10)
+	before := time.Now()
+	time.Sleep(time.Millisecond * 10)
+	c.accessToken(clientID, userID, time.Now().Add(time.Hour))
+	c.refreshToken(clientID, userID)
+	c.accessToken(clientID, "u2", time.Now().Add(time.Hour))
+	otherUser := c.accessToken(otherClientID, userID, time.Now().Add(time.Hour))
+
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		revoked, err := tx.RevokeAccessTokensByClientID(ctx, query.RevokeAccessTokensByClientIDParams{TenantID: c.tenantID, ClientID: clientID})
+		require.NoError(t, err)
+		require.EqualValues(t, 2, revoked)
+		revoked, err = tx.RevokeRefreshTokensByClientID(ctx, query.RevokeRefreshTokensByClientIDParams{TenantID: c.tenantID, ClientID: clientID})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, revoked)
+
+		// Already revoked tokens aren't counted again
+		revoked, err = tx.RevokeAccessTokensByUserID(ctx, query.RevokeAccessTokensByUserIDParams{TenantID: c.tenantID, UserID: userID})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, revoked)
+		revoked, err = tx.RevokeRefreshTokensByUserID(ctx, query.RevokeRefreshTokensByUserIDParams{TenantID: c.tenantID, UserID: userID})
+		require.NoError(t, err)
+		require.Zero(t, revoked)
+		_, err = tx.SelectValidAccessToken(ctx, query.SelectValidAccessTokenParams{TenantID: c.tenantID, ID: otherUser})
+		require.ErrorIs(t, err, store.ErrNotFound)
+
+		_, err = tx.SelectValidAccessToken(ctx, query.SelectValidAccessTokenParams{TenantID: c.tenantID, ID: old})
+		require.NoError(t, err)
+		revoked, err = tx.RevokeAccessTokensCreatedBefore(ctx, query.RevokeAccessTokensCreatedBeforeParams{TenantID: c.tenantID, Before: before})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, revoked)
+		revoked, err = tx.RevokeRefreshTokensCreatedBefore(ctx, query.RevokeRefreshTokensCreatedBeforeParams{TenantID: c.tenantID, Before: before})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, revoked)
+		_, err = tx.SelectValidRefreshToken(ctx, query.SelectValidRefreshTokenParams{TenantID: c.tenantID, ID: oldRefreshToken})
+		require.ErrorIs(t, err, store.ErrNotFound)
+		return nil
+	})
+}
+
+func testConsents(c conformance) {
+	t := c.t
+	clientID := c.client()
+	otherClientID := c.client()
+	userID := utils.GenRandomIDWithSize("u_", 12)
+	otherUserID := utils.GenRandomIDWithSize("u_", 12)
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		require.NoError(t, tx.UpsertConsent(ctx, query.UpsertConsentParams{TenantID: c.tenantID, UserID: userID, ClientID: clientID, Scopes: []string{"read"}}))
+		require.NoError(t, tx.UpsertConsent(ctx, query.UpsertConsentParams{TenantID: c.tenantID, UserID: userID, ClientID: clientID, Scopes: []string{"read", "write"}}))
+		require.NoError(t, tx.TouchConsent(ctx, query.TouchConsentParams{TenantID: c.tenantID, UserID: userID, ClientID: clientID}))
+
+		consents, err := tx.ListConsentsByUserID(ctx, query.ListConsentsByUserIDParams{TenantID: c.tenantID, UserID: userID})
+		require.NoError(t, err)
+		require.Len(t, consents, 1)
+		require.Equal(t, []string{"read", "write"}, consents[0].Scopes)
+		require.NotNil(t, consents[0].LastUsed)
+
+		// Touched together, and only the pairs given
+		for _, consent := range []query.UpsertConsentParams{
+			{TenantID: c.tenantID, UserID: otherUserID, ClientID: clientID},
+			{TenantID: c.tenantID, UserID: otherUserID, ClientID: otherClientID},
+		} {
+			require.NoError(t, tx.UpsertConsent(ctx, consent))
+		}
+		require.NoError(t, tx.TouchConsents(ctx, query.TouchConsentsParams{
+			TenantID:  c.tenantID,
+			UserIds:   []string{userID, otherUserID},
+			ClientIds: []string{otherClientID, clientID},
+		}))
+		consents, err = tx.ListConsentsByUserID(ctx, query.ListConsentsByUserIDParams{TenantID: c.tenantID, UserID: otherUserID})
+		require.NoError(t, err)
+		lastUsed := lo.SliceToMap(consents, func(item query.Consent) (string, bool) {
+			return item.ClientID, item.LastUsed != nil
+		})
+		require.Equal(t, map[string]bool{clientID: true, otherClientID: false}, lastUsed)
+
+		deleted, err := tx.DeleteConsent(ctx, query.DeleteConsentParams{TenantID: c.tenantID, UserID: userID, ClientID: clientID})
+		require.NoError(t, err)
+		require.EqualValues(t, 1, deleted)
+		deleted, err = tx.DeleteConsent(ctx, query.DeleteConsentParams{TenantID: c.tenantID, UserID: userID, ClientID: clientID})
+		require.NoError(t, err)
+		require.EqualValues(t, 0, deleted)
+		return nil
+	})
+}
+
+func testRollback(c conformance) {
+	t := c.t
+	clientID := c.client()
+	refreshToken := c.refreshToken(clientID, "u1")
+	userID := utils.GenRandomIDWithSize("u_", 12)
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		return tx.UpsertConsent(ctx, query.UpsertConsentParams{TenantID: c.tenantID, UserID: userID, ClientID: clientID, Scopes: []string{"read"}})
+	})
+
+	errRollback := errors.New("roll back")
+	newClientID := utils.GenRandomIDWithSize("c_", 12)
+	err := c.st.ExecInTx(context.Background(), time.Second*10, func(ctx context.Context, tx store.Tx) error {
+		_, err := tx.InsertClient(ctx, query.InsertClientParams{TenantID: c.tenantID, ID: newClientID, Secret: "s", Name: "new"})
+		require.NoError(t, err)
+		_, err = tx.UpdateClientSecret(ctx, query.UpdateClientSecretParams{TenantID: c.tenantID, ID: clientID, Secret: "changed"})
+		require.NoError(t, err)
+		_, err = tx.RotateRefreshToken(ctx, query.RotateRefreshTokenParams{TenantID: c.tenantID, ID: refreshToken})
+		require.NoError(t, err)
+		_, err = tx.DeleteConsent(ctx, query.DeleteConsentParams{TenantID: c.tenantID, UserID: userID, ClientID: clientID})
+		require.NoError(t, err)
+		// Writing the same row twice still rolls back to the first version
+		_, err = tx.UpdateClientSecret(ctx, query.UpdateClientSecretParams{TenantID: c.tenantID, ID: clientID, Secret: "changed again"})
+		require.NoError(t, err)
+		return errRollback
+	})
+	require.ErrorIs(t, err, errRollback)
+
+	c.exec(func(ctx context.Context, tx store.Tx) error {
+		_, err := tx.SelectClient(ctx, query.SelectClientParams{TenantID: c.tenantID, ID: newClientID})
+		require.ErrorIs(t, err, store.ErrNotFound)
+		client, err := tx.SelectClient(ctx, query.SelectClientParams{TenantID: c.tenantID, ID: clientID})
+		require.NoError(t, err)
+		require.Equal(t, "secret", client.Secret)
+		_, err = tx.SelectValidRefreshToken(ctx, query.SelectValidRefreshTokenParams{TenantID: c.tenantID, ID: refreshToken})
+		require.NoError(t, err)
+		consents, err := tx.ListConsentsByUserID(ctx, query.ListConsentsByUserIDParams{TenantID: c.tenantID, UserID: userID})
+		require.NoError(t, err)
+		require.Len(t, consents, 1)
+		return nil
+	})
+}
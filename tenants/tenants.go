@@ -0,0 +1,217 @@
+// Package tenants lets one deployment serve many OAuth providers. Each tenant has its own clients, scopes, tokens,
+// admin keys, and webhooks, and can have its own provider API and issuer. Requests are matched to a tenant by host
+// or by a /<tenant id> path prefix.
+package tenants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/provider_api"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	// Everything is the default tenant
+	ModeSingle = "single"
+	// The tenant with the request's host
+	ModeHost = "host"
+	// The tenant in the first path segment, e.g. /acme/oauth2/token
+	ModePath = "path"
+
+	ErrNotFound = errors.New("tenant not found")
+
+	// After a failed reload the next waits 1s, then 2s, 4s... up to this
+	maxReloadBackoff = time.Minute
+
+	logger = gologger.NewLogger()
+)
+
+// Tenant is what the handlers need to serve a tenant, with the server's settings filled in where it has none
+type Tenant struct {
+	ID   string
+	Name string
+	// Optional, returned from introspection and userinfo
+	Issuer          string
+	UserExchanger   provider_api.UserExchanger
+	PreIssuanceHook provider_api.PreIssuanceHook
+}
+
+// Registry looks tenants up from the tenants table. It loads the whole table and keeps it for a while, so a changed
+// tenant takes up to the TTL to be noticed. Reloads happen in the background, lookups keep using the tenants already
+// loaded until they finish.
+type Registry struct {
+	// Lists every tenant, from the pool outside of tests
+	listTenants func(ctx context.Context) ([]query.Tenant, error)
+	mode        string
+	ttl         time.Duration
+	// The server's provider settings, for tenants that don't have their own
+	defaults provider_api.Options
+	issuer   string
+
+	mu     sync.Mutex
+	loaded time.Time
+	// Closed when the reload in progress finishes, nil if there isn't one
+	reloading chan struct{}
+	// Set by a failed reload, cleared by a successful one. No reload starts before retryAt.
+	loadErr  error
+	failures int
+	retryAt  time.Time
+	byID     map[string]*Tenant
+	byHost   map[string]*Tenant
+	// Kept across reloads so the circuit breakers remember, replaced when the tenant's options change
+	clients map[string]providerClient
+}
+
+type providerClient struct {
+	opts   provider_api.Options
+	client *provider_api.Client
+}
+
+// NewRegistry resolves tenants with mode, host or path. defaults and issuer are used where a tenant has no
+// provider settings or issuer.
+func NewRegistry(pool *pgxpool.Pool, mode string, ttl time.Duration, defaults provider_api.Options, issuer string) *Registry {
+	return &Registry{
+		listTenants: func(ctx context.Context) (rows []query.Tenant, err error) {
+			err = query.ReliableExec(ctx, pool, time.Second*5, func(ctx context.Context, q *query.Queries) (err error) {
+				rows, err = q.ListTenants(ctx)
+				if err != nil {
+					return fmt.Errorf("error in ListTenants: %w", err)
+				}
+				return nil
+			})
+			return rows, err
+		},
+		mode:     mode,
+		ttl:      ttl,
+		defaults: defaults,
+		issuer:   issuer,
+		clients:  map[string]providerClient{},
+	}
+}
+
+func (r *Registry) Mode() string {
+	return r.mode
+}
+
+// ByID returns ErrNotFound if there's no such tenant
+func (r *Registry) ByID(ctx context.Context, id string) (*Tenant, error) {
+	return r.lookup(ctx, func() *Tenant {
+		return r.byID[id]
+	})
+}
+
+// ByHost ignores the port and case, it returns ErrNotFound if no tenant has the host
+func (r *Registry) ByHost(ctx context.Context, host string) (*Tenant, error) {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(host)
+	return r.lookup(ctx, func() *Tenant {
+		return r.byHost[host]
+	})
+}
+
+// lookup starts a reload once the tenants are older than the TTL. Only the first load is waited for, after that
+// lookups use the tenants already loaded while it runs.
+func (r *Registry) lookup(ctx context.Context, find func() *Tenant) (*Tenant, error) {
+	r.mu.Lock()
+	now := time.Now()
+	if r.reloading == nil && now.Sub(r.loaded) > r.ttl && !now.Before(r.retryAt) {
+		r.reloading = make(chan struct{})
+		go r.reload(r.reloading)
+	}
+	reloading, loaded := r.reloading, r.byID != nil
+	r.mu.Unlock()
+
+	if !loaded && reloading != nil {
+		select {
+		case <-reloading:
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.byID == nil {
+		// The first load failed, and we're backing off before trying again
+		return nil, r.loadErr
+	}
+	t := find()
+	if t == nil {
+		return nil, ErrNotFound
+	}
+	return t, nil
+}
+
+// reload loads the tenants without holding r.mu, then replaces them and closes done. A failure keeps the tenants
+// already loaded, and backs off before the next try.
+func (r *Registry) reload(done chan struct{}) {
+	// Not the request's context, the reload outlives it
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*10)
+	defer cancel()
+	rows, err := r.listTenants(ctx)
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	defer close(done)
+	r.reloading = nil
+	if err != nil {
+		backoff := maxReloadBackoff
+		if r.failures < 16 && time.Second<<r.failures < maxReloadBackoff {
+			backoff = time.Second << r.failures
+		}
+		r.failures++
+		r.loadErr = err
+		r.retryAt = time.Now().Add(backoff)
+		// Better to keep serving the tenants we know than fail every request
+		logger.Error().Err(err).Bool("haveTenants", r.byID != nil).Dur("retryIn", backoff).Msg("error loading tenants")
+		return
+	}
+	r.loadErr, r.failures, r.retryAt = nil, 0, time.Time{}
+	r.replace(rows)
+}
+
+// replace swaps in the tenants from rows, r.mu must be held
+func (r *Registry) replace(rows []query.Tenant) {
+	byID := map[string]*Tenant{}
+	byHost := map[string]*Tenant{}
+	clients := map[string]providerClient{}
+	for _, row := range rows {
+		opts := r.defaults
+		opts.UserExchangeURL = utils.Deref(row.ProviderUserExchangeUrl, opts.UserExchangeURL)
+		opts.PreIssuanceHookURL = utils.Deref(row.ProviderPreIssuanceHookUrl, opts.PreIssuanceHookURL)
+		opts.Secret = utils.Deref(row.ProviderSecret, opts.Secret)
+		pc, ok := r.clients[row.ID]
+		if !ok || pc.opts != opts {
+			pc = providerClient{opts: opts, client: provider_api.NewClient(opts)}
+		}
+		clients[row.ID] = pc
+
+		t := &Tenant{
+			ID:            row.ID,
+			Name:          row.Name,
+			Issuer:        utils.Deref(row.Issuer, r.issuer),
+			UserExchanger: pc.client,
+		}
+		if opts.PreIssuanceHookURL != "" {
+			t.PreIssuanceHook = pc.client
+		}
+		byID[t.ID] = t
+		if row.Host != nil {
+			byHost[strings.ToLower(*row.Host)] = t
+		}
+	}
+	r.byID, r.byHost, r.clients = byID, byHost, clients
+	r.loaded = time.Now()
+	logger.Debug().Int("tenants", len(byID)).Msg("loaded tenants")
+}
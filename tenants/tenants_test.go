@@ -0,0 +1,127 @@
+package tenants
+
+import (
+	"context"
+	"errors"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/provider_api"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/stretchr/testify/require"
+)
+
+// tenantsTable stands in for the tenants table, list blocks while it's paused
+type tenantsTable struct {
+	calls  int64
+	fail   int32
+	paused chan struct{}
+}
+
+func (tt *tenantsTable) list(ctx context.Context) ([]query.Tenant, error) {
+	atomic.AddInt64(&tt.calls, 1)
+	if tt.paused != nil {
+		<-tt.paused
+	}
+	if atomic.LoadInt32(&tt.fail) == 1 {
+		return nil, errors.New("database unavailable")
+	}
+	return []query.Tenant{{ID: "acme", Name: "Acme", Host: utils.Ptr("auth.acme.com")}}, nil
+}
+
+func newTestRegistry(tt *tenantsTable, ttl time.Duration) *Registry {
+	r := NewRegistry(nil, ModeHost, ttl, provider_api.Options{}, "")
+	r.listTenants = tt.list
+	return r
+}
+
+// waitForReload waits for the reload in progress, if there is one
+func waitForReload(r *Registry) {
+	r.mu.Lock()
+	reloading := r.reloading
+	r.mu.Unlock()
+	if reloading != nil {
+		<-reloading
+	}
+}
+
+func TestRegistryLookup(t *testing.T) {
+	tt := &tenantsTable{}
+	r := newTestRegistry(tt, time.Hour)
+	ctx := context.Background()
+
+	tenant, err := r.ByHost(ctx, "AUTH.acme.com:443")
+	require.NoError(t, err)
+	require.Equal(t, "acme", tenant.ID)
+	_, err = r.ByID(ctx, "other")
+	require.ErrorIs(t, err, ErrNotFound)
+	require.EqualValues(t, 1, atomic.LoadInt64(&tt.calls))
+}
+
+func TestRegistryReloadsInBackground(t *testing.T) {
+	tt := &tenantsTable{}
+	r := newTestRegistry(tt, time.Millisecond)
+	ctx := context.Background()
+	_, err := r.ByID(ctx, "acme")
+	require.NoError(t, err)
+
+	// A stale lookup starts a reload, but doesn't wait for it
+	tt.paused = make(chan struct{})
+	time.Sleep(time.Millisecond * 2)
+	for i := 0; i < 3; i++ {
+		tenant, err := r.ByID(ctx, "acme")
+		require.NoError(t, err)
+		require.Equal(t, "acme", tenant.ID)
+	}
+	close(tt.paused)
+	waitForReload(r)
+	require.EqualValues(t, 2, atomic.LoadInt64(&tt.calls))
+}
+
+func TestRegistryBacksOff(t *testing.T) {
+	tt := &tenantsTable{}
+	r := newTestRegistry(tt, time.Millisecond)
+	ctx := context.Background()
+	_, err := r.ByID(ctx, "acme")
+	require.NoError(t, err)
+
+	// The failed reload keeps the tenants already loaded, and isn't tried again until the backoff is over
+	atomic.StoreInt32(&tt.fail, 1)
+	time.Sleep(time.Millisecond * 2)
+	_, err = r.ByID(ctx, "acme")
+	require.NoError(t, err)
+	waitForReload(r)
+	for i := 0; i < 3; i++ {
+		_, err = r.ByID(ctx, "acme")
+		require.NoError(t, err)
+	}
+	require.EqualValues(t, 2, atomic.LoadInt64(&tt.calls))
+
+	r.mu.Lock()
+	require.Equal(t, 1, r.failures)
+	r.retryAt = time.Now()
+	r.mu.Unlock()
+	atomic.StoreInt32(&tt.fail, 0)
+	_, err = r.ByID(ctx, "acme")
+	require.NoError(t, err)
+	waitForReload(r)
+	r.mu.Lock()
+	require.Zero(t, r.failures)
+	r.mu.Unlock()
+}
+
+func TestRegistryFirstLoadFails(t *testing.T) {
+	tt := &tenantsTable{fail: 1}
+	r := newTestRegistry(tt, time.Hour)
+	ctx := context.Background()
+
+	_, err := r.ByID(ctx, "acme")
+	require.Error(t, err)
+	require.NotErrorIs(t, err, ErrNotFound)
+	// Backing off, so the same error without another query
+	_, err = r.ByID(ctx, "acme")
+	require.Error(t, err)
+	require.EqualValues(t, 1, atomic.LoadInt64(&tt.calls))
+}
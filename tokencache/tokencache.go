@@ -0,0 +1,116 @@
+// Package tokencache is an in-process LRU cache of valid access tokens for introspection. Entries are dropped when the
+// token expires or after the cache's max age, whichever is first, and revocation.Notice evicts revoked tokens.
+package tokencache
+
+import (
+	"container/list"
+	"sync"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+)
+
+type Cache struct {
+	size   int
+	maxAge time.Duration
+
+	mu      sync.Mutex
+	entries map[string]*list.Element
+	// Most recently used at the front
+	lru *list.List
+	// Bumped by every eviction, see Generation
+	generation uint64
+}
+
+type entry struct {
+	accessToken query.AccessToken
+	expires     time.Time
+}
+
+// New holds up to size tokens, each for at most maxAge. maxAge is how long a revocation can go unnoticed when
+// notices aren't delivered.
+func New(size int, maxAge time.Duration) *Cache {
+	return &Cache{
+		size:    size,
+		maxAge:  maxAge,
+		entries: map[string]*list.Element{},
+		lru:     list.New(),
+	}
+}
+
+// Get returns the token if it's cached and hasn't expired
+func (c *Cache) Get(id string) (query.AccessToken, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	elem, ok := c.entries[id]
+	if !ok {
+		return query.AccessToken{}, false
+	}
+	e := elem.Value.(*entry)
+	if !time.Now().Before(e.expires) {
+		c.remove(elem)
+		return query.AccessToken{}, false
+	}
+	c.lru.MoveToFront(elem)
+	return e.accessToken, true
+}
+
+// Generation changes whenever tokens are evicted. Get it before reading the token from the store and pass it to Add,
+// so a token revoked while it was being read isn't cached.
+func (c *Cache) Generation() uint64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.generation
+}
+
+// Add caches the token, or replaces the cached copy, unless there was an eviction since generation
+func (c *Cache) Add(accessToken query.AccessToken, generation uint64) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if generation != c.generation {
+		return
+	}
+	expires := time.Now().Add(c.maxAge)
+	if accessToken.Expires.Before(expires) {
+		expires = accessToken.Expires
+	}
+	if elem, ok := c.entries[accessToken.ID]; ok {
+		elem.Value = &entry{accessToken: accessToken, expires: expires}
+		c.lru.MoveToFront(elem)
+		return
+	}
+	c.entries[accessToken.ID] = c.lru.PushFront(&entry{accessToken: accessToken, expires: expires})
+	for c.lru.Len() > c.size {
+		c.remove(c.lru.Back())
+	}
+}
+
+// Evict drops every token matching the notice, returning how many were dropped. It checks every entry, revocations
+// are rare enough that an index per field isn't worth it.
+func (c *Cache) Evict(notice revocation.Notice) int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.generation++
+	evicted := 0
+	for elem := c.lru.Front(); elem != nil; {
+		next := elem.Next()
+		if notice.Matches(elem.Value.(*entry).accessToken) {
+			c.remove(elem)
+			evicted++
+		}
+		elem = next
+	}
+	return evicted
+}
+
+func (c *Cache) Len() int {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.lru.Len()
+}
+
+func (c *Cache) remove(elem *list.Element) {
+	c.lru.Remove(elem)
+	delete(c.entries, elem.Value.(*entry).accessToken.ID)
+}
@@ -0,0 +1,473 @@
+package utils
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+var ErrNotStruct = errors.New("not a struct")
+
+type (
+	// Config is the server's config. It's read from the YAML file at CONFIG_FILE if set, then each field's env var
+	// overrides it. Secrets can also be read from the file at <ENV VAR>_FILE, e.g. ADMIN_KEY_FILE.
+	Config struct {
+		Env string `yaml:"env" env:"ENV"`
+		// Has every admin permission, used to bootstrap scoped keys
+		AdminKey string `yaml:"admin_key" env:"ADMIN_KEY" secret:"true"`
+		// Optional, returned from introspection and userinfo as iss. Tenants can override it.
+		Issuer string `yaml:"issuer" env:"ISSUER"`
+
+		HTTP          HTTPConfig          `yaml:"http"`
+		Store         StoreConfig         `yaml:"store"`
+		Provider      ProviderConfig      `yaml:"provider"`
+		Tokens        TokensConfig        `yaml:"tokens"`
+		Introspection IntrospectionConfig `yaml:"introspection"`
+		RateLimits    RateLimitsConfig    `yaml:"rate_limits"`
+		Janitor       JanitorConfig       `yaml:"janitor"`
+		Metrics       MetricsConfig       `yaml:"metrics"`
+		Temporal      TemporalConfig      `yaml:"temporal"`
+		Webhooks      WebhooksConfig      `yaml:"webhooks"`
+		Tenants       TenantsConfig       `yaml:"tenants"`
+	}
+
+	HTTPConfig struct {
+		Port string `yaml:"port" env:"HTTP_PORT"`
+		// Metrics are served here, keep it off the public network
+		InternalAddr string `yaml:"internal_addr" env:"INTERNAL_HTTP_ADDR"`
+		// For AWS ALB needing some time to de-register the pod
+		ShutdownSleepSeconds int64 `yaml:"shutdown_sleep_seconds" env:"SHUTDOWN_SLEEP_SEC"`
+		// Comma separated CIDRs of proxies whose X-Forwarded-For is believed, on top of private and loopback addresses
+		TrustedProxies string `yaml:"trusted_proxies" env:"TRUSTED_PROXIES"`
+	}
+
+	StoreConfig struct {
+		// postgres, sqlite, or memory
+		Kind       string `yaml:"kind" env:"STORE"`
+		PGDSN      string `yaml:"pg_dsn" env:"PG_DSN" secret:"true"`
+		PGMaxConns int64  `yaml:"pg_max_conns" env:"PG_MAX_CONNS"`
+		PGMinConns int64  `yaml:"pg_min_conns" env:"PG_MIN_CONNS"`
+		IsPostgres bool   `yaml:"is_postgres" env:"IS_POSTGRES"`
+		// Apply pending migrations at startup
+		AutoMigrate bool   `yaml:"auto_migrate" env:"AUTO_MIGRATE"`
+		SQLitePath  string `yaml:"sqlite_path" env:"SQLITE_PATH"`
+	}
+
+	ProviderConfig struct {
+		UserExchangeURL        string `yaml:"user_exchange_url" env:"PROVIDER_USER_EXCHANGE_URL"`
+		PreIssuanceHookURL     string `yaml:"pre_issuance_hook_url" env:"PRE_ISSUANCE_HOOK_URL"`
+		Secret                 string `yaml:"secret" env:"PROVIDER_SECRET" secret:"true"`
+		TimeoutMS              int64  `yaml:"timeout_ms" env:"PROVIDER_TIMEOUT_MS"`
+		MaxRetries             int64  `yaml:"max_retries" env:"PROVIDER_MAX_RETRIES"`
+		BreakerFailures        int64  `yaml:"breaker_failures" env:"PROVIDER_BREAKER_FAILURES"`
+		BreakerCooldownSeconds int64  `yaml:"breaker_cooldown_seconds" env:"PROVIDER_BREAKER_COOLDOWN_SECONDS"`
+	}
+
+	TokensConfig struct {
+		AccessTokenExpireSeconds  int64 `yaml:"access_token_expire_seconds" env:"ACCESS_TOKEN_EXPIRE_SECONDS"`
+		RefreshTokenExpireSeconds int64 `yaml:"refresh_token_expire_seconds" env:"REFRESH_TOKEN_EXPIRE_SECONDS"`
+		// Refresh tokens unused for this long expire, 0 disables. Clients can override it.
+		RefreshTokenIdleSeconds        int64 `yaml:"refresh_token_idle_seconds" env:"REFRESH_TOKEN_IDLE_SECONDS"`
+		AuthorizationCodeExpireSeconds int64 `yaml:"authorization_code_expire_seconds" env:"AUTHORIZATION_CODE_EXPIRE_SECONDS"`
+	}
+
+	IntrospectionConfig struct {
+		// Valid access tokens cached per replica, 0 disables the cache
+		CacheSize int64 `yaml:"cache_size" env:"INTROSPECTION_CACHE_SIZE"`
+		// The longest a token stays cached. Revocations are sent to the other replicas with Postgres LISTEN/NOTIFY, on CRDB
+		// this is how long other replicas can keep accepting a revoked token.
+		CacheTTLSeconds int64 `yaml:"cache_ttl_seconds" env:"INTROSPECTION_CACHE_TTL_SECONDS"`
+	}
+
+	// RateLimitsConfig throttles /oauth2/authorize and /oauth2/token per IP and per client
+	RateLimitsConfig struct {
+		// memory or postgres, postgres shares the counters between replicas. Empty picks postgres with the postgres
+		// store and memory otherwise.
+		Counters string `yaml:"counters" env:"RATE_LIMIT_COUNTERS"`
+		// 0 for either disables the limit
+		IPPerMinute int64 `yaml:"ip_per_minute" env:"RATE_LIMIT_IP_PER_MINUTE"`
+		IPBurst     int64 `yaml:"ip_burst" env:"RATE_LIMIT_IP_BURST"`
+		// Clients can override these
+		ClientPerMinute int64 `yaml:"client_per_minute" env:"RATE_LIMIT_CLIENT_PER_MINUTE"`
+		ClientBurst     int64 `yaml:"client_burst" env:"RATE_LIMIT_CLIENT_BURST"`
+		// invalid_grant, unauthorized_client, and invalid_client errors within the window before the IP, or the IP for
+		// one client, is locked out, 0 disables
+		IPMaxFailures        int64 `yaml:"ip_max_failures" env:"RATE_LIMIT_IP_MAX_FAILURES"`
+		IPClientMaxFailures  int64 `yaml:"ip_client_max_failures" env:"RATE_LIMIT_IP_CLIENT_MAX_FAILURES"`
+		FailureWindowSeconds int64 `yaml:"failure_window_seconds" env:"RATE_LIMIT_FAILURE_WINDOW_SECONDS"`
+		LockoutSeconds       int64 `yaml:"lockout_seconds" env:"RATE_LIMIT_LOCKOUT_SECONDS"`
+	}
+
+	JanitorConfig struct {
+		IntervalSeconds int64 `yaml:"interval_seconds" env:"JANITOR_INTERVAL_SECONDS"`
+		RetentionHours  int64 `yaml:"retention_hours" env:"JANITOR_RETENTION_HOURS"`
+		BatchSize       int64 `yaml:"batch_size" env:"JANITOR_BATCH_SIZE"`
+	}
+
+	MetricsConfig struct {
+		MaxClientTags int64 `yaml:"max_client_tags" env:"METRICS_MAX_CLIENT_TAGS"`
+	}
+
+	TemporalConfig struct {
+		HostPort  string `yaml:"host_port" env:"TEMPORAL_HOST_PORT"`
+		Namespace string `yaml:"namespace" env:"TEMPORAL_NAMESPACE"`
+		TaskQueue string `yaml:"task_queue" env:"TEMPORAL_TASK_QUEUE"`
+	}
+
+	WebhooksConfig struct {
+		MaxAttempts int64 `yaml:"max_attempts" env:"WEBHOOK_MAX_ATTEMPTS"`
+	}
+
+	TenantsConfig struct {
+		// single, host, or path. host and path need the postgres store.
+		Mode string `yaml:"mode" env:"TENANT_MODE"`
+		// How long the tenants table is cached, so how long a changed tenant takes to be noticed
+		CacheSeconds int64 `yaml:"cache_seconds" env:"TENANT_CACHE_SECONDS"`
+	}
+
+	// ConfigErrors is every problem with the config, so they can all be fixed at once
+	ConfigErrors []string
+)
+
+func (e ConfigErrors) Error() string {
+	return "invalid config:\n  " + strings.Join(e, "\n  ")
+}
+
+func DefaultConfig() Config {
+	return Config{
+		HTTP: HTTPConfig{
+			Port:         "8080",
+			InternalAddr: ":8042",
+		},
+		Store: StoreConfig{
+			Kind:       "postgres",
+			PGMaxConns: 10,
+			PGMinConns: 1,
+			SQLitePath: "continuewith.db",
+		},
+		Provider: ProviderConfig{
+			TimeoutMS:              5000,
+			MaxRetries:             2,
+			BreakerFailures:        5,
+			BreakerCooldownSeconds: 30,
+		},
+		Tokens: TokensConfig{
+			AccessTokenExpireSeconds:       3600,
+			RefreshTokenExpireSeconds:      12 * 3600,
+			AuthorizationCodeExpireSeconds: 600,
+		},
+		Introspection: IntrospectionConfig{
+			CacheSize:       10000,
+			CacheTTLSeconds: 60,
+		},
+		RateLimits: RateLimitsConfig{
+			IPPerMinute:          300,
+			IPBurst:              60,
+			ClientPerMinute:      3000,
+			ClientBurst:          500,
+			IPMaxFailures:        20,
+			FailureWindowSeconds: 300,
+			LockoutSeconds:       900,
+		},
+		Janitor: JanitorConfig{
+			IntervalSeconds: 300,
+			RetentionHours:  7 * 24,
+			BatchSize:       1000,
+		},
+		Metrics: MetricsConfig{
+			MaxClientTags: 200,
+		},
+		Temporal: TemporalConfig{
+			Namespace: "default",
+			TaskQueue: "continuewith",
+		},
+		Webhooks: WebhooksConfig{
+			MaxAttempts: 15,
+		},
+		Tenants: TenantsConfig{
+			Mode:         "single",
+			CacheSeconds: 60,
+		},
+	}
+}
+
+// ReadConfig returns the defaults, overridden by the CONFIG_FILE file, overridden by the env. It isn't validated.
+func ReadConfig() (Config, error) {
+	cfg := DefaultConfig()
+	if path := os.Getenv("CONFIG_FILE"); path != "" {
+		fileBytes, err := os.ReadFile(path)
+		if err != nil {
+			return cfg, fmt.Errorf("error reading CONFIG_FILE: %w", err)
+		}
+		dec := yaml.NewDecoder(bytes.NewReader(fileBytes))
+		// Typos shouldn't silently fall back to the default
+		dec.KnownFields(true)
+		err = dec.Decode(&cfg)
+		if err != nil && !errors.Is(err, io.EOF) {
+			return cfg, fmt.Errorf("error parsing CONFIG_FILE %s: %w", path, err)
+		}
+	}
+
+	var errs ConfigErrors
+	err := walkConfig(&cfg, func(field reflect.StructField, val reflect.Value) {
+		if err := setFromEnv(field, val); err != nil {
+			errs = append(errs, err.Error())
+		}
+	})
+	if err != nil {
+		return cfg, err
+	}
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+	return cfg, nil
+}
+
+// walkConfig calls f with every field that has an env tag
+func walkConfig(cfg any, f func(field reflect.StructField, val reflect.Value)) error {
+	v := reflect.ValueOf(cfg)
+	if v.Kind() == reflect.Pointer {
+		v = v.Elem()
+	}
+	if v.Kind() != reflect.Struct {
+		return ErrNotStruct
+	}
+	for i := 0; i < v.NumField(); i++ {
+		field := v.Type().Field(i)
+		if field.Type.Kind() == reflect.Struct {
+			if err := walkConfig(v.Field(i).Addr().Interface(), f); err != nil {
+				return err
+			}
+			continue
+		}
+		if field.Tag.Get("env") != "" {
+			f(field, v.Field(i))
+		}
+	}
+	return nil
+}
+
+// setFromEnv sets the field from its env var, or for secrets the file at <env var>_FILE
+func setFromEnv(field reflect.StructField, val reflect.Value) error {
+	name := field.Tag.Get("env")
+	envVal := os.Getenv(name)
+	if field.Tag.Get("secret") == "true" {
+		if path := os.Getenv(name + "_FILE"); path != "" {
+			if envVal != "" {
+				return fmt.Errorf("%s and %s_FILE are both set", name, name)
+			}
+			fileBytes, err := os.ReadFile(path)
+			if err != nil {
+				return fmt.Errorf("error reading %s_FILE: %s", name, err)
+			}
+			// Editors and echo leave a trailing newline
+			envVal = strings.TrimRight(string(fileBytes), "\r\n")
+		}
+	}
+	if envVal == "" {
+		return nil
+	}
+
+	switch val.Kind() {
+	case reflect.String:
+		val.SetString(envVal)
+	case reflect.Int64:
+		i, err := strconv.ParseInt(envVal, 10, 64)
+		if err != nil {
+			return fmt.Errorf("%s must be an integer, got %q", name, envVal)
+		}
+		val.SetInt(i)
+	case reflect.Bool:
+		b, err := strconv.ParseBool(envVal)
+		if err != nil {
+			return fmt.Errorf("%s must be 1, 0, true, or false, got %q", name, envVal)
+		}
+		val.SetBool(b)
+	default:
+		return fmt.Errorf("%s has unsupported type %s", name, val.Kind())
+	}
+	return nil
+}
+
+// ValidateStore checks what's needed to connect to the store
+func (c Config) ValidateStore() error {
+	var errs ConfigErrors
+	switch c.Store.Kind {
+	case "postgres":
+		if c.Store.PGDSN == "" {
+			errs = append(errs, "store.pg_dsn (PG_DSN) is required with the postgres store")
+		}
+		if c.Store.PGMaxConns < 1 {
+			errs = append(errs, "store.pg_max_conns (PG_MAX_CONNS) must be at least 1")
+		}
+		if c.Store.PGMinConns < 0 || c.Store.PGMinConns > c.Store.PGMaxConns {
+			errs = append(errs, "store.pg_min_conns (PG_MIN_CONNS) must be between 0 and store.pg_max_conns")
+		}
+	case "sqlite":
+		if c.Store.SQLitePath == "" {
+			errs = append(errs, "store.sqlite_path (SQLITE_PATH) is required with the sqlite store")
+		}
+	case "memory":
+	default:
+		errs = append(errs, fmt.Sprintf("store.kind (STORE) must be postgres, sqlite, or memory, got %q", c.Store.Kind))
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// Validate checks everything the server needs, returning all of the problems as ConfigErrors
+func (c Config) Validate() error {
+	var errs ConfigErrors
+	var storeErrs ConfigErrors
+	if errors.As(c.ValidateStore(), &storeErrs) {
+		errs = append(errs, storeErrs...)
+	}
+
+	if port, err := strconv.Atoi(c.HTTP.Port); err != nil || port < 1 || port > 65535 {
+		errs = append(errs, fmt.Sprintf("http.port (HTTP_PORT) must be a port number, got %q", c.HTTP.Port))
+	}
+	if c.HTTP.InternalAddr == "" {
+		errs = append(errs, "http.internal_addr (INTERNAL_HTTP_ADDR) is required")
+	}
+
+	if _, err := ParseCIDRs(c.HTTP.TrustedProxies); err != nil {
+		errs = append(errs, fmt.Sprintf("http.trusted_proxies (TRUSTED_PROXIES) must be comma separated CIDRs: %s", err))
+	}
+
+	if c.AdminKey == "" {
+		errs = append(errs, "admin_key (ADMIN_KEY) is required")
+	}
+	if c.Provider.Secret == "" {
+		errs = append(errs, "provider.secret (PROVIDER_SECRET) is required")
+	}
+	if !isHTTPURL(c.Provider.UserExchangeURL) {
+		errs = append(errs, fmt.Sprintf("provider.user_exchange_url (PROVIDER_USER_EXCHANGE_URL) must be an http(s) URL, got %q", c.Provider.UserExchangeURL))
+	}
+	if c.Provider.PreIssuanceHookURL != "" && !isHTTPURL(c.Provider.PreIssuanceHookURL) {
+		errs = append(errs, fmt.Sprintf("provider.pre_issuance_hook_url (PRE_ISSUANCE_HOOK_URL) must be an http(s) URL, got %q", c.Provider.PreIssuanceHookURL))
+	}
+
+	positive := map[string]int64{
+		"provider.timeout_ms (PROVIDER_TIMEOUT_MS)":                                    c.Provider.TimeoutMS,
+		"tokens.access_token_expire_seconds (ACCESS_TOKEN_EXPIRE_SECONDS)":             c.Tokens.AccessTokenExpireSeconds,
+		"tokens.refresh_token_expire_seconds (REFRESH_TOKEN_EXPIRE_SECONDS)":           c.Tokens.RefreshTokenExpireSeconds,
+		"tokens.authorization_code_expire_seconds (AUTHORIZATION_CODE_EXPIRE_SECONDS)": c.Tokens.AuthorizationCodeExpireSeconds,
+		"janitor.interval_seconds (JANITOR_INTERVAL_SECONDS)":                          c.Janitor.IntervalSeconds,
+		"janitor.retention_hours (JANITOR_RETENTION_HOURS)":                            c.Janitor.RetentionHours,
+		"janitor.batch_size (JANITOR_BATCH_SIZE)":                                      c.Janitor.BatchSize,
+		"webhooks.max_attempts (WEBHOOK_MAX_ATTEMPTS)":                                 c.Webhooks.MaxAttempts,
+		"introspection.cache_ttl_seconds (INTROSPECTION_CACHE_TTL_SECONDS)":            c.Introspection.CacheTTLSeconds,
+		"rate_limits.failure_window_seconds (RATE_LIMIT_FAILURE_WINDOW_SECONDS)":       c.RateLimits.FailureWindowSeconds,
+		"rate_limits.lockout_seconds (RATE_LIMIT_LOCKOUT_SECONDS)":                     c.RateLimits.LockoutSeconds,
+		"tenants.cache_seconds (TENANT_CACHE_SECONDS)":                                 c.Tenants.CacheSeconds,
+	}
+	notNegative := map[string]int64{
+		"http.shutdown_sleep_seconds (SHUTDOWN_SLEEP_SEC)":                       c.HTTP.ShutdownSleepSeconds,
+		"tokens.refresh_token_idle_seconds (REFRESH_TOKEN_IDLE_SECONDS)":         c.Tokens.RefreshTokenIdleSeconds,
+		"provider.max_retries (PROVIDER_MAX_RETRIES)":                            c.Provider.MaxRetries,
+		"provider.breaker_failures (PROVIDER_BREAKER_FAILURES)":                  c.Provider.BreakerFailures,
+		"provider.breaker_cooldown_seconds (PROVIDER_BREAKER_COOLDOWN_SECONDS)":  c.Provider.BreakerCooldownSeconds,
+		"metrics.max_client_tags (METRICS_MAX_CLIENT_TAGS)":                      c.Metrics.MaxClientTags,
+		"introspection.cache_size (INTROSPECTION_CACHE_SIZE)":                    c.Introspection.CacheSize,
+		"rate_limits.ip_per_minute (RATE_LIMIT_IP_PER_MINUTE)":                   c.RateLimits.IPPerMinute,
+		"rate_limits.ip_burst (RATE_LIMIT_IP_BURST)":                             c.RateLimits.IPBurst,
+		"rate_limits.client_per_minute (RATE_LIMIT_CLIENT_PER_MINUTE)":           c.RateLimits.ClientPerMinute,
+		"rate_limits.client_burst (RATE_LIMIT_CLIENT_BURST)":                     c.RateLimits.ClientBurst,
+		"rate_limits.ip_max_failures (RATE_LIMIT_IP_MAX_FAILURES)":               c.RateLimits.IPMaxFailures,
+		"rate_limits.ip_client_max_failures (RATE_LIMIT_IP_CLIENT_MAX_FAILURES)": c.RateLimits.IPClientMaxFailures,
+	}
+	var numErrs []string
+	for name, val := range positive {
+		if val < 1 {
+			numErrs = append(numErrs, fmt.Sprintf("%s must be at least 1, got %d", name, val))
+		}
+	}
+	for name, val := range notNegative {
+		if val < 0 {
+			numErrs = append(numErrs, fmt.Sprintf("%s can't be negative, got %d", name, val))
+		}
+	}
+	// Maps are unordered, keep the output stable
+	sort.Strings(numErrs)
+	errs = append(errs, numErrs...)
+
+	if c.Store.Kind == "postgres" && c.Store.AutoMigrate && !c.Store.IsPostgres {
+		// CockroachDB's advisory locks are no-ops, so replicas starting together would race to migrate
+		errs = append(errs, "store.auto_migrate (AUTO_MIGRATE) needs store.is_postgres (IS_POSTGRES), run continuewith migrate up from one place on CockroachDB")
+	}
+
+	switch c.RateLimits.Counters {
+	case "", "memory":
+	case "postgres":
+		if c.Store.Kind != "postgres" {
+			errs = append(errs, "rate_limits.counters (RATE_LIMIT_COUNTERS) can only be postgres with the postgres store")
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("rate_limits.counters (RATE_LIMIT_COUNTERS) must be memory or postgres, got %q", c.RateLimits.Counters))
+	}
+
+	switch c.Tenants.Mode {
+	case "single":
+	case "host", "path":
+		if c.Store.Kind != "postgres" {
+			errs = append(errs, fmt.Sprintf("tenants.mode (TENANT_MODE) can only be %s with the postgres store", c.Tenants.Mode))
+		}
+	default:
+		errs = append(errs, fmt.Sprintf("tenants.mode (TENANT_MODE) must be single, host, or path, got %q", c.Tenants.Mode))
+	}
+
+	if c.Temporal.HostPort != "" && c.Temporal.TaskQueue == "" {
+		errs = append(errs, "temporal.task_queue (TEMPORAL_TASK_QUEUE) is required with temporal")
+	}
+
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+// ParseCIDRs parses comma separated CIDRs, empty is none
+func ParseCIDRs(s string) ([]*net.IPNet, error) {
+	var ipNets []*net.IPNet
+	for _, cidr := range strings.Split(s, ",") {
+		cidr = strings.TrimSpace(cidr)
+		if cidr == "" {
+			continue
+		}
+		_, ipNet, err := net.ParseCIDR(cidr)
+		if err != nil {
+			return nil, err
+		}
+		ipNets = append(ipNets, ipNet)
+	}
+	return ipNets, nil
+}
+
+func isHTTPURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != ""
+}
+
+// Redacted returns a copy with every secret replaced, for printing
+func (c Config) Redacted() Config {
+	redacted := c
+	// Only fails for non structs
+	_ = walkConfig(&redacted, func(field reflect.StructField, val reflect.Value) {
+		if field.Tag.Get("secret") == "true" && val.String() != "" {
+			val.SetString("REDACTED")
+		}
+	})
+	return redacted
+}
@@ -0,0 +1,255 @@
+package utils
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// clearConfigEnv unsets every config env var for the test, so the environment it runs in can't leak in
+func clearConfigEnv(t *testing.T) {
+	t.Setenv("CONFIG_FILE", "")
+	cfg := DefaultConfig()
+	require.NoError(t, walkConfig(&cfg, func(field reflect.StructField, val reflect.Value) {
+		t.Setenv(field.Tag.Get("env"), "")
+		t.Setenv(field.Tag.Get("env")+"_FILE", "")
+	}))
+}
+
+func writeTestFile(t *testing.T, name, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(path, []byte(content), 0o600))
+	return path
+}
+
+func TestReadConfig(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		// Values of "file:<content>" are written to a file and replaced with its path
+		env   map[string]string
+		check func(t *testing.T, cfg Config)
+		// Every one of these, and nothing else
+		errs ConfigErrors
+		err  string
+	}{
+		{
+			name: "defaults",
+			check: func(t *testing.T, cfg Config) {
+				require.Equal(t, DefaultConfig(), cfg)
+			},
+		},
+		{
+			name: "env overrides",
+			env: map[string]string{
+				"HTTP_PORT":                   "9090",
+				"ACCESS_TOKEN_EXPIRE_SECONDS": "60",
+				"IS_POSTGRES":                 "true",
+				"ADMIN_KEY":                   "adm",
+			},
+			check: func(t *testing.T, cfg Config) {
+				require.Equal(t, "9090", cfg.HTTP.Port)
+				require.Equal(t, int64(60), cfg.Tokens.AccessTokenExpireSeconds)
+				require.True(t, cfg.Store.IsPostgres)
+				require.Equal(t, "adm", cfg.AdminKey)
+				// Untouched fields keep their defaults
+				require.Equal(t, DefaultConfig().HTTP.InternalAddr, cfg.HTTP.InternalAddr)
+			},
+		},
+		{
+			name: "env overrides the file",
+			env: map[string]string{
+				"CONFIG_FILE": "file:http:\n  port: \"7070\"\n  internal_addr: \":7071\"\nadmin_key: from_file\n",
+				"HTTP_PORT":   "9090",
+			},
+			check: func(t *testing.T, cfg Config) {
+				require.Equal(t, "9090", cfg.HTTP.Port)
+				require.Equal(t, ":7071", cfg.HTTP.InternalAddr)
+				require.Equal(t, "from_file", cfg.AdminKey)
+			},
+		},
+		{
+			name: "empty file",
+			env:  map[string]string{"CONFIG_FILE": "file:"},
+			check: func(t *testing.T, cfg Config) {
+				require.Equal(t, DefaultConfig(), cfg)
+			},
+		},
+		{
+			name: "unknown file field",
+			env:  map[string]string{"CONFIG_FILE": "file:http:\n  prot: \"7070\"\n"},
+			err:  "field prot not found",
+		},
+		{
+			name: "missing file",
+			env:  map[string]string{"CONFIG_FILE": "/does/not/exist.yaml"},
+			err:  "error reading CONFIG_FILE",
+		},
+		{
+			name: "secret from file",
+			env: map[string]string{
+				"ADMIN_KEY_FILE":       "file:adm\n",
+				"PROVIDER_SECRET_FILE": "file:s3cret\r\n",
+			},
+			check: func(t *testing.T, cfg Config) {
+				require.Equal(t, "adm", cfg.AdminKey)
+				require.Equal(t, "s3cret", cfg.Provider.Secret)
+			},
+		},
+		{
+			name: "only secrets read _FILE",
+			env:  map[string]string{"HTTP_PORT_FILE": "file:9090"},
+			check: func(t *testing.T, cfg Config) {
+				require.Equal(t, DefaultConfig().HTTP.Port, cfg.HTTP.Port)
+			},
+		},
+		{
+			name: "every error",
+			env: map[string]string{
+				"ACCESS_TOKEN_EXPIRE_SECONDS": "1h",
+				"IS_POSTGRES":                 "yes",
+				"ADMIN_KEY":                   "adm",
+				"ADMIN_KEY_FILE":              "file:adm",
+				"PROVIDER_SECRET_FILE":        "/does/not/exist",
+			},
+			errs: ConfigErrors{
+				"ADMIN_KEY and ADMIN_KEY_FILE are both set",
+				"error reading PROVIDER_SECRET_FILE: open /does/not/exist: no such file or directory",
+				"IS_POSTGRES must be 1, 0, true, or false, got \"yes\"",
+				"ACCESS_TOKEN_EXPIRE_SECONDS must be an integer, got \"1h\"",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			clearConfigEnv(t)
+			for k, v := range tc.env {
+				if strings.HasPrefix(v, "file:") {
+					v = writeTestFile(t, k, strings.TrimPrefix(v, "file:"))
+				}
+				t.Setenv(k, v)
+			}
+
+			cfg, err := ReadConfig()
+			switch {
+			case tc.errs != nil:
+				var errs ConfigErrors
+				require.True(t, errors.As(err, &errs), err)
+				require.ElementsMatch(t, tc.errs, errs)
+			case tc.err != "":
+				require.ErrorContains(t, err, tc.err)
+			default:
+				require.NoError(t, err)
+				tc.check(t, cfg)
+			}
+		})
+	}
+}
+
+func validConfig() Config {
+	cfg := DefaultConfig()
+	cfg.AdminKey = "adm"
+	cfg.Store.PGDSN = "postgresql://localhost/continuewith"
+	cfg.Provider.Secret = "s3cret"
+	cfg.Provider.UserExchangeURL = "https://app.example.com/exchange"
+	return cfg
+}
+
+func TestValidate(t *testing.T) {
+	for _, tc := range []struct {
+		name   string
+		change func(cfg *Config)
+		errs   ConfigErrors
+	}{
+		{
+			name:   "valid",
+			change: func(cfg *Config) {},
+		},
+		{
+			name: "sqlite doesn't need a dsn",
+			change: func(cfg *Config) {
+				cfg.Store.Kind = "sqlite"
+				cfg.Store.PGDSN = ""
+			},
+		},
+		{
+			name: "every error",
+			change: func(cfg *Config) {
+				cfg.Store.PGDSN = ""
+				cfg.HTTP.Port = "http"
+				cfg.HTTP.TrustedProxies = "10.0.0.0/8,nope"
+				cfg.AdminKey = ""
+				cfg.Provider.UserExchangeURL = "app.example.com"
+				cfg.Tokens.AccessTokenExpireSeconds = 0
+				cfg.RateLimits.IPBurst = -1
+				cfg.RateLimits.Counters = "redis"
+				cfg.Tenants.Mode = "subdomain"
+			},
+			errs: ConfigErrors{
+				"store.pg_dsn (PG_DSN) is required with the postgres store",
+				"http.port (HTTP_PORT) must be a port number, got \"http\"",
+				"http.trusted_proxies (TRUSTED_PROXIES) must be comma separated CIDRs: invalid CIDR address: nope",
+				"admin_key (ADMIN_KEY) is required",
+				"provider.user_exchange_url (PROVIDER_USER_EXCHANGE_URL) must be an http(s) URL, got \"app.example.com\"",
+				"rate_limits.ip_burst (RATE_LIMIT_IP_BURST) can't be negative, got -1",
+				"tokens.access_token_expire_seconds (ACCESS_TOKEN_EXPIRE_SECONDS) must be at least 1, got 0",
+				"rate_limits.counters (RATE_LIMIT_COUNTERS) must be memory or postgres, got \"redis\"",
+				"tenants.mode (TENANT_MODE) must be single, host, or path, got \"subdomain\"",
+			},
+		},
+		{
+			name: "postgres only features",
+			change: func(cfg *Config) {
+				cfg.Store.Kind = "memory"
+				cfg.RateLimits.Counters = "postgres"
+				cfg.Tenants.Mode = "host"
+			},
+			errs: ConfigErrors{
+				"rate_limits.counters (RATE_LIMIT_COUNTERS) can only be postgres with the postgres store",
+				"tenants.mode (TENANT_MODE) can only be host with the postgres store",
+			},
+		},
+		{
+			name: "auto migrate on CRDB",
+			change: func(cfg *Config) {
+				cfg.Store.AutoMigrate = true
+			},
+			errs: ConfigErrors{
+				"store.auto_migrate (AUTO_MIGRATE) needs store.is_postgres (IS_POSTGRES), run continuewith migrate up from one place on CockroachDB",
+			},
+		},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := validConfig()
+			tc.change(&cfg)
+			err := cfg.Validate()
+			if tc.errs == nil {
+				require.NoError(t, err)
+				return
+			}
+			var errs ConfigErrors
+			require.True(t, errors.As(err, &errs), err)
+			// In order, so the output is stable
+			require.Equal(t, tc.errs, errs)
+		})
+	}
+}
+
+func TestRedacted(t *testing.T) {
+	cfg := validConfig()
+	cfg.Provider.Secret = ""
+	redacted := cfg.Redacted()
+
+	require.Equal(t, "REDACTED", redacted.AdminKey)
+	require.Equal(t, "REDACTED", redacted.Store.PGDSN)
+	// Unset secrets stay unset, so you can see they're missing
+	require.Equal(t, "", redacted.Provider.Secret)
+	require.Equal(t, cfg.Provider.UserExchangeURL, redacted.Provider.UserExchangeURL)
+	require.Equal(t, cfg.HTTP, redacted.HTTP)
+	// The original is untouched
+	require.Equal(t, "adm", cfg.AdminKey)
+	require.Equal(t, "postgresql://localhost/continuewith", cfg.Store.PGDSN)
+}
@@ -1,21 +1,195 @@
 package utils
 
-import "os"
+import (
+	"errors"
+	"net"
+)
 
+// The server's config, set by LoadConfig, see Config for where it comes from. Library code (http_server, store, provider_api) takes its config as options instead.
 var (
-	Env = os.Getenv("ENV")
+	Env string
+
+	HTTPPort string
+	// Serves metrics
+	InternalHTTPAddr string
+	// How long to wait after a shutdown signal before draining, so load balancers stop sending traffic
+	ShutdownSleepSeconds int64
+	// Proxies whose X-Forwarded-For is believed, besides private and loopback addresses
+	TrustedProxies []*net.IPNet
 
-	PGDSN = os.Getenv("PG_DSN")
+	PGDSN      string
+	PGMaxConns int64
+	PGMinConns int64
 
-	ProviderAPIUserExchange = MustEnv("PROVIDER_USER_EXCHANGE_URL")
+	ProviderAPIUserExchange string
+	// Optional, called before codes and tokens are issued so the provider can deny or customize them
+	PreIssuanceHookURL string
+	// Shared with the provider to sign requests to it, never give the provider the ADMIN_KEY
+	ProviderSecret string
+	// Per attempt
+	ProviderTimeoutMS int64
+	// Retries on network errors and 5xx
+	ProviderMaxRetries int64
+	// Consecutive failed calls before we stop calling the provider for PROVIDER_BREAKER_COOLDOWN_SECONDS, 0 disables
+	ProviderBreakerFailures        int64
+	ProviderBreakerCooldownSeconds int64
+
+	// postgres (CRDB or Postgres, the default), sqlite, or memory. Only postgres has admin keys, the audit log, webhooks, and background jobs.
+	Store string
+	// The database file for the sqlite store
+	SQLitePath string
 
 	// CRDB by default, which means serializable isolation by default
-	IsPostgres = os.Getenv("IS_POSTGRES") == "1"
+	IsPostgres bool
+	// Apply pending migrations at startup, replicas take turns with an advisory lock. Postgres only.
+	AutoMigrate bool
+
+	RefreshTokenExpireSeconds int64
+	AccessTokenExpireSeconds  int64
+	// 0 is no idle timeout
+	RefreshTokenIdleSeconds int64
+	// How long an authorization code can be exchanged
+	AuthorizationCodeExpireSeconds int64
+
+	AdminKey string
+	// Optional, the iss of introspection and userinfo responses for tenants without their own
+	Issuer string
+
+	// Valid access tokens cached per replica for introspection, 0 disables
+	IntrospectionCacheSize int64
+	// The longest a token stays cached, and so how long a revocation can go unnoticed without LISTEN/NOTIFY
+	IntrospectionCacheTTLSeconds int64
+
+	// memory or postgres
+	RateLimitCounters        string
+	RateLimitIPPerMinute     int64
+	RateLimitIPBurst         int64
+	RateLimitClientPerMinute int64
+	RateLimitClientBurst     int64
+	// invalid_grant, unauthorized_client, and invalid_client errors within the window before a lockout, 0 disables
+	RateLimitIPMaxFailures        int64
+	RateLimitIPClientMaxFailures  int64
+	RateLimitFailureWindowSeconds int64
+	RateLimitLockoutSeconds       int64
 
-	// Default 12 hours
-	RefreshTokenExpireSeconds = GetEnvOrDefaultInt("REFRESH_TOKEN_EXPIRE_SECONDS", 12*3600)
-	// Default 1 hour
-	AccessTokenExpireSeconds = GetEnvOrDefaultInt("ACCESS_TOKEN_EXPIRE_SECONDS", 3600)
+	JanitorIntervalSeconds int64
+	// How long expired and revoked rows are kept before the janitor deletes them
+	JanitorRetentionHours int64
+	JanitorBatchSize      int64
 
-	AdminKey = MustEnv("ADMIN_KEY")
+	// Clients past this many are reported under a single label
+	MetricsMaxClientTags int64
+
+	// Setting this runs cleanup, webhook delivery, bulk revocation, and key rotation as Temporal workflows
+	TemporalHostPort  string
+	TemporalNamespace string
+	TemporalTaskQueue string
+
+	// Deliveries are marked failed after this many attempts, default backoff reaches the 6h cap around attempt 12
+	WebhookMaxAttempts int64
+
+	// single, host, or path, see the tenants package
+	TenantMode         string
+	TenantCacheSeconds int64
 )
+
+// LoadConfig sets the server's config from ReadConfig, returning every problem with it as ConfigErrors.
+// Call it after loading any .env file.
+func LoadConfig() error {
+	return loadConfig(Config.Validate)
+}
+
+// LoadStoreConfig sets the config but only validates the database config, for commands that don't run the server
+func LoadStoreConfig() error {
+	return loadConfig(Config.ValidateStore)
+}
+
+func loadConfig(validate func(Config) error) error {
+	cfg, err := ReadAndValidateConfig(validate)
+	if err != nil {
+		return err
+	}
+	applyConfig(cfg)
+	return nil
+}
+
+// ReadAndValidateConfig returns the env and validation problems together, and the config unless the file couldn't be read
+func ReadAndValidateConfig(validate func(Config) error) (Config, error) {
+	cfg, err := ReadConfig()
+	var errs ConfigErrors
+	if err != nil && !errors.As(err, &errs) {
+		return cfg, err
+	}
+	var validateErrs ConfigErrors
+	if errors.As(validate(cfg), &validateErrs) {
+		errs = append(errs, validateErrs...)
+	}
+	if len(errs) > 0 {
+		return cfg, errs
+	}
+	return cfg, nil
+}
+
+func applyConfig(cfg Config) {
+	Env = cfg.Env
+	AdminKey = cfg.AdminKey
+	Issuer = cfg.Issuer
+
+	HTTPPort = cfg.HTTP.Port
+	InternalHTTPAddr = cfg.HTTP.InternalAddr
+	ShutdownSleepSeconds = cfg.HTTP.ShutdownSleepSeconds
+	// Validated
+	TrustedProxies, _ = ParseCIDRs(cfg.HTTP.TrustedProxies)
+
+	Store = cfg.Store.Kind
+	PGDSN = cfg.Store.PGDSN
+	PGMaxConns = cfg.Store.PGMaxConns
+	PGMinConns = cfg.Store.PGMinConns
+	IsPostgres = cfg.Store.IsPostgres
+	AutoMigrate = cfg.Store.AutoMigrate
+	SQLitePath = cfg.Store.SQLitePath
+
+	ProviderAPIUserExchange = cfg.Provider.UserExchangeURL
+	PreIssuanceHookURL = cfg.Provider.PreIssuanceHookURL
+	ProviderSecret = cfg.Provider.Secret
+	ProviderTimeoutMS = cfg.Provider.TimeoutMS
+	ProviderMaxRetries = cfg.Provider.MaxRetries
+	ProviderBreakerFailures = cfg.Provider.BreakerFailures
+	ProviderBreakerCooldownSeconds = cfg.Provider.BreakerCooldownSeconds
+
+	AccessTokenExpireSeconds = cfg.Tokens.AccessTokenExpireSeconds
+	RefreshTokenExpireSeconds = cfg.Tokens.RefreshTokenExpireSeconds
+	RefreshTokenIdleSeconds = cfg.Tokens.RefreshTokenIdleSeconds
+	AuthorizationCodeExpireSeconds = cfg.Tokens.AuthorizationCodeExpireSeconds
+
+	IntrospectionCacheSize = cfg.Introspection.CacheSize
+	IntrospectionCacheTTLSeconds = cfg.Introspection.CacheTTLSeconds
+
+	RateLimitCounters = cfg.RateLimits.Counters
+	if RateLimitCounters == "" {
+		RateLimitCounters = IfElse(cfg.Store.Kind == "postgres", "postgres", "memory")
+	}
+	RateLimitIPPerMinute = cfg.RateLimits.IPPerMinute
+	RateLimitIPBurst = cfg.RateLimits.IPBurst
+	RateLimitClientPerMinute = cfg.RateLimits.ClientPerMinute
+	RateLimitClientBurst = cfg.RateLimits.ClientBurst
+	RateLimitIPMaxFailures = cfg.RateLimits.IPMaxFailures
+	RateLimitIPClientMaxFailures = cfg.RateLimits.IPClientMaxFailures
+	RateLimitFailureWindowSeconds = cfg.RateLimits.FailureWindowSeconds
+	RateLimitLockoutSeconds = cfg.RateLimits.LockoutSeconds
+
+	JanitorIntervalSeconds = cfg.Janitor.IntervalSeconds
+	JanitorRetentionHours = cfg.Janitor.RetentionHours
+	JanitorBatchSize = cfg.Janitor.BatchSize
+
+	MetricsMaxClientTags = cfg.Metrics.MaxClientTags
+
+	TemporalHostPort = cfg.Temporal.HostPort
+	TemporalNamespace = cfg.Temporal.Namespace
+	TemporalTaskQueue = cfg.Temporal.TaskQueue
+
+	WebhookMaxAttempts = cfg.Webhooks.MaxAttempts
+
+	TenantMode = cfg.Tenants.Mode
+	TenantCacheSeconds = cfg.Tenants.CacheSeconds
+}
@@ -2,12 +2,15 @@ package utils
 
 import (
 	"context"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"encoding/json"
 	"errors"
 	"fmt"
 	"log"
 	"net/http"
+	"net/url"
 	"os"
 	"reflect"
 	"runtime"
@@ -23,6 +26,7 @@ import (
 	gonanoid "github.com/matoous/go-nanoid/v2"
 	"github.com/rs/zerolog"
 	"github.com/segmentio/ksuid"
+	"github.com/uber-go/tally/v4"
 
 	"github.com/UltimateTournament/backoff/v4"
 	"github.com/jackc/pgx/v5"
@@ -56,7 +60,7 @@ func GetEnvOrDefaultInt(env string, defaultVal int64) int64 {
 	if e == "" {
 		return defaultVal
 	} else {
-		intVal, err := strconv.ParseInt(e, 10, 16)
+		intVal, err := strconv.ParseInt(e, 10, 64)
 		if err != nil {
 			logger.Error().Msg(fmt.Sprintf("Failed to parse string to int '%s'", env))
 			os.Exit(1)
@@ -78,6 +82,12 @@ func GenKSortedID(prefix string) string {
 	return prefix + ksuid.New().String()
 }
 
+// SHA256Hex is for hashing high entropy secrets (like API keys) before storage, not passwords
+func SHA256Hex(s string) string {
+	h := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(h[:])
+}
+
 // Cannot use to set something to "", must manually use sq.NullString for that
 func SQLNullString(s string) sql.NullString {
 	return sql.NullString{
@@ -129,6 +139,9 @@ func DaysUntil(t time.Time, d time.Weekday) int {
 	return int(delta)
 }
 
+// ReliableExecRetries is set by observability.InitMetrics
+var ReliableExecRetries = tally.NoopScope.Counter("reliable_exec_retries")
+
 // this wrapper exists so caller stack skipping works
 func ReliableExec(ctx context.Context, pool *pgxpool.Pool, tryTimeout time.Duration, f func(ctx context.Context, conn *pgxpool.Conn) error) error {
 	return reliableExec(ctx, pool, tryTimeout, func(ctx context.Context, tx *pgxpool.Conn) error {
@@ -171,6 +184,7 @@ func reliableExec(ctx context.Context, pool *pgxpool.Pool, tryTimeout time.Durat
 		}
 		return err
 	}, cfg, func(err error, d time.Duration) {
+		ReliableExecRetries.Inc(1)
 		reqID, _ := ctx.Value(gologger.ReqIDKey).(string)
 		l := zerolog.Ctx(ctx).Info().Err(err).CallerSkipFrame(5)
 		if reqID != "" {
@@ -287,6 +301,24 @@ func FirstOr[T any](a []T, def T) T {
 	return a[0]
 }
 
+var ErrInvalidRedirectURI = errors.New("invalid redirect uri")
+
+// ValidateRedirectURI checks a client's redirect URI is absolute and has no fragment (RFC 6749 3.1.2). Custom schemes
+// are allowed for native apps.
+func ValidateRedirectURI(redirectURI string) error {
+	u, err := url.Parse(redirectURI)
+	if err != nil {
+		return fmt.Errorf("%s: %s -- %w", redirectURI, err, ErrInvalidRedirectURI)
+	}
+	if !u.IsAbs() || (u.Host == "" && u.Opaque == "" && u.Path == "") {
+		return fmt.Errorf("%s is not absolute -- %w", redirectURI, ErrInvalidRedirectURI)
+	}
+	if u.Fragment != "" || strings.Contains(redirectURI, "#") {
+		return fmt.Errorf("%s has a fragment -- %w", redirectURI, ErrInvalidRedirectURI)
+	}
+	return nil
+}
+
 var ErrVersionBadFormat = PermError("bad version format")
 
 // VersionToInt converts a simple semantic version string (e.e. 18.02.66)
@@ -0,0 +1,158 @@
+package webhooks
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+)
+
+var (
+	EventAuthorizationGranted = "authorization.granted"
+	EventAuthorizationRevoked = "authorization.revoked"
+	EventRefreshTokenReuse    = "refresh_token.reuse_detected"
+
+	EventTypes = []string{
+		EventAuthorizationGranted,
+		EventAuthorizationRevoked,
+		EventRefreshTokenReuse,
+	}
+
+	StatusPending   = "pending"
+	StatusDelivered = "delivered"
+	StatusFailed    = "failed"
+
+	SignatureHeader  = "x-continuewith-signature"
+	EventTypeHeader  = "x-continuewith-event"
+	DeliveryIDHeader = "x-continuewith-delivery"
+
+	ErrInvalidSignature = errors.New("invalid signature")
+	ErrSignatureExpired = errors.New("signature timestamp outside of tolerance")
+
+	logger = gologger.NewLogger()
+)
+
+type Payload struct {
+	ID       string
+	TenantID string
+	Type     string
+	Created  time.Time
+	Data     any
+}
+
+type (
+	AuthorizationGrantedData struct {
+		UserID   string
+		ClientID string
+		Scopes   []string
+	}
+
+	AuthorizationRevokedData struct {
+		UserID   *string `json:",omitempty"`
+		ClientID *string `json:",omitempty"`
+		// Set when everything created before a time was revoked
+		Before        *time.Time `json:",omitempty"`
+		AccessTokens  int64
+		RefreshTokens int64
+	}
+
+	RefreshTokenReuseData struct {
+		UserID         string
+		ClientID       string
+		RefreshTokenID string
+		// All of the user's tokens for the client are revoked when reuse is detected
+		AccessTokensRevoked  int64
+		RefreshTokensRevoked int64
+	}
+)
+
+// Enqueue writes a delivery for every subscription of the tenant to the event type.
+// Call it with the same transaction that makes the change, that's what makes this an outbox.
+func Enqueue(ctx context.Context, q *query.Queries, tenantID, eventType string, data any) error {
+	subs, err := q.ListWebhookSubscriptionsForEvent(ctx, query.ListWebhookSubscriptionsForEventParams{
+		TenantID:  tenantID,
+		EventType: eventType,
+	})
+	if err != nil {
+		return fmt.Errorf("error in ListWebhookSubscriptionsForEvent: %w", err)
+	}
+	if len(subs) == 0 {
+		return nil
+	}
+
+	payload := Payload{
+		ID:       utils.GenKSortedID("evt_"),
+		TenantID: tenantID,
+		Type:     eventType,
+		Created:  time.Now(),
+		Data:     data,
+	}
+	payloadBytes, err := json.Marshal(payload)
+	if err != nil {
+		return fmt.Errorf("error in json.Marshal: %w", err)
+	}
+
+	for _, sub := range subs {
+		err = q.InsertWebhookDelivery(ctx, query.InsertWebhookDeliveryParams{
+			TenantID:       tenantID,
+			ID:             utils.GenKSortedID("whd_"),
+			SubscriptionID: sub.ID,
+			EventID:        payload.ID,
+			EventType:      eventType,
+			Payload:        payloadBytes,
+		})
+		if err != nil {
+			return fmt.Errorf("error in InsertWebhookDelivery: %w", err)
+		}
+	}
+	return nil
+}
+
+// Sign returns the signature header value, in the format `t=<unix seconds>,v1=<hex hmac-sha256 of "<t>.<body>">`
+func Sign(secret string, timestamp time.Time, body []byte) string {
+	t := strconv.FormatInt(timestamp.Unix(), 10)
+	return fmt.Sprintf("t=%s,v1=%s", t, computeSignature(secret, t, body))
+}
+
+func computeSignature(secret, t string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(t))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// VerifySignature is for providers written in Go to check the signature header of a delivery
+func VerifySignature(secret, header string, body []byte, tolerance time.Duration) error {
+	var t, sig string
+	for _, part := range strings.Split(header, ",") {
+		k, v, _ := strings.Cut(part, "=")
+		switch k {
+		case "t":
+			t = v
+		case "v1":
+			sig = v
+		}
+	}
+	ts, err := strconv.ParseInt(t, 10, 64)
+	if err != nil || sig == "" {
+		return ErrInvalidSignature
+	}
+	if !hmac.Equal([]byte(sig), []byte(computeSignature(secret, t, body))) {
+		return ErrInvalidSignature
+	}
+	if d := time.Since(time.Unix(ts, 0)); d > tolerance || d < -tolerance {
+		return ErrSignatureExpired
+	}
+	return nil
+}
@@ -0,0 +1,234 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/UltimateTournament/backoff/v4"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgxpool"
+)
+
+var (
+	pollInterval = time.Second
+	batchSize    = int32(20)
+	// How long a claimed delivery is hidden from other replicas. The batch is delivered concurrently, so it only has to
+	// fit one delivery timeout and recordTimeout.
+	leaseDuration = time.Minute
+	recordTimeout = time.Second * 10
+
+	deliveryClient = &http.Client{Timeout: time.Second * 10}
+)
+
+// Deliverer delivers webhooks from the outbox
+type Deliverer struct {
+	pool *pgxpool.Pool
+	// Failed deliveries are retried until they've been attempted this many times
+	maxAttempts int64
+}
+
+func NewDeliverer(pool *pgxpool.Pool, maxAttempts int64) *Deliverer {
+	return &Deliverer{
+		pool:        pool,
+		maxAttempts: maxAttempts,
+	}
+}
+
+type Worker struct {
+	deliverer *Deliverer
+	stop      chan struct{}
+	done      chan struct{}
+}
+
+// StartWorker polls the outbox and delivers due webhooks until Shutdown is called. Safe to run on every replica.
+func StartWorker(deliverer *Deliverer) *Worker {
+	w := &Worker{
+		deliverer: deliverer,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	go w.run()
+	return w
+}
+
+func (w *Worker) Shutdown(ctx context.Context) error {
+	close(w.stop)
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) run() {
+	defer close(w.done)
+	ticker := time.NewTicker(pollInterval)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+			ctx, cancel := context.WithTimeout(context.Background(), leaseDuration)
+			if _, err := w.deliverer.DeliverDue(ctx); err != nil {
+				logger.Error().Err(err).Msg("error delivering webhooks")
+			}
+			cancel()
+		}
+	}
+}
+
+// DeliverDue claims and attempts a batch of due deliveries, returning how many were attempted. The batch is delivered
+// concurrently, and every attempt is recorded before the lease runs out, so another replica can't claim a delivery
+// that's still in flight.
+func (d *Deliverer) DeliverDue(ctx context.Context) (int, error) {
+	var deliveries []query.WebhookDelivery
+	claimed := time.Now()
+	err := query.ReliableExecInTx(ctx, d.pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+		deliveries, err = q.ClaimWebhookDeliveries(ctx, query.ClaimWebhookDeliveriesParams{
+			LeaseUntil: claimed.Add(leaseDuration),
+			RowLimit:   batchSize,
+		})
+		if err != nil {
+			return fmt.Errorf("error in ClaimWebhookDeliveries: %w", err)
+		}
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	subs := map[string]*query.WebhookSubscription{}
+	var due []query.WebhookDelivery
+	for _, delivery := range deliveries {
+		if _, ok := subs[delivery.SubscriptionID]; ok {
+			due = append(due, delivery)
+			continue
+		}
+		var sub query.WebhookSubscription
+		err = query.ReliableExec(ctx, d.pool, time.Second*10, func(ctx context.Context, q *query.Queries) (err error) {
+			sub, err = q.SelectWebhookSubscription(ctx, query.SelectWebhookSubscriptionParams{
+				TenantID: delivery.TenantID,
+				ID:       delivery.SubscriptionID,
+			})
+			if err != nil {
+				return fmt.Errorf("error in SelectWebhookSubscription: %w", err)
+			}
+			return nil
+		})
+		if errors.Is(err, pgx.ErrNoRows) {
+			// Deleted, its deliveries cascade
+			continue
+		}
+		if err != nil {
+			// The claimed deliveries are picked up again when the lease runs out
+			return 0, err
+		}
+		subs[delivery.SubscriptionID] = &sub
+		due = append(due, delivery)
+	}
+
+	// Leave time to record the attempts before the lease runs out
+	deliverCtx, cancel := context.WithDeadline(ctx, claimed.Add(leaseDuration-recordTimeout))
+	defer cancel()
+	var wg sync.WaitGroup
+	errs := make([]error, len(due))
+	for i, delivery := range due {
+		wg.Add(1)
+		go func(i int, delivery query.WebhookDelivery) {
+			defer wg.Done()
+			if deliverCtx.Err() != nil {
+				// Looking the subscriptions up took the whole lease, don't count it against the endpoint
+				return
+			}
+			statusCode, deliverErr := deliver(deliverCtx, *subs[delivery.SubscriptionID], delivery)
+			errs[i] = d.recordAttempt(delivery, statusCode, deliverErr)
+		}(i, delivery)
+	}
+	wg.Wait()
+	for _, err := range errs {
+		if err != nil {
+			return len(due), err
+		}
+	}
+	return len(due), nil
+}
+
+func deliver(ctx context.Context, sub query.WebhookSubscription, delivery query.WebhookDelivery) (*int64, error) {
+	if sub.Disabled {
+		return nil, errors.New("subscription disabled")
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, sub.Url, bytes.NewReader(delivery.Payload))
+	if err != nil {
+		return nil, fmt.Errorf("error in http.NewRequestWithContext: %w", err)
+	}
+	req.Header.Set("content-type", "application/json")
+	req.Header.Set(SignatureHeader, Sign(sub.Secret, time.Now(), delivery.Payload))
+	req.Header.Set(EventTypeHeader, delivery.EventType)
+	req.Header.Set(DeliveryIDHeader, delivery.ID)
+
+	res, err := deliveryClient.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("error in client.Do: %w", err)
+	}
+	defer res.Body.Close()
+	statusCode := utils.Ptr(int64(res.StatusCode))
+	if res.StatusCode > 299 {
+		resBytes, _ := io.ReadAll(io.LimitReader(res.Body, 1024))
+		return statusCode, fmt.Errorf("%d - %s", res.StatusCode, resBytes)
+	}
+	return statusCode, nil
+}
+
+// recordAttempt has its own timeout, the attempt was made so it's recorded even if the batch ran out of time
+func (d *Deliverer) recordAttempt(delivery query.WebhookDelivery, statusCode *int64, deliverErr error) error {
+	ctx, cancel := context.WithTimeout(context.Background(), recordTimeout)
+	defer cancel()
+	params := query.UpdateWebhookDeliveryAttemptParams{
+		ID:             delivery.ID,
+		Status:         StatusDelivered,
+		LastStatusCode: statusCode,
+		NextAttempt:    delivery.NextAttempt,
+		Delivered:      utils.Ptr(time.Now()),
+	}
+	if deliverErr != nil {
+		attempts := delivery.Attempts + 1
+		params.Status = utils.IfElse(attempts >= d.maxAttempts, StatusFailed, StatusPending)
+		params.LastError = utils.Ptr(deliverErr.Error())
+		params.NextAttempt = time.Now().Add(retryDelay(attempts))
+		params.Delivered = nil
+		logger.Warn().Err(deliverErr).Str("deliveryID", delivery.ID).Int64("attempts", attempts).Str("status", params.Status).Msg("webhook delivery failed")
+	}
+
+	return query.ReliableExec(ctx, d.pool, time.Second*10, func(ctx context.Context, q *query.Queries) error {
+		err := q.UpdateWebhookDeliveryAttempt(ctx, params)
+		if err != nil {
+			return fmt.Errorf("error in UpdateWebhookDeliveryAttempt: %w", err)
+		}
+		return nil
+	})
+}
+
+// retryDelay is the jittered exponential backoff after a number of failed attempts: ~10s, ~20s, ~40s... capped at 6h
+func retryDelay(attempts int64) time.Duration {
+	b := backoff.NewExponentialBackOff()
+	b.InitialInterval = time.Second * 10
+	b.Multiplier = 2
+	b.MaxInterval = time.Hour * 6
+	b.MaxElapsedTime = 0
+	b.Reset()
+	d := b.NextBackOff()
+	for i := int64(1); i < attempts; i++ {
+		d = b.NextBackOff()
+	}
+	return d
+}
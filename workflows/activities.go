@@ -0,0 +1,71 @@
+package workflows
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/janitor"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/store"
+	"github.com/danthegoodman1/GoAPITemplate/webhooks"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/uber-go/tally/v4"
+)
+
+type Activities struct {
+	pool      *pgxpool.Pool
+	store     store.Store
+	notifier  *revocation.Notifier
+	janitor   janitor.Config
+	deliverer *webhooks.Deliverer
+	scope     tally.Scope
+}
+
+func NewActivities(cfg Config) *Activities {
+	janitorCfg := cfg.Janitor
+	janitorCfg.Pool = cfg.Pool
+	return &Activities{
+		pool:      cfg.Pool,
+		store:     store.NewPostgres(cfg.Pool, cfg.IsPostgres),
+		notifier:  revocation.NewNotifier(cfg.Pool, cfg.IsPostgres),
+		janitor:   janitorCfg,
+		deliverer: webhooks.NewDeliverer(cfg.Pool, cfg.WebhookMaxAttempts),
+		scope:     cfg.Scope,
+	}
+}
+
+// CleanupExpiredRows does not need the advisory lock, the workflow ID already makes sure only one runs
+func (a *Activities) CleanupExpiredRows(ctx context.Context) error {
+	return janitor.Clean(ctx, a.janitor, a.scope.SubScope("janitor"))
+}
+
+func (a *Activities) DeliverWebhooks(ctx context.Context) (int, error) {
+	return a.deliverer.DeliverDue(ctx)
+}
+
+func (a *Activities) RevokeTokens(ctx context.Context, filter revocation.Filter) (res revocation.Result, err error) {
+	err = a.store.ExecInTx(ctx, time.Minute, func(ctx context.Context, tx store.Tx) (err error) {
+		res, err = revocation.Revoke(ctx, tx, filter)
+		return
+	})
+	if err != nil {
+		return res, err
+	}
+	a.notifier.Notify(ctx, filter.Notice())
+	return res, nil
+}
+
+func (a *Activities) RevokeAdminKey(ctx context.Context, tenantID, keyID string) error {
+	return query.ReliableExec(ctx, a.pool, time.Second*10, func(ctx context.Context, q *query.Queries) error {
+		_, err := q.RevokeAdminKey(ctx, query.RevokeAdminKeyParams{
+			TenantID: tenantID,
+			ID:       keyID,
+		})
+		if err != nil {
+			return fmt.Errorf("error in RevokeAdminKey: %w", err)
+		}
+		return nil
+	})
+}
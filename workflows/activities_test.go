@@ -0,0 +1,162 @@
+package workflows
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/janitor"
+	"github.com/danthegoodman1/GoAPITemplate/pg/pgtest"
+	"github.com/danthegoodman1/GoAPITemplate/query"
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/danthegoodman1/GoAPITemplate/webhooks"
+	"github.com/stretchr/testify/require"
+	"github.com/uber-go/tally/v4"
+	"go.temporal.io/sdk/testsuite"
+)
+
+// The activities run against the database at TEST_PG_DSN
+func newActivityEnv(t *testing.T) (*testsuite.TestActivityEnvironment, *query.Queries) {
+	pool := pgtest.Pool(t)
+	var suite testsuite.WorkflowTestSuite
+	env := suite.NewTestActivityEnvironment()
+	env.RegisterActivity(NewActivities(Config{
+		Pool:       pool,
+		IsPostgres: pgtest.IsPostgres(),
+		Janitor: janitor.Config{
+			Retention: time.Hour,
+			BatchSize: 1000,
+		},
+		WebhookMaxAttempts: 15,
+		Scope:              tally.NoopScope,
+	}))
+	return env, query.New(pool)
+}
+
+// seedGrant inserts a client with an access and refresh token for the user
+func seedGrant(t *testing.T, q *query.Queries, tenantID, clientID, userID string, expires time.Time) {
+	ctx := context.Background()
+	_, err := q.InsertClient(ctx, query.InsertClientParams{TenantID: tenantID, ID: clientID, Secret: "s", Name: "test"})
+	require.NoError(t, err)
+	refreshTokenID := utils.GenRandomIDWithSize("r_", 16)
+	require.NoError(t, q.InsertRefreshToken(ctx, query.InsertRefreshTokenParams{
+		TenantID: tenantID,
+		ID:       refreshTokenID,
+		ClientID: clientID,
+		UserID:   userID,
+		Scopes:   []string{"read"},
+		Expires:  expires,
+	}))
+	require.NoError(t, q.InsertAccessToken(ctx, query.InsertAccessTokenParams{
+		TenantID:     tenantID,
+		ID:           utils.GenRandomIDWithSize("a_", 16),
+		ClientID:     clientID,
+		RefreshToken: &refreshTokenID,
+		UserID:       userID,
+		Scopes:       []string{"read"},
+		Expires:      expires,
+	}))
+}
+
+func TestCleanupExpiredRowsActivity(t *testing.T) {
+	env, q := newActivityEnv(t)
+	tenantID := pgtest.TenantID()
+
+	clientID := utils.GenRandomIDWithSize("c_", 12)
+	seedGrant(t, q, tenantID, clientID, "expired", time.Now().Add(-time.Hour*2))
+	seedGrant(t, q, tenantID, clientID+"_2", "valid", time.Now().Add(time.Hour))
+
+	_, err := env.ExecuteActivity(a.CleanupExpiredRows)
+	require.NoError(t, err)
+
+	ctx := context.Background()
+	expired, err := q.ListAccessTokensByUserID(ctx, query.ListAccessTokensByUserIDParams{TenantID: tenantID, UserID: "expired"})
+	require.NoError(t, err)
+	require.Empty(t, expired)
+	valid, err := q.ListAccessTokensByUserID(ctx, query.ListAccessTokensByUserIDParams{TenantID: tenantID, UserID: "valid"})
+	require.NoError(t, err)
+	require.Len(t, valid, 1)
+}
+
+func TestDeliverWebhooksActivity(t *testing.T) {
+	env, q := newActivityEnv(t)
+	tenantID := pgtest.TenantID()
+
+	received := make(chan *http.Request, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = io.Copy(io.Discard, r.Body)
+		received <- r
+	}))
+	defer srv.Close()
+
+	ctx := context.Background()
+	_, err := q.InsertWebhookSubscription(ctx, query.InsertWebhookSubscriptionParams{
+		TenantID:   tenantID,
+		ID:         utils.GenRandomIDWithSize("whs_", 12),
+		Url:        srv.URL,
+		Secret:     "whsec",
+		EventTypes: []string{webhooks.EventAuthorizationRevoked},
+	})
+	require.NoError(t, err)
+	require.NoError(t, webhooks.Enqueue(ctx, q, tenantID, webhooks.EventAuthorizationRevoked, map[string]string{"user_id": "u1"}))
+
+	val, err := env.ExecuteActivity(a.DeliverWebhooks)
+	require.NoError(t, err)
+	var attempted int
+	require.NoError(t, val.Get(&attempted))
+	require.GreaterOrEqual(t, attempted, 1)
+
+	select {
+	case r := <-received:
+		require.Equal(t, webhooks.EventAuthorizationRevoked, r.Header.Get(webhooks.EventTypeHeader))
+	case <-time.After(time.Second * 5):
+		t.Fatal("webhook not delivered")
+	}
+}
+
+func TestRevokeTokensActivity(t *testing.T) {
+	env, q := newActivityEnv(t)
+	tenantID := pgtest.TenantID()
+	seedGrant(t, q, tenantID, utils.GenRandomIDWithSize("c_", 12), "u1", time.Now().Add(time.Hour))
+	seedGrant(t, q, tenantID, utils.GenRandomIDWithSize("c_", 12), "u2", time.Now().Add(time.Hour))
+
+	val, err := env.ExecuteActivity(a.RevokeTokens, revocation.Filter{TenantID: tenantID, UserID: utils.Ptr("u1")})
+	require.NoError(t, err)
+	var res revocation.Result
+	require.NoError(t, val.Get(&res))
+	require.Equal(t, revocation.Result{AccessTokens: 1, RefreshTokens: 1}, res)
+
+	// Another tenant's user with the same ID is untouched
+	val, err = env.ExecuteActivity(a.RevokeTokens, revocation.Filter{TenantID: pgtest.TenantID(), UserID: utils.Ptr("u2")})
+	require.NoError(t, err)
+	require.NoError(t, val.Get(&res))
+	require.Equal(t, revocation.Result{}, res)
+
+	_, err = env.ExecuteActivity(a.RevokeTokens, revocation.Filter{TenantID: tenantID})
+	require.Error(t, err)
+}
+
+func TestRevokeAdminKeyActivity(t *testing.T) {
+	env, q := newActivityEnv(t)
+	tenantID := pgtest.TenantID()
+	ctx := context.Background()
+	key, err := q.InsertAdminKey(ctx, query.InsertAdminKeyParams{
+		TenantID:    tenantID,
+		ID:          utils.GenRandomIDWithSize("ak_", 12),
+		Name:        "old",
+		KeyHash:     utils.GenRandomIDWithSize("", 32),
+		Permissions: []string{"audit:read"},
+	})
+	require.NoError(t, err)
+
+	_, err = env.ExecuteActivity(a.RevokeAdminKey, tenantID, key.ID)
+	require.NoError(t, err)
+
+	key, err = q.SelectAdminKey(ctx, query.SelectAdminKeyParams{TenantID: tenantID, ID: key.ID})
+	require.NoError(t, err)
+	require.True(t, key.Revoked)
+}
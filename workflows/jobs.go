@@ -0,0 +1,69 @@
+package workflows
+
+import (
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/workflow"
+)
+
+var (
+	// Only used to reference activity methods from workflows
+	a *Activities
+
+	// Iterations before the delivery loop continues as new to keep history small
+	webhookDeliveryIterations = 500
+)
+
+func withActivityOptions(ctx workflow.Context, timeout time.Duration) workflow.Context {
+	return workflow.WithActivityOptions(ctx, workflow.ActivityOptions{
+		StartToCloseTimeout: timeout,
+		RetryPolicy: &temporal.RetryPolicy{
+			InitialInterval: time.Second,
+			MaximumInterval: time.Minute,
+		},
+	})
+}
+
+// CleanupWorkflow runs on a cron schedule, replacing the in-process janitor
+func CleanupWorkflow(ctx workflow.Context) error {
+	ctx = withActivityOptions(ctx, time.Minute*30)
+	return workflow.ExecuteActivity(ctx, a.CleanupExpiredRows).Get(ctx, nil)
+}
+
+// WebhookDeliveryWorkflow polls the outbox forever, replacing the in-process webhook worker
+func WebhookDeliveryWorkflow(ctx workflow.Context) error {
+	ctx = withActivityOptions(ctx, time.Minute)
+	for i := 0; i < webhookDeliveryIterations; i++ {
+		var attempted int
+		err := workflow.ExecuteActivity(ctx, a.DeliverWebhooks).Get(ctx, &attempted)
+		if err != nil {
+			return err
+		}
+		if attempted == 0 {
+			// Nothing due, back off a bit. Otherwise there may be more so go again right away
+			if err := workflow.Sleep(ctx, time.Second); err != nil {
+				return err
+			}
+		}
+	}
+	return workflow.NewContinueAsNewError(ctx, WebhookDeliveryWorkflow)
+}
+
+// BulkRevokeWorkflow revokes tokens in the background so large revocations survive restarts
+func BulkRevokeWorkflow(ctx workflow.Context, filter revocation.Filter) (revocation.Result, error) {
+	ctx = withActivityOptions(ctx, time.Minute*10)
+	var res revocation.Result
+	err := workflow.ExecuteActivity(ctx, a.RevokeTokens, filter).Get(ctx, &res)
+	return res, err
+}
+
+// RotateAdminKeyWorkflow revokes the old key once the grace period is over. Cancel it to keep the old key.
+func RotateAdminKeyWorkflow(ctx workflow.Context, tenantID, oldKeyID string, gracePeriod time.Duration) error {
+	if err := workflow.Sleep(ctx, gracePeriod); err != nil {
+		return err
+	}
+	ctx = withActivityOptions(ctx, time.Minute)
+	return workflow.ExecuteActivity(ctx, a.RevokeAdminKey, tenantID, oldKeyID).Get(ctx, nil)
+}
@@ -0,0 +1,156 @@
+package workflows
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/revocation"
+	"github.com/danthegoodman1/GoAPITemplate/utils"
+	"github.com/stretchr/testify/mock"
+	"github.com/stretchr/testify/require"
+	"github.com/stretchr/testify/suite"
+	"go.temporal.io/sdk/temporal"
+	"go.temporal.io/sdk/testsuite"
+	"go.temporal.io/sdk/workflow"
+)
+
+type jobsTestSuite struct {
+	suite.Suite
+	testsuite.WorkflowTestSuite
+
+	env *testsuite.TestWorkflowEnvironment
+}
+
+func TestJobs(t *testing.T) {
+	suite.Run(t, new(jobsTestSuite))
+}
+
+func (s *jobsTestSuite) SetupTest() {
+	s.env = s.NewTestWorkflowEnvironment()
+	s.env.RegisterActivity(&Activities{})
+}
+
+func (s *jobsTestSuite) AfterTest(suiteName, testName string) {
+	s.env.AssertExpectations(s.T())
+}
+
+func (s *jobsTestSuite) TestCleanupWorkflow() {
+	s.env.OnActivity(a.CleanupExpiredRows, mock.Anything).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(CleanupWorkflow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *jobsTestSuite) TestCleanupWorkflowRetries() {
+	s.env.OnActivity(a.CleanupExpiredRows, mock.Anything).Return(errors.New("connection reset")).Once()
+	s.env.OnActivity(a.CleanupExpiredRows, mock.Anything).Return(nil).Once()
+
+	s.env.ExecuteWorkflow(CleanupWorkflow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+}
+
+func (s *jobsTestSuite) TestWebhookDeliveryWorkflowContinuesAsNew() {
+	defer func(n int) { webhookDeliveryIterations = n }(webhookDeliveryIterations)
+	webhookDeliveryIterations = 4
+
+	// Busy batches go again right away, empty ones sleep first
+	attempted := []int{3, 0, 1, 0}
+	var started []time.Time
+	for _, n := range attempted {
+		n := n
+		s.env.OnActivity(a.DeliverWebhooks, mock.Anything).Return(func(ctx context.Context) (int, error) {
+			started = append(started, s.env.Now())
+			return n, nil
+		}).Once()
+	}
+
+	s.env.ExecuteWorkflow(WebhookDeliveryWorkflow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.True(workflow.IsContinueAsNewError(s.env.GetWorkflowError()))
+	s.Require().Len(started, 4)
+	s.Less(started[1].Sub(started[0]), time.Second)
+	s.GreaterOrEqual(started[2].Sub(started[1]), time.Second)
+}
+
+func (s *jobsTestSuite) TestWebhookDeliveryWorkflowFails() {
+	s.env.OnActivity(a.DeliverWebhooks, mock.Anything).Return(0, temporal.NewNonRetryableApplicationError("bad", "test", nil)).Once()
+
+	s.env.ExecuteWorkflow(WebhookDeliveryWorkflow)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.Error(s.env.GetWorkflowError())
+	s.False(workflow.IsContinueAsNewError(s.env.GetWorkflowError()))
+}
+
+func (s *jobsTestSuite) TestBulkRevokeWorkflow() {
+	filter := revocation.Filter{TenantID: "t1", UserID: utils.Ptr("u1")}
+	s.env.OnActivity(a.RevokeTokens, mock.Anything, filter).Return(revocation.Result{AccessTokens: 3, RefreshTokens: 2}, nil).Once()
+
+	s.env.ExecuteWorkflow(BulkRevokeWorkflow, filter)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.Require().NoError(s.env.GetWorkflowError())
+	var res revocation.Result
+	s.Require().NoError(s.env.GetWorkflowResult(&res))
+	s.Equal(revocation.Result{AccessTokens: 3, RefreshTokens: 2}, res)
+}
+
+func (s *jobsTestSuite) TestBulkRevokeWorkflowInvalidFilter() {
+	filter := revocation.Filter{TenantID: "t1"}
+	s.env.OnActivity(a.RevokeTokens, mock.Anything, filter).Return(revocation.Result{}, temporal.NewNonRetryableApplicationError(revocation.ErrInvalidFilter.Error(), "PermError", nil)).Once()
+
+	s.env.ExecuteWorkflow(BulkRevokeWorkflow, filter)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.Error(s.env.GetWorkflowError())
+}
+
+func (s *jobsTestSuite) TestRotateAdminKeyWorkflow() {
+	start := s.env.Now()
+	var revokedAt time.Time
+	s.env.OnActivity(a.RevokeAdminKey, mock.Anything, "t1", "ak_old").Return(func(ctx context.Context, tenantID, keyID string) error {
+		revokedAt = s.env.Now()
+		return nil
+	}).Once()
+
+	s.env.ExecuteWorkflow(RotateAdminKeyWorkflow, "t1", "ak_old", time.Hour)
+
+	s.True(s.env.IsWorkflowCompleted())
+	s.NoError(s.env.GetWorkflowError())
+	s.GreaterOrEqual(revokedAt.Sub(start), time.Hour)
+}
+
+func (s *jobsTestSuite) TestRotateAdminKeyWorkflowCancelled() {
+	s.env.RegisterDelayedCallback(s.env.CancelWorkflow, time.Minute*30)
+
+	s.env.ExecuteWorkflow(RotateAdminKeyWorkflow, "t1", "ak_old", time.Hour)
+
+	s.True(s.env.IsWorkflowCompleted())
+	var canceled *temporal.CanceledError
+	s.ErrorAs(s.env.GetWorkflowError(), &canceled)
+	s.env.AssertNotCalled(s.T(), "RevokeAdminKey", mock.Anything, mock.Anything, mock.Anything)
+}
+
+func TestWithActivityOptionsRetriesForever(t *testing.T) {
+	var env testsuite.WorkflowTestSuite
+	wfEnv := env.NewTestWorkflowEnvironment()
+	var policy *temporal.RetryPolicy
+	wfEnv.RegisterWorkflowWithOptions(func(ctx workflow.Context) error {
+		policy = workflow.GetActivityOptions(withActivityOptions(ctx, time.Minute)).RetryPolicy
+		return nil
+	}, workflow.RegisterOptions{Name: "options"})
+
+	wfEnv.ExecuteWorkflow("options")
+
+	require.NoError(t, wfEnv.GetWorkflowError())
+	require.NotNil(t, policy)
+	require.Zero(t, policy.MaximumAttempts)
+	require.Equal(t, time.Minute, policy.MaximumInterval)
+}
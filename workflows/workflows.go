@@ -0,0 +1,119 @@
+package workflows
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/danthegoodman1/GoAPITemplate/gologger"
+	"github.com/danthegoodman1/GoAPITemplate/janitor"
+	"github.com/jackc/pgx/v5/pgxpool"
+	"github.com/uber-go/tally/v4"
+	"go.temporal.io/sdk/client"
+	"go.temporal.io/sdk/contrib/opentelemetry"
+	sdktally "go.temporal.io/sdk/contrib/tally"
+	"go.temporal.io/sdk/interceptor"
+	"go.temporal.io/sdk/worker"
+)
+
+var (
+	CleanupWorkflowID         = "continuewith-cleanup"
+	WebhookDeliveryWorkflowID = "continuewith-webhook-delivery"
+
+	logger = gologger.NewLogger()
+)
+
+// Config is everything the worker and its activities need, nothing in here is read from the environment
+type Config struct {
+	HostPort  string
+	Namespace string
+	TaskQueue string
+
+	// The activities only work against Postgres or CRDB
+	Pool       *pgxpool.Pool
+	IsPostgres bool
+	// The cleanup workflow runs every Janitor.Interval
+	Janitor            janitor.Config
+	WebhookMaxAttempts int64
+
+	Scope tally.Scope
+}
+
+type Worker struct {
+	worker    worker.Worker
+	client    client.Client
+	taskQueue string
+}
+
+// Start connects to Temporal, starts the worker, and makes sure the long-running cleanup and webhook delivery workflows are running
+func Start(ctx context.Context, cfg Config) (*Worker, error) {
+	tracingInterceptor, err := opentelemetry.NewTracingInterceptor(opentelemetry.TracerOptions{})
+	if err != nil {
+		return nil, fmt.Errorf("error in opentelemetry.NewTracingInterceptor: %w", err)
+	}
+
+	c, err := client.Dial(client.Options{
+		HostPort:       cfg.HostPort,
+		Namespace:      cfg.Namespace,
+		MetricsHandler: sdktally.NewMetricsHandler(sdktally.NewPrometheusNamingScope(cfg.Scope.SubScope("temporal"))),
+		Interceptors:   []interceptor.ClientInterceptor{tracingInterceptor},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error in client.Dial: %w", err)
+	}
+
+	w := worker.New(c, cfg.TaskQueue, worker.Options{})
+	w.RegisterWorkflow(CleanupWorkflow)
+	w.RegisterWorkflow(WebhookDeliveryWorkflow)
+	w.RegisterWorkflow(BulkRevokeWorkflow)
+	w.RegisterWorkflow(RotateAdminKeyWorkflow)
+	w.RegisterActivity(NewActivities(cfg))
+	if err := w.Start(); err != nil {
+		c.Close()
+		return nil, fmt.Errorf("error in worker.Start: %w", err)
+	}
+
+	// Starting with a fixed ID returns the existing run if one is already going, so every replica can do this
+	_, err = c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:           CleanupWorkflowID,
+		TaskQueue:    cfg.TaskQueue,
+		CronSchedule: fmt.Sprintf("@every %ds", int64(cfg.Janitor.Interval/time.Second)),
+	}, CleanupWorkflow)
+	if err != nil {
+		return nil, fmt.Errorf("error starting CleanupWorkflow: %w", err)
+	}
+	_, err = c.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:        WebhookDeliveryWorkflowID,
+		TaskQueue: cfg.TaskQueue,
+	}, WebhookDeliveryWorkflow)
+	if err != nil {
+		return nil, fmt.Errorf("error starting WebhookDeliveryWorkflow: %w", err)
+	}
+
+	logger.Info().Str("hostPort", cfg.HostPort).Str("taskQueue", cfg.TaskQueue).Msg("started temporal worker")
+	return &Worker{worker: w, client: c, taskQueue: cfg.TaskQueue}, nil
+}
+
+func (w *Worker) Shutdown(ctx context.Context) error {
+	done := make(chan struct{})
+	go func() {
+		w.worker.Stop()
+		w.client.Close()
+		close(done)
+	}()
+	select {
+	case <-done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+// StartWorkflow starts a one-off workflow on the ContinueWith task queue
+func (w *Worker) StartWorkflow(ctx context.Context, id string, workflow any, args ...any) (client.WorkflowRun, error) {
+	return w.client.ExecuteWorkflow(ctx, client.StartWorkflowOptions{
+		ID:                       id,
+		TaskQueue:                w.taskQueue,
+		WorkflowExecutionTimeout: time.Hour * 24 * 30,
+	}, workflow, args...)
+}